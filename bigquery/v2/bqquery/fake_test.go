@@ -0,0 +1,165 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bqquery
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	bigquery "google.golang.org/api/bigquery/v2"
+)
+
+// fakeBigQuery is a fake of the BigQuery job calls made by a Runner in the
+// project "p". The results of every query are the rows (name, num) for num
+// from 0 to rows-1.
+type fakeBigQuery struct {
+	t *testing.T
+
+	mu             sync.Mutex
+	rows           int
+	pollsUntilDone int // number of gets of a job before it is done
+	insertFailures int // number of inserts that fail after inserting the job
+	resultFailures int // number of getQueryResults that fail
+	jobs           map[string]*fakeJob
+	pageRequests   int
+	locations      []string // of the gets of jobs and results
+}
+
+type fakeJob struct {
+	job   *bigquery.Job
+	polls int
+}
+
+func newFakeBigQuery(t *testing.T, rows int) (*fakeBigQuery, *httptest.Server) {
+	f := &fakeBigQuery{t: t, rows: rows, jobs: make(map[string]*fakeJob)}
+	return f, httptest.NewServer(f)
+}
+
+var fakeSchema = &bigquery.TableSchema{Fields: []*bigquery.TableFieldSchema{
+	{Name: "name", Type: "STRING"},
+	{Name: "num", Type: "INTEGER"},
+}}
+
+func writeError(w http.ResponseWriter, code int, reason string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	fmt.Fprintf(w, `{"error": {"code": %d, "message": "%s", "errors": [{"reason": "%s"}]}}`, code, reason, reason)
+}
+
+func (f *fakeBigQuery) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	const prefix = "/bigquery/v2/projects/p/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		writeError(w, 404, "notFound")
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	var res interface{}
+	switch {
+	case r.Method == "POST" && len(parts) == 1 && parts[0] == "jobs":
+		var job bigquery.Job
+		if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+			writeError(w, 400, "invalid")
+			return
+		}
+		id := job.JobReference.JobId
+		if f.jobs[id] != nil {
+			writeError(w, 409, "duplicate")
+			return
+		}
+		job.Status = &bigquery.JobStatus{State: "RUNNING"}
+		if job.Configuration.DryRun {
+			job.Status.State = "DONE"
+			job.Statistics = &bigquery.JobStatistics{TotalBytesProcessed: 1234}
+		}
+		f.jobs[id] = &fakeJob{job: &job}
+		if f.insertFailures > 0 {
+			f.insertFailures--
+			writeError(w, 503, "backendError")
+			return
+		}
+		res = &job
+	case r.Method == "GET" && len(parts) == 2 && parts[0] == "jobs":
+		j := f.job(w, r, parts[1])
+		if j == nil {
+			return
+		}
+		j.polls++
+		if j.polls >= f.pollsUntilDone {
+			j.job.Status.State = "DONE"
+			if strings.Contains(j.job.Configuration.Query.Query, "FAIL") {
+				e := &bigquery.ErrorProto{Reason: "invalidQuery", Message: "Syntax error", Location: "query"}
+				j.job.Status.ErrorResult = e
+				j.job.Status.Errors = []*bigquery.ErrorProto{e}
+			}
+		}
+		res = j.job
+	case r.Method == "GET" && len(parts) == 2 && parts[0] == "queries":
+		if f.job(w, r, parts[1]) == nil {
+			return
+		}
+		f.pageRequests++
+		if f.resultFailures > 0 {
+			f.resultFailures--
+			writeError(w, 500, "backendError")
+			return
+		}
+		res = f.results(r)
+	default:
+		writeError(w, 404, "notFound")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		f.t.Error(err)
+	}
+}
+
+// job returns the job with the given ID, recording the location of the
+// request, or writes an error if there is no such job.
+func (f *fakeBigQuery) job(w http.ResponseWriter, r *http.Request, id string) *fakeJob {
+	j := f.jobs[id]
+	if j == nil {
+		writeError(w, 404, "notFound")
+		return nil
+	}
+	f.locations = append(f.locations, r.URL.Query().Get("location"))
+	return j
+}
+
+// results returns the page of results requested by r.
+func (f *fakeBigQuery) results(r *http.Request) *bigquery.GetQueryResultsResponse {
+	q := r.URL.Query()
+	start, _ := strconv.Atoi(q.Get("pageToken"))
+	max, _ := strconv.Atoi(q.Get("maxResults"))
+	if max == 0 {
+		max = 1000
+	}
+	res := &bigquery.GetQueryResultsResponse{
+		JobComplete: true,
+		Schema:      fakeSchema,
+		TotalRows:   uint64(f.rows),
+	}
+	end := start + max
+	if end < f.rows {
+		res.PageToken = strconv.Itoa(end)
+	} else {
+		end = f.rows
+	}
+	for i := start; i < end; i++ {
+		res.Rows = append(res.Rows, &bigquery.TableRow{F: []*bigquery.TableCell{
+			{V: fmt.Sprintf("row-%d", i)},
+			{V: strconv.Itoa(i)},
+		}})
+	}
+	return res
+}
@@ -0,0 +1,158 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bqquery
+
+import (
+	"context"
+
+	bigquery "google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/bigquery/v2/bqrows"
+	"google.golang.org/api/iterator"
+)
+
+// A RowIterator iterates over the rows of the results of a query job.
+type RowIterator struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	job    *Job
+	pages  chan page // prefetched pages, if the Runner prefetches
+
+	schema    *bigquery.TableSchema
+	totalRows uint64
+	rows      []*bigquery.TableRow // rows of the current page not returned yet
+	token     string               // of the next page
+	done      bool                 // whether there are no more pages
+	err       error
+}
+
+// A page is a page of results, or the error of getting it.
+type page struct {
+	res *bigquery.GetQueryResultsResponse
+	err error
+}
+
+func newRowIterator(ctx context.Context, j *Job) *RowIterator {
+	ctx, cancel := context.WithCancel(ctx)
+	it := &RowIterator{ctx: ctx, cancel: cancel, job: j}
+	if n := j.runner.Prefetch; n > 0 {
+		// The goroutine holds one page while it waits to send it.
+		it.pages = make(chan page, n-1)
+		go it.prefetch()
+	}
+	return it
+}
+
+// Next decodes the next row into dst, which must be a pointer to a struct
+// or to a map[string]interface{}, as described in the bqrows package. It
+// returns iterator.Done if there are no more rows. An error decoding a row
+// does not stop the iteration.
+func (it *RowIterator) Next(dst interface{}) error {
+	for len(it.rows) == 0 {
+		if it.err != nil {
+			return it.err
+		}
+		if it.done {
+			return iterator.Done
+		}
+		it.nextPage()
+	}
+	row := it.rows[0]
+	it.rows = it.rows[1:]
+	return bqrows.DecodeRow(it.schema, row, dst)
+}
+
+// Schema returns the schema of the results. It returns nil before the first
+// call to Next.
+func (it *RowIterator) Schema() *bigquery.TableSchema {
+	return it.schema
+}
+
+// TotalRows returns the total number of rows in the results. It returns
+// zero before the first call to Next.
+func (it *RowIterator) TotalRows() uint64 {
+	return it.totalRows
+}
+
+// Stop stops the iteration, and the prefetching of pages. After Stop, Next
+// returns iterator.Done.
+func (it *RowIterator) Stop() {
+	it.cancel()
+	it.done = true
+	it.rows = nil
+}
+
+// nextPage sets the fields of it from the next page.
+func (it *RowIterator) nextPage() {
+	var p page
+	if it.pages != nil {
+		var ok bool
+		p, ok = <-it.pages
+		if !ok {
+			// Stop was called.
+			it.done = true
+			return
+		}
+	} else {
+		p.res, p.err = it.job.getResults(it.ctx, it.token)
+	}
+	if p.err != nil {
+		it.err = p.err
+		return
+	}
+	if it.schema == nil {
+		it.schema = p.res.Schema
+	}
+	it.totalRows = p.res.TotalRows
+	it.rows = p.res.Rows
+	it.token = p.res.PageToken
+	it.done = it.token == ""
+}
+
+// prefetch gets the pages of results and sends them to it.pages, until
+// there are no more pages or the iteration is stopped.
+func (it *RowIterator) prefetch() {
+	defer close(it.pages)
+	token := ""
+	for {
+		res, err := it.job.getResults(it.ctx, token)
+		select {
+		case it.pages <- page{res, err}:
+		case <-it.ctx.Done():
+			return
+		}
+		if err != nil || res.PageToken == "" {
+			return
+		}
+		token = res.PageToken
+	}
+}
+
+// getResults gets the page of the results of j with the given token,
+// retrying transient errors, until the job is complete.
+func (j *Job) getResults(ctx context.Context, token string) (*bigquery.GetQueryResultsResponse, error) {
+	bo := j.runner.Backoff
+	for {
+		call := j.runner.Service.Jobs.GetQueryResults(j.ref.ProjectId, j.ref.JobId).Context(ctx)
+		if j.ref.Location != "" {
+			call.Location(j.ref.Location)
+		}
+		if j.runner.PageSize > 0 {
+			call.MaxResults(j.runner.PageSize)
+		}
+		if token != "" {
+			call.PageToken(token)
+		}
+		res, err := call.Do()
+		switch {
+		case err == nil && res.JobComplete:
+			return res, nil
+		case err != nil && !retryable(err):
+			return nil, err
+		}
+		if err := sleep(ctx, bo.Pause()); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bqquery
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"time"
+
+	bigquery "google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/bigquery/v2/bqrows"
+)
+
+// A Parameter is the value of a query parameter.
+//
+// Values of the types below are passed as parameters of the corresponding
+// BigQuery types. Slices of them, other than []byte, are passed as arrays.
+//
+//	string                   STRING
+//	[]byte                   BYTES
+//	integer types            INT64
+//	float64, float32         FLOAT64
+//	*big.Rat                 NUMERIC, NULL if nil
+//	bool                     BOOL
+//	time.Time                TIMESTAMP
+//	bqrows.Date              DATE
+//	bqrows.Time              TIME
+//	bqrows.DateTime          DATETIME
+//	*bigquery.QueryParameter any type, with the given type and value
+type Parameter struct {
+	// Name is the name of a named parameter, without the leading @, and
+	// empty for a positional parameter.
+	Name string
+
+	// Value is the value of the parameter.
+	Value interface{}
+}
+
+var bytesType = reflect.TypeOf([]byte(nil))
+
+// parameterValue returns the type and value of a query parameter for v.
+func parameterValue(v interface{}) (*bigquery.QueryParameterType, *bigquery.QueryParameterValue, error) {
+	scalar := func(typ, val string) (*bigquery.QueryParameterType, *bigquery.QueryParameterValue, error) {
+		return &bigquery.QueryParameterType{Type: typ}, &bigquery.QueryParameterValue{Value: val}, nil
+	}
+	switch x := v.(type) {
+	case *bigquery.QueryParameter:
+		if x == nil {
+			return nil, nil, fmt.Errorf("nil *bigquery.QueryParameter")
+		}
+		return x.ParameterType, x.ParameterValue, nil
+	case string:
+		return scalar("STRING", x)
+	case []byte:
+		return scalar("BYTES", base64.StdEncoding.EncodeToString(x))
+	case bool:
+		return scalar("BOOL", strconv.FormatBool(x))
+	case *big.Rat:
+		if x == nil {
+			// A NULL value.
+			return &bigquery.QueryParameterType{Type: "NUMERIC"}, &bigquery.QueryParameterValue{}, nil
+		}
+		return scalar("NUMERIC", x.FloatString(9))
+	case time.Time:
+		return scalar("TIMESTAMP", x.UTC().Format("2006-01-02 15:04:05.999999-07:00"))
+	case bqrows.Date:
+		return scalar("DATE", x.String())
+	case bqrows.Time:
+		return scalar("TIME", x.String())
+	case bqrows.DateTime:
+		return scalar("DATETIME", x.Date.String()+" "+x.Time.String())
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return scalar("INT64", strconv.FormatInt(rv.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("%d overflows INT64", rv.Uint())
+		}
+		return scalar("INT64", strconv.FormatUint(rv.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		return scalar("FLOAT64", strconv.FormatFloat(rv.Float(), 'g', -1, 64))
+	case reflect.Slice, reflect.Array:
+		if rv.Type() == bytesType {
+			break
+		}
+		// The element type is that of the zero value, so that the type of
+		// empty arrays is known.
+		elemType, _, err := parameterValue(reflect.Zero(rv.Type().Elem()).Interface())
+		if err != nil {
+			return nil, nil, err
+		}
+		if elemType.Type == "ARRAY" {
+			return nil, nil, fmt.Errorf("arrays of arrays are not supported")
+		}
+		val := &bigquery.QueryParameterValue{ArrayValues: []*bigquery.QueryParameterValue{}}
+		for i := 0; i < rv.Len(); i++ {
+			_, ev, err := parameterValue(rv.Index(i).Interface())
+			if err != nil {
+				return nil, nil, err
+			}
+			val.ArrayValues = append(val.ArrayValues, ev)
+		}
+		return &bigquery.QueryParameterType{Type: "ARRAY", ArrayType: elemType}, val, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported type %T", v)
+}
@@ -0,0 +1,354 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package bqquery runs BigQuery queries with the bigquery/v2 package and
+// reads their results.
+//
+// A Runner inserts query jobs with JobsInsertCall, polls them with
+// JobsGetCall until they are done, and reads their results with
+// JobsGetQueryResultsCall, one page after the other:
+//
+//	r := &bqquery.Runner{Service: svc, ProjectID: "my-project"}
+//	it, err := r.Query(ctx, &bqquery.Query{
+//		SQL:        "SELECT name, num FROM dataset.table WHERE num > @min",
+//		Parameters: []bqquery.Parameter{{Name: "min", Value: 10}},
+//	})
+//	if err != nil {
+//		// A failed job is reported as a *bqquery.Error.
+//	}
+//	defer it.Stop()
+//	for {
+//		var row struct {
+//			Name string
+//			Num  int64
+//		}
+//		err := it.Next(&row)
+//		if err == iterator.Done {
+//			break
+//		}
+//		...
+//	}
+//
+// Rows are decoded with the bqrows package.
+//
+// This is an EXPERIMENTAL API and may be changed or removed in the future.
+package bqquery
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	bigquery "google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/googleapi"
+)
+
+// A Query describes a query job.
+type Query struct {
+	// SQL is the text of the query, in standard SQL unless UseLegacySQL is
+	// set.
+	SQL string
+
+	// Parameters are the values of the query parameters. Either all or none
+	// of them must be named.
+	Parameters []Parameter
+
+	// UseLegacySQL selects the legacy SQL dialect for SQL.
+	UseLegacySQL bool
+
+	// DefaultDataset is the dataset of unqualified table names in SQL.
+	DefaultDataset *bigquery.DatasetReference
+
+	// Destination is the table the results are written to. If it is nil,
+	// the results are written to a temporary table.
+	Destination *bigquery.TableReference
+
+	// WriteDisposition and CreateDisposition specify how Destination is
+	// written, as described for bigquery.JobConfigurationQuery.
+	WriteDisposition  string
+	CreateDisposition string
+
+	// DryRun validates the query and estimates its cost, reported in the
+	// statistics of the job, without running it.
+	DryRun bool
+
+	// Labels are the labels of the job.
+	Labels map[string]string
+
+	// Location is the location the job runs in. If it is empty, the
+	// Location of the Runner is used.
+	Location string
+
+	// JobID is the ID of the job. If it is empty, a random ID is used.
+	JobID string
+}
+
+// A Runner runs queries in a project.
+type Runner struct {
+	// Service is used to make the calls.
+	Service *bigquery.Service
+
+	// ProjectID is the project that runs the jobs.
+	ProjectID string
+
+	// Location is the default location of the jobs.
+	Location string
+
+	// PageSize is the maximum number of rows in a page of results. If it is
+	// zero, the server chooses.
+	PageSize int64
+
+	// Prefetch is the number of pages of results that iterators fetch before
+	// they are needed. If it is zero, pages are fetched by Next.
+	Prefetch int
+
+	// Backoff is the backoff between the polls of a running job, and
+	// between retries of calls that failed with a transient error. The zero
+	// value uses the defaults of gax.Backoff.
+	Backoff gax.Backoff
+}
+
+// An Error is the error of a failed job.
+type Error struct {
+	// JobID is the ID of the job.
+	JobID string
+
+	// Err is the error that caused the job to fail.
+	Err *bigquery.ErrorProto
+
+	// Errors are all the errors encountered while running the job, which
+	// may include errors that did not cause it to fail.
+	Errors []*bigquery.ErrorProto
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("bqquery: job %s failed: %s", e.JobID, e.Err.Message)
+	if e.Err.Reason != "" {
+		msg += " (" + e.Err.Reason + ")"
+	}
+	if e.Err.Location != "" {
+		msg += " at " + e.Err.Location
+	}
+	return msg
+}
+
+// Run inserts a job for q, without waiting for it to complete.
+func (r *Runner) Run(ctx context.Context, q *Query) (*Job, error) {
+	job, err := r.newJob(q)
+	if err != nil {
+		return nil, err
+	}
+	bo := r.Backoff
+	ref := job.JobReference
+	for retried := false; ; retried = true {
+		res, err := r.Service.Jobs.Insert(r.ProjectID, job).Context(ctx).Do()
+		if err == nil {
+			if res.JobReference != nil {
+				ref = res.JobReference
+			}
+			return &Job{runner: r, ref: ref, job: res}, nil
+		}
+		if e, ok := err.(*googleapi.Error); ok && e.Code == 409 && retried {
+			// A previous attempt inserted the job.
+			j := &Job{runner: r, ref: ref}
+			if err := j.refresh(ctx); err != nil {
+				return nil, err
+			}
+			return j, nil
+		}
+		if !retryable(err) {
+			return nil, err
+		}
+		if err := sleep(ctx, bo.Pause()); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Query runs q, waits for it to complete, and returns an iterator over its
+// results.
+func (r *Runner) Query(ctx context.Context, q *Query) (*RowIterator, error) {
+	j, err := r.Run(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	if err := j.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return j.Read(ctx), nil
+}
+
+func (r *Runner) newJob(q *Query) (*bigquery.Job, error) {
+	params, mode, err := queryParameters(q.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	id := q.JobID
+	if id == "" {
+		id = randomID()
+	}
+	location := q.Location
+	if location == "" {
+		location = r.Location
+	}
+	useLegacySQL := q.UseLegacySQL
+	return &bigquery.Job{
+		JobReference: &bigquery.JobReference{ProjectId: r.ProjectID, JobId: id, Location: location},
+		Configuration: &bigquery.JobConfiguration{
+			DryRun: q.DryRun,
+			Labels: q.Labels,
+			Query: &bigquery.JobConfigurationQuery{
+				Query:             q.SQL,
+				QueryParameters:   params,
+				ParameterMode:     mode,
+				UseLegacySql:      &useLegacySQL,
+				DefaultDataset:    q.DefaultDataset,
+				DestinationTable:  q.Destination,
+				WriteDisposition:  q.WriteDisposition,
+				CreateDisposition: q.CreateDisposition,
+			},
+		},
+	}, nil
+}
+
+// randomID returns a random job ID.
+func randomID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return "bqquery_" + hex.EncodeToString(b)
+}
+
+// A Job is a query job.
+type Job struct {
+	runner *Runner
+	ref    *bigquery.JobReference
+	job    *bigquery.Job // as last returned by the server
+}
+
+// ID returns the ID of the job.
+func (j *Job) ID() string {
+	return j.ref.JobId
+}
+
+// Location returns the location the job runs in.
+func (j *Job) Location() string {
+	return j.ref.Location
+}
+
+// Status returns the status of the job, as last returned by the server.
+func (j *Job) Status() *bigquery.JobStatus {
+	return j.job.Status
+}
+
+// Statistics returns the statistics of the job, as last returned by the
+// server. For a dry run, they include the number of bytes the query would
+// process.
+func (j *Job) Statistics() *bigquery.JobStatistics {
+	return j.job.Statistics
+}
+
+// done reports whether the job is done.
+func (j *Job) done() bool {
+	return j.job.Status != nil && j.job.Status.State == "DONE"
+}
+
+// Wait polls the job until it is done, and returns an *Error if it failed.
+func (j *Job) Wait(ctx context.Context) error {
+	bo := j.runner.Backoff
+	for !j.done() {
+		if err := sleep(ctx, bo.Pause()); err != nil {
+			return err
+		}
+		if err := j.refresh(ctx); err != nil && !retryable(err) {
+			return err
+		}
+	}
+	if s := j.job.Status; s.ErrorResult != nil {
+		return &Error{JobID: j.ref.JobId, Err: s.ErrorResult, Errors: s.Errors}
+	}
+	return nil
+}
+
+// refresh gets the job from the server.
+func (j *Job) refresh(ctx context.Context) error {
+	call := j.runner.Service.Jobs.Get(j.ref.ProjectId, j.ref.JobId).Context(ctx)
+	if j.ref.Location != "" {
+		call.Location(j.ref.Location)
+	}
+	job, err := call.Do()
+	if err != nil {
+		return err
+	}
+	j.job = job
+	return nil
+}
+
+// Read returns an iterator over the results of the job, which must be done.
+// The results of a dry run have no rows.
+func (j *Job) Read(ctx context.Context) *RowIterator {
+	if j.job.Configuration != nil && j.job.Configuration.DryRun {
+		return &RowIterator{done: true, cancel: func() {}}
+	}
+	return newRowIterator(ctx, j)
+}
+
+// retryable reports whether a call that failed with err may succeed if it
+// is retried.
+func retryable(err error) bool {
+	e, ok := err.(*googleapi.Error)
+	if !ok {
+		return false
+	}
+	switch e.Code {
+	case 429, 500, 502, 503, 504:
+		return true
+	}
+	for _, item := range e.Errors {
+		if item.Reason == "backendError" || item.Reason == "rateLimitExceeded" {
+			return true
+		}
+	}
+	return false
+}
+
+// sleep pauses for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// queryParameters returns the parameters of a query for params, and the
+// parameter mode.
+func queryParameters(params []Parameter) ([]*bigquery.QueryParameter, string, error) {
+	if len(params) == 0 {
+		return nil, "", nil
+	}
+	named := params[0].Name != ""
+	qps := make([]*bigquery.QueryParameter, len(params))
+	for i, p := range params {
+		if (p.Name != "") != named {
+			return nil, "", fmt.Errorf("bqquery: parameters must be either all named or all positional")
+		}
+		typ, val, err := parameterValue(p.Value)
+		if err != nil {
+			return nil, "", fmt.Errorf("bqquery: parameter %d: %v", i, err)
+		}
+		qps[i] = &bigquery.QueryParameter{Name: p.Name, ParameterType: typ, ParameterValue: val}
+	}
+	if named {
+		return qps, "NAMED", nil
+	}
+	return qps, "POSITIONAL", nil
+}
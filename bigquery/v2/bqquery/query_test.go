@@ -0,0 +1,317 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bqquery
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	gax "github.com/googleapis/gax-go/v2"
+	bigquery "google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/bigquery/v2/bqrows"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+func newRunner(t *testing.T, url string) *Runner {
+	svc, err := bigquery.NewService(context.Background(),
+		option.WithHTTPClient(http.DefaultClient), option.WithEndpoint(url+"/bigquery/v2/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Runner{
+		Service:   svc,
+		ProjectID: "p",
+		Backoff:   gax.Backoff{Initial: time.Millisecond, Max: time.Millisecond},
+	}
+}
+
+type row struct {
+	Name string
+	Num  int
+}
+
+// readAll returns the rows of it.
+func readAll(it *RowIterator) ([]row, error) {
+	var rows []row
+	for {
+		var r row
+		err := it.Next(&r)
+		if err == iterator.Done {
+			return rows, nil
+		}
+		if err != nil {
+			return rows, err
+		}
+		rows = append(rows, r)
+	}
+}
+
+func wantRows(n int) []row {
+	var rows []row
+	for i := 0; i < n; i++ {
+		rows = append(rows, row{fmt.Sprintf("row-%d", i), i})
+	}
+	return rows
+}
+
+func TestQuery(t *testing.T) {
+	f, srv := newFakeBigQuery(t, 25)
+	defer srv.Close()
+	f.pollsUntilDone = 2
+	r := newRunner(t, srv.URL)
+	r.Location = "EU"
+	r.PageSize = 10
+	r.Prefetch = 2
+
+	it, err := r.Query(context.Background(), &Query{
+		SQL: "SELECT name, num FROM t WHERE num > @min AND name IN UNNEST(@names)",
+		Parameters: []Parameter{
+			{Name: "min", Value: -1},
+			{Name: "names", Value: []string{"a", "b"}},
+		},
+		JobID: "job-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Stop()
+	got, err := readAll(it)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(wantRows(25), got); diff != "" {
+		t.Errorf("rows mismatch (-want +got):\n%s", diff)
+	}
+	if it.TotalRows() != 25 || len(it.Schema().Fields) != 2 {
+		t.Errorf("got %d total rows and schema %v", it.TotalRows(), it.Schema())
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.pageRequests != 3 {
+		t.Errorf("got %d page requests, want 3", f.pageRequests)
+	}
+	for _, l := range f.locations {
+		if l != "EU" {
+			t.Errorf("got requests in locations %q, want EU", f.locations)
+			break
+		}
+	}
+	q := f.jobs["job-1"].job.Configuration.Query
+	if q.UseLegacySql == nil || *q.UseLegacySql {
+		t.Error("query did not use standard SQL")
+	}
+	if q.ParameterMode != "NAMED" {
+		t.Errorf("got parameter mode %q, want NAMED", q.ParameterMode)
+	}
+	names := q.QueryParameters[1]
+	if names.ParameterType.Type != "ARRAY" || names.ParameterType.ArrayType.Type != "STRING" || len(names.ParameterValue.ArrayValues) != 2 {
+		t.Errorf("got array parameter %+v %+v", names.ParameterType, names.ParameterValue)
+	}
+}
+
+func TestQueryWithoutPrefetch(t *testing.T) {
+	f, srv := newFakeBigQuery(t, 5)
+	defer srv.Close()
+	f.resultFailures = 1
+	r := newRunner(t, srv.URL)
+	r.PageSize = 2
+
+	it, err := r.Query(context.Background(), &Query{SQL: "SELECT 1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var maps []map[string]interface{}
+	for {
+		var m map[string]interface{}
+		err := it.Next(&m)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		maps = append(maps, m)
+	}
+	if len(maps) != 5 || maps[4]["num"] != int64(4) {
+		t.Errorf("got rows %v", maps)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.pageRequests != 4 {
+		t.Errorf("got %d page requests, want 4 including a retry", f.pageRequests)
+	}
+}
+
+func TestQueryFailed(t *testing.T) {
+	f, srv := newFakeBigQuery(t, 1)
+	defer srv.Close()
+	f.pollsUntilDone = 3
+	r := newRunner(t, srv.URL)
+
+	_, err := r.Query(context.Background(), &Query{SQL: "FAIL", JobID: "bad"})
+	e, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("got error %v, want *Error", err)
+	}
+	if e.JobID != "bad" || e.Err.Reason != "invalidQuery" || len(e.Errors) != 1 {
+		t.Errorf("got %+v", e)
+	}
+	if want := "bqquery: job bad failed: Syntax error (invalidQuery) at query"; e.Error() != want {
+		t.Errorf("got message %q, want %q", e.Error(), want)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	_, srv := newFakeBigQuery(t, 1)
+	defer srv.Close()
+	r := newRunner(t, srv.URL)
+	ctx := context.Background()
+
+	j, err := r.Run(ctx, &Query{SQL: "SELECT 1", DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := j.Statistics().TotalBytesProcessed; got != 1234 {
+		t.Errorf("got %d bytes processed, want 1234", got)
+	}
+	if err := j.Read(ctx).Next(&row{}); err != iterator.Done {
+		t.Errorf("got %v, want iterator.Done", err)
+	}
+}
+
+func TestRunRetry(t *testing.T) {
+	f, srv := newFakeBigQuery(t, 1)
+	defer srv.Close()
+	// The job is inserted, but the first response is an error, so the retry
+	// finds the job already exists.
+	f.insertFailures = 1
+	r := newRunner(t, srv.URL)
+
+	j, err := r.Run(context.Background(), &Query{SQL: "SELECT 1", JobID: "job-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.ID() != "job-1" || j.Status() == nil {
+		t.Errorf("got job %q with status %v", j.ID(), j.Status())
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.jobs) != 1 {
+		t.Errorf("got %d jobs, want 1", len(f.jobs))
+	}
+}
+
+func TestPrefetchBound(t *testing.T) {
+	f, srv := newFakeBigQuery(t, 100)
+	defer srv.Close()
+	r := newRunner(t, srv.URL)
+	r.PageSize = 10
+	r.Prefetch = 2
+
+	it, err := r.Query(context.Background(), &Query{SQL: "SELECT 1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := it.Next(&row{}); err != nil {
+		t.Fatal(err)
+	}
+	requests := func() int {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return f.pageRequests
+	}
+	// The current page, and two prefetched ones.
+	for i := 0; requests() < 3 && i < 1000; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := requests(); n != 3 {
+		t.Errorf("got %d page requests, want 3", n)
+	}
+	it.Stop()
+	if err := it.Next(&row{}); err != iterator.Done {
+		t.Errorf("Next after Stop: got %v, want iterator.Done", err)
+	}
+}
+
+func TestParameters(t *testing.T) {
+	ts := time.Date(2020, 5, 1, 12, 0, 0, 500000000, time.FixedZone("x", 3600))
+	params, mode, err := queryParameters([]Parameter{
+		{Value: "s"},
+		{Value: []byte("hi")},
+		{Value: uint8(7)},
+		{Value: 1.5},
+		{Value: big.NewRat(1, 4)},
+		{Value: (*big.Rat)(nil)},
+		{Value: true},
+		{Value: ts},
+		{Value: []bqrows.Date{{Year: 2020, Month: 5, Day: 1}}},
+		{Value: bqrows.DateTime{Date: bqrows.Date{Year: 2020, Month: 5, Day: 1}, Time: bqrows.Time{Hour: 1}}},
+		{Value: []int{}},
+		{Value: &bigquery.QueryParameter{ParameterType: &bigquery.QueryParameterType{Type: "GEOGRAPHY"}, ParameterValue: &bigquery.QueryParameterValue{Value: "POINT(1 2)"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode != "POSITIONAL" {
+		t.Errorf("got mode %q, want POSITIONAL", mode)
+	}
+	var got []string
+	for _, p := range params {
+		s := p.ParameterType.Type
+		if at := p.ParameterType.ArrayType; at != nil {
+			s += "<" + at.Type + ">"
+		}
+		if p.ParameterValue.ArrayValues != nil {
+			var vals []string
+			for _, v := range p.ParameterValue.ArrayValues {
+				vals = append(vals, v.Value)
+			}
+			s += " [" + strings.Join(vals, ",") + "]"
+		} else {
+			s += " " + p.ParameterValue.Value
+		}
+		got = append(got, s)
+	}
+	want := []string{
+		"STRING s",
+		"BYTES aGk=",
+		"INT64 7",
+		"FLOAT64 1.5",
+		"NUMERIC 0.250000000",
+		"NUMERIC ",
+		"BOOL true",
+		"TIMESTAMP 2020-05-01 11:00:00.5+00:00",
+		"ARRAY<DATE> [2020-05-01]",
+		"DATETIME 2020-05-01 01:00:00",
+		"ARRAY<INT64> []",
+		"GEOGRAPHY POINT(1 2)",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, params := range [][]Parameter{
+		{{Name: "a", Value: 1}, {Value: 2}},
+		{{Value: struct{}{}}},
+		{{Value: [][]int{{1}}}},
+		{{Value: uint64(1 << 63)}},
+	} {
+		if _, _, err := queryParameters(params); err == nil {
+			t.Errorf("queryParameters(%v): got nil error", params)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bqrows
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A Date is a BigQuery DATE: a date without a time zone.
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+// ParseDate parses a date in the format YYYY-MM-DD.
+func ParseDate(s string) (Date, error) {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return Date{}, err
+	}
+	return DateOf(t), nil
+}
+
+// DateOf returns the date of t in its location.
+func DateOf(t time.Time) Date {
+	y, m, d := t.Date()
+	return Date{Year: y, Month: m, Day: d}
+}
+
+// String returns d in the format YYYY-MM-DD.
+func (d Date) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+// In returns the time at midnight of d in loc.
+func (d Date) In(loc *time.Location) time.Time {
+	return time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, loc)
+}
+
+// A Time is a BigQuery TIME: a time of day without a date or time zone.
+// BigQuery stores times with microsecond precision.
+type Time struct {
+	Hour       int
+	Minute     int
+	Second     int
+	Nanosecond int
+}
+
+// ParseTime parses a time in the format HH:MM:SS[.FFFFFF].
+func ParseTime(s string) (Time, error) {
+	t, err := time.Parse("15:04:05.999999999", s)
+	if err != nil {
+		return Time{}, err
+	}
+	return TimeOf(t), nil
+}
+
+// TimeOf returns the time of day of t in its location.
+func TimeOf(t time.Time) Time {
+	return Time{Hour: t.Hour(), Minute: t.Minute(), Second: t.Second(), Nanosecond: t.Nanosecond()}
+}
+
+// String returns t in the format HH:MM:SS, followed by the microseconds of
+// t if they are not zero.
+func (t Time) String() string {
+	s := fmt.Sprintf("%02d:%02d:%02d", t.Hour, t.Minute, t.Second)
+	if t.Nanosecond == 0 {
+		return s
+	}
+	return fmt.Sprintf("%s.%06d", s, t.Nanosecond/1000)
+}
+
+// A DateTime is a BigQuery DATETIME: a date and time without a time zone.
+type DateTime struct {
+	Date Date
+	Time Time
+}
+
+// ParseDateTime parses a date and time in the format
+// YYYY-MM-DD[T| ]HH:MM:SS[.FFFFFF].
+func ParseDateTime(s string) (DateTime, error) {
+	i := strings.IndexAny(s, "T ")
+	if i < 0 {
+		return DateTime{}, fmt.Errorf("bqrows: cannot parse %q as DATETIME", s)
+	}
+	d, err := ParseDate(s[:i])
+	if err != nil {
+		return DateTime{}, err
+	}
+	t, err := ParseTime(s[i+1:])
+	if err != nil {
+		return DateTime{}, err
+	}
+	return DateTime{Date: d, Time: t}, nil
+}
+
+// DateTimeOf returns the date and time of t in its location.
+func DateTimeOf(t time.Time) DateTime {
+	return DateTime{Date: DateOf(t), Time: TimeOf(t)}
+}
+
+// String returns dt in the format YYYY-MM-DDTHH:MM:SS[.FFFFFF].
+func (dt DateTime) String() string {
+	return dt.Date.String() + "T" + dt.Time.String()
+}
+
+// In returns the time of dt in loc.
+func (dt DateTime) In(loc *time.Location) time.Time {
+	return time.Date(dt.Date.Year, dt.Date.Month, dt.Date.Day, dt.Time.Hour, dt.Time.Minute, dt.Time.Second, dt.Time.Nanosecond, loc)
+}
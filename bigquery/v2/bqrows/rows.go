@@ -0,0 +1,772 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package bqrows converts the rows of BigQuery tables and query results,
+// which the bigquery/v2 package represents as untyped TableRows, to and from
+// Go values.
+//
+// Decode fills structs or maps from the rows returned by
+// JobsGetQueryResultsCall and TabledataListCall:
+//
+//	res, err := svc.Jobs.GetQueryResults(projectID, jobID).Do()
+//	...
+//	var rows []struct {
+//		Name  string
+//		Count int64 `bigquery:"num"`
+//		Tags  []string
+//	}
+//	err = bqrows.Decode(res.Schema, res.Rows, &rows)
+//
+// Encode converts Go values to the rows of a TabledataInsertAllCall:
+//
+//	rows, err := bqrows.Encode(table.Schema, values, nil)
+//	...
+//	res, err := svc.Tabledata.InsertAll(projectID, datasetID, tableID,
+//		&bigquery.TableDataInsertAllRequest{Rows: rows}).Do()
+//
+// Struct fields are matched to columns by the name in their bigquery tag, or
+// else by their name, ignoring case. Fields tagged `bigquery:"-"`,
+// unexported fields and fields without a matching column are ignored.
+//
+// Columns are decoded to the Go types below. The first type listed for each
+// column type is the one used in maps and interface{} values; the others are
+// accepted in struct fields.
+//
+//	STRING, GEOGRAPHY     string
+//	BYTES                 []byte
+//	INTEGER, INT64        int64, other integer types, float64, float32
+//	FLOAT, FLOAT64        float64, float32
+//	NUMERIC, BIGNUMERIC   *big.Rat, big.Rat, float64, float32, string
+//	BOOLEAN, BOOL         bool
+//	TIMESTAMP             time.Time
+//	DATE                  Date, time.Time, string
+//	TIME                  Time, string
+//	DATETIME              DateTime, time.Time, string
+//	RECORD, STRUCT        map[string]interface{}, struct
+//
+// REPEATED columns are decoded to slices, []interface{} in maps and
+// interface{} values. Fields can also be pointers to any of these types.
+// NULL values set fields to their zero value, which is nil for pointers.
+// time.Time values decoded from DATE and DATETIME columns are in UTC.
+// Encode accepts the same types, and omits nil pointers, interfaces and
+// slices from the rows, making the columns NULL.
+//
+// This is an EXPERIMENTAL API and may be changed or removed in the future.
+package bqrows
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	bigquery "google.golang.org/api/bigquery/v2"
+)
+
+var (
+	bytesType    = reflect.TypeOf([]byte(nil))
+	ratType      = reflect.TypeOf(big.Rat{})
+	timeType     = reflect.TypeOf(time.Time{})
+	dateType     = reflect.TypeOf(Date{})
+	civilTime    = reflect.TypeOf(Time{})
+	dateTimeType = reflect.TypeOf(DateTime{})
+)
+
+// Decode decodes rows with the given schema, and appends them to the slice
+// pointed to by dst. The elements of the slice must be structs, pointers to
+// structs or map[string]interface{}.
+func Decode(schema *bigquery.TableSchema, rows []*bigquery.TableRow, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("bqrows: Decode needs a non-nil pointer to a slice, got %T", dst)
+	}
+	s := v.Elem()
+	for i, row := range rows {
+		e := reflect.New(s.Type().Elem()).Elem()
+		if err := decodeRecord(e, schema.Fields, rowCells(row), ""); err != nil {
+			return fmt.Errorf("bqrows: row %d: %v", i, err)
+		}
+		s.Set(reflect.Append(s, e))
+	}
+	return nil
+}
+
+// DecodeRow decodes row with the given schema into dst, which must be a
+// pointer to a struct or to a map[string]interface{}.
+func DecodeRow(schema *bigquery.TableSchema, row *bigquery.TableRow, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("bqrows: DecodeRow needs a non-nil pointer, got %T", dst)
+	}
+	if err := decodeRecord(v.Elem(), schema.Fields, rowCells(row), ""); err != nil {
+		return fmt.Errorf("bqrows: %v", err)
+	}
+	return nil
+}
+
+// rowCells returns the values of the cells of row.
+func rowCells(row *bigquery.TableRow) []interface{} {
+	if row == nil {
+		return nil
+	}
+	cells := make([]interface{}, len(row.F))
+	for i, c := range row.F {
+		if c != nil {
+			cells[i] = c.V
+		}
+	}
+	return cells
+}
+
+// recordCells returns the values of the cells of v, the value of a RECORD
+// cell in the form {"f": [{"v": ...}, ...]}.
+func recordCells(v interface{}) ([]interface{}, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("got %T, want a record", v)
+	}
+	fs, ok := m["f"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("got record without fields")
+	}
+	return cellValues(fs)
+}
+
+// cellValues returns the values of cells, each in the form {"v": ...}.
+func cellValues(cells []interface{}) ([]interface{}, error) {
+	vals := make([]interface{}, len(cells))
+	for i, c := range cells {
+		m, ok := c.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("got %T, want a cell", c)
+		}
+		vals[i] = m["v"]
+	}
+	return vals, nil
+}
+
+func isRecord(f *bigquery.TableFieldSchema) bool {
+	return f.Type == "RECORD" || f.Type == "STRUCT"
+}
+
+func decodeRecord(dst reflect.Value, fields []*bigquery.TableFieldSchema, cells []interface{}, path string) error {
+	if len(cells) != len(fields) {
+		return fmt.Errorf("%sgot %d values for %d columns", prefix(path), len(cells), len(fields))
+	}
+	switch {
+	case dst.Kind() == reflect.Ptr:
+		p := reflect.New(dst.Type().Elem())
+		if err := decodeRecord(p.Elem(), fields, cells, path); err != nil {
+			return err
+		}
+		dst.Set(p)
+		return nil
+	case dst.Kind() == reflect.Interface && dst.NumMethod() == 0:
+		m, err := recordValue(fields, cells, path)
+		if err != nil {
+			return err
+		}
+		dst.Set(reflect.ValueOf(m))
+		return nil
+	case dst.Kind() == reflect.Map && dst.Type().Key().Kind() == reflect.String:
+		m := reflect.MakeMapWithSize(dst.Type(), len(fields))
+		for i, f := range fields {
+			e := reflect.New(dst.Type().Elem()).Elem()
+			if err := decodeField(e, f, cells[i], path+f.Name); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(f.Name).Convert(dst.Type().Key()), e)
+		}
+		dst.Set(m)
+		return nil
+	case dst.Kind() == reflect.Struct:
+		sf := structFields(dst.Type())
+		for i, f := range fields {
+			index, ok := sf[strings.ToLower(f.Name)]
+			if !ok {
+				continue
+			}
+			if err := decodeField(dst.FieldByIndex(index), f, cells[i], path+f.Name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("%scannot decode record into %s", prefix(path), dst.Type())
+}
+
+// prefix returns the prefix of error messages about the field at path.
+func prefix(path string) string {
+	if path == "" {
+		return ""
+	}
+	return path + ": "
+}
+
+func decodeField(dst reflect.Value, f *bigquery.TableFieldSchema, cell interface{}, path string) error {
+	if dst.Kind() == reflect.Interface && dst.NumMethod() == 0 {
+		v, err := fieldValue(f, cell, path)
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			dst.Set(reflect.Zero(dst.Type()))
+		} else {
+			dst.Set(reflect.ValueOf(v))
+		}
+		return nil
+	}
+	if f.Mode != "REPEATED" {
+		return decodeValue(dst, f, cell, path)
+	}
+	if cell == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	if dst.Kind() == reflect.Ptr {
+		p := reflect.New(dst.Type().Elem())
+		if err := decodeField(p.Elem(), f, cell, path); err != nil {
+			return err
+		}
+		dst.Set(p)
+		return nil
+	}
+	items, ok := cell.([]interface{})
+	if !ok {
+		return fmt.Errorf("%s: got %T, want a repeated value", path, cell)
+	}
+	if dst.Kind() != reflect.Slice {
+		return fmt.Errorf("%s: cannot decode repeated %s into %s", path, f.Type, dst.Type())
+	}
+	vals, err := cellValues(items)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	s := reflect.MakeSlice(dst.Type(), len(vals), len(vals))
+	for i, v := range vals {
+		if err := decodeValue(s.Index(i), f, v, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+			return err
+		}
+	}
+	dst.Set(s)
+	return nil
+}
+
+// decodeValue decodes v, a single value of the column f, into dst.
+func decodeValue(dst reflect.Value, f *bigquery.TableFieldSchema, v interface{}, path string) error {
+	if v == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	if dst.Kind() == reflect.Interface && dst.NumMethod() == 0 {
+		val, err := value(f, v, path)
+		if err != nil {
+			return err
+		}
+		dst.Set(reflect.ValueOf(val))
+		return nil
+	}
+	if isRecord(f) {
+		cells, err := recordCells(v)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		return decodeRecord(dst, f.Fields, cells, path+".")
+	}
+	if dst.Kind() == reflect.Ptr {
+		p := reflect.New(dst.Type().Elem())
+		if err := decodeValue(p.Elem(), f, v, path); err != nil {
+			return err
+		}
+		dst.Set(p)
+		return nil
+	}
+	val, err := parseScalar(f.Type, v)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if !assign(dst, f.Type, val) {
+		return fmt.Errorf("%s: cannot decode %s into %s", path, f.Type, dst.Type())
+	}
+	return nil
+}
+
+// fieldValue returns the value of cell in the column f, as it is stored in a
+// map[string]interface{}.
+func fieldValue(f *bigquery.TableFieldSchema, cell interface{}, path string) (interface{}, error) {
+	if cell == nil {
+		return nil, nil
+	}
+	if f.Mode != "REPEATED" {
+		return value(f, cell, path)
+	}
+	items, ok := cell.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: got %T, want a repeated value", path, cell)
+	}
+	vals, err := cellValues(items)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for i, v := range vals {
+		if vals[i], err = value(f, v, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+			return nil, err
+		}
+	}
+	return vals, nil
+}
+
+// value returns a single value v of the column f, as it is stored in a
+// map[string]interface{}.
+func value(f *bigquery.TableFieldSchema, v interface{}, path string) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if isRecord(f) {
+		cells, err := recordCells(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return recordValue(f.Fields, cells, path+".")
+	}
+	val, err := parseScalar(f.Type, v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return val, nil
+}
+
+func recordValue(fields []*bigquery.TableFieldSchema, cells []interface{}, path string) (map[string]interface{}, error) {
+	if len(cells) != len(fields) {
+		return nil, fmt.Errorf("%sgot %d values for %d columns", prefix(path), len(cells), len(fields))
+	}
+	m := make(map[string]interface{}, len(fields))
+	for i, f := range fields {
+		v, err := fieldValue(f, cells[i], path+f.Name)
+		if err != nil {
+			return nil, err
+		}
+		m[f.Name] = v
+	}
+	return m, nil
+}
+
+// parseScalar parses v, a value of a column of type typ.
+func parseScalar(typ string, v interface{}) (interface{}, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("got %T, want a string", v)
+	}
+	switch typ {
+	case "STRING", "GEOGRAPHY":
+		return s, nil
+	case "BYTES":
+		return base64.StdEncoding.DecodeString(s)
+	case "INTEGER", "INT64":
+		return strconv.ParseInt(s, 10, 64)
+	case "FLOAT", "FLOAT64":
+		return strconv.ParseFloat(s, 64)
+	case "NUMERIC", "BIGNUMERIC":
+		r, ok := new(big.Rat).SetString(s)
+		if !ok {
+			return nil, fmt.Errorf("cannot parse %q as %s", s, typ)
+		}
+		return r, nil
+	case "BOOLEAN", "BOOL":
+		return strconv.ParseBool(s)
+	case "TIMESTAMP":
+		return parseTimestamp(s)
+	case "DATE":
+		return ParseDate(s)
+	case "TIME":
+		return ParseTime(s)
+	case "DATETIME":
+		return ParseDateTime(s)
+	}
+	return nil, fmt.Errorf("unsupported type %q", typ)
+}
+
+// parseTimestamp parses a TIMESTAMP, which is returned as the number of
+// seconds since the epoch, possibly with a fraction and an exponent.
+func parseTimestamp(s string) (time.Time, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return time.Time{}, fmt.Errorf("cannot parse %q as TIMESTAMP", s)
+	}
+	r.Mul(r, big.NewRat(1e6, 1))
+	us := new(big.Int).Quo(r.Num(), r.Denom())
+	if !us.IsInt64() {
+		return time.Time{}, fmt.Errorf("TIMESTAMP %q out of range", s)
+	}
+	n := us.Int64()
+	return time.Unix(n/1e6, n%1e6*1e3).UTC(), nil
+}
+
+// numericScale returns the number of digits after the decimal point of
+// values of a column of type typ, which is NUMERIC or BIGNUMERIC.
+func numericScale(typ string) int {
+	if typ == "BIGNUMERIC" {
+		return 38
+	}
+	return 9
+}
+
+// ratString returns r as a decimal, without trailing zeros.
+func ratString(r *big.Rat, scale int) string {
+	s := r.FloatString(scale)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// assign sets dst to val, a value of a column of type typ, and reports whether
+// val can be assigned to dst.
+func assign(dst reflect.Value, typ string, val interface{}) bool {
+	if v := reflect.ValueOf(val); v.Type().AssignableTo(dst.Type()) {
+		dst.Set(v)
+		return true
+	}
+	switch x := val.(type) {
+	case string:
+		if dst.Kind() == reflect.String {
+			dst.SetString(x)
+			return true
+		}
+	case int64:
+		switch dst.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if !dst.OverflowInt(x) {
+				dst.SetInt(x)
+				return true
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if x >= 0 && !dst.OverflowUint(uint64(x)) {
+				dst.SetUint(uint64(x))
+				return true
+			}
+		case reflect.Float32, reflect.Float64:
+			dst.SetFloat(float64(x))
+			return true
+		}
+	case float64:
+		switch dst.Kind() {
+		case reflect.Float32, reflect.Float64:
+			dst.SetFloat(x)
+			return true
+		}
+	case *big.Rat:
+		switch {
+		case dst.Type() == ratType:
+			dst.Set(reflect.ValueOf(x).Elem())
+			return true
+		case dst.Kind() == reflect.Float32 || dst.Kind() == reflect.Float64:
+			f, _ := x.Float64()
+			dst.SetFloat(f)
+			return true
+		case dst.Kind() == reflect.String:
+			dst.SetString(ratString(x, numericScale(typ)))
+			return true
+		}
+	case bool:
+		if dst.Kind() == reflect.Bool {
+			dst.SetBool(x)
+			return true
+		}
+	case Date:
+		switch {
+		case dst.Type() == timeType:
+			dst.Set(reflect.ValueOf(x.In(time.UTC)))
+			return true
+		case dst.Kind() == reflect.String:
+			dst.SetString(x.String())
+			return true
+		}
+	case Time:
+		if dst.Kind() == reflect.String {
+			dst.SetString(x.String())
+			return true
+		}
+	case DateTime:
+		switch {
+		case dst.Type() == timeType:
+			dst.Set(reflect.ValueOf(x.In(time.UTC)))
+			return true
+		case dst.Kind() == reflect.String:
+			dst.SetString(x.String())
+			return true
+		}
+	}
+	return false
+}
+
+// Encode returns the rows of a TabledataInsertAllCall for the values in src
+// with the given schema. src must be a slice of structs, pointers to structs
+// or map[string]interface{}. Map keys without a matching column are an error.
+// If insertID is not nil, the InsertId of the row for the value src[i] is
+// insertID(i).
+func Encode(schema *bigquery.TableSchema, src interface{}, insertID func(i int) string) ([]*bigquery.TableDataInsertAllRequestRows, error) {
+	v := reflect.ValueOf(src)
+	if v.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("bqrows: Encode needs a slice, got %T", src)
+	}
+	rows := make([]*bigquery.TableDataInsertAllRequestRows, v.Len())
+	for i := range rows {
+		m, err := encodeRecord(schema.Fields, v.Index(i), "")
+		if err != nil {
+			return nil, fmt.Errorf("bqrows: row %d: %v", i, err)
+		}
+		rows[i] = &bigquery.TableDataInsertAllRequestRows{Json: m}
+		if insertID != nil {
+			rows[i].InsertId = insertID(i)
+		}
+	}
+	return rows, nil
+}
+
+// EncodeRow returns the JSON object of the row of a TabledataInsertAllCall
+// for src with the given schema. src must be a struct, a pointer to a struct
+// or a map[string]interface{}.
+func EncodeRow(schema *bigquery.TableSchema, src interface{}) (map[string]bigquery.JsonValue, error) {
+	m, err := encodeRecord(schema.Fields, reflect.ValueOf(src), "")
+	if err != nil {
+		return nil, fmt.Errorf("bqrows: %v", err)
+	}
+	return m, nil
+}
+
+// indirect returns the value v points to or contains, or an invalid value if
+// it is nil.
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func encodeRecord(fields []*bigquery.TableFieldSchema, v reflect.Value, path string) (map[string]bigquery.JsonValue, error) {
+	v = indirect(v)
+	if !v.IsValid() {
+		return nil, fmt.Errorf("%scannot encode nil record", prefix(path))
+	}
+	m := make(map[string]bigquery.JsonValue)
+	switch {
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		byName := make(map[string]*bigquery.TableFieldSchema, len(fields))
+		for _, f := range fields {
+			byName[strings.ToLower(f.Name)] = f
+		}
+		for _, k := range v.MapKeys() {
+			f, ok := byName[strings.ToLower(k.String())]
+			if !ok {
+				return nil, fmt.Errorf("%sno column %q in schema", prefix(path), k.String())
+			}
+			val, err := encodeField(f, v.MapIndex(k), path+f.Name)
+			if err != nil {
+				return nil, err
+			}
+			if val != nil {
+				m[f.Name] = val
+			}
+		}
+	case v.Kind() == reflect.Struct:
+		sf := structFields(v.Type())
+		for _, f := range fields {
+			index, ok := sf[strings.ToLower(f.Name)]
+			if !ok {
+				continue
+			}
+			val, err := encodeField(f, v.FieldByIndex(index), path+f.Name)
+			if err != nil {
+				return nil, err
+			}
+			if val != nil {
+				m[f.Name] = val
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%scannot encode %s as a record", prefix(path), v.Type())
+	}
+	return m, nil
+}
+
+func encodeField(f *bigquery.TableFieldSchema, v reflect.Value, path string) (interface{}, error) {
+	if f.Mode != "REPEATED" {
+		return encodeValue(f, v, path)
+	}
+	v = indirect(v)
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("%s: cannot encode %s as repeated %s", path, v.Type(), f.Type)
+	}
+	if v.Kind() == reflect.Slice && v.IsNil() {
+		return nil, nil
+	}
+	vals := make([]interface{}, v.Len())
+	for i := range vals {
+		p := fmt.Sprintf("%s[%d]", path, i)
+		val, err := encodeValue(f, v.Index(i), p)
+		if err != nil {
+			return nil, err
+		}
+		if val == nil {
+			return nil, fmt.Errorf("%s: repeated values cannot be NULL", p)
+		}
+		vals[i] = val
+	}
+	return vals, nil
+}
+
+// encodeValue returns the JSON value of v, a single value of the column f.
+func encodeValue(f *bigquery.TableFieldSchema, v reflect.Value, path string) (interface{}, error) {
+	v = indirect(v)
+	if !v.IsValid() || v.Kind() == reflect.Slice && v.IsNil() {
+		return nil, nil
+	}
+	if isRecord(f) {
+		return encodeRecord(f.Fields, v, path+".")
+	}
+	val, ok := encodeScalar(f.Type, v)
+	if !ok {
+		return nil, fmt.Errorf("%s: cannot encode %s as %s", path, v.Type(), f.Type)
+	}
+	return val, nil
+}
+
+// encodeScalar returns the JSON value of v for a column of type typ, and
+// reports whether v can be encoded as typ.
+func encodeScalar(typ string, v reflect.Value) (interface{}, bool) {
+	switch typ {
+	case "STRING", "GEOGRAPHY":
+		if v.Kind() == reflect.String {
+			return v.String(), true
+		}
+	case "BYTES":
+		if v.Type().ConvertibleTo(bytesType) && v.Kind() == reflect.Slice {
+			return base64.StdEncoding.EncodeToString(v.Bytes()), true
+		}
+	case "INTEGER", "INT64":
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return v.Int(), true
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if v.Uint() <= math.MaxInt64 {
+				return int64(v.Uint()), true
+			}
+		}
+	case "FLOAT", "FLOAT64":
+		switch v.Kind() {
+		case reflect.Float32, reflect.Float64:
+			return encodeFloat(v.Float()), true
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return float64(v.Int()), true
+		}
+	case "NUMERIC", "BIGNUMERIC":
+		switch {
+		case v.Type() == ratType:
+			r := v.Interface().(big.Rat)
+			return ratString(&r, numericScale(typ)), true
+		case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+			return strconv.FormatFloat(v.Float(), 'f', -1, 64), true
+		case v.Kind() == reflect.Int || v.Kind() == reflect.Int64 || v.Kind() == reflect.Int32:
+			return strconv.FormatInt(v.Int(), 10), true
+		case v.Kind() == reflect.String:
+			return v.String(), true
+		}
+	case "BOOLEAN", "BOOL":
+		if v.Kind() == reflect.Bool {
+			return v.Bool(), true
+		}
+	case "TIMESTAMP":
+		if v.Type() == timeType {
+			return v.Interface().(time.Time).UTC().Format("2006-01-02T15:04:05.999999Z07:00"), true
+		}
+	case "DATE":
+		switch {
+		case v.Type() == dateType:
+			return v.Interface().(Date).String(), true
+		case v.Type() == timeType:
+			return DateOf(v.Interface().(time.Time)).String(), true
+		case v.Kind() == reflect.String:
+			return v.String(), true
+		}
+	case "TIME":
+		switch {
+		case v.Type() == civilTime:
+			return v.Interface().(Time).String(), true
+		case v.Kind() == reflect.String:
+			return v.String(), true
+		}
+	case "DATETIME":
+		switch {
+		case v.Type() == dateTimeType:
+			return v.Interface().(DateTime).String(), true
+		case v.Type() == timeType:
+			return DateTimeOf(v.Interface().(time.Time)).String(), true
+		case v.Kind() == reflect.String:
+			return v.String(), true
+		}
+	}
+	return nil, false
+}
+
+// encodeFloat returns the JSON value of f, which is a string for the values
+// that JSON numbers cannot represent.
+func encodeFloat(f float64) interface{} {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	return f
+}
+
+// fieldCache maps struct types to the result of structFields.
+var fieldCache sync.Map
+
+// structFields returns the indexes of the fields of the struct type t that
+// are matched to columns, by the lower case name of the column.
+func structFields(t reflect.Type) map[string][]int {
+	if m, ok := fieldCache.Load(t); ok {
+		return m.(map[string][]int)
+	}
+	m := make(map[string][]int)
+	tagged := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		name := sf.Tag.Get("bigquery")
+		if name == "-" {
+			continue
+		}
+		key := strings.ToLower(name)
+		if name == "" {
+			// Fields named by their tag take precedence.
+			key = strings.ToLower(sf.Name)
+			if tagged[key] {
+				continue
+			}
+		} else {
+			tagged[key] = true
+		}
+		m[key] = sf.Index
+	}
+	fieldCache.Store(t, m)
+	return m
+}
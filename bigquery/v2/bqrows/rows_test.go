@@ -0,0 +1,343 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bqrows
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	bigquery "google.golang.org/api/bigquery/v2"
+)
+
+type address struct {
+	City string
+	Zip  int
+}
+
+type purchase struct {
+	Day    Date
+	Amount *float64
+}
+
+type record struct {
+	Name    string
+	Count   int64 `bigquery:"num"`
+	Score   float64
+	Price   *big.Rat
+	OK      bool
+	TS      time.Time
+	Day     time.Time
+	At      *Time
+	DT      DateTime
+	Data    []byte
+	Geo     string
+	Tags    []string
+	Addr    *address
+	History []purchase
+	Ignored string `bigquery:"-"`
+}
+
+var cmpOpts = []cmp.Option{
+	cmp.Comparer(func(a, b *big.Rat) bool { return a == nil && b == nil || a != nil && b != nil && a.Cmp(b) == 0 }),
+	cmpopts.EquateNaNs(),
+}
+
+func readResults(t *testing.T) *bigquery.GetQueryResultsResponse {
+	t.Helper()
+	b, err := ioutil.ReadFile("testdata/query_results.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res bigquery.GetQueryResultsResponse
+	if err := json.Unmarshal(b, &res); err != nil {
+		t.Fatal(err)
+	}
+	return &res
+}
+
+func float(f float64) *float64 { return &f }
+
+var wantRecords = []record{
+	{
+		Name:  "alice",
+		Count: -42,
+		Score: 1.5,
+		Price: big.NewRat(123456789, 1000000),
+		OK:    true,
+		TS:    time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC),
+		Day:   time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC),
+		At:    &Time{12, 34, 56, 789000000},
+		DT:    DateTime{Date{2020, 5, 1}, Time{12, 34, 56, 0}},
+		Data:  []byte("hello"),
+		Geo:   "POINT(1 2)",
+		Tags:  []string{"a", "b"},
+		Addr:  &address{City: "Paris", Zip: 75001},
+		History: []purchase{
+			{Day: Date{2020, 4, 1}, Amount: float(2.5)},
+			{Day: Date{2020, 4, 2}},
+		},
+	},
+	{
+		Name:    "bob",
+		Score:   math.NaN(),
+		TS:      time.Date(2020, 5, 1, 0, 0, 0, 123456000, time.UTC),
+		Tags:    []string{},
+		History: []purchase{},
+	},
+}
+
+func TestDecodeStructs(t *testing.T) {
+	res := readResults(t)
+	// Decode appends to the slice.
+	got := []record{{Name: "existing"}}
+	if err := Decode(res.Schema, res.Rows, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := append([]record{{Name: "existing"}}, wantRecords...)
+	if diff := cmp.Diff(want, got, cmpOpts...); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	var ptrs []*record
+	if err := Decode(res.Schema, res.Rows, &ptrs); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&wantRecords[0], ptrs[0], cmpOpts...); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDecodeMaps(t *testing.T) {
+	res := readResults(t)
+	var got []map[string]interface{}
+	if err := Decode(res.Schema, res.Rows, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]interface{}{
+		{
+			"name":  "alice",
+			"num":   int64(-42),
+			"score": 1.5,
+			"price": big.NewRat(123456789, 1000000),
+			"ok":    true,
+			"ts":    time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC),
+			"day":   Date{2020, 5, 1},
+			"at":    Time{12, 34, 56, 789000000},
+			"dt":    DateTime{Date{2020, 5, 1}, Time{12, 34, 56, 0}},
+			"data":  []byte("hello"),
+			"geo":   "POINT(1 2)",
+			"tags":  []interface{}{"a", "b"},
+			"addr":  map[string]interface{}{"city": "Paris", "zip": int64(75001)},
+			"history": []interface{}{
+				map[string]interface{}{"day": Date{2020, 4, 1}, "amount": 2.5},
+				map[string]interface{}{"day": Date{2020, 4, 2}, "amount": nil},
+			},
+		},
+		{
+			"name":    "bob",
+			"num":     nil,
+			"score":   math.NaN(),
+			"price":   nil,
+			"ok":      false,
+			"ts":      time.Date(2020, 5, 1, 0, 0, 0, 123456000, time.UTC),
+			"day":     nil,
+			"at":      nil,
+			"dt":      nil,
+			"data":    nil,
+			"geo":     nil,
+			"tags":    []interface{}{},
+			"addr":    nil,
+			"history": []interface{}{},
+		},
+	}
+	if diff := cmp.Diff(want, got, cmpOpts...); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	var row map[string]interface{}
+	if err := DecodeRow(res.Schema, res.Rows[0], &row); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want[0], row, cmpOpts...); diff != "" {
+		t.Errorf("DecodeRow mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDecodeConversions(t *testing.T) {
+	res := readResults(t)
+	var got struct {
+		Num   int8
+		Score float32
+		Price string
+		Day   string
+		At    string
+		DT    time.Time
+		Addr  map[string]interface{}
+		Tags  interface{}
+	}
+	if err := DecodeRow(res.Schema, res.Rows[0], &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Num != -42 || got.Score != 1.5 || got.Price != "123.456789" || got.Day != "2020-05-01" ||
+		got.At != "12:34:56.789000" || !got.DT.Equal(time.Date(2020, 5, 1, 12, 34, 56, 0, time.UTC)) {
+		t.Errorf("got %+v", got)
+	}
+	if diff := cmp.Diff(map[string]interface{}{"city": "Paris", "zip": int64(75001)}, got.Addr); diff != "" {
+		t.Errorf("Addr mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]interface{}{"a", "b"}, got.Tags); diff != "" {
+		t.Errorf("Tags mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	schema := &bigquery.TableSchema{Fields: []*bigquery.TableFieldSchema{
+		{Name: "n", Type: "INTEGER"},
+		{Name: "r", Type: "RECORD", Fields: []*bigquery.TableFieldSchema{{Name: "b", Type: "BOOLEAN"}}},
+	}}
+	row := func(n, r interface{}) []*bigquery.TableRow {
+		return []*bigquery.TableRow{{F: []*bigquery.TableCell{{V: n}, {V: r}}}}
+	}
+	rec := func(b interface{}) interface{} {
+		return map[string]interface{}{"f": []interface{}{map[string]interface{}{"v": b}}}
+	}
+	for _, test := range []struct {
+		desc string
+		rows []*bigquery.TableRow
+		dst  interface{}
+		want string
+	}{
+		{"not a pointer", row("1", nil), []map[string]interface{}{}, "pointer to a slice"},
+		{"bad integer", row("x", nil), &[]map[string]interface{}{}, "row 0: n: strconv.ParseInt"},
+		{"overflow", row("300", nil), &[]struct{ N int8 }{}, "row 0: n: cannot decode INTEGER into int8"},
+		{"wrong type", row("1", nil), &[]struct{ N string }{}, "cannot decode INTEGER into string"},
+		{"nested", row(nil, rec("maybe")), &[]map[string]interface{}{}, "row 0: r.b: strconv.ParseBool"},
+		{"not a record", row(nil, "x"), &[]map[string]interface{}{}, "r: got string, want a record"},
+		{"not a struct", row("1", nil), &[]int{}, "cannot decode record into int"},
+		{"cell count", []*bigquery.TableRow{{F: []*bigquery.TableCell{{V: "1"}}}}, &[]map[string]interface{}{}, "got 1 values for 2 columns"},
+	} {
+		err := Decode(schema, test.rows, test.dst)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got error %v, want one containing %q", test.desc, err, test.want)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	res := readResults(t)
+	rows, err := Encode(res.Schema, wantRecords, func(i int) string { return string('a' + rune(i)) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*bigquery.TableDataInsertAllRequestRows{
+		{
+			InsertId: "a",
+			Json: map[string]bigquery.JsonValue{
+				"name":  "alice",
+				"num":   int64(-42),
+				"score": 1.5,
+				"price": "123.456789",
+				"ok":    true,
+				"ts":    "2020-05-01T00:00:00Z",
+				"day":   "2020-05-01",
+				"at":    "12:34:56.789000",
+				"dt":    "2020-05-01T12:34:56",
+				"data":  "aGVsbG8=",
+				"geo":   "POINT(1 2)",
+				"tags":  []interface{}{"a", "b"},
+				"addr":  map[string]bigquery.JsonValue{"city": "Paris", "zip": int64(75001)},
+				"history": []interface{}{
+					map[string]bigquery.JsonValue{"day": "2020-04-01", "amount": 2.5},
+					map[string]bigquery.JsonValue{"day": "2020-04-02"},
+				},
+			},
+		},
+		{
+			InsertId: "b",
+			Json: map[string]bigquery.JsonValue{
+				"name":    "bob",
+				"num":     int64(0),
+				"score":   "NaN",
+				"ok":      false,
+				"ts":      "2020-05-01T00:00:00.123456Z",
+				"day":     "0001-01-01",
+				"dt":      "0000-00-00T00:00:00",
+				"geo":     "",
+				"tags":    []interface{}{},
+				"history": []interface{}{},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, rows, cmpopts.IgnoreFields(bigquery.TableDataInsertAllRequestRows{}, "ForceSendFields", "NullFields")); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	// Maps decoded from rows are encoded to the same rows.
+	var maps []map[string]interface{}
+	if err := Decode(res.Schema, res.Rows, &maps); err != nil {
+		t.Fatal(err)
+	}
+	rows, err = Encode(res.Schema, maps, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rows[0].Json["price"]; got != "123.456789" {
+		t.Errorf("price = %v, want 123.456789", got)
+	}
+	if _, ok := rows[1].Json["num"]; ok {
+		t.Error("NULL num was encoded")
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	schema := &bigquery.TableSchema{Fields: []*bigquery.TableFieldSchema{
+		{Name: "n", Type: "INTEGER"},
+		{Name: "s", Type: "STRING", Mode: "REPEATED"},
+	}}
+	for _, test := range []struct {
+		desc string
+		src  interface{}
+		want string
+	}{
+		{"not a slice", map[string]interface{}{}, "needs a slice"},
+		{"unknown column", []map[string]interface{}{{"x": 1}}, `row 0: no column "x" in schema`},
+		{"wrong type", []map[string]interface{}{{"n": "1"}}, "row 0: n: cannot encode string as INTEGER"},
+		{"not repeated", []map[string]interface{}{{"s": "a"}}, "cannot encode string as repeated STRING"},
+		{"null element", []map[string]interface{}{{"s": []interface{}{"a", nil}}}, "s[1]: repeated values cannot be NULL"},
+		{"not a record", []int{1}, "cannot encode int as a record"},
+	} {
+		_, err := Encode(schema, test.src, nil)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got error %v, want one containing %q", test.desc, err, test.want)
+		}
+	}
+}
+
+func TestCivil(t *testing.T) {
+	for _, s := range []string{"2020-05-01T12:34:56", "2020-05-01T00:00:00.000001"} {
+		dt, err := ParseDateTime(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := dt.String(); got != s {
+			t.Errorf("ParseDateTime(%q).String() = %q", s, got)
+		}
+	}
+	if dt, err := ParseDateTime("2020-05-01 12:34:56"); err != nil || dt.String() != "2020-05-01T12:34:56" {
+		t.Errorf("ParseDateTime with a space = %v, %v", dt, err)
+	}
+	for _, s := range []string{"2020-05-01", "12:00", "2020-13-01T00:00:00"} {
+		if _, err := ParseDateTime(s); err == nil {
+			t.Errorf("ParseDateTime(%q): got nil error", s)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package drivesync keeps a local mirror of the files of a drive up to date
+// with the changes listed by the drive/v3 package.
+//
+// A Syncer lists the changes since the page token saved in a cursor.Store,
+// calls a function with an Event for each change, and saves the page token
+// of the next sync. The first sync, and a sync whose page token has expired,
+// lists all the files instead, after a Reset event.
+//
+//	s := &drivesync.Syncer{Service: svc, Store: store}
+//	err := s.Run(ctx, time.Minute, func(e drivesync.Event) error {
+//		switch e.Type {
+//		case drivesync.Reset:
+//			// Discard the mirror.
+//		case drivesync.FileChanged:
+//			// Update e.File in the mirror.
+//		case drivesync.FileRemoved:
+//			// Remove e.FileID from the mirror.
+//		}
+//		return nil
+//	})
+//
+// This is an EXPERIMENTAL API and may be changed or removed in the future.
+package drivesync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	drive "google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/support/cursor"
+)
+
+// An EventType is the type of an Event.
+type EventType int
+
+const (
+	// Reset means that the mirror must be discarded: it is followed by a
+	// FileChanged event for each file.
+	Reset EventType = iota
+
+	// FileChanged means that a file was added or changed. Trashed files are
+	// changed files whose Trashed field is true.
+	FileChanged
+
+	// FileRemoved means that a file was deleted, or is no longer
+	// accessible.
+	FileRemoved
+
+	// DriveChanged means that a shared drive was added or changed.
+	DriveChanged
+
+	// DriveRemoved means that a shared drive was deleted, or is no longer
+	// accessible.
+	DriveRemoved
+)
+
+var eventTypeNames = []string{"Reset", "FileChanged", "FileRemoved", "DriveChanged", "DriveRemoved"}
+
+func (t EventType) String() string {
+	if t < 0 || int(t) >= len(eventTypeNames) {
+		return fmt.Sprintf("EventType(%d)", int(t))
+	}
+	return eventTypeNames[t]
+}
+
+// An Event is a change of a file or a shared drive.
+type Event struct {
+	Type EventType
+
+	// FileID and File are the ID and the new state of the file of
+	// FileChanged and FileRemoved events. File is nil for FileRemoved
+	// events.
+	FileID string
+	File   *drive.File
+
+	// DriveID and Drive are the ID and the new state of the shared drive of
+	// DriveChanged and DriveRemoved events. Drive is nil for DriveRemoved
+	// events.
+	DriveID string
+	Drive   *drive.Drive
+
+	// Change is the change the event was made from. It is nil for the
+	// events of a full sync.
+	Change *drive.Change
+}
+
+// A Syncer syncs the changes of the files of a user, or of a shared drive.
+type Syncer struct {
+	// Service is the service used to list changes and files.
+	Service *drive.Service
+
+	// Store stores the page token of the next sync.
+	Store cursor.Store
+
+	// Key is the key of the page token in Store. It defaults to
+	// "drive/changes", or "drive/changes/" followed by DriveID.
+	Key string
+
+	// DriveID is the ID of the shared drive to sync. If it is empty, the
+	// files of the user are synced.
+	DriveID string
+
+	// FileFields are the fields of the files of the events, such as
+	// "id,name,parents,modifiedTime". If it is empty, files have the fields
+	// that the API returns by default.
+	FileFields string
+
+	// PageSize is the maximum number of changes or files listed per page.
+	// If it is zero, the API default is used.
+	PageSize int64
+}
+
+func (s *Syncer) key() string {
+	switch {
+	case s.Key != "":
+		return s.Key
+	case s.DriveID != "":
+		return "drive/changes/" + s.DriveID
+	}
+	return "drive/changes"
+}
+
+// expired reports whether err means that a page token has expired.
+func expired(err error) bool {
+	e, ok := err.(*googleapi.Error)
+	return ok && (e.Code == http.StatusNotFound || e.Code == http.StatusGone)
+}
+
+// Sync lists the changes since the last sync, and calls fn with an event
+// for each one. If there was no previous sync, or its page token has
+// expired, Sync calls fn with a Reset event, then with a FileChanged event
+// for each file.
+//
+// Sync saves the page token of the next sync after each page of changes,
+// once fn has returned for each of its events. If fn returns an error, Sync
+// stops and returns it, and the next sync lists the changes of the page
+// again.
+func (s *Syncer) Sync(ctx context.Context, fn func(Event) error) error {
+	return cursor.Sync(ctx, s.Store, s.key(), func(token string) error {
+		return s.changes(ctx, token, fn)
+	}, func() error {
+		return s.full(ctx, fn)
+	}, expired)
+}
+
+// changes lists the changes since token.
+func (s *Syncer) changes(ctx context.Context, token string, fn func(Event) error) error {
+	for {
+		call := s.Service.Changes.List(token).IncludeRemoved(true).Context(ctx)
+		if s.DriveID != "" {
+			call.DriveId(s.DriveID).IncludeItemsFromAllDrives(true).SupportsAllDrives(true)
+		}
+		if s.PageSize > 0 {
+			call.PageSize(s.PageSize)
+		}
+		if s.FileFields != "" {
+			call.Fields(googleapi.Field("nextPageToken,newStartPageToken,changes(changeType,time,removed,fileId,driveId,drive,file(" + s.FileFields + "))"))
+		}
+		cl, err := call.Do()
+		if err != nil {
+			return err
+		}
+		for _, c := range cl.Changes {
+			if err := fn(changeEvent(c)); err != nil {
+				return err
+			}
+		}
+		next := cl.NextPageToken
+		if next == "" {
+			next = cl.NewStartPageToken
+		}
+		if next == "" {
+			return errors.New("drivesync: change list has no next page token nor new start page token")
+		}
+		if err := s.Store.Save(ctx, s.key(), next); err != nil {
+			return err
+		}
+		if cl.NextPageToken == "" {
+			return nil
+		}
+		token = next
+	}
+}
+
+func changeEvent(c *drive.Change) Event {
+	e := Event{FileID: c.FileId, File: c.File, DriveID: c.DriveId, Drive: c.Drive, Change: c}
+	switch {
+	case c.ChangeType == "drive" && c.Removed:
+		e.Type = DriveRemoved
+	case c.ChangeType == "drive":
+		e.Type = DriveChanged
+	case c.Removed:
+		e.Type = FileRemoved
+	default:
+		e.Type = FileChanged
+	}
+	return e
+}
+
+// full lists all the files. The start page token of the next sync is got
+// first, so that the next sync lists the changes made during the listing.
+func (s *Syncer) full(ctx context.Context, fn func(Event) error) error {
+	tcall := s.Service.Changes.GetStartPageToken().Context(ctx)
+	if s.DriveID != "" {
+		tcall.DriveId(s.DriveID).SupportsAllDrives(true)
+	}
+	st, err := tcall.Do()
+	if err != nil {
+		return err
+	}
+	if err := fn(Event{Type: Reset}); err != nil {
+		return err
+	}
+	call := s.Service.Files.List()
+	if s.DriveID != "" {
+		call.Corpora("drive").DriveId(s.DriveID).IncludeItemsFromAllDrives(true).SupportsAllDrives(true)
+	}
+	if s.PageSize > 0 {
+		call.PageSize(s.PageSize)
+	}
+	if s.FileFields != "" {
+		call.Fields(googleapi.Field("nextPageToken,files(" + s.FileFields + ")"))
+	}
+	err = call.Pages(ctx, func(fl *drive.FileList) error {
+		for _, f := range fl.Files {
+			if err := fn(Event{Type: FileChanged, FileID: f.Id, File: f, DriveID: s.DriveID}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.Store.Save(ctx, s.key(), st.StartPageToken)
+}
+
+// Run syncs every interval until ctx is done or a sync fails, and returns
+// the error. A sync that fails with a transient error of the API is retried,
+// as described by cursor.Run.
+func (s *Syncer) Run(ctx context.Context, interval time.Duration, fn func(Event) error) error {
+	return cursor.Run(ctx, interval, func() error {
+		return s.Sync(ctx, fn)
+	})
+}
+
+// Stream is like Run, but sends the events to ch. A page of changes is
+// considered handled once its events have been received from ch.
+func (s *Syncer) Stream(ctx context.Context, interval time.Duration, ch chan<- Event) error {
+	return s.Run(ctx, interval, func(e Event) error {
+		select {
+		case ch <- e:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
@@ -0,0 +1,176 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package drivesync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	drive "google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+	"google.golang.org/api/support/cursor"
+)
+
+// fakeDrive serves the change and file lists of a drive.
+func fakeDrive(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/drive/v3/changes/startPageToken":
+			if q.Get("driveId") != "d1" || q.Get("supportsAllDrives") != "true" {
+				t.Errorf("got query %v", q)
+			}
+			fmt.Fprint(w, `{"startPageToken": "10"}`)
+		case "/drive/v3/files":
+			if q.Get("driveId") != "d1" || q.Get("corpora") != "drive" || q.Get("fields") != "nextPageToken,files(id,name)" {
+				t.Errorf("got query %v", q)
+			}
+			switch q.Get("pageToken") {
+			case "":
+				fmt.Fprint(w, `{"nextPageToken": "p2", "files": [{"id": "f1", "name": "a"}, {"id": "f2", "name": "b"}]}`)
+			case "p2":
+				fmt.Fprint(w, `{"files": [{"id": "f3", "name": "c"}]}`)
+			default:
+				t.Errorf("got file list page token %q", q.Get("pageToken"))
+			}
+		case "/drive/v3/changes":
+			if q.Get("includeRemoved") != "true" || q.Get("driveId") != "d1" || q.Get("pageSize") != "2" {
+				t.Errorf("got query %v", q)
+			}
+			switch q.Get("pageToken") {
+			case "10":
+				fmt.Fprint(w, `{"nextPageToken": "11", "changes": [
+					{"changeType": "file", "fileId": "f1", "file": {"id": "f1", "name": "a2"}},
+					{"changeType": "file", "fileId": "f2", "removed": true}
+				]}`)
+			case "11":
+				fmt.Fprint(w, `{"newStartPageToken": "12", "changes": [
+					{"changeType": "drive", "driveId": "d1", "drive": {"id": "d1", "name": "Team"}}
+				]}`)
+			case "12":
+				fmt.Fprint(w, `{"newStartPageToken": "12"}`)
+			default:
+				http.Error(w, `{"error": {"code": 404, "message": "Page token is no longer valid."}}`, http.StatusNotFound)
+			}
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			http.Error(w, "unexpected", http.StatusBadRequest)
+		}
+	}))
+}
+
+// summary summarizes an event for comparisons.
+func summary(e Event) string {
+	switch e.Type {
+	case FileChanged:
+		return fmt.Sprintf("%v %s %s", e.Type, e.FileID, e.File.Name)
+	case DriveChanged:
+		return fmt.Sprintf("%v %s %s", e.Type, e.DriveID, e.Drive.Name)
+	case FileRemoved:
+		return fmt.Sprintf("%v %s", e.Type, e.FileID)
+	}
+	return e.Type.String()
+}
+
+func TestSync(t *testing.T) {
+	srv := fakeDrive(t)
+	defer srv.Close()
+	ctx := context.Background()
+	svc, err := drive.NewService(ctx, option.WithHTTPClient(http.DefaultClient), option.WithEndpoint(srv.URL+"/drive/v3/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := cursor.NewMemoryStore()
+	s := &Syncer{Service: svc, Store: store, DriveID: "d1", FileFields: "id,name", PageSize: 2}
+
+	full := []string{"Reset", "FileChanged f1 a", "FileChanged f2 b", "FileChanged f3 c"}
+	for _, test := range []struct {
+		cursor string // if not empty, saved before the sync
+		want   []string
+	}{
+		{"", full},
+		{"", []string{"FileChanged f1 a2", "FileRemoved f2", "DriveChanged d1 Team"}},
+		{"", nil},
+		{"9", full},
+	} {
+		if test.cursor != "" {
+			if err := store.Save(ctx, "drive/changes/d1", test.cursor); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var got []string
+		if err := s.Sync(ctx, func(e Event) error {
+			got = append(got, summary(e))
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("events mismatch (-want +got):\n%s", diff)
+		}
+	}
+	if c, _ := store.Load(ctx, "drive/changes/d1"); c != "10" {
+		t.Errorf("got cursor %q, want 10", c)
+	}
+
+	// A failing handler stops the sync after the last saved page.
+	errStop := errors.New("stop")
+	n := 0
+	err = s.Sync(ctx, func(e Event) error {
+		n++
+		if n == 3 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop {
+		t.Fatalf("got error %v, want %v", err, errStop)
+	}
+	if c, _ := store.Load(ctx, "drive/changes/d1"); c != "11" {
+		t.Errorf("got cursor %q, want 11", c)
+	}
+}
+
+func TestStream(t *testing.T) {
+	srv := fakeDrive(t)
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	svc, err := drive.NewService(ctx, option.WithHTTPClient(http.DefaultClient), option.WithEndpoint(srv.URL+"/drive/v3/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Syncer{Service: svc, Store: cursor.NewMemoryStore(), Key: "k", DriveID: "d1", FileFields: "id,name", PageSize: 2}
+	ch := make(chan Event)
+	done := make(chan error, 1)
+	go func() { done <- s.Stream(ctx, time.Millisecond, ch) }()
+	var got []string
+	for len(got) < 7 {
+		got = append(got, summary(<-ch))
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+	want := []string{"Reset", "FileChanged f1 a", "FileChanged f2 b", "FileChanged f3 c", "FileChanged f1 a2", "FileRemoved f2", "DriveChanged d1 Team"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("events mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEventTypeString(t *testing.T) {
+	if got := DriveRemoved.String(); got != "DriveRemoved" {
+		t.Errorf("got %q", got)
+	}
+	if got := EventType(9).String(); got != "EventType(9)" {
+		t.Errorf("got %q", got)
+	}
+}
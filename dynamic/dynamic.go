@@ -0,0 +1,510 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dynamic provides a client for any Google API described by a
+// discovery document, for APIs and revisions that have no generated package.
+//
+// A Service is created from the bytes of a discovery document, which may be
+// read from a file or fetched from the discovery service with FetchDocument:
+//
+//	doc, err := dynamic.FetchDocument(ctx, "storage", "v1", option.WithoutAuthentication())
+//	if err != nil {
+//		// TODO: Handle error.
+//	}
+//	s, err := dynamic.NewService(ctx, doc)
+//	if err != nil {
+//		// TODO: Handle error.
+//	}
+//
+// Methods are called by their IDs, with their parameters given in a map and
+// request bodies given as values that encode to JSON, such as a
+// map[string]interface{}. Responses are returned as decoded JSON:
+//
+//	obj, err := s.NewCall("storage.objects.get", map[string]interface{}{
+//		"bucket": "my-bucket",
+//		"object": "my-object",
+//	}, nil).Do()
+//
+// Like the generated packages, the calls support media upload and download,
+// paging, and report errors as *googleapi.Error values.
+//
+// This is an EXPERIMENTAL API and may be changed or removed in the future.
+package dynamic // import "google.golang.org/api/dynamic"
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/internal/disco"
+	"google.golang.org/api/internal/gensupport"
+	"google.golang.org/api/internal/version"
+	"google.golang.org/api/option"
+	"google.golang.org/api/option/internaloption"
+	htransport "google.golang.org/api/transport/http"
+)
+
+const discoveryBasePath = "https://www.googleapis.com/discovery/v1/"
+
+// FetchDocument fetches the discovery document of version of the API name
+// from the discovery service. Documents of public APIs do not need
+// credentials, so opts typically include option.WithoutAuthentication or
+// option.WithAPIKey. option.WithEndpoint may be used to fetch from another
+// discovery service.
+func FetchDocument(ctx context.Context, name, version string, opts ...option.ClientOption) ([]byte, error) {
+	opts = append(opts, internaloption.WithDefaultEndpoint(discoveryBasePath))
+	client, endpoint, err := htransport.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint == "" {
+		endpoint = discoveryBasePath
+	}
+	urls := googleapi.ResolveRelative(endpoint, "apis/{api}/{version}/rest")
+	req, err := http.NewRequest("GET", urls, nil)
+	if err != nil {
+		return nil, err
+	}
+	googleapi.Expand(req.URL, map[string]string{
+		"api":     name,
+		"version": version,
+	})
+	res, err := gensupport.SendRequest(ctx, client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+// A Service is a client for the API described by a discovery document.
+type Service struct {
+	client    *http.Client
+	BasePath  string // API endpoint base URL
+	UserAgent string // optional additional User-Agent fragment
+
+	doc     *disco.Document
+	methods map[string]*disco.Method
+	style   googleapi.MarshalStyle
+}
+
+// NewService creates a Service for the API described by document, the
+// contents of a discovery document. By default it requests all of the
+// OAuth2 scopes listed in the document and uses the endpoint given by its
+// rootUrl and servicePath. As in generated packages, if the environment
+// variable named after the API, like STORAGE_EMULATOR_HOST, is set, requests
+// are sent without authentication to the emulator at the address it holds.
+func NewService(ctx context.Context, document []byte, opts ...option.ClientOption) (*Service, error) {
+	doc, err := disco.NewDocument(document)
+	if err != nil {
+		return nil, err
+	}
+	var scopes []string
+	for _, sc := range doc.Auth.OAuth2Scopes {
+		scopes = append(scopes, sc.ID)
+	}
+	if len(scopes) > 0 {
+		// NOTE: prepend, so we don't override user-specified scopes.
+		opts = append([]option.ClientOption{option.WithScopes(scopes...)}, opts...)
+	}
+	basePath := doc.RootURL + doc.ServicePath
+	opts = append(opts, internaloption.WithDefaultEndpoint(basePath))
+	if doc.MTLSRootURL != "" {
+		opts = append(opts, internaloption.WithDefaultMTLSEndpoint(doc.MTLSRootURL+doc.ServicePath))
+	}
+	opts = append(opts, internaloption.WithEmulatorHostEnv(doc.EmulatorHostEnv()))
+	client, endpoint, err := htransport.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	s := &Service{
+		client:   client,
+		BasePath: basePath,
+		doc:      doc,
+		methods:  map[string]*disco.Method{},
+		style:    googleapi.WithoutDataWrapper,
+	}
+	if endpoint != "" {
+		s.BasePath = endpoint
+	}
+	for _, f := range doc.Features {
+		if f == "dataWrapper" {
+			s.style = googleapi.WithDataWrapper
+		}
+	}
+	s.addMethods(doc.Methods, doc.Resources)
+	return s, nil
+}
+
+func (s *Service) addMethods(ms disco.MethodList, rs disco.ResourceList) {
+	for _, m := range ms {
+		s.methods[m.ID] = m
+	}
+	for _, r := range rs {
+		s.addMethods(r.Methods, r.Resources)
+	}
+}
+
+// Name returns the name of the API, such as "storage".
+func (s *Service) Name() string { return s.doc.Name }
+
+// Version returns the version of the API, such as "v1".
+func (s *Service) Version() string { return s.doc.Version }
+
+// Methods returns the IDs of the methods of the API in sorted order.
+func (s *Service) Methods() []string {
+	var ids []string
+	for id := range s.methods {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (s *Service) userAgent() string {
+	if s.UserAgent == "" {
+		return googleapi.UserAgent
+	}
+	return googleapi.UserAgent + " " + s.UserAgent
+}
+
+// A Call is a call of an API method.
+type Call struct {
+	s          *Service
+	m          *disco.Method
+	body       interface{}
+	pathParams map[string]string
+	urlParams  gensupport.URLParams
+	mediaInfo  *gensupport.MediaInfo
+	ctx_       context.Context
+	header_    http.Header
+	err        error // error found while building the call, reported by Do
+}
+
+// NewCall returns a call of the method with ID id, such as
+// "storage.objects.get", with the given parameters and request body.
+//
+// The values of params may be strings, numbers, booleans or, for repeated
+// parameters, slices of those. Parameters common to all methods of the API,
+// such as "fields", may also be given. The body must be nil if the method
+// takes no request body; otherwise it must be a value that encodes to JSON,
+// such as a map[string]interface{}, or a []byte or json.RawMessage holding
+// encoded JSON.
+//
+// Errors in the method ID or arguments are reported by the Do, Download or
+// Pages method of the call.
+func (s *Service) NewCall(id string, params map[string]interface{}, body interface{}) *Call {
+	c := &Call{s: s, pathParams: map[string]string{}, urlParams: make(gensupport.URLParams)}
+	c.m = s.methods[id]
+	if c.m == nil {
+		c.err = fmt.Errorf("dynamic: unknown method %q", id)
+		return c
+	}
+	if body != nil && c.m.Request == nil {
+		c.err = fmt.Errorf("dynamic: method %q takes no request body", id)
+		return c
+	}
+	c.body = body
+	c.err = c.setParams(params)
+	return c
+}
+
+// setParams sets the path and query parameters of c from params.
+func (c *Call) setParams(params map[string]interface{}) error {
+	known := map[string]*disco.Parameter{}
+	for _, p := range c.s.doc.Parameters {
+		known[p.Name] = p
+	}
+	for _, p := range c.m.Parameters {
+		known[p.Name] = p
+	}
+	for name, v := range params {
+		p := known[name]
+		if p == nil {
+			return fmt.Errorf("dynamic: unknown parameter %q for method %q", name, c.m.ID)
+		}
+		vals := paramValues(v)
+		if len(vals) > 1 && !p.Repeated {
+			return fmt.Errorf("dynamic: parameter %q of method %q is not repeated, but has %d values", name, c.m.ID, len(vals))
+		}
+		if p.Location == "path" {
+			if len(vals) != 1 {
+				return fmt.Errorf("dynamic: path parameter %q of method %q must have one value", name, c.m.ID)
+			}
+			c.pathParams[name] = vals[0]
+			continue
+		}
+		c.urlParams.SetMulti(name, vals)
+	}
+	for _, p := range c.m.Parameters {
+		if _, ok := params[p.Name]; p.Required && !ok {
+			return fmt.Errorf("dynamic: missing required parameter %q of method %q", p.Name, c.m.ID)
+		}
+	}
+	return nil
+}
+
+// paramValues returns the string forms of the parameter value v.
+func paramValues(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return []string{fmt.Sprint(v)}
+	}
+	vals := make([]string, rv.Len())
+	for i := range vals {
+		vals[i] = fmt.Sprint(rv.Index(i).Interface())
+	}
+	return vals
+}
+
+// Media specifies the media to upload in one or more chunks. The chunk size
+// may be controlled by supplying a MediaOption generated by
+// googleapi.ChunkSize. The chunk size defaults to
+// googleapi.DefaultUploadChunkSize. The Content-Type header used in the
+// upload request will be determined by sniffing the contents of r, unless a
+// MediaOption generated by googleapi.ContentType is supplied.
+// At most one of Media and ResumableMedia may be set.
+func (c *Call) Media(r io.Reader, options ...googleapi.MediaOption) *Call {
+	c.mediaInfo = gensupport.NewInfoFromMedia(r, options)
+	return c
+}
+
+// ResumableMedia specifies the media to upload in chunks and can be
+// canceled with ctx. At most one of Media and ResumableMedia may be set.
+// mediaType identifies the MIME media type of the upload, such as
+// "image/png". If mediaType is "", it will be auto-detected. The provided
+// ctx will supersede any context previously provided to the Context method.
+func (c *Call) ResumableMedia(ctx context.Context, r io.ReaderAt, size int64, mediaType string) *Call {
+	c.ctx_ = ctx
+	c.mediaInfo = gensupport.NewInfoFromResumableMedia(r, size, mediaType)
+	return c
+}
+
+// ProgressUpdater provides a callback function that will be called after
+// every chunk. It should be a low-latency function in order to not slow
+// down the upload operation. This should only be called when using
+// ResumableMedia (as opposed to Media).
+func (c *Call) ProgressUpdater(pu googleapi.ProgressUpdater) *Call {
+	c.mediaInfo.SetProgressUpdater(pu)
+	return c
+}
+
+// Context sets the context to be used in this call's Do, Download and Pages
+// methods. Any pending HTTP request will be aborted if the provided context
+// is canceled.
+func (c *Call) Context(ctx context.Context) *Call {
+	c.ctx_ = ctx
+	return c
+}
+
+// Header returns an http.Header that can be modified by the caller to add
+// HTTP headers to the request.
+func (c *Call) Header() http.Header {
+	if c.header_ == nil {
+		c.header_ = make(http.Header)
+	}
+	return c.header_
+}
+
+func (c *Call) doRequest(alt string) (*http.Response, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	reqHeaders := make(http.Header)
+	reqHeaders.Set("x-goog-api-client", "gl-go/"+gensupport.GoVersion()+" gdcl/"+version.Repo+" gdcl-method/"+c.m.ID)
+	for k, v := range c.header_ {
+		reqHeaders[k] = v
+	}
+	reqHeaders.Set("User-Agent", c.s.userAgent())
+	var body io.Reader
+	if c.body != nil {
+		switch b := c.body.(type) {
+		case []byte:
+			body = bytes.NewReader(b)
+		case json.RawMessage:
+			body = bytes.NewReader(b)
+		default:
+			var err error
+			if body, err = c.s.style.JSONReader(c.body); err != nil {
+				return nil, err
+			}
+		}
+		reqHeaders.Set("Content-Type", "application/json")
+	}
+	c.urlParams.Set("alt", alt)
+	c.urlParams.Set("prettyPrint", "false")
+	urls := googleapi.ResolveRelative(c.s.BasePath, c.m.Path)
+	if c.mediaInfo != nil {
+		path, err := c.uploadPath()
+		if err != nil {
+			return nil, err
+		}
+		urls = googleapi.ResolveRelative(c.s.BasePath, path)
+		c.urlParams.Set("uploadType", c.mediaInfo.UploadType())
+		if body == nil {
+			body = new(bytes.Buffer)
+			reqHeaders.Set("Content-Type", "application/json")
+		}
+	}
+	body, getBody, cleanup := c.mediaInfo.UploadRequest(reqHeaders, body)
+	defer cleanup()
+	urls += "?" + c.urlParams.Encode()
+	req, err := http.NewRequest(c.m.HTTPMethod, urls, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = reqHeaders
+	gensupport.SetGetBody(req, getBody)
+	googleapi.Expand(req.URL, c.pathParams)
+	return gensupport.SendRequest(c.ctx_, c.s.client, req)
+}
+
+// uploadPath returns the path used to upload media with the method.
+func (c *Call) uploadPath() (string, error) {
+	if c.m.MediaUpload == nil {
+		return "", fmt.Errorf("dynamic: method %q does not support media upload", c.m.ID)
+	}
+	for _, protocol := range []string{"resumable", "simple"} {
+		if p, ok := c.m.MediaUpload.Protocols[protocol]; ok {
+			return p.Path, nil
+		}
+	}
+	return "", fmt.Errorf("dynamic: method %q has no media upload path", c.m.ID)
+}
+
+// Do executes the call and returns its response, the decoded JSON object,
+// which is nil if the method has no response. Any non-2xx status code is an
+// error; the error is a *googleapi.Error if the server returned an error
+// response.
+func (c *Call) Do(opts ...googleapi.CallOption) (map[string]interface{}, error) {
+	gensupport.SetOptions(c.urlParams, opts...)
+	res, err := c.doRequest("json")
+	if res != nil && res.StatusCode == http.StatusNotModified {
+		if res.Body != nil {
+			res.Body.Close()
+		}
+		return nil, &googleapi.Error{
+			Code:   res.StatusCode,
+			Header: res.Header,
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return nil, err
+	}
+	rx := c.mediaInfo.ResumableUpload(res.Header.Get("Location"))
+	if rx != nil {
+		rx.Client = c.s.client
+		rx.UserAgent = c.s.userAgent()
+		ctx := c.ctx_
+		if ctx == nil {
+			ctx = context.TODO()
+		}
+		res, err = rx.Upload(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+		if err := googleapi.CheckResponse(res); err != nil {
+			return nil, err
+		}
+	}
+	if c.m.Response == nil {
+		return nil, nil
+	}
+	var ret map[string]interface{}
+	if err := gensupport.DecodeResponse(&ret, res); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Download fetches the API endpoint's "media" value, instead of the normal
+// API response value. If the returned error is nil, the Response is
+// guaranteed to have a 2xx status code. Callers must close the Response.Body
+// as usual.
+func (c *Call) Download(opts ...googleapi.CallOption) (*http.Response, error) {
+	if c.err == nil && !c.m.SupportsMediaDownload {
+		return nil, fmt.Errorf("dynamic: method %q does not support media download", c.m.ID)
+	}
+	gensupport.SetOptions(c.urlParams, opts...)
+	res, err := c.doRequest("media")
+	if err != nil {
+		return nil, err
+	}
+	if err := googleapi.CheckMediaResponse(res); err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	return res, nil
+}
+
+// Pages invokes f for each page of results, starting with the page given by
+// the "pageToken" parameter, if any. A non-nil error returned from f will
+// halt the iteration. The provided context supersedes any context provided
+// to the Context method. The method must have a "pageToken" parameter, and
+// its response a "nextPageToken" property.
+func (c *Call) Pages(ctx context.Context, f func(map[string]interface{}) error) error {
+	if c.err == nil && !c.paged() {
+		return fmt.Errorf("dynamic: method %q does not support paging", c.m.ID)
+	}
+	c.ctx_ = ctx
+	defer c.urlParams.SetMulti("pageToken", c.urlParams["pageToken"]) // reset paging to original point
+	for {
+		x, err := c.Do()
+		if err != nil {
+			return err
+		}
+		if err := f(x); err != nil {
+			return err
+		}
+		next, _ := x["nextPageToken"].(string)
+		if next == "" {
+			return nil
+		}
+		c.urlParams.Set("pageToken", next)
+	}
+}
+
+// paged reports whether the method of c returns results in pages.
+func (c *Call) paged() bool {
+	hasToken := false
+	for _, p := range c.m.Parameters {
+		if p.Name == "pageToken" {
+			hasToken = true
+		}
+	}
+	if !hasToken || c.m.Response == nil {
+		return false
+	}
+	resp := c.m.Response
+	if resp.RefSchema != nil {
+		resp = resp.RefSchema
+	}
+	for _, p := range resp.Properties {
+		if p.Name == "nextPageToken" {
+			return true
+		}
+	}
+	return false
+}
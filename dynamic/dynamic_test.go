@@ -0,0 +1,228 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dynamic
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// newTestService returns a Service for testdata/example-api.json whose
+// requests are handled by h.
+func newTestService(t *testing.T, h http.HandlerFunc) (*Service, func()) {
+	srv := httptest.NewServer(h)
+	doc, err := ioutil.ReadFile("testdata/example-api.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewService(context.Background(), doc, option.WithEndpoint(srv.URL+"/example/v1/"), option.WithoutAuthentication())
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	return s, srv.Close
+}
+
+func TestMethods(t *testing.T) {
+	s, done := newTestService(t, nil)
+	defer done()
+	want := []string{"example.items.delete", "example.items.get", "example.items.insert", "example.items.list"}
+	if got := s.Methods(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Methods() = %q, want %q", got, want)
+	}
+	if s.Name() != "example" || s.Version() != "v1" {
+		t.Errorf("got name %q, version %q, want example, v1", s.Name(), s.Version())
+	}
+}
+
+func TestDo(t *testing.T) {
+	var gotURL string
+	s, done := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		gotURL = r.URL.String()
+		w.Write([]byte(`{"name": "a/b", "size": "3"}`))
+	})
+	defer done()
+	got, err := s.NewCall("example.items.get", map[string]interface{}{
+		"name":    "a/b",
+		"tags":    []string{"x", "y"},
+		"verbose": true,
+		"fields":  "name",
+	}, nil).Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"name": "a/b", "size": "3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if want := "/example/v1/items/a/b?alt=json&fields=name&prettyPrint=false&tags=x&tags=y&verbose=true"; gotURL != want {
+		t.Errorf("got URL %s, want %s", gotURL, want)
+	}
+}
+
+func TestDoBody(t *testing.T) {
+	var gotMethod, gotBody string
+	s, done := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		gotMethod = r.Method
+		b, _ := ioutil.ReadAll(r.Body)
+		gotBody = string(b)
+		w.Write(b)
+	})
+	defer done()
+	for _, body := range []interface{}{
+		map[string]interface{}{"name": "n"},
+		[]byte(`{"name":"n"}`),
+		json.RawMessage(`{"name":"n"}`),
+	} {
+		got, err := s.NewCall("example.items.insert", nil, body).Do()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gotMethod != "POST" || strings.TrimSpace(gotBody) != `{"name":"n"}` {
+			t.Errorf("%T: got request %s %s", body, gotMethod, gotBody)
+		}
+		if got["name"] != "n" {
+			t.Errorf("%T: got response %v", body, got)
+		}
+	}
+
+	// Methods without responses return nil.
+	got, err := s.NewCall("example.items.delete", map[string]interface{}{"name": "n"}, nil).Do()
+	if err != nil || got != nil {
+		t.Errorf("delete: got %v, %v, want nil, nil", got, err)
+	}
+	if gotMethod != "DELETE" {
+		t.Errorf("delete: got method %s", gotMethod)
+	}
+}
+
+func TestCallErrors(t *testing.T) {
+	s, done := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s", r.URL)
+	})
+	defer done()
+	for _, test := range []struct {
+		id     string
+		params map[string]interface{}
+		body   interface{}
+		want   string
+	}{
+		{"example.items.nope", nil, nil, `dynamic: unknown method "example.items.nope"`},
+		{"example.items.get", map[string]interface{}{}, nil, `dynamic: missing required parameter "name" of method "example.items.get"`},
+		{"example.items.get", map[string]interface{}{"name": "n", "color": "red"}, nil, `dynamic: unknown parameter "color" for method "example.items.get"`},
+		{"example.items.get", map[string]interface{}{"name": []string{"a", "b"}}, nil, `dynamic: parameter "name" of method "example.items.get" is not repeated, but has 2 values`},
+		{"example.items.get", map[string]interface{}{"name": "n"}, map[string]interface{}{}, `dynamic: method "example.items.get" takes no request body`},
+	} {
+		_, err := s.NewCall(test.id, test.params, test.body).Do()
+		if err == nil || err.Error() != test.want {
+			t.Errorf("%s %v: got error %v, want %q", test.id, test.params, err, test.want)
+		}
+	}
+	if _, err := s.NewCall("example.items.list", nil, nil).Download(); err == nil {
+		t.Error("Download of example.items.list: got nil error")
+	}
+	if err := s.NewCall("example.items.get", map[string]interface{}{"name": "n"}, nil).Pages(context.Background(), nil); err == nil {
+		t.Error("Pages of example.items.get: got nil error")
+	}
+}
+
+func TestErrorResponse(t *testing.T) {
+	s, done := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error": {"code": 404, "message": "no such item"}}`))
+	})
+	defer done()
+	_, err := s.NewCall("example.items.get", map[string]interface{}{"name": "n"}, nil).Do()
+	if e, ok := err.(*googleapi.Error); !ok || e.Code != http.StatusNotFound || e.Message != "no such item" {
+		t.Errorf("got error %#v, want *googleapi.Error with code 404", err)
+	}
+}
+
+func TestPages(t *testing.T) {
+	pages := map[string]string{
+		"":   `{"items": [{"name": "a"}], "nextPageToken": "t1"}`,
+		"t1": `{"items": [{"name": "b"}], "nextPageToken": "t2"}`,
+		"t2": `{"items": [{"name": "c"}]}`,
+	}
+	s, done := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(pages[r.URL.Query().Get("pageToken")]))
+	})
+	defer done()
+	var names []string
+	err := s.NewCall("example.items.list", nil, nil).Pages(context.Background(), func(page map[string]interface{}) error {
+		for _, it := range page["items"].([]interface{}) {
+			names = append(names, it.(map[string]interface{})["name"].(string))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got %q, want %q", names, want)
+	}
+}
+
+func TestMedia(t *testing.T) {
+	var gotURL, gotBody string
+	s, done := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		gotURL = r.URL.String()
+		b, _ := ioutil.ReadAll(r.Body)
+		gotBody = string(b)
+		w.Write([]byte(`{"name": "n"}`))
+	})
+	defer done()
+	call := s.NewCall("example.items.insert", nil, map[string]interface{}{"name": "n"})
+	if _, err := call.Media(strings.NewReader("media data"), googleapi.ContentType("text/plain")).Do(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "/upload/example/v1/items?alt=json&prettyPrint=false&uploadType=multipart"; gotURL != want {
+		t.Errorf("got URL %s, want %s", gotURL, want)
+	}
+	for _, want := range []string{`{"name":"n"}`, "Content-Type: text/plain", "media data"} {
+		if !strings.Contains(gotBody, want) {
+			t.Errorf("upload body does not contain %q:\n%s", want, gotBody)
+		}
+	}
+
+	res, err := s.NewCall("example.items.get", map[string]interface{}{"name": "n"}, nil).Download()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if want := "/example/v1/items/n?alt=media&prettyPrint=false"; gotURL != want {
+		t.Errorf("got download URL %s, want %s", gotURL, want)
+	}
+}
+
+func TestFetchDocument(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/discovery/v1/apis/example/v1/rest" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"name": "example"}`))
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+	doc, err := FetchDocument(ctx, "example", "v1", option.WithEndpoint(srv.URL+"/discovery/v1/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(doc), `{"name": "example"}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if _, err := FetchDocument(ctx, "missing", "v1", option.WithEndpoint(srv.URL+"/discovery/v1/"), option.WithoutAuthentication()); err == nil {
+		t.Error("got nil error for missing document")
+	}
+}
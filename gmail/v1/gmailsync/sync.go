@@ -0,0 +1,281 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gmailsync keeps a local mirror of a mailbox up to date with the
+// history listed by the gmail/v1 package.
+//
+// A Syncer lists the history of the mailbox since the history ID saved in a
+// cursor.Store, calls a function with an Event for each change, and saves
+// the history ID of the next sync. The first sync, and a sync whose history
+// ID is too old, lists all the messages instead, after a Reset event.
+//
+//	s := &gmailsync.Syncer{Service: svc, Store: store, LabelID: "INBOX"}
+//	err := s.Run(ctx, time.Minute, func(e gmailsync.Event) error {
+//		switch e.Type {
+//		case gmailsync.Reset:
+//			// Discard the mirror.
+//		case gmailsync.MessageAdded:
+//			// Get e.MessageID and add it to the mirror.
+//		case gmailsync.MessageDeleted:
+//			// Remove e.MessageID from the mirror.
+//		}
+//		return nil
+//	})
+//
+// This is an EXPERIMENTAL API and may be changed or removed in the future.
+package gmailsync
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	gmail "google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/support/cursor"
+)
+
+// An EventType is the type of an Event.
+type EventType int
+
+const (
+	// Reset means that the mirror must be discarded: it is followed by a
+	// MessageAdded event for each message.
+	Reset EventType = iota
+
+	// MessageAdded means that a message was added to the mailbox.
+	MessageAdded
+
+	// MessageDeleted means that a message was deleted from the mailbox.
+	MessageDeleted
+
+	// LabelsAdded means that labels were added to a message.
+	LabelsAdded
+
+	// LabelsRemoved means that labels were removed from a message.
+	LabelsRemoved
+)
+
+var eventTypeNames = []string{"Reset", "MessageAdded", "MessageDeleted", "LabelsAdded", "LabelsRemoved"}
+
+func (t EventType) String() string {
+	if t < 0 || int(t) >= len(eventTypeNames) {
+		return fmt.Sprintf("EventType(%d)", int(t))
+	}
+	return eventTypeNames[t]
+}
+
+// An Event is a change of a message of a mailbox.
+type Event struct {
+	Type EventType
+
+	// MessageID and ThreadID are the IDs of the message and of its thread.
+	MessageID string
+	ThreadID  string
+
+	// Message is the message as listed, with only its IDs and, except for
+	// the events of a full sync, its labels. The message can be got with
+	// UsersMessagesService.Get.
+	Message *gmail.Message
+
+	// LabelIDs are the IDs of the labels added or removed by LabelsAdded and
+	// LabelsRemoved events.
+	LabelIDs []string
+
+	// HistoryID is the ID of the history record of the event. It is zero for
+	// the events of a full sync.
+	HistoryID uint64
+}
+
+// A Syncer syncs the changes of the messages of a mailbox.
+type Syncer struct {
+	// Service is the service used to list history and messages.
+	Service *gmail.Service
+
+	// Store stores the history ID of the next sync.
+	Store cursor.Store
+
+	// Key is the key of the history ID in Store. It defaults to
+	// "gmail/history/" followed by UserID and, if it is not empty, by "/"
+	// and LabelID.
+	Key string
+
+	// UserID is the ID of the user whose mailbox is synced. It defaults to
+	// "me", the authenticated user.
+	UserID string
+
+	// LabelID limits the sync to the messages with the label, such as
+	// "INBOX".
+	LabelID string
+
+	// HistoryTypes limit the changes listed to those of the given types,
+	// such as "messageAdded". All the changes are listed by default.
+	HistoryTypes []string
+
+	// PageSize is the maximum number of history records or messages listed
+	// per page. If it is zero, the API default is used.
+	PageSize int64
+}
+
+func (s *Syncer) userID() string {
+	if s.UserID == "" {
+		return "me"
+	}
+	return s.UserID
+}
+
+func (s *Syncer) key() string {
+	if s.Key != "" {
+		return s.Key
+	}
+	k := "gmail/history/" + s.userID()
+	if s.LabelID != "" {
+		k += "/" + s.LabelID
+	}
+	return k
+}
+
+func (s *Syncer) save(ctx context.Context, historyID uint64) error {
+	return s.Store.Save(ctx, s.key(), strconv.FormatUint(historyID, 10))
+}
+
+// expired reports whether err means that a history ID is too old.
+func expired(err error) bool {
+	e, ok := err.(*googleapi.Error)
+	return ok && e.Code == http.StatusNotFound
+}
+
+// Sync lists the history of the mailbox since the last sync, and calls fn
+// with an event for each change. If there was no previous sync, or its
+// history ID is too old, Sync calls fn with a Reset event, then with a
+// MessageAdded event for each message.
+//
+// Sync saves the history ID of the next sync after each page of history,
+// once fn has returned for each of its events. If fn returns an error, Sync
+// stops and returns it, and the next sync lists the changes of the page
+// again.
+func (s *Syncer) Sync(ctx context.Context, fn func(Event) error) error {
+	return cursor.Sync(ctx, s.Store, s.key(), func(c string) error {
+		historyID, err := strconv.ParseUint(c, 10, 64)
+		if err != nil {
+			return fmt.Errorf("gmailsync: invalid history ID %q", c)
+		}
+		return s.history(ctx, historyID, fn)
+	}, func() error {
+		return s.full(ctx, fn)
+	}, expired)
+}
+
+// history lists the history since historyID.
+func (s *Syncer) history(ctx context.Context, historyID uint64, fn func(Event) error) error {
+	call := s.Service.Users.History.List(s.userID()).StartHistoryId(historyID)
+	if s.LabelID != "" {
+		call.LabelId(s.LabelID)
+	}
+	if len(s.HistoryTypes) > 0 {
+		call.HistoryTypes(s.HistoryTypes...)
+	}
+	if s.PageSize > 0 {
+		call.MaxResults(s.PageSize)
+	}
+	return call.Pages(ctx, func(res *gmail.ListHistoryResponse) error {
+		for _, h := range res.History {
+			for _, e := range historyEvents(h) {
+				if err := fn(e); err != nil {
+					return err
+				}
+			}
+		}
+		// The records are in chronological order: the last one is where
+		// the next sync starts, until the last page gives the current
+		// history ID.
+		next := res.HistoryId
+		if res.NextPageToken != "" || next == 0 {
+			if len(res.History) == 0 {
+				return nil
+			}
+			next = res.History[len(res.History)-1].Id
+		}
+		return s.save(ctx, next)
+	})
+}
+
+// historyEvents returns the events of a history record.
+func historyEvents(h *gmail.History) []Event {
+	var es []Event
+	add := func(t EventType, m *gmail.Message, labelIDs []string) {
+		if m == nil {
+			return
+		}
+		es = append(es, Event{Type: t, MessageID: m.Id, ThreadID: m.ThreadId, Message: m, LabelIDs: labelIDs, HistoryID: h.Id})
+	}
+	for _, a := range h.MessagesAdded {
+		add(MessageAdded, a.Message, nil)
+	}
+	for _, a := range h.LabelsAdded {
+		add(LabelsAdded, a.Message, a.LabelIds)
+	}
+	for _, r := range h.LabelsRemoved {
+		add(LabelsRemoved, r.Message, r.LabelIds)
+	}
+	for _, d := range h.MessagesDeleted {
+		add(MessageDeleted, d.Message, nil)
+	}
+	return es
+}
+
+// full lists all the messages. The history ID of the next sync is got
+// first, so that the next sync lists the changes made during the listing.
+func (s *Syncer) full(ctx context.Context, fn func(Event) error) error {
+	profile, err := s.Service.Users.GetProfile(s.userID()).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	if err := fn(Event{Type: Reset}); err != nil {
+		return err
+	}
+	call := s.Service.Users.Messages.List(s.userID())
+	if s.LabelID != "" {
+		call.LabelIds(s.LabelID)
+	}
+	if s.PageSize > 0 {
+		call.MaxResults(s.PageSize)
+	}
+	err = call.Pages(ctx, func(res *gmail.ListMessagesResponse) error {
+		for _, m := range res.Messages {
+			if err := fn(Event{Type: MessageAdded, MessageID: m.Id, ThreadID: m.ThreadId, Message: m}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.save(ctx, profile.HistoryId)
+}
+
+// Run syncs every interval until ctx is done or a sync fails, and returns
+// the error. A sync that fails with a transient error of the API is retried,
+// as described by cursor.Run.
+func (s *Syncer) Run(ctx context.Context, interval time.Duration, fn func(Event) error) error {
+	return cursor.Run(ctx, interval, func() error {
+		return s.Sync(ctx, fn)
+	})
+}
+
+// Stream is like Run, but sends the events to ch. A page of history is
+// considered handled once its events have been received from ch.
+func (s *Syncer) Stream(ctx context.Context, interval time.Duration, ch chan<- Event) error {
+	return s.Run(ctx, interval, func(e Event) error {
+		select {
+		case ch <- e:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
@@ -0,0 +1,178 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gmailsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	gmail "google.golang.org/api/gmail/v1"
+	"google.golang.org/api/option"
+	"google.golang.org/api/support/cursor"
+)
+
+// fakeGmail serves the history and messages of a mailbox.
+func fakeGmail(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/gmail/v1/users/me/profile":
+			fmt.Fprint(w, `{"emailAddress": "me@example.com", "historyId": "100"}`)
+		case "/gmail/v1/users/me/messages":
+			if q.Get("labelIds") != "INBOX" || q.Get("maxResults") != "2" {
+				t.Errorf("got query %v", q)
+			}
+			switch q.Get("pageToken") {
+			case "":
+				fmt.Fprint(w, `{"nextPageToken": "p2", "messages": [{"id": "m1", "threadId": "t1"}, {"id": "m2", "threadId": "t1"}]}`)
+			case "p2":
+				fmt.Fprint(w, `{"messages": [{"id": "m3", "threadId": "t3"}]}`)
+			default:
+				t.Errorf("got message list page token %q", q.Get("pageToken"))
+			}
+		case "/gmail/v1/users/me/history":
+			if q.Get("labelId") != "INBOX" || q.Get("maxResults") != "2" {
+				t.Errorf("got query %v", q)
+			}
+			switch start, page := q.Get("startHistoryId"), q.Get("pageToken"); {
+			case start == "100" && page == "":
+				fmt.Fprint(w, `{"historyId": "105", "nextPageToken": "h2", "history": [
+					{"id": "101", "messagesAdded": [{"message": {"id": "m4", "threadId": "t4", "labelIds": ["INBOX"]}}]},
+					{"id": "102", "labelsAdded": [{"message": {"id": "m1", "threadId": "t1"}, "labelIds": ["STARRED"]}]}
+				]}`)
+			case start == "100" && page == "h2":
+				fmt.Fprint(w, `{"historyId": "105", "history": [
+					{"id": "104",
+					 "labelsRemoved": [{"message": {"id": "m2", "threadId": "t1"}, "labelIds": ["UNREAD"]}],
+					 "messagesDeleted": [{"message": {"id": "m3", "threadId": "t3"}}]}
+				]}`)
+			case start == "102" || start == "105":
+				fmt.Fprint(w, `{"historyId": "105"}`)
+			default:
+				http.Error(w, `{"error": {"code": 404, "message": "Requested entity was not found."}}`, http.StatusNotFound)
+			}
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			http.Error(w, "unexpected", http.StatusBadRequest)
+		}
+	}))
+}
+
+// summary summarizes an event for comparisons.
+func summary(e Event) string {
+	s := []string{e.Type.String()}
+	if e.MessageID != "" {
+		s = append(s, e.MessageID, e.ThreadID)
+	}
+	s = append(s, e.LabelIDs...)
+	if e.HistoryID != 0 {
+		s = append(s, fmt.Sprint(e.HistoryID))
+	}
+	return strings.Join(s, " ")
+}
+
+func newService(t *testing.T, srv *httptest.Server) *gmail.Service {
+	svc, err := gmail.NewService(context.Background(), option.WithHTTPClient(http.DefaultClient), option.WithEndpoint(srv.URL+"/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc
+}
+
+func TestSync(t *testing.T) {
+	srv := fakeGmail(t)
+	defer srv.Close()
+	ctx := context.Background()
+	store := cursor.NewMemoryStore()
+	s := &Syncer{Service: newService(t, srv), Store: store, LabelID: "INBOX", PageSize: 2}
+
+	full := []string{"Reset", "MessageAdded m1 t1", "MessageAdded m2 t1", "MessageAdded m3 t3"}
+	for _, test := range []struct {
+		cursor string // if not empty, saved before the sync
+		want   []string
+	}{
+		{"", full},
+		{"", []string{
+			"MessageAdded m4 t4 101",
+			"LabelsAdded m1 t1 STARRED 102",
+			"LabelsRemoved m2 t1 UNREAD 104",
+			"MessageDeleted m3 t3 104",
+		}},
+		{"", nil},
+		{"5", full},
+	} {
+		if test.cursor != "" {
+			if err := store.Save(ctx, "gmail/history/me/INBOX", test.cursor); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var got []string
+		if err := s.Sync(ctx, func(e Event) error {
+			got = append(got, summary(e))
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("events mismatch (-want +got):\n%s", diff)
+		}
+	}
+	if c, _ := store.Load(ctx, "gmail/history/me/INBOX"); c != "100" {
+		t.Errorf("got cursor %q, want 100", c)
+	}
+
+	// A failing handler stops the sync after the last saved page.
+	errStop := errors.New("stop")
+	n := 0
+	err := s.Sync(ctx, func(e Event) error {
+		n++
+		if n == 3 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop {
+		t.Fatalf("got error %v, want %v", err, errStop)
+	}
+	if c, _ := store.Load(ctx, "gmail/history/me/INBOX"); c != "102" {
+		t.Errorf("got cursor %q, want 102", c)
+	}
+
+	if err := store.Save(ctx, "gmail/history/me/INBOX", "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Sync(ctx, func(Event) error { return nil }); err == nil {
+		t.Error("got nil error for an invalid cursor")
+	}
+}
+
+func TestStream(t *testing.T) {
+	srv := fakeGmail(t)
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := &Syncer{Service: newService(t, srv), Store: cursor.NewMemoryStore(), LabelID: "INBOX", PageSize: 2}
+	ch := make(chan Event)
+	done := make(chan error, 1)
+	go func() { done <- s.Stream(ctx, time.Millisecond, ch) }()
+	var got []string
+	for len(got) < 8 {
+		got = append(got, summary(<-ch))
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+	if got[0] != "Reset" || got[7] != "MessageDeleted m3 t3 104" {
+		t.Errorf("got events %q", got)
+	}
+}
@@ -0,0 +1,300 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mailmsg
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ownHeaders are the headers that are built from the fields of a Message,
+// and are ignored in its Header when it is built.
+var ownHeaders = map[string]bool{
+	"From":         true,
+	"Reply-To":     true,
+	"To":           true,
+	"Cc":           true,
+	"Bcc":          true,
+	"Subject":      true,
+	"Date":         true,
+	"Message-Id":   true,
+	"In-Reply-To":  true,
+	"References":   true,
+	"Mime-Version": true,
+}
+
+// An entity is a MIME entity of a message being built: either a leaf with an
+// encoded body, or a multipart entity with parts.
+type entity struct {
+	header   textproto.MIMEHeader
+	body     []byte
+	parts    []*entity
+	boundary string
+}
+
+// multipartEntity returns a multipart entity of the given subtype with the
+// given parts, or the part itself if there is only one.
+func multipartEntity(subtype string, parts ...*entity) *entity {
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	b := multipart.NewWriter(ioutil.Discard).Boundary()
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", mime.FormatMediaType("multipart/"+subtype, map[string]string{"boundary": b}))
+	return &entity{header: h, parts: parts, boundary: b}
+}
+
+// textEntity returns a quoted-printable text entity of the given subtype.
+func textEntity(subtype, text string) (*entity, error) {
+	var buf bytes.Buffer
+	w := quotedprintable.NewWriter(&buf)
+	if _, err := io.WriteString(w, text); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", mime.FormatMediaType("text/"+subtype, map[string]string{"charset": "UTF-8"}))
+	h.Set("Content-Transfer-Encoding", "quoted-printable")
+	return &entity{header: h, body: buf.Bytes()}, nil
+}
+
+// attachmentEntity returns a base64 entity with the data of a, with the given
+// disposition.
+func attachmentEntity(a *Attachment, disposition string) (*entity, error) {
+	ct := a.ContentType
+	if ct == "" {
+		ct = mime.TypeByExtension(path.Ext(a.Filename))
+	}
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+	mediaType, params, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return nil, fmt.Errorf("mailmsg: attachment %q: %v", a.Filename, err)
+	}
+	dparams := map[string]string{}
+	if a.Filename != "" {
+		name := mime.QEncoding.Encode("utf-8", a.Filename)
+		params["name"] = name
+		dparams["filename"] = name
+	}
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", mime.FormatMediaType(mediaType, params))
+	h.Set("Content-Disposition", mime.FormatMediaType(disposition, dparams))
+	h.Set("Content-Transfer-Encoding", "base64")
+	if a.ContentID != "" {
+		if err := checkHeader("Content-ID", a.ContentID); err != nil {
+			return nil, err
+		}
+		h.Set("Content-ID", angleAddr(a.ContentID))
+	}
+	return &entity{header: h, body: encodeBase64Lines(a.Data)}, nil
+}
+
+// encodeBase64Lines encodes data in base64 with lines of 76 characters.
+func encodeBase64Lines(data []byte) []byte {
+	enc := base64.StdEncoding.EncodeToString(data)
+	var buf bytes.Buffer
+	for len(enc) > 76 {
+		buf.WriteString(enc[:76])
+		buf.WriteString("\r\n")
+		enc = enc[76:]
+	}
+	buf.WriteString(enc)
+	return buf.Bytes()
+}
+
+// writeHeader writes the header h, in the order of its keys.
+func writeHeader(w io.Writer, h textproto.MIMEHeader) error {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range h[k] {
+			if _, err := fmt.Fprintf(w, "%s: %s\r\n", k, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeBody writes the body of e, after its header.
+func (e *entity) writeBody(w io.Writer) error {
+	if e.parts == nil {
+		_, err := w.Write(e.body)
+		return err
+	}
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(e.boundary); err != nil {
+		return err
+	}
+	for _, p := range e.parts {
+		pw, err := mw.CreatePart(p.header)
+		if err != nil {
+			return err
+		}
+		if err := p.writeBody(pw); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+// body returns the entity of the body of m, with its alternatives, inline
+// files and attachments.
+func (m *Message) body() (*entity, error) {
+	var alternatives []*entity
+	if m.Text != "" || m.HTML == "" {
+		e, err := textEntity("plain", m.Text)
+		if err != nil {
+			return nil, err
+		}
+		alternatives = append(alternatives, e)
+	}
+	if m.HTML != "" {
+		e, err := textEntity("html", m.HTML)
+		if err != nil {
+			return nil, err
+		}
+		alternatives = append(alternatives, e)
+	}
+	body := multipartEntity("alternative", alternatives...)
+	if len(m.Inline) > 0 {
+		related := []*entity{body}
+		for _, a := range m.Inline {
+			e, err := attachmentEntity(a, "inline")
+			if err != nil {
+				return nil, err
+			}
+			related = append(related, e)
+		}
+		body = multipartEntity("related", related...)
+	}
+	if len(m.Attachments) > 0 {
+		mixed := []*entity{body}
+		for _, a := range m.Attachments {
+			e, err := attachmentEntity(a, "attachment")
+			if err != nil {
+				return nil, err
+			}
+			mixed = append(mixed, e)
+		}
+		body = multipartEntity("mixed", mixed...)
+	}
+	return body, nil
+}
+
+// checkHeader returns an error if the name of a header is invalid, or its
+// value has line breaks, which would let it add headers or end the header of
+// the message.
+func checkHeader(name, value string) error {
+	if name == "" || strings.ContainsAny(name, ": \t\r\n") {
+		return fmt.Errorf("mailmsg: invalid header name %q", name)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("mailmsg: %s header has a line break", name)
+	}
+	return nil
+}
+
+// angleAddr returns id enclosed in angle brackets, if it is not already.
+func angleAddr(id string) string {
+	if strings.HasPrefix(id, "<") && strings.HasSuffix(id, ">") {
+		return id
+	}
+	return "<" + id + ">"
+}
+
+func formatAddresses(as []*mail.Address) string {
+	s := make([]string, len(as))
+	for i, a := range as {
+		s[i] = a.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+// Bytes returns m as an RFC 2822 message.
+func (m *Message) Bytes() ([]byte, error) {
+	type header struct{ name, value string }
+	var hs []header
+	add := func(name, value string) {
+		if value != "" {
+			hs = append(hs, header{name, value})
+		}
+	}
+	if m.From != nil {
+		add("From", m.From.String())
+	}
+	add("Reply-To", formatAddresses(m.ReplyTo))
+	add("To", formatAddresses(m.To))
+	add("Cc", formatAddresses(m.Cc))
+	add("Bcc", formatAddresses(m.Bcc))
+	add("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	if !m.Date.IsZero() {
+		add("Date", m.Date.Format(time.RFC1123Z))
+	}
+	if m.MessageID != "" {
+		add("Message-ID", angleAddr(m.MessageID))
+	}
+	if m.InReplyTo != "" {
+		add("In-Reply-To", angleAddr(m.InReplyTo))
+	}
+	refs := make([]string, len(m.References))
+	for i, r := range m.References {
+		refs[i] = angleAddr(r)
+	}
+	add("References", strings.Join(refs, " "))
+	var keys []string
+	for k := range m.Header {
+		ck := textproto.CanonicalMIMEHeaderKey(k)
+		if !ownHeaders[ck] && !strings.HasPrefix(ck, "Content-") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range m.Header[k] {
+			add(textproto.CanonicalMIMEHeaderKey(k), v)
+		}
+	}
+	add("MIME-Version", "1.0")
+
+	var buf bytes.Buffer
+	for _, h := range hs {
+		if err := checkHeader(h.name, h.value); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, "%s: %s\r\n", h.name, h.value)
+	}
+	body, err := m.body()
+	if err != nil {
+		return nil, err
+	}
+	if err := writeHeader(&buf, body.header); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\r\n")
+	if err := body.writeBody(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,210 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package mailmsg builds and parses the email messages of the gmail/v1
+// package.
+//
+// A Message holds the headers, text and HTML bodies, attachments and inline
+// images of an email. Its Bytes method builds the RFC 2822 message that
+// UsersMessagesService.Send expects, either in the Raw field of a
+// gmail.Message, as returned by Encode, or as a media upload, as done by
+// Send. Parse converts a gmail.Message returned with the "full" or "raw"
+// format into a Message, and Fetch downloads the attachments that were not
+// included in it.
+//
+//	m := &mailmsg.Message{
+//		From:    &mail.Address{Name: "Gopher", Address: "gopher@example.com"},
+//		To:      []*mail.Address{{Address: "friend@example.com"}},
+//		Subject: "Hello",
+//		Text:    "Hello, world!",
+//		HTML:    "<p>Hello, <b>world</b>!</p>",
+//	}
+//	sent, err := mailmsg.Send(ctx, svc, "me", m)
+//	...
+//	msg, err := svc.Users.Messages.Get("me", id).Format("full").Do()
+//	...
+//	m, err = mailmsg.Parse(msg)
+//
+// This is an EXPERIMENTAL API and may be changed or removed in the future.
+package mailmsg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	gmail "google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// A Message is an email message.
+type Message struct {
+	// ID, ThreadID, LabelIDs and Snippet are those of the gmail.Message
+	// the Message was parsed from. Only ThreadID is used when building a
+	// message: it adds the message to the thread, which also requires the
+	// InReplyTo, References and Subject fields to match the thread.
+	ID       string
+	ThreadID string
+	LabelIDs []string
+	Snippet  string
+
+	From    *mail.Address
+	ReplyTo []*mail.Address
+	To      []*mail.Address
+	Cc      []*mail.Address
+	Bcc     []*mail.Address
+	Subject string
+
+	// Date is the date of the message. The Date header is omitted if it is
+	// zero, and the message gets the time it is sent.
+	Date time.Time
+
+	// MessageID, InReplyTo and References are message IDs, with or without
+	// their angle brackets, that link replies to the messages they reply to.
+	MessageID  string
+	InReplyTo  string
+	References []string
+
+	// Header holds the other headers of a message being built, and all the
+	// headers of a parsed message, with their values as they appear in the
+	// message. When building, headers that have a field of their own, and
+	// the Content-* and MIME-Version headers, are ignored.
+	Header textproto.MIMEHeader
+
+	// Text and HTML are the plain text and HTML bodies. A message with both
+	// lets the reader choose one of them. The line breaks of parsed bodies
+	// are "\n".
+	Text string
+	HTML string
+
+	// Attachments are the files attached to the message, and Inline the
+	// files, such as images, that the HTML body refers to by their content
+	// ID, as in <img src="cid:logo">.
+	Attachments []*Attachment
+	Inline      []*Attachment
+}
+
+// An Attachment is a file attached to a message.
+type Attachment struct {
+	// Filename is the name of the file.
+	Filename string
+
+	// ContentType is the MIME type of the file. If it is empty, it is
+	// guessed from the extension of the file name, and defaults to
+	// application/octet-stream.
+	ContentType string
+
+	// ContentID is the content ID of an inline file, without its angle
+	// brackets.
+	ContentID string
+
+	// Data is the content of the file. It is nil for the attachments of a
+	// parsed message that are stored apart from the message until they are
+	// fetched by Fetch.
+	Data []byte
+
+	// AttachmentID, PartID and Size are those of the attachments of a
+	// message parsed from the "full" format.
+	AttachmentID string
+	PartID       string
+	Size         int64
+}
+
+// Reply returns a message that replies to m in the same thread, with the
+// subject and threading headers set. It is sent to the Reply-To addresses of
+// m, or else to its sender.
+func (m *Message) Reply() *Message {
+	r := &Message{
+		ThreadID:  m.ThreadID,
+		Subject:   m.Subject,
+		InReplyTo: m.MessageID,
+	}
+	if !strings.HasPrefix(strings.ToLower(r.Subject), "re:") {
+		r.Subject = "Re: " + r.Subject
+	}
+	r.References = append(r.References, m.References...)
+	if m.MessageID != "" {
+		r.References = append(r.References, m.MessageID)
+	}
+	if len(m.ReplyTo) > 0 {
+		r.To = append(r.To, m.ReplyTo...)
+	} else if m.From != nil {
+		r.To = []*mail.Address{m.From}
+	}
+	return r
+}
+
+// Encode returns the gmail.Message that holds m in its Raw field, for use
+// with UsersMessagesService.Send, Insert and Import, and with drafts.
+func (m *Message) Encode() (*gmail.Message, error) {
+	b, err := m.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return &gmail.Message{Raw: encodeBase64URL(b), ThreadId: m.ThreadID}, nil
+}
+
+// Send sends m on behalf of the user with the given ID, or "me" for the
+// authenticated user. Unlike the Raw field of a gmail.Message, the media
+// upload used by Send does not grow the message by a third, and allows
+// messages up to the size limit of the API.
+func Send(ctx context.Context, svc *gmail.Service, userID string, m *Message) (*gmail.Message, error) {
+	b, err := m.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return svc.Users.Messages.Send(userID, &gmail.Message{ThreadId: m.ThreadID}).
+		Media(bytes.NewReader(b), googleapi.ContentType("message/rfc822")).
+		Context(ctx).
+		Do()
+}
+
+// Get gets the message with the given ID in the "full" format, and parses
+// it. The attachments that are stored apart from the message can then be
+// fetched by Fetch.
+func Get(ctx context.Context, svc *gmail.Service, userID, id string) (*Message, error) {
+	msg, err := svc.Users.Messages.Get(userID, id).Format("full").Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	return Parse(msg)
+}
+
+// Fetch fetches the data of the attachments and inline files of m that are
+// stored apart from it.
+func Fetch(ctx context.Context, svc *gmail.Service, userID string, m *Message) error {
+	for _, as := range [][]*Attachment{m.Attachments, m.Inline} {
+		for _, a := range as {
+			if a.Data != nil || a.AttachmentID == "" {
+				continue
+			}
+			if err := FetchAttachment(ctx, svc, userID, m.ID, a); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// FetchAttachment fetches the data of the attachment a of the message with
+// the given ID.
+func FetchAttachment(ctx context.Context, svc *gmail.Service, userID, messageID string, a *Attachment) error {
+	body, err := svc.Users.Messages.Attachments.Get(userID, messageID, a.AttachmentID).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	data, err := decodeBase64URL(body.Data)
+	if err != nil {
+		return fmt.Errorf("mailmsg: decoding attachment %s: %v", a.AttachmentID, err)
+	}
+	a.Data = data
+	if a.Size == 0 {
+		a.Size = int64(len(data))
+	}
+	return nil
+}
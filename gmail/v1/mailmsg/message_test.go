@@ -0,0 +1,371 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mailmsg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	gmail "google.golang.org/api/gmail/v1"
+	"google.golang.org/api/option"
+)
+
+func testMessage() *Message {
+	return &Message{
+		ThreadID:   "t1",
+		From:       &mail.Address{Name: "Göpher", Address: "gopher@example.com"},
+		ReplyTo:    []*mail.Address{{Address: "replies@example.com"}},
+		To:         []*mail.Address{{Name: "A", Address: "a@example.com"}, {Address: "b@example.com"}},
+		Cc:         []*mail.Address{{Address: "c@example.com"}},
+		Bcc:        []*mail.Address{{Address: "d@example.com"}},
+		Subject:    "Grüße, world",
+		Date:       time.Date(2020, 5, 1, 12, 30, 0, 0, time.FixedZone("", 2*3600)),
+		MessageID:  "m2@example.com",
+		InReplyTo:  "<m1@example.com>",
+		References: []string{"<m0@example.com>", "m1@example.com"},
+		Header:     textproto.MIMEHeader{"X-Mailer": {"mailmsg"}, "Subject": {"ignored"}},
+		Text:       "Hello,\nworld! " + strings.Repeat("long line ", 20),
+		HTML:       `<p>Hello, <img src="cid:logo"></p>`,
+		Attachments: []*Attachment{
+			{Filename: "notes.txt", Data: []byte("some notes\n")},
+			{Filename: "résumé.bin", ContentType: "application/x-custom", Data: bytes.Repeat([]byte{0, 1, 2, 255}, 100)},
+		},
+		Inline: []*Attachment{
+			{Filename: "logo.png", ContentID: "logo", Data: []byte("\x89PNG...")},
+		},
+	}
+}
+
+func TestBuildParseRaw(t *testing.T) {
+	m := testMessage()
+	msg, err := m.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.ThreadId != "t1" {
+		t.Errorf("got thread ID %q, want t1", msg.ThreadId)
+	}
+	raw, err := decodeBase64URL(msg.Raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Bcc: <d@example.com>\r\n",
+		"Subject: =?utf-8?q?Gr=C3=BC=C3=9Fe,_world?=\r\n",
+		"Date: Fri, 01 May 2020 12:30:00 +0200\r\n",
+		"Message-ID: <m2@example.com>\r\n",
+		"References: <m0@example.com> <m1@example.com>\r\n",
+		"X-Mailer: mailmsg\r\n",
+		"MIME-Version: 1.0\r\n",
+		"Content-Type: multipart/mixed;",
+	} {
+		if !bytes.Contains(raw, []byte(want)) {
+			t.Errorf("raw message does not contain %q:\n%s", want, raw)
+		}
+	}
+	if bytes.Contains(raw, []byte("ignored")) {
+		t.Errorf("raw message contains a Subject header from Header:\n%s", raw)
+	}
+	for _, line := range strings.Split(string(raw), "\r\n") {
+		if len(line) > 78 && !strings.Contains(line, "boundary=") {
+			t.Errorf("line longer than 78 characters: %q", line)
+		}
+	}
+
+	got, err := Parse(&gmail.Message{Id: "m", ThreadId: "t1", Raw: msg.Raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := testMessage()
+	want.ID = "m"
+	want.MessageID = "<m2@example.com>"
+	want.References[1] = "<m1@example.com>"
+	want.Attachments[0].ContentType = "text/plain"
+	for _, a := range append(want.Attachments, want.Inline...) {
+		a.Size = int64(len(a.Data))
+	}
+	want.Inline[0].ContentType = "image/png"
+	if diff := cmp.Diff(want, got,
+		cmpopts.IgnoreFields(Message{}, "Header"),
+		cmp.Comparer(func(a, b time.Time) bool { return a.Equal(b) }),
+	); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if got.Header.Get("X-Mailer") != "mailmsg" {
+		t.Errorf("got header %v", got.Header)
+	}
+}
+
+func TestBuildStructure(t *testing.T) {
+	for _, test := range []struct {
+		m    *Message
+		want string
+	}{
+		{&Message{Subject: "s"}, "text/plain"},
+		{&Message{Subject: "s", HTML: "<p>"}, "text/html"},
+		{&Message{Subject: "s", Text: "t", HTML: "<p>"}, "multipart/alternative"},
+		{&Message{Subject: "s", HTML: "<p>", Inline: []*Attachment{{ContentID: "a"}}}, "multipart/related"},
+		{&Message{Subject: "s", Attachments: []*Attachment{{Filename: "a.pdf"}}}, "multipart/mixed"},
+	} {
+		b, err := test.m.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := mail.ReadMessage(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != test.want {
+			t.Errorf("%+v: got content type %q, %v, want %q", test.m, mediaType, err, test.want)
+		}
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	for _, m := range []*Message{
+		{Subject: "s", MessageID: "a\r\nBcc: evil@example.com"},
+		{Subject: "s", InReplyTo: "a\nb"},
+		{Subject: "s", Header: textproto.MIMEHeader{"X-A": {"a\rb"}}},
+		{Subject: "s", Header: textproto.MIMEHeader{"X A": {"a"}}},
+		{Subject: "s", Inline: []*Attachment{{ContentID: "a\nb"}}},
+		{Subject: "s", Attachments: []*Attachment{{ContentType: "/"}}},
+	} {
+		if _, err := m.Bytes(); err == nil {
+			t.Errorf("%+v: got nil error", m)
+		}
+	}
+}
+
+func TestReply(t *testing.T) {
+	m := &Message{
+		ThreadID:   "t1",
+		From:       &mail.Address{Address: "a@example.com"},
+		Subject:    "Lunch",
+		MessageID:  "<m1@example.com>",
+		References: []string{"<m0@example.com>"},
+	}
+	want := &Message{
+		ThreadID:   "t1",
+		To:         []*mail.Address{{Address: "a@example.com"}},
+		Subject:    "Re: Lunch",
+		InReplyTo:  "<m1@example.com>",
+		References: []string{"<m0@example.com>", "<m1@example.com>"},
+	}
+	got := m.Reply()
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if got := got.Reply().Subject; got != "Re: Lunch" {
+		t.Errorf("got subject %q, want %q", got, "Re: Lunch")
+	}
+	m.ReplyTo = []*mail.Address{{Address: "list@example.com"}}
+	if got := m.Reply().To; len(got) != 1 || got[0].Address != "list@example.com" {
+		t.Errorf("got To %v, want the Reply-To address", got)
+	}
+}
+
+// full is a message as returned with the "full" format.
+const full = `{
+  "id": "m1",
+  "threadId": "t1",
+  "labelIds": ["INBOX", "UNREAD"],
+  "snippet": "Hi there",
+  "payload": {
+    "partId": "",
+    "mimeType": "multipart/mixed",
+    "headers": [
+      {"name": "From", "value": "=?iso-8859-1?q?J=F6rg?= <jorg@example.com>"},
+      {"name": "To", "value": "me@example.com, Other <other@example.com>"},
+      {"name": "Subject", "value": "=?utf-8?q?Caf=C3=A9?="},
+      {"name": "Date", "value": "Fri, 1 May 2020 10:00:00 +0000"},
+      {"name": "Message-ID", "value": "<m1@example.com>"},
+      {"name": "Received", "value": "from a"},
+      {"name": "Received", "value": "from b"}
+    ],
+    "parts": [
+      {
+        "partId": "0",
+        "mimeType": "multipart/related",
+        "parts": [
+          {
+            "partId": "0.0",
+            "mimeType": "multipart/alternative",
+            "parts": [
+              {
+                "partId": "0.0.0",
+                "mimeType": "text/plain",
+                "headers": [{"name": "Content-Type", "value": "text/plain; charset=iso-8859-1"}],
+                "body": {"size": 9, "data": "SGkgdGhlcmUg6Q=="}
+              },
+              {
+                "partId": "0.0.1",
+                "mimeType": "text/html",
+                "headers": [{"name": "Content-Type", "value": "text/html; charset=UTF-8"}],
+                "body": {"size": 20, "data": "PHA-SGkgPGltZyBzcmM9ImNpZDpsb2dvIj48L3A-"}
+              }
+            ]
+          },
+          {
+            "partId": "0.1",
+            "mimeType": "image/png",
+            "filename": "",
+            "headers": [
+              {"name": "Content-Type", "value": "image/png"},
+              {"name": "Content-ID", "value": "<logo>"}
+            ],
+            "body": {"size": 4, "data": "iVBORw"}
+          }
+        ]
+      },
+      {
+        "partId": "1",
+        "mimeType": "application/pdf",
+        "filename": "report.pdf",
+        "headers": [
+          {"name": "Content-Type", "value": "application/pdf; name=\"report.pdf\""},
+          {"name": "Content-Disposition", "value": "attachment; filename=\"report.pdf\""}
+        ],
+        "body": {"attachmentId": "att1", "size": 5}
+      }
+    ]
+  }
+}`
+
+func TestParseFull(t *testing.T) {
+	var msg gmail.Message
+	if err := json.Unmarshal([]byte(full), &msg); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Parse(&msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Message{
+		ID:        "m1",
+		ThreadID:  "t1",
+		LabelIDs:  []string{"INBOX", "UNREAD"},
+		Snippet:   "Hi there",
+		From:      &mail.Address{Name: "Jörg", Address: "jorg@example.com"},
+		To:        []*mail.Address{{Address: "me@example.com"}, {Name: "Other", Address: "other@example.com"}},
+		Subject:   "Café",
+		Date:      time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC),
+		MessageID: "<m1@example.com>",
+		Text:      "Hi there é",
+		HTML:      `<p>Hi <img src="cid:logo"></p>`,
+		Inline: []*Attachment{
+			{ContentType: "image/png", ContentID: "logo", Data: []byte("\x89PNG"), PartID: "0.1", Size: 4},
+		},
+		Attachments: []*Attachment{
+			{Filename: "report.pdf", ContentType: "application/pdf", AttachmentID: "att1", PartID: "1", Size: 5},
+		},
+	}
+	if diff := cmp.Diff(want, got,
+		cmpopts.IgnoreFields(Message{}, "Header"),
+		cmp.Comparer(func(a, b time.Time) bool { return a.Equal(b) }),
+	); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if got := got.Header["Received"]; len(got) != 2 {
+		t.Errorf("got Received headers %q, want 2", got)
+	}
+
+	if _, err := Parse(&gmail.Message{Id: "m"}); err == nil {
+		t.Error("got nil error for a message without raw message or payload")
+	}
+	if _, err := Parse(&gmail.Message{Raw: "!"}); err == nil {
+		t.Error("got nil error for an invalid raw message")
+	}
+}
+
+func TestSendFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/upload/gmail/v1/users/me/messages/send":
+			_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			mr := multipart.NewReader(r.Body, params["boundary"])
+			p, err := mr.NextPart()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var meta gmail.Message
+			if err := json.NewDecoder(p).Decode(&meta); err != nil {
+				t.Fatal(err)
+			}
+			if meta.ThreadId != "t1" {
+				t.Errorf("got thread ID %q, want t1", meta.ThreadId)
+			}
+			p, err = mr.NextPart()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ct := p.Header.Get("Content-Type"); ct != "message/rfc822" {
+				t.Errorf("got media content type %q", ct)
+			}
+			b, err := ioutil.ReadAll(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Contains(b, []byte("Subject: Hi\r\n")) {
+				t.Errorf("got message\n%s", b)
+			}
+			w.Write([]byte(`{"id": "m2", "threadId": "t1"}`))
+		case r.Method == "GET" && r.URL.Path == "/gmail/v1/users/me/messages/m1":
+			if got := r.URL.Query().Get("format"); got != "full" {
+				t.Errorf("got format %q, want full", got)
+			}
+			w.Write([]byte(full))
+		case r.Method == "GET" && r.URL.Path == "/gmail/v1/users/me/messages/m1/attachments/att1":
+			w.Write([]byte(`{"size": 5, "data": "JVBERi0="}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			http.Error(w, "unexpected", http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+	svc, err := gmail.NewService(ctx, option.WithHTTPClient(http.DefaultClient), option.WithEndpoint(srv.URL+"/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent, err := Send(ctx, svc, "me", &Message{ThreadID: "t1", To: []*mail.Address{{Address: "a@example.com"}}, Subject: "Hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent.Id != "m2" {
+		t.Errorf("got ID %q, want m2", sent.Id)
+	}
+
+	m, err := Get(ctx, svc, "me", "m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Fetch(ctx, svc, "me", m); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(m.Attachments[0].Data); got != "%PDF-" {
+		t.Errorf("got attachment data %q, want %%PDF-", got)
+	}
+	if got := string(m.Inline[0].Data); got != "\x89PNG" {
+		t.Errorf("got inline data %q", got)
+	}
+}
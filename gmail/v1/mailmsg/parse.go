@@ -0,0 +1,253 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mailmsg
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+
+	gmail "google.golang.org/api/gmail/v1"
+)
+
+var (
+	wordDecoder   = new(mime.WordDecoder)
+	addressParser = &mail.AddressParser{WordDecoder: wordDecoder}
+)
+
+func encodeBase64URL(b []byte) string {
+	return base64.URLEncoding.EncodeToString(b)
+}
+
+// decodeBase64URL decodes s in base64url, with or without padding.
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// Parse parses msg, as returned by UsersMessagesService.Get with the "full"
+// or "raw" format. With the "metadata" format, only the headers are parsed.
+//
+// Parse is lenient: headers that cannot be parsed leave their fields zero,
+// but remain in the Header of the returned message.
+func Parse(msg *gmail.Message) (*Message, error) {
+	m := &Message{
+		ID:       msg.Id,
+		ThreadID: msg.ThreadId,
+		LabelIDs: msg.LabelIds,
+		Snippet:  msg.Snippet,
+	}
+	switch {
+	case msg.Raw != "":
+		b, err := decodeBase64URL(msg.Raw)
+		if err != nil {
+			return nil, fmt.Errorf("mailmsg: decoding raw message: %v", err)
+		}
+		r, err := mail.ReadMessage(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("mailmsg: %v", err)
+		}
+		h := textproto.MIMEHeader(r.Header)
+		m.parseHeader(h)
+		if err := m.addEntity(h, r.Body); err != nil {
+			return nil, fmt.Errorf("mailmsg: %v", err)
+		}
+	case msg.Payload != nil:
+		m.parseHeader(partHeader(msg.Payload))
+		if err := m.addPart(msg.Payload); err != nil {
+			return nil, fmt.Errorf("mailmsg: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("mailmsg: message %q has neither a raw message nor a payload", msg.Id)
+	}
+	return m, nil
+}
+
+// partHeader returns the headers of p.
+func partHeader(p *gmail.MessagePart) textproto.MIMEHeader {
+	h := make(textproto.MIMEHeader)
+	for _, ph := range p.Headers {
+		h.Add(ph.Name, ph.Value)
+	}
+	return h
+}
+
+// parseHeader sets the header fields of m from h.
+func (m *Message) parseHeader(h textproto.MIMEHeader) {
+	m.Header = h
+	addresses := func(name string) []*mail.Address {
+		as, err := addressParser.ParseList(h.Get(name))
+		if err != nil {
+			return nil
+		}
+		return as
+	}
+	if from := addresses("From"); len(from) > 0 {
+		m.From = from[0]
+	}
+	m.ReplyTo = addresses("Reply-To")
+	m.To = addresses("To")
+	m.Cc = addresses("Cc")
+	m.Bcc = addresses("Bcc")
+	m.Subject = decodeWords(h.Get("Subject"))
+	if d, err := mail.ParseDate(h.Get("Date")); err == nil {
+		m.Date = d
+	}
+	m.MessageID = strings.TrimSpace(h.Get("Message-Id"))
+	m.InReplyTo = strings.TrimSpace(h.Get("In-Reply-To"))
+	if refs := strings.Fields(h.Get("References")); len(refs) > 0 {
+		m.References = refs
+	}
+}
+
+// decodeWords decodes the encoded words of a header value, or returns it as
+// is if they cannot be decoded.
+func decodeWords(s string) string {
+	d, err := wordDecoder.DecodeHeader(s)
+	if err != nil {
+		return s
+	}
+	return d
+}
+
+// addEntity adds the bodies and attachments of the MIME entity with header h
+// and the given body to m.
+func (m *Message) addEntity(h textproto.MIMEHeader, body io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err == nil && strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := m.addEntity(p.Header, p); err != nil {
+				return err
+			}
+		}
+	}
+	switch strings.ToLower(strings.TrimSpace(h.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	m.addLeaf(h, "", data, false)
+	return nil
+}
+
+// addPart adds the bodies and attachments of the part p of a message in the
+// "full" format to m.
+func (m *Message) addPart(p *gmail.MessagePart) error {
+	if strings.HasPrefix(p.MimeType, "multipart/") {
+		for _, c := range p.Parts {
+			if err := m.addPart(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	h := partHeader(p)
+	if h.Get("Content-Type") == "" && p.MimeType != "" {
+		h.Set("Content-Type", p.MimeType)
+	}
+	var data []byte
+	external := false
+	if p.Body != nil {
+		if p.Body.Data != "" {
+			var err error
+			data, err = decodeBase64URL(p.Body.Data)
+			if err != nil {
+				return fmt.Errorf("part %s: %v", p.PartId, err)
+			}
+		}
+		external = p.Body.AttachmentId != ""
+	}
+	if a := m.addLeaf(h, p.Filename, data, external); a != nil {
+		a.PartID = p.PartId
+		if p.Body != nil {
+			a.AttachmentID = p.Body.AttachmentId
+			a.Size = p.Body.Size
+		}
+	}
+	return nil
+}
+
+// addLeaf adds the leaf entity with header h and the given decoded data to
+// m: the first plain text and HTML parts that are not attachments are the
+// bodies of m, and other parts are attachments, or inline files if they
+// have a content ID and are not attachments. It returns the attachment or
+// inline file that was added, if any. external reports whether the data of
+// the entity is stored apart from the message.
+func (m *Message) addLeaf(h textproto.MIMEHeader, filename string, data []byte, external bool) *Attachment {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+	disposition, dparams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	if filename == "" {
+		filename = dparams["filename"]
+	}
+	if filename == "" {
+		filename = params["name"]
+	}
+	filename = decodeWords(filename)
+	if disposition != "attachment" && filename == "" && !external {
+		switch {
+		case mediaType == "text/plain" && m.Text == "":
+			m.Text = decodeText(params["charset"], data)
+			return nil
+		case mediaType == "text/html" && m.HTML == "":
+			m.HTML = decodeText(params["charset"], data)
+			return nil
+		}
+	}
+	a := &Attachment{
+		Filename:    filename,
+		ContentType: mediaType,
+		ContentID:   strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(h.Get("Content-Id")), "<"), ">"),
+		Data:        data,
+		Size:        int64(len(data)),
+	}
+	if external {
+		a.Data = nil
+	}
+	if a.ContentID != "" && disposition != "attachment" {
+		m.Inline = append(m.Inline, a)
+	} else {
+		m.Attachments = append(m.Attachments, a)
+	}
+	return a
+}
+
+// decodeText returns text in the given charset as a string, with its line
+// breaks as "\n". Only UTF-8, US-ASCII and ISO-8859-1 are decoded; text in
+// other charsets is returned as is.
+func decodeText(charset string, text []byte) string {
+	s := string(text)
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1":
+		r := make([]rune, len(text))
+		for i, b := range text {
+			r[i] = rune(b)
+		}
+		s = string(r)
+	}
+	return strings.Replace(s, "\r\n", "\n", -1)
+}
@@ -0,0 +1,286 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/internal/disco"
+)
+
+// An apiChange is a change to the Go API generated for a discovery document
+// between two of its revisions.
+type apiChange struct {
+	Kind     string `json:"kind"`          // "added", "removed" or "changed"
+	Element  string `json:"element"`       // "method", "parameter", "schema" or "property"
+	Name     string `json:"name"`          // name in the discovery document, like "storage.objects.get.bucket"
+	Old      string `json:"old,omitempty"` // Go declaration in the old revision, and type in the document
+	New      string `json:"new,omitempty"` // Go declaration in the new revision, and type in the document
+	Breaking bool   `json:"breaking"`      // whether code using the old revision may not compile
+}
+
+func (c *apiChange) String() string {
+	var b strings.Builder
+	if c.Breaking {
+		b.WriteString("BREAKING ")
+	}
+	fmt.Fprintf(&b, "%s %s %s", c.Kind, c.Element, c.Name)
+	switch c.Kind {
+	case "added":
+		fmt.Fprintf(&b, ": %s", c.New)
+	case "removed":
+		fmt.Fprintf(&b, ": %s", c.Old)
+	default:
+		fmt.Fprintf(&b, ": %s -> %s", c.Old, c.New)
+	}
+	return b.String()
+}
+
+// A surfaceElement is a part of a generated API that callers may depend on.
+type surfaceElement struct {
+	element  string   // as for apiChange
+	name     string   // as for apiChange
+	decl     string   // the Go declaration; callers depend on all of it
+	wire     string   // for simple types, the type and format in the document
+	required bool     // for parameters, whether it is an argument of the method
+	features []string // for methods, the optional methods of the call, like "Pages"
+}
+
+// apiSurface returns the elements of the Go API generated for a, keyed by
+// element and name. It generates the code for a to name the Go types.
+func apiSurface(a *API) (map[string]*surfaceElement, error) {
+	if _, err := a.GenerateCode(); err != nil {
+		return nil, err
+	}
+	surface := make(map[string]*surfaceElement)
+	add := func(e *surfaceElement) {
+		surface[e.element+" "+e.name] = e
+	}
+	for _, name := range a.sortedSchemaNames() {
+		s := a.schemas[name]
+		add(&surfaceElement{element: "schema", name: name, decl: s.GoName()})
+		if s.typ.Kind != disco.StructKind || s.typ.Variant != nil {
+			continue
+		}
+		for _, p := range s.properties() {
+			if p.assignedGoName == "" {
+				continue
+			}
+			typ := p.TypeAsGo()
+			if p.forcePointerType() {
+				typ = "*" + typ
+			}
+			add(&surfaceElement{
+				element: "property",
+				name:    name + "." + p.p.Name,
+				decl:    s.GoName() + "." + p.assignedGoName + " " + typ,
+				wire:    wireType(p.Type().Type, p.Type().Format, p.Type().Kind == disco.SimpleKind),
+			})
+		}
+	}
+	var addMethods func(recv string, ms []*Method)
+	addMethods = func(recv string, ms []*Method) {
+		for _, m := range ms {
+			add(m.surface(recv))
+			for _, p := range m.Params() {
+				e := &surfaceElement{
+					element:  "parameter",
+					name:     m.Id() + "." + p.p.Name,
+					wire:     wireType(p.p.Type, p.p.Format, true),
+					required: p.p.Required,
+				}
+				if p.p.Required {
+					e.decl = "argument of type " + p.GoType()
+					if p.p.Repeated {
+						e.decl = "argument of type []" + p.GoType()
+					}
+				} else {
+					variadic := ""
+					if p.p.Repeated {
+						variadic = "..."
+					}
+					e.decl = fmt.Sprintf("%s(%s%s)", initialCap(p.p.Name), variadic, p.GoType())
+				}
+				add(e)
+			}
+		}
+	}
+	addMethods("Service", a.APIMethods())
+	var addResources func(rs disco.ResourceList)
+	addResources = func(rs disco.ResourceList) {
+		for _, r := range rs {
+			addMethods(resourceGoType(r), a.resourceMethods(r))
+			addResources(r.Resources)
+		}
+	}
+	addResources(a.doc.Resources)
+	return surface, nil
+}
+
+// surface returns the surface element for the method itself, with recv the
+// Go type of its receiver.
+func (m *Method) surface(recv string) *surfaceElement {
+	ret := responseType(m.api, m.m)
+	if m.IsRawResponse() {
+		ret = "*http.Response"
+	}
+	decl := fmt.Sprintf("%s.%s(%s)", recv, initialCap(m.m.Name), m.NewArguments())
+	if ret == "" {
+		decl += " error"
+	} else {
+		decl += " (" + ret + ", error)"
+	}
+	var features []string
+	if m.supportsMediaUpload() {
+		features = append(features, "Media", "ResumableMedia", "ProgressUpdater")
+	}
+	if m.supportsMediaDownload() {
+		features = append(features, "Download")
+	}
+	if _, _, ok := m.supportsPaging(); ok {
+		features = append(features, "Pages")
+	}
+	if m.m.HTTPMethod == "GET" {
+		features = append(features, "IfNoneMatch")
+	}
+	return &surfaceElement{element: "method", name: m.Id(), decl: decl, features: features}
+}
+
+// wireType returns the type and format of a simple type in a discovery
+// document, or "" if simple is false.
+func wireType(typ, format string, simple bool) string {
+	if !simple {
+		return ""
+	}
+	if format == "" {
+		return typ
+	}
+	return typ + "/" + format
+}
+
+func (e *surfaceElement) String() string {
+	s := e.decl
+	if e.wire != "" {
+		s += " (" + e.wire + ")"
+	}
+	if len(e.features) > 0 {
+		s += " [" + strings.Join(e.features, ", ") + "]"
+	}
+	return s
+}
+
+// diffAPIs returns the changes to the generated Go API between the discovery
+// documents old and new, sorted by element and name.
+func diffAPIs(old, new []byte) ([]*apiChange, error) {
+	var surfaces [2]map[string]*surfaceElement
+	for i, b := range [][]byte{old, new} {
+		a, err := apiFromJSON(b)
+		if err != nil {
+			return nil, err
+		}
+		if surfaces[i], err = apiSurface(a); err != nil {
+			return nil, fmt.Errorf("generating %s: %v", a.ID, err)
+		}
+	}
+	var changes []*apiChange
+	for k, o := range surfaces[0] {
+		if _, ok := surfaces[1][k]; !ok {
+			changes = append(changes, &apiChange{Kind: "removed", Element: o.element, Name: o.name, Old: o.String(), Breaking: true})
+		}
+	}
+	for k, n := range surfaces[1] {
+		o, ok := surfaces[0][k]
+		if !ok {
+			// Only new required parameters of existing methods change the
+			// signature of a method.
+			breaking := false
+			if n.required {
+				_, breaking = surfaces[0]["method "+n.name[:strings.LastIndex(n.name, ".")]]
+			}
+			changes = append(changes, &apiChange{Kind: "added", Element: n.element, Name: n.name, New: n.String(), Breaking: breaking})
+			continue
+		}
+		removed := len(missing(o.features, n.features)) > 0
+		added := len(missing(n.features, o.features)) > 0
+		if o.decl == n.decl && o.wire == n.wire && o.required == n.required && !removed && !added {
+			continue
+		}
+		changes = append(changes, &apiChange{
+			Kind:     "changed",
+			Element:  n.element,
+			Name:     n.name,
+			Old:      o.String(),
+			New:      n.String(),
+			Breaking: o.decl != n.decl || o.required != n.required || removed,
+		})
+	}
+	order := map[string]int{"schema": 0, "property": 0, "method": 1, "parameter": 1}
+	sort.Slice(changes, func(i, j int) bool {
+		ci, cj := changes[i], changes[j]
+		if order[ci.Element] != order[cj.Element] {
+			return order[ci.Element] < order[cj.Element]
+		}
+		if ci.Name != cj.Name {
+			return ci.Name < cj.Name
+		}
+		return ci.Element < cj.Element
+	})
+	return changes, nil
+}
+
+// missing returns the elements of a that are not in b.
+func missing(a, b []string) []string {
+	var m []string
+	for _, s := range a {
+		found := false
+		for _, t := range b {
+			found = found || s == t
+		}
+		if !found {
+			m = append(m, s)
+		}
+	}
+	return m
+}
+
+// hasBreaking reports whether any of changes is breaking.
+func hasBreaking(changes []*apiChange) bool {
+	for _, c := range changes {
+		if c.Breaking {
+			return true
+		}
+	}
+	return false
+}
+
+// writeChanges writes changes to w in format, which is "text" for one line
+// per change or "json" for a JSON array of apiChange objects.
+func writeChanges(w io.Writer, changes []*apiChange, format string) error {
+	switch format {
+	case "text":
+		for _, c := range changes {
+			if _, err := fmt.Fprintln(w, c); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "json":
+		if changes == nil {
+			changes = []*apiChange{}
+		}
+		b, err := json.MarshalIndent(changes, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+	default:
+		return fmt.Errorf("unknown diff format %q", format)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDiffAPIs(t *testing.T) {
+	old, new := readTestdata(t, "apidiff-old.json"), readTestdata(t, "apidiff-new.json")
+	changes, err := diffAPIs(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeChanges(&buf, changes, "text"); err != nil {
+		t.Fatal(err)
+	}
+	goldenFile := filepath.Join("testdata", "apidiff.txt")
+	if *updateGolden {
+		if err := ioutil.WriteFile(goldenFile, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := readTestdata(t, "apidiff.txt"); !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("got changes:\n%s\nwant:\n%s", buf.Bytes(), want)
+	}
+	if !hasBreaking(changes) {
+		t.Error("hasBreaking = false, want true")
+	}
+
+	buf.Reset()
+	if err := writeChanges(&buf, changes, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var got []*apiChange
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(changes) {
+		t.Fatalf("got %d changes in JSON, want %d", len(got), len(changes))
+	}
+	for i, c := range got {
+		if *c != *changes[i] {
+			t.Errorf("JSON change %d = %+v, want %+v", i, c, changes[i])
+		}
+	}
+}
+
+func TestDiffAPIsUnchanged(t *testing.T) {
+	doc := readTestdata(t, "apidiff-old.json")
+	changes, err := diffAPIs(doc, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("got %d changes, want none: %v", len(changes), changes)
+	}
+	var buf bytes.Buffer
+	if err := writeChanges(&buf, changes, "json"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "[]\n"; got != want {
+		t.Errorf("got JSON %q, want %q", got, want)
+	}
+	if err := writeChanges(&buf, changes, "xml"); err == nil {
+		t.Error("got nil error for unknown format")
+	}
+}
@@ -26,7 +26,7 @@ import (
 	"time"
 	"unicode"
 
-	"google.golang.org/api/google-api-go-generator/internal/disco"
+	"google.golang.org/api/internal/disco"
 	"google.golang.org/api/internal/version"
 )
 
@@ -58,6 +58,10 @@ var (
 
 	copyrightYear = flag.String("copyright_year", fmt.Sprintf("%d", time.Now().Year()), "Year for copyright.")
 
+	diffAgainst = flag.String("diff_against", "", "If non-empty, the path to an older revision of the API in --api_json_file. Instead of generating code, report the changes to the generated Go API between the two revisions, and exit with status 1 if any of them are breaking.")
+	diffFormat  = flag.String("diff_format", "text", "The format of the report for --diff_against: \"text\" or \"json\".")
+	logBreaking = flag.Bool("log_breaking_changes", false, "Log the changes to the generated Go APIs that break them, when updating the cached discovery documents. This compares the Go API surface of each old and new document, which slows down generation.")
+
 	serviceTypes = []string{"Service", "APIService"}
 )
 
@@ -134,6 +138,9 @@ func main() {
 	if *install {
 		*build = true
 	}
+	if *diffAgainst != "" {
+		os.Exit(diffMain())
+	}
 
 	var (
 		apiIds  = []string{}
@@ -280,10 +287,18 @@ func apiFromFile(file string) (*API, error) {
 	if err != nil {
 		return nil, fmt.Errorf("Error reading %s: %v", file, err)
 	}
-	doc, err := disco.NewDocument(jsonBytes)
+	a, err := apiFromJSON(jsonBytes)
 	if err != nil {
 		return nil, fmt.Errorf("reading document from %q: %v", file, err)
 	}
+	return a, nil
+}
+
+func apiFromJSON(jsonBytes []byte) (*API, error) {
+	doc, err := disco.NewDocument(jsonBytes)
+	if err != nil {
+		return nil, err
+	}
 	a := &API{
 		ID:        doc.ID,
 		Name:      doc.Name,
@@ -306,9 +321,59 @@ func checkAndUpdateSpecFile(file string, contents []byte) error {
 	if err := isNewerRevision(existing, contents); err != nil {
 		return err
 	}
+	if *logBreaking {
+		logBreakingChanges(file, existing, contents)
+	}
 	return writeFile(file, contents)
 }
 
+// logBreakingChanges logs the changes between the old and new contents of
+// file that break the generated Go API.
+func logBreakingChanges(file string, old, new []byte) {
+	if bytes.Equal(old, new) {
+		return
+	}
+	changes, err := diffAPIs(old, new)
+	if err != nil {
+		log.Printf("Comparing %s with its previous revision: %v", file, err)
+		return
+	}
+	for _, c := range changes {
+		if c.Breaking {
+			log.Printf("%s: %s", file, c)
+		}
+	}
+}
+
+// diffMain implements the --diff_against mode, returning the exit status.
+func diffMain() int {
+	if *jsonFile == "" {
+		log.Print("--diff_against requires --api_json_file")
+		return 2
+	}
+	var docs [2][]byte
+	for i, file := range []string{*diffAgainst, *jsonFile} {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Print(err)
+			return 2
+		}
+		docs[i] = b
+	}
+	changes, err := diffAPIs(docs[0], docs[1])
+	if err == nil {
+		err = writeChanges(os.Stdout, changes, *diffFormat)
+	}
+	if err != nil {
+		log.Print(err)
+		return 2
+	}
+	if hasBreaking(changes) {
+		return 1
+	}
+	return 0
+}
+
 // isNewerRevision returns nil if the contents of new has a newer revision than
 // the contents of old.
 func isNewerRevision(old []byte, new []byte) error {
@@ -496,6 +561,15 @@ func (a *API) apiBaseURL() string {
 	return resolveRelative(base, rel)
 }
 
+// apiMTLSBaseURL returns the base URL of the API's mTLS endpoint, or "" if
+// the discovery document does not specify one.
+func (a *API) apiMTLSBaseURL() string {
+	if *baseURL != "" || a.doc.MTLSRootURL == "" {
+		return ""
+	}
+	return resolveRelative(a.doc.MTLSRootURL, a.doc.ServicePath)
+}
+
 func (a *API) needsDataWrapper() bool {
 	for _, feature := range a.doc.Features {
 		if feature == "dataWrapper" {
@@ -684,6 +758,7 @@ func (a *API) GenerateCode() ([]byte, error) {
 		"net/url",
 		"strconv",
 		"strings",
+		"time",
 	} {
 		pn("  %q", imp)
 	}
@@ -714,12 +789,17 @@ func (a *API) GenerateCode() ([]byte, error) {
 	pn("var _ = errors.New")
 	pn("var _ = strings.Replace")
 	pn("var _ = context.Canceled")
+	pn("var _ = time.Now")
 	pn("var _ = internaloption.WithDefaultEndpoint")
 	pn("")
 	pn("const apiId = %q", a.doc.ID)
 	pn("const apiName = %q", a.doc.Name)
 	pn("const apiVersion = %q", a.doc.Version)
 	pn("const basePath = %q", a.apiBaseURL())
+	mtlsBasePath := a.apiMTLSBaseURL()
+	if mtlsBasePath != "" {
+		pn("const mtlsBasePath = %q", mtlsBasePath)
+	}
 
 	a.generateScopeConstants()
 	a.PopulateSchemas()
@@ -731,6 +811,10 @@ func (a *API) GenerateCode() ([]byte, error) {
 	a.GetName(service)
 
 	pn("// NewService creates a new %s.", service)
+	pn("//")
+	p("%s", asComment("", fmt.Sprintf("If the %s environment variable is set and option.WithEndpoint is not "+
+		"used, requests are sent without authentication to the emulator at the address it holds, "+
+		`like "localhost:9000".`, a.doc.EmulatorHostEnv())))
 	pn("func NewService(ctx context.Context, opts ...option.ClientOption) (*%s, error) {", service)
 	if len(a.doc.Auth.OAuth2Scopes) != 0 {
 		pn("scopesOption := option.WithScopes(")
@@ -742,6 +826,10 @@ func (a *API) GenerateCode() ([]byte, error) {
 		pn("opts = append([]option.ClientOption{scopesOption}, opts...)")
 	}
 	pn("opts = append(opts, internaloption.WithDefaultEndpoint(basePath))")
+	if mtlsBasePath != "" {
+		pn("opts = append(opts, internaloption.WithDefaultMTLSEndpoint(mtlsBasePath))")
+	}
+	pn("opts = append(opts, internaloption.WithEmulatorHostEnv(%q))", a.doc.EmulatorHostEnv())
 	pn("client, endpoint, err := htransport.NewClient(ctx, opts...)")
 	pn("if err != nil { return nil, err }")
 	pn("s, err := New(client)")
@@ -793,6 +881,9 @@ func (a *API) GenerateCode() ([]byte, error) {
 	for _, name := range a.sortedSchemaNames() {
 		a.schemas[name].writeSchemaCode(a)
 	}
+	for _, name := range a.sortedSchemaNames() {
+		a.schemas[name].writeSchemaFields()
+	}
 
 	for _, meth := range a.APIMethods() {
 		meth.generateCode()
@@ -802,6 +893,9 @@ func (a *API) GenerateCode() ([]byte, error) {
 		a.generateResourceMethods(res)
 	}
 
+	a.generateOperationPoller()
+	a.generateResourceNames()
+
 	clean, err := format.Source(buf.Bytes())
 	if err != nil {
 		return buf.Bytes(), err
@@ -866,6 +960,7 @@ type Schema struct {
 	apiName      string // the native API-defined name of this type
 	goName       string // lazily populated by GoName
 	goReturnType string // lazily populated by GoReturnType
+	fieldsName   string // lazily populated by FieldsName
 	props        []*Property
 }
 
@@ -1333,6 +1428,9 @@ func (s *Schema) writeSchemaStruct(api *API) {
 	}
 	s.api.p("\n")
 	des := s.Description()
+	if s.typ.Deprecated {
+		des = addDeprecated(des, "type")
+	}
 	if des != "" {
 		s.api.p("%s", asComment("", fmt.Sprintf("%s: %s", s.GoName(), des)))
 	}
@@ -1346,6 +1444,7 @@ func (s *Schema) writeSchemaStruct(api *API) {
 	}
 
 	firstFieldName := "" // used to store a struct field name for use in documentation.
+	var accessors []*formatAccessor
 	for i, p := range s.properties() {
 		if i > 0 {
 			s.api.p("\n")
@@ -1358,6 +1457,9 @@ func (s *Schema) writeSchemaStruct(api *API) {
 		}
 		p.assignedGoName = pname
 		des := p.Description()
+		if p.Type().Deprecated {
+			des = addDeprecated(des, "field")
+		}
 		if des != "" {
 			s.api.p("%s", asComment("\t", fmt.Sprintf("%s: %s", pname, des)))
 		}
@@ -1373,7 +1475,22 @@ func (s *Schema) writeSchemaStruct(api *API) {
 			typ = "*" + typ
 		}
 
-		s.api.pn(" %s %s `json:\"%s,omitempty%s\"`", pname, typ, p.p.Name, extraOpt)
+		var extraTag string
+		if p.Type().ReadOnly {
+			// Read-only fields are omitted from request bodies.
+			extraTag = ` googleapi:"readonly"`
+		}
+
+		s.api.pn(" %s %s `json:\"%s,omitempty%s\"%s`", pname, typ, p.p.Name, extraOpt, extraTag)
+		if f := formats[p.Type().Format]; f != nil && typ == "string" {
+			accessors = append(accessors, &formatAccessor{
+				wellKnownFormat: f,
+				name:            p.Type().Format,
+				field:           pname,
+				getter:          np.Get(pname + f.suffix),
+				setter:          np.Get("Set" + pname + f.suffix),
+			})
+		}
 		if firstFieldName == "" {
 			firstFieldName = pname
 		}
@@ -1400,7 +1517,9 @@ func (s *Schema) writeSchemaStruct(api *API) {
 		"any non-pointer, non-interface field appearing in %s will " +
 		"be sent to the server regardless of whether the field is " +
 		"empty or not. This may be used to include empty fields in " +
-		"Patch requests."
+		"Patch requests. Values nested within fields may be listed with " +
+		"dotted paths, such as \"Field.key\" for a map entry or " +
+		"\"Field.0.Subfield\" for a field of a list element."
 	comment := fmt.Sprintf(commentFmtStr, forceSendName, firstFieldName, forceSendName)
 	s.api.p("\n")
 	s.api.p("%s", asComment("\t", comment))
@@ -1412,7 +1531,8 @@ func (s *Schema) writeSchemaStruct(api *API) {
 		"By default, fields with empty values are omitted from API requests. However, " +
 		"any field with an empty value appearing in %s will be sent to the server as null. " +
 		"It is an error if a field in this list has a non-empty value. This may be used to " +
-		"include null fields in Patch requests."
+		"include null fields in Patch requests. Values nested within fields may be listed " +
+		"with dotted paths, as for ForceSendFields."
 	comment = fmt.Sprintf(commentFmtStr, nullFieldsName, firstFieldName, nullFieldsName)
 	s.api.p("\n")
 	s.api.p("%s", asComment("\t", comment))
@@ -1422,62 +1542,348 @@ func (s *Schema) writeSchemaStruct(api *API) {
 	s.api.pn("}")
 	s.writeSchemaMarshal(forceSendName, nullFieldsName)
 	s.writeSchemaUnmarshal()
+	for _, acc := range accessors {
+		s.writeFormatAccessor(acc)
+	}
+}
+
+// hasReadOnly reports whether s or a schema nested in it has read-only
+// properties.
+func hasReadOnly(s *disco.Schema, seen map[*disco.Schema]bool) bool {
+	if s == nil || seen[s] {
+		return false
+	}
+	seen[s] = true
+	if s.RefSchema != nil {
+		return hasReadOnly(s.RefSchema, seen)
+	}
+	for _, p := range s.Properties {
+		if p.Schema.ReadOnly || hasReadOnly(p.Schema, seen) {
+			return true
+		}
+	}
+	return hasReadOnly(s.ItemSchema, seen) || hasReadOnly(s.AdditionalProperties, seen)
+}
+
+// addDeprecated appends a deprecation notice for an API element of the
+// given kind, such as "field", to its description.
+func addDeprecated(des, kind string) string {
+	notice := fmt.Sprintf("Deprecated: This %s is deprecated in the API.", kind)
+	if des == "" {
+		return notice
+	}
+	return des + "\n\n" + notice
+}
+
+// A wellKnownFormat describes how the values of a well-known discovery format,
+// which are transmitted as strings, convert to and from a Go type.
+type wellKnownFormat struct {
+	gotype string // Go type of the value, e.g. "time.Time"
+	suffix string // suffix of the accessor names, e.g. "Time"
+	parse  string // gensupport function that parses the string
+	fmt    string // gensupport function that formats the value
+	noErr  bool   // whether parse cannot fail
+}
+
+// formats maps the well-known string formats to their Go types.
+var formats = map[string]*wellKnownFormat{
+	"google-datetime":  {"time.Time", "Time", "ParseDateTime", "FormatDateTime", false},
+	"date-time":        {"time.Time", "Time", "ParseDateTime", "FormatDateTime", false},
+	"date":             {"time.Time", "Time", "ParseDate", "FormatDate", false},
+	"google-duration":  {"time.Duration", "Duration", "ParseDuration", "FormatDuration", false},
+	"google-fieldmask": {"[]string", "Paths", "ParseFieldMask", "FormatFieldMask", true},
+	"byte":             {"[]byte", "Bytes", "ParseBytes", "FormatBytes", false},
+}
+
+// A formatAccessor is a pair of methods that get and set a string field
+// with a well-known format as a value of the format's Go type.
+type formatAccessor struct {
+	*wellKnownFormat
+	name   string // the discovery format, e.g. "google-datetime"
+	field  string
+	getter string
+	setter string
+}
+
+func (s *Schema) writeFormatAccessor(acc *formatAccessor) {
+	pn := s.api.pn
+	pn("\n// %s returns %s, which has the %q format, as a %s.", acc.getter, acc.field, acc.name, acc.gotype)
+	if acc.noErr {
+		pn("func (s *%s) %s() %s {", s.GoName(), acc.getter, acc.gotype)
+	} else {
+		pn("func (s *%s) %s() (%s, error) {", s.GoName(), acc.getter, acc.gotype)
+	}
+	pn(" return gensupport.%s(s.%s)", acc.parse, acc.field)
+	pn("}")
+	pn("\n// %s sets %s to v in the %q format.", acc.setter, acc.field, acc.name)
+	pn("func (s *%s) %s(v %s) {", s.GoName(), acc.setter, acc.gotype)
+	pn(" s.%s = gensupport.%s(v)", acc.field, acc.fmt)
+	pn("}")
 }
 
 // writeSchemaMarshal writes a custom MarshalJSON function for s, which allows
 // fields to be explicitly transmitted by listing them in the field identified
 // by forceSendFieldName, and allows fields to be transmitted with the null value
 // by listing them in the field identified by nullFieldsName.
+//
+// The function encodes each field in turn with a gensupport.JSONEncoder, which
+// follows the same rules as gensupport.MarshalJSON without reflection.
 func (s *Schema) writeSchemaMarshal(forceSendFieldName, nullFieldsName string) {
-	s.api.pn("func (s *%s) MarshalJSON() ([]byte, error) {", s.GoName())
-	s.api.pn("\ttype NoMethod %s", s.GoName())
-	// pass schema as methodless type to prevent subsequent calls to MarshalJSON from recursing indefinitely.
-	s.api.pn("\traw := NoMethod(*s)")
-	s.api.pn("\treturn gensupport.MarshalJSON(raw, s.%s, s.%s)", forceSendFieldName, nullFieldsName)
-	s.api.pn("}")
+	pn := s.api.pn
+	pn("func (s *%s) MarshalJSON() ([]byte, error) {", s.GoName())
+	pn("\te := gensupport.NewJSONEncoder(s.%s, s.%s)", forceSendFieldName, nullFieldsName)
+	for _, p := range s.properties() {
+		if p.assignedGoName != "" {
+			s.writeFieldMarshal(p)
+		}
+	}
+	pn("\treturn e.Bytes()")
+	pn("}")
 }
 
+// writeFieldMarshal writes the statements of a MarshalJSON function that
+// encode the field for p.
+func (s *Schema) writeFieldMarshal(p *Property) {
+	pn := s.api.pn
+	name, field := p.p.Name, p.assignedGoName
+	v := "s." + field
+	typ := p.TypeAsGo()
+	// Named simple types are encoded as the simple types they are defined as.
+	simple := typ
+	if t := p.Type(); t.Kind == disco.ReferenceKind && t.RefSchema.Kind == disco.SimpleKind {
+		simple = mustSimpleTypeConvert(t.RefSchema.Type, t.RefSchema.Format)
+	}
+	quoted := p.Type().IsIntAsString()
+	switch {
+	case p.forcePointerType():
+		pn("\tif e.PtrField(%q, %q, %s == nil) {", name, field, v)
+		if w := valueWriter(simple, typ, "*"+v, quoted); w != "" {
+			pn("\t\t%s", w)
+		} else {
+			pn("\t\te.Value(%s)", v)
+		}
+	case strings.HasPrefix(typ, "*") || simple == "interface{}":
+		pn("\tif e.PtrField(%q, %q, %s == nil) {", name, field, v)
+		pn("\t\te.Value(%s)", v)
+	case typ == "map[string]string":
+		pn("\te.StringMapField(%q, %q, %s)", name, field, v)
+		return
+	case strings.HasPrefix(typ, "map["):
+		pn("\tif e.Field(%q, %q, len(%s) == 0) {", name, field, v)
+		pn("\t\te.Map(%s)", v)
+	case typ == "[]string":
+		pn("\tif e.Field(%q, %q, len(%s) == 0) {", name, field, v)
+		pn("\t\te.Strings(%s)", v)
+	case strings.HasPrefix(typ, "[]") || strings.HasPrefix(typ, "googleapi."):
+		pn("\tif e.Field(%q, %q, len(%s) == 0) {", name, field, v)
+		pn("\t\te.List(%s)", v)
+	case valueWriter(simple, typ, v, quoted) != "":
+		empty := v + " == 0"
+		switch simple {
+		case "string":
+			empty = v + ` == ""`
+		case "bool":
+			empty = "!" + v
+		}
+		pn("\tif e.Field(%q, %q, %s) {", name, field, empty)
+		pn("\t\t%s", valueWriter(simple, typ, v, quoted))
+	default:
+		// Struct values, used for variants, are always sent.
+		pn("\tif e.Field(%q, %q, false) {", name, field)
+		pn("\t\te.Value(%s)", v)
+	}
+	pn("\t}")
+}
+
+// valueWriter returns the JSONEncoder call that writes the expression v, of
+// Go type typ defined as the simple type simple, or "" if simple is not a
+// simple type with its own encoder method.
+func valueWriter(simple, typ, v string, quoted bool) string {
+	conv := func(want string) string {
+		if typ == want {
+			return v
+		}
+		return want + "(" + v + ")"
+	}
+	switch simple {
+	case "string":
+		return fmt.Sprintf("e.String(%s)", conv("string"))
+	case "bool":
+		return fmt.Sprintf("e.Bool(%s)", conv("bool"))
+	case "float64":
+		return fmt.Sprintf("e.Float(%s)", conv("float64"))
+	case "int64", "int32":
+		return fmt.Sprintf("e.Int(%s, %t)", conv("int64"), quoted)
+	case "uint64", "uint32":
+		return fmt.Sprintf("e.Uint(%s, %t)", conv("uint64"), quoted)
+	}
+	return ""
+}
+
+// writeSchemaUnmarshal writes a custom UnmarshalJSON function for s, which
+// decodes each field in turn with a gensupport.JSONDecoder instead of
+// reflecting over the schema.
 func (s *Schema) writeSchemaUnmarshal() {
-	var floatProps []*Property
+	pn := s.api.pn
+	pn("\nfunc (s *%s) UnmarshalJSON(data []byte) error {", s.GoName())
+	pn("\td := gensupport.NewJSONDecoder(data)")
+	pn("\tfor d.Next() {")
+	pn("\t\tswitch d.Key() {")
 	for _, p := range s.properties() {
-		if p.p.Schema.Type == "number" {
-			floatProps = append(floatProps, p)
+		if p.assignedGoName != "" {
+			s.writeFieldUnmarshal(p)
+		}
+	}
+	pn("\t\t}")
+	pn("\t}")
+	pn("\treturn d.Err()")
+	pn("}")
+}
+
+// writeFieldUnmarshal writes the case of an UnmarshalJSON function that
+// decodes the field for p.
+func (s *Schema) writeFieldUnmarshal(p *Property) {
+	pn := s.api.pn
+	v := "s." + p.assignedGoName
+	typ := p.TypeAsGo()
+	simple := typ
+	if t := p.Type(); t.Kind == disco.ReferenceKind && t.RefSchema.Kind == disco.SimpleKind {
+		simple = mustSimpleTypeConvert(t.RefSchema.Type, t.RefSchema.Format)
+	}
+	read, readType := valueReader(simple)
+	conv := "v"
+	if typ != readType {
+		conv = typ + "(v)"
+	}
+	pn("\t\tcase %q:", p.p.Name)
+	switch {
+	case p.forcePointerType() && read != "":
+		pn("\t\t\tif d.Null() {")
+		pn("\t\t\t\t%s = nil", v)
+		pn("\t\t\t} else if v, ok := %s; ok {", read)
+		if conv == "v" {
+			pn("\t\t\t\t%s = &v", v)
+		} else {
+			pn("\t\t\t\tpv := %s", conv)
+			pn("\t\t\t\t%s = &pv", v)
+		}
+		pn("\t\t\t}")
+	case typ == "map[string]string" || typ == "[]string":
+		read = "d.Strings()"
+		if typ == "map[string]string" {
+			read = fmt.Sprintf("d.StringMap(%s)", v)
+		}
+		pn("\t\t\tif d.Null() {")
+		pn("\t\t\t\t%s = nil", v)
+		pn("\t\t\t} else if v, ok := %s; ok {", read)
+		pn("\t\t\t\t%s = v", v)
+		pn("\t\t\t}")
+	case read != "" && !p.forcePointerType() && !strings.HasPrefix(typ, "*") &&
+		!strings.HasPrefix(typ, "[]") && !strings.HasPrefix(typ, "map[") && !strings.HasPrefix(typ, "googleapi."):
+		pn("\t\t\tif v, ok := %s; ok {", read)
+		pn("\t\t\t\t%s = %s", v, conv)
+		pn("\t\t\t}")
+	default:
+		pn("\t\t\td.Value(&%s)", v)
+	}
+}
+
+// valueReader returns the JSONDecoder call that reads a value of the simple
+// type simple, and the Go type of the value it returns, or "" if simple is
+// not a simple type with its own decoder method.
+func valueReader(simple string) (call, gotype string) {
+	switch simple {
+	case "string":
+		return "d.String()", "string"
+	case "bool":
+		return "d.Bool()", "bool"
+	case "float64":
+		return "d.Float()", "float64"
+	case "int64", "int32":
+		return fmt.Sprintf("d.Int(%s)", simple[3:]), "int64"
+	case "uint64", "uint32":
+		return fmt.Sprintf("d.Uint(%s)", simple[4:]), "uint64"
+	}
+	return "", ""
+}
+
+// hasFields reports whether s is a struct schema with properties, for
+// which a field path builder is written.
+func (s *Schema) hasFields() bool {
+	if s.typ.Kind != disco.StructKind || s.typ.Variant != nil {
+		return false
+	}
+	for _, p := range s.properties() {
+		if p.assignedGoName != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// FieldsName returns (or creates and returns) the Go name of the field path
+// builder for s. It must be called after all schema names are assigned.
+func (s *Schema) FieldsName() string {
+	if s.fieldsName == "" {
+		s.fieldsName = s.api.GetName(s.GoName() + "Fields")
+	}
+	return s.fieldsName
+}
+
+// fieldsSchema returns the struct schema whose field path builder is used
+// for a property of type t, looking through references and the elements of
+// arrays, or nil if paths into t are not built.
+func (a *API) fieldsSchema(t *disco.Schema) *Schema {
+	for {
+		switch t.Kind {
+		case disco.ReferenceKind:
+			t = t.RefSchema
+		case disco.ArrayKind:
+			t = t.ElementSchema()
+		case disco.StructKind:
+			if s := a.schemas[t.Name]; s != nil && s.hasFields() {
+				return s
+			}
+			return nil
+		default:
+			return nil
 		}
 	}
-	if len(floatProps) == 0 {
+}
+
+// writeSchemaFields writes a type that builds the googleapi.FieldPath of
+// each field of s, for use with partial responses and update masks.
+func (s *Schema) writeSchemaFields() {
+	if !s.hasFields() {
 		return
 	}
 	pn := s.api.pn
-	pn("\nfunc (s *%s) UnmarshalJSON(data []byte) error {", s.GoName())
-	pn("  type NoMethod %s", s.GoName()) // avoid infinite recursion
-	pn("  var s1 struct {")
-	// Hide the float64 fields of the schema with fields that correctly
-	// unmarshal special values.
-	for _, p := range floatProps {
-		typ := "gensupport.JSONFloat64"
-		if p.forcePointerType() {
-			typ = "*" + typ
+	typ := s.FieldsName()
+	s.api.p("\n%s", asComment("", fmt.Sprintf("%s builds the paths of the fields of %s, "+
+		"for use with partial responses and update masks. Its zero value refers to %s itself. "+
+		"Convert it to a googleapi.FieldPath to refer to the field it was obtained from.",
+		typ, s.GoName(), s.GoName())))
+	pn("type %s googleapi.FieldPath", typ)
+	for _, p := range s.properties() {
+		if p.assignedGoName == "" {
+			continue
 		}
-		pn("%s %s `json:\"%s\"`", p.assignedGoName, typ, p.p.Name)
-	}
-	pn("    *NoMethod") // embed the schema
-	pn("  }")
-	// Set the schema value into the wrapper so its other fields are unmarshaled.
-	pn("  s1.NoMethod = (*NoMethod)(s)")
-	pn("  if err := json.Unmarshal(data, &s1); err != nil {")
-	pn("    return err")
-	pn("  }")
-	// Copy each shadowing field into the field it shadows.
-	for _, p := range floatProps {
-		n := p.assignedGoName
-		if p.forcePointerType() {
-			pn("if s1.%s != nil { s.%s = (*float64)(s1.%s) }", n, n, n)
+		if fs := s.api.fieldsSchema(p.Type()); fs != nil {
+			pn("\n// %s returns the paths of the fields of %q.", p.assignedGoName, p.p.Name)
+			pn("func (f %s) %s() %s {", typ, p.assignedGoName, fs.FieldsName())
+			pn(" return %s(googleapi.FieldPath(f).Child(%q))", fs.FieldsName(), p.p.Name)
+			pn("}")
+			continue
+		}
+		if p.Type().Kind == disco.MapKind {
+			pn("\n// %s returns the path of %q. Use Child to refer to a key.", p.assignedGoName, p.p.Name)
 		} else {
-			pn("s.%s = float64(s1.%s)", n, n)
+			pn("\n// %s returns the path of %q.", p.assignedGoName, p.p.Name)
 		}
+		pn("func (f %s) %s() googleapi.FieldPath {", typ, p.assignedGoName)
+		pn(" return googleapi.FieldPath(f).Child(%q)", p.p.Name)
+		pn("}")
 	}
-	pn(" return nil")
-	pn("}")
 }
 
 // isResponseType returns true for all types that are used as a response.
@@ -1555,6 +1961,330 @@ func (a *API) generateResourceMethods(r *disco.Resource) {
 	}
 }
 
+// operationGetter is a generated method that retrieves an Operation.
+type operationGetter struct {
+	recv string // Go expression for the resource service, e.g. "p.s.Apps.Operations".
+	meth *Method
+	args []*argument
+}
+
+// operationGetters returns the "get" methods of r and its sub-resources that
+// return an Operation and can be called with values taken from the
+// operation's name or self link.
+func (a *API) operationGetters(recv string, r, parent *disco.Resource) []*operationGetter {
+	recv += "." + resourceGoField(r, parent)
+	var getters []*operationGetter
+	for _, meth := range a.resourceMethods(r) {
+		m := meth.m
+		if m.Name != "get" || m.Request != nil || m.Response == nil || m.Response.Ref != "Operation" {
+			continue
+		}
+		args := meth.NewArguments()
+		ok := true
+		for _, arg := range args.l {
+			if arg.location != "path" || arg.gotype != "string" || !strings.Contains(m.Path, arg.apiname+"}") {
+				ok = false
+			}
+		}
+		if ok {
+			getters = append(getters, &operationGetter{recv: recv, meth: meth, args: args.l})
+		}
+	}
+	for _, res := range r.Resources {
+		getters = append(getters, a.operationGetters(recv, res, r)...)
+	}
+	return getters
+}
+
+// schemaProperty returns the property of the struct schema s with the given
+// name, or nil if there is none.
+func schemaProperty(s *disco.Schema, name string) *disco.Property {
+	if s.RefSchema != nil {
+		s = s.RefSchema
+	}
+	for _, p := range s.Properties {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// generateOperationPoller writes an OperationPoller type that polls the
+// API's Operation schema until it completes, if the API has one along with
+// a method to retrieve it.
+func (a *API) generateOperationPoller() {
+	s := a.schemas["Operation"]
+	if s == nil || s.typ.Kind != disco.StructKind || s.typ.Variant != nil {
+		return
+	}
+	op := s.typ
+	var done string
+	if p := schemaProperty(op, "done"); p != nil && p.Schema.Type == "boolean" {
+		done = "p.op." + initialCap(p.Name)
+	} else if p := schemaProperty(op, "status"); p != nil && p.Schema.Type == "string" {
+		done = fmt.Sprintf("p.op.%s == %q", initialCap(p.Name), "DONE")
+	} else {
+		return
+	}
+	// Operations are identified by their self link or their name.
+	var sources []string
+	for _, name := range []string{"selfLink", "name"} {
+		if p := schemaProperty(op, name); p != nil && p.Schema.Type == "string" {
+			sources = append(sources, "p.op."+initialCap(name))
+		}
+	}
+	var getters []*operationGetter
+	for _, res := range a.doc.Resources {
+		getters = append(getters, a.operationGetters("p.s", res, nil)...)
+	}
+	if len(sources) == 0 || len(getters) == 0 {
+		return
+	}
+
+	pn := a.pn
+	service := a.ServiceType()
+	typ := s.GoName()
+	poller := a.GetName("OperationPoller")
+	newPoller := a.GetName("New" + poller)
+
+	pn("\n// %s polls a long-running %s until it completes.", poller, typ)
+	pn("type %s struct {", poller)
+	pn(" s *%s", service)
+	pn(" op *%s", typ)
+	pn("}")
+	pn("\n// %s returns an %s for op, which is typically returned", newPoller, poller)
+	pn("// by a method that starts a long-running operation.")
+	pn("func %s(s *%s, op *%s) *%s {", newPoller, service, typ, poller)
+	pn(" return &%s{s: s, op: op}", poller)
+	pn("}")
+	pn("\n// Operation returns the most recently retrieved state of the operation.")
+	pn("func (p *%s) Operation() *%s { return p.op }", poller, typ)
+	pn("\n// Done reports whether the operation has completed.")
+	pn("func (p *%s) Done() bool { return %s }", poller, done)
+	pn("\n// Poll retrieves the latest state of the operation, unless it has")
+	pn("// already completed. If the operation completed with an error, Poll")
+	pn("// returns it as a *googleapi.OperationError.")
+	pn("func (p *%s) Poll(ctx context.Context, opts ...googleapi.CallOption) error {", poller)
+	pn(" if !p.Done() {")
+	pn("  op, err := p.get(ctx, opts...)")
+	pn("  if err != nil { return err }")
+	pn("  p.op = op")
+	pn(" }")
+	pn(" if !p.Done() { return nil }")
+	a.writeOperationError(op)
+	pn(" return nil")
+	pn("}")
+	pn("\n// Wait polls the operation with exponential backoff until it completes")
+	pn("// or ctx is done, and returns the completed operation. If the operation")
+	pn("// completed with an error, Wait returns it as a *googleapi.OperationError.")
+	pn("func (p *%s) Wait(ctx context.Context, opts ...googleapi.CallOption) (*%s, error) {", poller, typ)
+	pn(" err := gensupport.PollOperation(ctx, func() (bool, error) {")
+	pn("  if err := p.Poll(ctx, opts...); err != nil { return false, err }")
+	pn("  return p.Done(), nil")
+	pn(" })")
+	pn(" if err != nil { return nil, err }")
+	pn(" return p.op, nil")
+	pn("}")
+
+	pn("\nfunc (p *%s) get(ctx context.Context, opts ...googleapi.CallOption) (*%s, error) {", poller, typ)
+	for _, src := range sources {
+		for _, g := range getters {
+			var pattern string
+			var callArgs []string
+			for _, arg := range g.args {
+				if strings.Contains(g.meth.m.Path, "{+"+arg.apiname+"}") {
+					pattern = g.meth.NamedParam(arg.apiname).p.Pattern
+				}
+				callArgs = append(callArgs, fmt.Sprintf("m[%q]", arg.apiname))
+			}
+			pn(" if m, ok := gensupport.MatchPath(%q, %q, %s); ok {", g.meth.m.Path, pattern, src)
+			pn("  return %s.Get(%s).Context(ctx).Do(opts...)", g.recv, strings.Join(callArgs, ", "))
+			pn(" }")
+		}
+	}
+	pn(` return nil, fmt.Errorf("no method to poll operation %%q", %s)`, sources[len(sources)-1])
+	pn("}")
+}
+
+// writeOperationError writes code that returns the error field of the
+// Operation schema op as a *googleapi.OperationError, if it is set.
+func (a *API) writeOperationError(op *disco.Schema) {
+	pe := schemaProperty(op, "error")
+	if pe == nil {
+		return
+	}
+	es := pe.Schema
+	if es.RefSchema != nil {
+		es = es.RefSchema
+	}
+	if es.Kind != disco.StructKind {
+		return
+	}
+	pn := a.pn
+	field := "p.op." + initialCap(pe.Name)
+	pn(" if %s != nil {", field)
+	if p := schemaProperty(op, "name"); p != nil && p.Schema.Type == "string" {
+		pn("  err := &googleapi.OperationError{Name: p.op.%s}", initialCap(p.Name))
+	} else {
+		pn("  err := &googleapi.OperationError{}")
+	}
+	if p := schemaProperty(es, "code"); p != nil && p.Schema.Type == "integer" {
+		pn("  err.Code = int(%s.%s)", field, initialCap(p.Name))
+	}
+	if p := schemaProperty(es, "message"); p != nil && p.Schema.Type == "string" {
+		pn("  err.Message = %s.%s", field, initialCap(p.Name))
+	}
+	if p := schemaProperty(es, "errors"); p != nil && p.Schema.Kind == disco.ArrayKind {
+		is := p.Schema.ElementSchema()
+		code, msg := schemaProperty(is, "code"), schemaProperty(is, "message")
+		if code != nil && msg != nil && code.Schema.Type == "string" && msg.Schema.Type == "string" {
+			pn("  for _, e := range %s.%s {", field, initialCap(p.Name))
+			pn("   err.Errors = append(err.Errors, googleapi.ErrorItem{Reason: e.%s, Message: e.%s})", initialCap(code.Name), initialCap(msg.Name))
+			pn("  }")
+		}
+	}
+	pn("  return err")
+	pn(" }")
+}
+
+// resourceNameLiteralRE matches the literal segments of a path parameter
+// pattern that can be turned into a resource name template.
+var resourceNameLiteralRE = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+// resourceNameTemplate converts a path parameter pattern such as
+// "^projects/[^/]+/secrets/[^/]+$" to a resource name template such as
+// "projects/{projectsId}/secrets/{secretsId}", naming each variable segment
+// after the literal segment that precedes it. It reports false if the
+// pattern contains anything other than literal and "[^/]+" segments.
+func resourceNameTemplate(pattern string) (string, bool) {
+	if !strings.HasPrefix(pattern, "^") || !strings.HasSuffix(pattern, "$") {
+		return "", false
+	}
+	// Replace the variable segments first, since they contain slashes.
+	pattern = strings.Replace(pattern[1:len(pattern)-1], "[^/]+", "*", -1)
+	segs := strings.Split(pattern, "/")
+	seen := map[string]bool{}
+	hasVar := false
+	for i, seg := range segs {
+		if seg != "*" {
+			if !resourceNameLiteralRE.MatchString(seg) {
+				return "", false
+			}
+			continue
+		}
+		if i == 0 || !resourceNameLiteralRE.MatchString(segs[i-1]) {
+			return "", false
+		}
+		v := segs[i-1] + "Id"
+		if seen[v] {
+			return "", false
+		}
+		seen[v] = true
+		segs[i] = "{" + v + "}"
+		hasVar = true
+	}
+	if !hasVar {
+		return "", false
+	}
+	return strings.Join(segs, "/"), true
+}
+
+// resourceNameTemplates returns the sorted resource name templates derived
+// from the path parameter patterns of the API's methods.
+func (a *API) resourceNameTemplates() []string {
+	set := map[string]bool{}
+	var add func(meths []*Method)
+	add = func(meths []*Method) {
+		for _, meth := range meths {
+			for _, p := range meth.Params() {
+				if p.p.Location != "path" || p.p.Pattern == "" {
+					continue
+				}
+				if t, ok := resourceNameTemplate(p.p.Pattern); ok {
+					set[t] = true
+				}
+			}
+		}
+	}
+	add(a.APIMethods())
+	var walk func(r *disco.Resource)
+	walk = func(r *disco.Resource) {
+		add(a.resourceMethods(r))
+		for _, res := range r.Resources {
+			walk(res)
+		}
+	}
+	for _, res := range a.doc.Resources {
+		walk(res)
+	}
+	var templates []string
+	for t := range set {
+		templates = append(templates, t)
+	}
+	sort.Strings(templates)
+	return templates
+}
+
+// generateResourceNames writes a type for each resource name template of
+// the API, with a Format method that builds the name and a Parse function
+// that splits a name into its variable segments.
+func (a *API) generateResourceNames() {
+	pn := a.pn
+	for _, template := range a.resourceNameTemplates() {
+		// parts holds the operands of the expression that formats the name.
+		var lits, vars, parts []string
+		lit := ""
+		for i, seg := range strings.Split(template, "/") {
+			if i > 0 {
+				lit += "/"
+			}
+			if !strings.HasPrefix(seg, "{") {
+				lits = append(lits, initialCap(seg))
+				lit += seg
+				continue
+			}
+			if lit != "" {
+				parts = append(parts, strconv.Quote(lit))
+				lit = ""
+			}
+			vars = append(vars, initialCap(seg[1:len(seg)-1]))
+			parts = append(parts, "n."+vars[len(vars)-1])
+		}
+		if lit != "" {
+			parts = append(parts, strconv.Quote(lit))
+		}
+		typ := a.GetName(strings.Join(lits, "") + "Name")
+		parse := a.GetName("Parse" + typ)
+
+		pn("\n// %s is a resource name of the form", typ)
+		pn("// %q.", template)
+		pn("type %s struct {", typ)
+		for _, v := range vars {
+			pn(" %s string", v)
+		}
+		pn("}")
+		pn("\n// Format returns the resource name identified by n, for use with the")
+		pn("// methods that take it as a parameter.")
+		pn("func (n %s) Format() string {", typ)
+		pn(" return %s", strings.Join(parts, " + "))
+		pn("}")
+		pn("\n// String returns n.Format().")
+		pn("func (n %s) String() string { return n.Format() }", typ)
+		pn("\n// %s parses a resource name of the form", parse)
+		pn("// %q.", template)
+		pn("func %s(name string) (%s, error) {", parse, typ)
+		pn(" vals, err := gensupport.ParseResourceName(%q, name)", template)
+		pn(" if err != nil { return %s{}, err }", typ)
+		pn(" return %s{", typ)
+		for i, v := range vars {
+			pn("  %s: vals[%d],", v, i)
+		}
+		pn(" }, nil")
+		pn("}")
+	}
+}
+
 func resourceGoField(r, parent *disco.Resource) string {
 	// Avoid conflicts with method names.
 	und := ""
@@ -1809,7 +2539,11 @@ func (meth *Method) generateCode() {
 	pn(" header_ http.Header")
 	pn("}")
 
-	p("\n%s", asComment("", methodName+": "+meth.m.Description))
+	des := meth.m.Description
+	if meth.m.Deprecated {
+		des = addDeprecated(des, "method")
+	}
+	p("\n%s", asComment("", methodName+": "+des))
 	if res != nil {
 		if url := canonicalDocsURL[fmt.Sprintf("%v%v/%v", docsLink, res.Name, meth.m.Name)]; url != "" {
 			pn("// For details, see %v", url)
@@ -1862,6 +2596,9 @@ func (meth *Method) generateCode() {
 		des := opt.p.Description
 		des = strings.Replace(des, "Optional.", "", 1)
 		des = strings.TrimSpace(des)
+		if opt.p.Deprecated {
+			des = addDeprecated(des, "parameter")
+		}
 		p("\n%s", asComment("", fmt.Sprintf("%s sets the optional parameter %q: %s", setter, opt.p.Name, des)))
 		addFieldValueComments(p, opt, "", true)
 		np := new(namePool)
@@ -1991,7 +2728,7 @@ func (meth *Method) generateCode() {
 
 	pn("\nfunc (c *%s) doRequest(alt string) (*http.Response, error) {", callName)
 	pn(`reqHeaders := make(http.Header)`)
-	pn(`reqHeaders.Set("x-goog-api-client", "gl-go/"+gensupport.GoVersion()+" gdcl/%s")`, version.Repo)
+	pn(`reqHeaders.Set("x-goog-api-client", "gl-go/"+gensupport.GoVersion()+" gdcl/%s gdcl-method/%s")`, version.Repo, meth.Id())
 	pn("for k, v := range c.header_ {")
 	pn(" reqHeaders[k] = v")
 	pn("}")
@@ -2015,7 +2752,11 @@ func (meth *Method) generateCode() {
 				if a.needsDataWrapper() {
 					style = "WithDataWrapper"
 				}
-				pn("body, err := googleapi.%s.JSONReader(c.%s)", style, ba.goname)
+				if hasReadOnly(ba.schema.typ, map[*disco.Schema]bool{}) {
+					pn("body, err := gensupport.JSONRequestReader(googleapi.%s, c.%s)", style, ba.goname)
+				} else {
+					pn("body, err := googleapi.%s.JSONReader(c.%s)", style, ba.goname)
+				}
 				pn("if err != nil { return nil, err }")
 			}
 
@@ -8,12 +8,18 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
 	"io/ioutil"
+	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 
-	"google.golang.org/api/google-api-go-generator/internal/disco"
+	"google.golang.org/api/internal/disco"
 	"google.golang.org/api/internal/version"
 )
 
@@ -38,11 +44,14 @@ func TestAPIs(t *testing.T) {
 		"mapofint64strings",
 		"mapofobjects",
 		"mapofstrings-1",
+		"metadata",
+		"operation-status",
 		"param-rename",
 		"quotednum",
 		"repeated",
 		"required-query",
 		"resource-named-service", // appengine/v1/appengine-api.json
+		"resource-names",
 		"unfortunatedefaults",
 		"variants",
 		"wrapnewlines",
@@ -84,6 +93,69 @@ func TestAPIs(t *testing.T) {
 	}
 }
 
+// TestMarshalJSONEquivalence builds the golden files with a test that checks
+// that the generated MarshalJSON methods agree with gensupport.MarshalJSON on
+// random values of each schema.
+func TestMarshalJSONEquivalence(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping build of golden files in short mode")
+	}
+	check, err := ioutil.ReadFile(filepath.Join("testdata", "marshaljson_test.go.in"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The packages must be within the module to import its internal packages.
+	dir, err := ioutil.TempDir(".", "marshaltest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	goldens, err := filepath.Glob(filepath.Join("testdata", "*.want"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, golden := range goldens {
+		name := strings.TrimSuffix(filepath.Base(golden), ".want")
+		if name == "param-rename" {
+			// Its parameter names shadow schema types, so it does not build.
+			continue
+		}
+		src, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), golden, src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var schemas []string
+		for _, d := range f.Decls {
+			if fd, ok := d.(*ast.FuncDecl); ok && fd.Recv != nil && fd.Name.Name == "MarshalJSON" {
+				recv := fd.Recv.List[0].Type.(*ast.StarExpr).X.(*ast.Ident)
+				schemas = append(schemas, fmt.Sprintf("new(%s)", recv.Name))
+			}
+		}
+		if len(schemas) == 0 {
+			continue
+		}
+		pkgDir := filepath.Join(dir, strings.Replace(name, "-", "", -1))
+		if err := os.Mkdir(pkgDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		test := strings.NewReplacer("PACKAGE", f.Name.Name, "SCHEMAS", strings.Join(schemas, ", ")).Replace(string(check))
+		if err := ioutil.WriteFile(filepath.Join(pkgDir, "api.go"), src, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(pkgDir, "marshaljson_test.go"), []byte(test), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command(filepath.Join(runtime.GOROOT(), "bin", "go"), "test", "./"+filepath.Base(dir)+"/...")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+}
+
 func TestScope(t *testing.T) {
 	tests := [][]string{
 		{
@@ -242,3 +314,26 @@ func TestIsNewerRevision(t *testing.T) {
 		t.Fatalf("got %v, want %v", err, errOldRevision)
 	}
 }
+
+func TestResourceNameTemplate(t *testing.T) {
+	for _, test := range []struct {
+		pattern string
+		want    string
+		ok      bool
+	}{
+		{"^projects/[^/]+$", "projects/{projectsId}", true},
+		{"^projects/[^/]+/secrets/[^/]+$", "projects/{projectsId}/secrets/{secretsId}", true},
+		{"^projects/[^/]+/locations/[^/]+/settings$", "projects/{projectsId}/locations/{locationsId}/settings", true},
+		{"^projects/[^/]+/secrets/.*$", "", false},
+		{"^[^/]+$", "", false},
+		{"^projects/[^/]+/[^/]+$", "", false},
+		{"^projects/[^/]+/projects/[^/]+$", "", false},
+		{"^projects$", "", false},
+		{"projects/[^/]+", "", false},
+	} {
+		got, ok := resourceNameTemplate(test.pattern)
+		if got != test.want || ok != test.ok {
+			t.Errorf("resourceNameTemplate(%q) = %q, %t; want %q, %t", test.pattern, got, ok, test.want, test.ok)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package googleapi
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A FieldPath identifies a field of an API schema by the JSON names of the
+// fields that lead to it, starting from the top-level schema. Generated
+// packages provide builders for the field paths of each of their schemas.
+type FieldPath []string
+
+// Child returns the path of the field name within the field identified by p.
+// It may also be used to refer to a key of a map field.
+func (p FieldPath) Child(name string) FieldPath {
+	c := make(FieldPath, len(p), len(p)+1)
+	copy(c, p)
+	return append(c, name)
+}
+
+// Field returns p as a Field, for use with partial responses.
+func (p FieldPath) Field() Field {
+	return Field(strings.Join(p, "/"))
+}
+
+// identRE matches field path segments that need no quoting in update masks.
+var identRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// String returns p in the dotted form used by update masks, such as
+// "labels.env". Segments that are not identifiers, such as some map keys,
+// are quoted with backticks.
+func (p FieldPath) String() string {
+	segs := make([]string, len(p))
+	for i, s := range p {
+		if identRE.MatchString(s) {
+			segs[i] = s
+		} else {
+			segs[i] = "`" + strings.Replace(s, "`", "``", -1) + "`"
+		}
+	}
+	return strings.Join(segs, ".")
+}
+
+// UpdateMask returns the update mask that lists paths, for use with the
+// updateMask parameter of PATCH methods.
+func UpdateMask(paths ...FieldPath) string {
+	r := make([]string, len(paths))
+	for i, p := range paths {
+		r[i] = p.String()
+	}
+	return strings.Join(r, ",")
+}
+
+// DiffFields returns the paths of the fields that would change if the
+// schema value new were sent in a PATCH request for a resource whose
+// current value is old. Both must be pointers to structs of the same
+// generated schema type. If old is nil, every field that would be sent is
+// reported.
+//
+// Following the rules used to encode requests, a field of new is considered
+// to be sent if it has a non-empty value or is listed in ForceSendFields,
+// and to be cleared if it is listed in NullFields. Sent fields that differ
+// from old are reported, as are cleared fields. Nested schemas present in
+// both old and new are compared field by field.
+func DiffFields(old, new interface{}) ([]FieldPath, error) {
+	nv := reflect.ValueOf(new)
+	if nv.Kind() != reflect.Ptr || nv.IsNil() || nv.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("googleapi: DiffFields: new is %T, want non-nil pointer to struct", new)
+	}
+	var ov reflect.Value // invalid if there is no old value
+	if old != nil {
+		v := reflect.ValueOf(old)
+		if v.Type() != nv.Type() {
+			return nil, fmt.Errorf("googleapi: DiffFields: old is %T, want %T", old, new)
+		}
+		if !v.IsNil() {
+			ov = v.Elem()
+		}
+	}
+	return diffStructs(nil, ov, nv.Elem(), nil)
+}
+
+// diffStructs returns the paths of the fields of the struct nv that differ
+// from those of ov, below path. forced are the entries of ForceSendFields
+// of the enclosing structs that are dotted paths into nv, such as "Field"
+// for "Child.Field", which force fields of nv to be sent like its own
+// ForceSendFields.
+func diffStructs(path FieldPath, ov, nv reflect.Value, forced []string) ([]FieldPath, error) {
+	force, err := stringSet(nv, "ForceSendFields")
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range forced {
+		force[f] = true
+	}
+	null, err := stringSet(nv, "NullFields")
+	if err != nil {
+		return nil, err
+	}
+	var paths []FieldPath
+	t := nv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := jsonName(f)
+		if name == "" {
+			continue
+		}
+		p := path.Child(name)
+		n := nv.Field(i)
+		if null[f.Name] {
+			paths = append(paths, p)
+			continue
+		}
+		// Nested values listed in NullFields with dotted paths, such as
+		// "Field.key" for a map entry, are cleared individually.
+		var nullKeys []FieldPath
+		for nf := range null {
+			if strings.HasPrefix(nf, f.Name+".") {
+				nullKeys = append(nullKeys, nestedPath(p, f.Type, nf[len(f.Name)+1:]))
+			}
+		}
+		if len(nullKeys) > 0 {
+			sort.Slice(nullKeys, func(i, j int) bool { return nullKeys[i].String() < nullKeys[j].String() })
+			paths = append(paths, nullKeys...)
+		}
+		switch {
+		case n.Kind() == reflect.Ptr || n.Kind() == reflect.Interface:
+			// Nil pointers and interfaces are never sent.
+			if n.IsNil() {
+				continue
+			}
+		case isEmptyValue(n) && !force[f.Name]:
+			continue
+		}
+		if !ov.IsValid() {
+			paths = append(paths, p)
+			continue
+		}
+		o := ov.Field(i)
+		if n.Kind() == reflect.Ptr && n.Elem().Kind() == reflect.Struct && !o.IsNil() {
+			var nested []string
+			for ff := range force {
+				if strings.HasPrefix(ff, f.Name+".") {
+					nested = append(nested, ff[len(f.Name)+1:])
+				}
+			}
+			sub, err := diffStructs(p, o.Elem(), n.Elem(), nested)
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, sub...)
+			continue
+		}
+		if !reflect.DeepEqual(o.Interface(), n.Interface()) {
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
+
+// nestedPath returns the field path of the value identified by rest, the
+// remainder of a dotted NullFields entry, within the field with path p and
+// type t. Go field names in rest are replaced by their JSON names.
+func nestedPath(p FieldPath, t reflect.Type, rest string) FieldPath {
+	for rest != "" {
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		seg := rest
+		switch t.Kind() {
+		case reflect.Struct, reflect.Slice:
+		case reflect.Map:
+			if k := t.Elem().Kind(); k != reflect.Ptr && k != reflect.Struct && k != reflect.Map && k != reflect.Slice {
+				// Keys of maps of simple values may contain dots.
+				return p.Child(rest)
+			}
+		default:
+			return p.Child(rest)
+		}
+		rest = ""
+		if i := strings.IndexByte(seg, '.'); i >= 0 {
+			seg, rest = seg[:i], seg[i+1:]
+		}
+		if t.Kind() == reflect.Struct {
+			f, ok := t.FieldByName(seg)
+			if !ok {
+				// Paths below unknown fields are kept as they are.
+				p = p.Child(seg)
+				if rest != "" {
+					p = p.Child(rest)
+				}
+				return p
+			}
+			if name := jsonName(f); name != "" {
+				seg = name
+			}
+			t = f.Type
+		} else {
+			t = t.Elem()
+		}
+		p = p.Child(seg)
+	}
+	return p
+}
+
+// jsonName returns the JSON name of the schema field f, or "" if f is not
+// encoded.
+func jsonName(f reflect.StructField) string {
+	tag := f.Tag.Get("json")
+	if i := strings.Index(tag, ","); i >= 0 {
+		tag = tag[:i]
+	}
+	if tag == "-" {
+		return ""
+	}
+	return tag
+}
+
+// stringSet returns the elements of the []string field name of the struct v
+// as a set.
+func stringSet(v reflect.Value, name string) (map[string]bool, error) {
+	set := map[string]bool{}
+	f := v.FieldByName(name)
+	if !f.IsValid() {
+		return set, nil
+	}
+	ss, ok := f.Interface().([]string)
+	if !ok {
+		return nil, errors.New("googleapi: DiffFields: " + name + " is not a []string")
+	}
+	for _, s := range ss {
+		set[s] = true
+	}
+	return set, nil
+}
+
+// isEmptyValue reports whether v is the empty value for its type, and so is
+// omitted from requests unless it is listed in ForceSendFields.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
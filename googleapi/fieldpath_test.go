@@ -0,0 +1,169 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package googleapi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFieldPath(t *testing.T) {
+	root := FieldPath(nil)
+	labels := root.Child("labels")
+	p := labels.Child("env")
+	if got, want := p.Field(), Field("labels/env"); got != want {
+		t.Errorf("Field() = %q, want %q", got, want)
+	}
+	if got, want := p.String(), "labels.env"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got, want := labels.Child("app.kubernetes.io/name").String(), "labels.`app.kubernetes.io/name`"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	// Children of the same path must not share storage.
+	a, b := labels.Child("a"), labels.Child("b")
+	if a[1] != "a" || b[1] != "b" {
+		t.Errorf("got %v and %v, want independent paths", a, b)
+	}
+	if got, want := UpdateMask(root.Child("name"), p), "name,labels.env"; got != want {
+		t.Errorf("UpdateMask() = %q, want %q", got, want)
+	}
+}
+
+type diffInner struct {
+	Size  int64  `json:"size,omitempty,string"`
+	Color string `json:"color,omitempty"`
+
+	ForceSendFields []string `json:"-"`
+	NullFields      []string `json:"-"`
+}
+
+type diffOuter struct {
+	Name   string            `json:"name,omitempty"`
+	Count  int64             `json:"count,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Tags   []string          `json:"tags,omitempty"`
+	Inner  *diffInner        `json:"inner,omitempty"`
+
+	ServerResponse  `json:"-"`
+	ForceSendFields []string `json:"-"`
+	NullFields      []string `json:"-"`
+}
+
+func TestDiffFields(t *testing.T) {
+	old := &diffOuter{
+		Name:   "a",
+		Count:  3,
+		Labels: map[string]string{"env": "prod"},
+		Tags:   []string{"x"},
+		Inner:  &diffInner{Size: 1, Color: "red"},
+	}
+	for _, test := range []struct {
+		desc string
+		old  *diffOuter
+		new  *diffOuter
+		want []string
+	}{
+		{
+			desc: "identical",
+			old:  old,
+			new:  old,
+			want: nil,
+		},
+		{
+			desc: "empty fields are not sent",
+			old:  old,
+			new:  &diffOuter{},
+			want: nil,
+		},
+		{
+			desc: "changed scalars and collections",
+			old:  old,
+			new: &diffOuter{
+				Name:   "b",
+				Count:  3,
+				Labels: map[string]string{"env": "dev"},
+				Tags:   []string{"x", "y"},
+			},
+			want: []string{"name", "labels", "tags"},
+		},
+		{
+			desc: "force send",
+			old:  old,
+			new:  &diffOuter{Name: "a", ForceSendFields: []string{"Name", "Count"}},
+			want: []string{"count"},
+		},
+		{
+			desc: "null fields",
+			old:  old,
+			new:  &diffOuter{NullFields: []string{"Tags", "Labels.env", "Labels.b"}},
+			want: []string{"labels.b", "labels.env", "tags"},
+		},
+		{
+			desc: "nested",
+			old:  old,
+			new:  &diffOuter{Inner: &diffInner{Size: 1, Color: "blue", NullFields: []string{"Size"}}},
+			want: []string{"inner.size", "inner.color"},
+		},
+		{
+			desc: "null nested fields",
+			old:  old,
+			new:  &diffOuter{Inner: &diffInner{Size: 1}, NullFields: []string{"Inner.Color"}},
+			want: []string{"inner.color"},
+		},
+		{
+			desc: "force send nested fields",
+			old:  old,
+			new:  &diffOuter{Inner: &diffInner{Size: 1}, ForceSendFields: []string{"Inner.Color"}},
+			want: []string{"inner.color"},
+		},
+		{
+			desc: "force send nested fields of both structs",
+			old:  old,
+			new:  &diffOuter{Inner: &diffInner{ForceSendFields: []string{"Size"}}, ForceSendFields: []string{"Inner.Color"}},
+			want: []string{"inner.size", "inner.color"},
+		},
+		{
+			desc: "new nested",
+			old:  &diffOuter{},
+			new:  &diffOuter{Inner: &diffInner{Color: "blue"}},
+			want: []string{"inner"},
+		},
+		{
+			desc: "nil old",
+			old:  nil,
+			new:  &diffOuter{Name: "a", ForceSendFields: []string{"Count"}},
+			want: []string{"name", "count"},
+		},
+	} {
+		paths, err := DiffFields(test.old, test.new)
+		if err != nil {
+			t.Errorf("%s: %v", test.desc, err)
+			continue
+		}
+		var got []string
+		for _, p := range paths {
+			got = append(got, p.String())
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestDiffFieldsErrors(t *testing.T) {
+	for _, test := range []struct {
+		old, new interface{}
+	}{
+		{nil, nil},
+		{nil, diffOuter{}},
+		{&diffInner{}, &diffOuter{}},
+		{nil, new(int)},
+	} {
+		if _, err := DiffFields(test.old, test.new); err == nil {
+			t.Errorf("DiffFields(%T, %T): got nil error, want error", test.old, test.new)
+		}
+	}
+}
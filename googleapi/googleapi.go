@@ -109,6 +109,41 @@ func (e *Error) Error() string {
 	return buf.String()
 }
 
+// OperationError describes the failure of a long-running operation, as
+// reported in the operation's error field once it has completed.
+type OperationError struct {
+	// Name is the name of the operation that failed.
+	Name string
+	// Code is the error code reported for the operation, if any. For
+	// operations that report a google.rpc.Status, it is a canonical gRPC
+	// status code rather than an HTTP status code.
+	Code int
+	// Message is the error message reported for the operation, if any.
+	Message string
+	// Errors contains the individual errors reported for the operation.
+	// Reason holds the error type identifier reported by the service.
+	Errors []ErrorItem
+}
+
+func (e *OperationError) Error() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "googleapi: operation %s failed", e.Name)
+	if e.Code != 0 {
+		fmt.Fprintf(&buf, " with code %d", e.Code)
+	}
+	if e.Message != "" {
+		fmt.Fprintf(&buf, ": %s", e.Message)
+	}
+	for i, v := range e.Errors {
+		sep := ", "
+		if i == 0 && e.Message == "" {
+			sep = ": "
+		}
+		fmt.Fprintf(&buf, "%s%s (%s)", sep, v.Message, v.Reason)
+	}
+	return buf.String()
+}
+
 type errorReply struct {
 	Error *Error `json:"error"`
 }
@@ -233,10 +268,29 @@ func ChunkSize(size int) MediaOption {
 	return chunkSizeOption(size)
 }
 
+type gzipOption bool
+
+func (g gzipOption) setOptions(o *MediaOptions) {
+	o.Gzip = bool(g)
+}
+
+// Gzip returns a MediaOption which compresses single request media uploads
+// with gzip as they are sent, and sets the Content-Encoding header of the
+// upload request to "gzip". The whole request body is compressed as it is
+// read from the media. The server decompresses the request, so the uploaded
+// media is unchanged. Only use it with APIs that accept compressed requests.
+//
+// The chunks of resumable uploads are sent uncompressed, as their
+// Content-Range header must count the bytes sent.
+func Gzip() MediaOption {
+	return gzipOption(true)
+}
+
 // MediaOptions stores options for customizing media upload.  It is not used by developers directly.
 type MediaOptions struct {
 	ContentType           string
 	ForceEmptyContentType bool
+	Gzip                  bool
 
 	ChunkSize int
 }
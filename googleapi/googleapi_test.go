@@ -290,6 +290,36 @@ func TestCheckResponse(t *testing.T) {
 	}
 }
 
+func TestOperationError(t *testing.T) {
+	for _, test := range []struct {
+		in   *OperationError
+		want string
+	}{
+		{
+			&OperationError{Name: "op-1"},
+			"googleapi: operation op-1 failed",
+		},
+		{
+			&OperationError{Name: "apps/a/operations/1", Code: 5, Message: "not found"},
+			"googleapi: operation apps/a/operations/1 failed with code 5: not found",
+		},
+		{
+			&OperationError{
+				Name: "op-2",
+				Errors: []ErrorItem{
+					{Reason: "QUOTA_EXCEEDED", Message: "Quota exceeded"},
+					{Reason: "RESOURCE_NOT_READY", Message: "Disk not ready"},
+				},
+			},
+			"googleapi: operation op-2 failed: Quota exceeded (QUOTA_EXCEEDED), Disk not ready (RESOURCE_NOT_READY)",
+		},
+	} {
+		if got := test.in.Error(); got != test.want {
+			t.Errorf("%+v.Error():\ngot:  %q\nwant: %q", test.in, got, test.want)
+		}
+	}
+}
+
 type VariantPoint struct {
 	Type        string
 	Coordinates []float64
@@ -29,7 +29,8 @@ const (
 
 var defaultValidator = &Validator{client: newCachingClient(http.DefaultClient)}
 
-// Payload represents a decoded payload of an ID Token.
+// Payload represents a decoded payload of an ID Token. Claims holds all the
+// claims of the token, including those decoded into the other fields.
 type Payload struct {
 	Issuer   string                 `json:"iss"`
 	Audience string                 `json:"aud"`
@@ -277,6 +278,10 @@ func (j *jwt) parsedPayload() (*Payload, error) {
 	if err != nil {
 		return nil, fmt.Errorf("idtoken: unable to unmarshal JWT payload: %v", err)
 	}
+	err = json.Unmarshal(dp, &p.Claims)
+	if err != nil {
+		return nil, fmt.Errorf("idtoken: unable to unmarshal JWT payload claims: %v", err)
+	}
 	return &p, nil
 }
 
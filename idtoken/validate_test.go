@@ -17,6 +17,7 @@ import (
 	"io/ioutil"
 	"math/big"
 	"net/http"
+	"reflect"
 	"testing"
 
 	"google.golang.org/api/option"
@@ -76,6 +77,9 @@ func TestValidateRS256(t *testing.T) {
 			if !tt.wantErr && payload.Audience != testAudience {
 				t.Fatalf("got %v, want %v", payload.Audience, testAudience)
 			}
+			if !tt.wantErr && payload.Claims["iss"] != "example.com" {
+				t.Fatalf("got claims %v, want iss claim %q", payload.Claims, "example.com")
+			}
 		})
 	}
 }
@@ -194,6 +198,28 @@ func commonToken(t *testing.T, alg string) *jwt {
 	}
 }
 
+func TestParsedPayloadClaims(t *testing.T) {
+	pb := []byte(`{"iss":"example.com","aud":"test-audience","exp":1588334400,"email":"sa@example.com","email_verified":true}`)
+	j := &jwt{payload: base64.RawURLEncoding.EncodeToString(pb)}
+	p, err := j.parsedPayload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Issuer != "example.com" || p.Audience != testAudience || p.Expires != 1588334400 {
+		t.Errorf("got payload %+v", p)
+	}
+	want := map[string]interface{}{
+		"iss":            "example.com",
+		"aud":            testAudience,
+		"exp":            float64(1588334400),
+		"email":          "sa@example.com",
+		"email_verified": true,
+	}
+	if !reflect.DeepEqual(p.Claims, want) {
+		t.Errorf("got claims %v, want %v", p.Claims, want)
+	}
+}
+
 type RoundTripFn func(req *http.Request) *http.Response
 
 func (f RoundTripFn) RoundTrip(req *http.Request) (*http.Response, error) { return f(req), nil }
@@ -10,19 +10,24 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
 	storage "google.golang.org/api/storage/v1"
+	"google.golang.org/api/transport/http/httpreplay"
 )
 
 type object struct {
@@ -41,8 +46,17 @@ var (
 	}
 	aclObjects = []string{"acl1", "acl2"}
 	copyObj    = "copy-object"
+
+	recordDir = flag.String("record", "", "record the requests made by each test to a file in this directory")
+	replayDir = flag.String("replay", "", "replay the requests recorded in this directory instead of using the network")
 )
 
+// replayInitial is stored in recorded files, for the tests to use the same
+// project and bucket when replaying.
+type replayInitial struct {
+	ProjectID, Bucket string
+}
+
 const (
 	envProject    = "GCLOUD_TESTS_GOLANG_PROJECT_ID"
 	envPrivateKey = "GCLOUD_TESTS_GOLANG_KEY"
@@ -153,7 +167,76 @@ func createService() *storage.Service {
 	return s
 }
 
+// testService returns the service used by t. With the -record or -replay
+// flag, the requests of t are recorded to or replayed from its own file, so
+// that each test, and each run of it, replays its recording from the start.
+// done must be called when t is done, to write the recording or to check
+// that all the recorded requests were replayed.
+func testService(t *testing.T) (s *storage.Service, done func()) {
+	ctx := context.Background()
+	switch {
+	case *replayDir != "":
+		filename := filepath.Join(*replayDir, t.Name()+".replay")
+		rep, err := httpreplay.NewReplayer(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var initial replayInitial
+		if err := json.Unmarshal(rep.Initial(), &initial); err != nil {
+			t.Fatalf("reading %s: %v", filename, err)
+		}
+		projectID, bucket = initial.ProjectID, initial.Bucket
+		if s, err = storage.NewService(ctx, option.WithHTTPClient(rep.Client())); err != nil {
+			t.Fatal(err)
+		}
+		return s, func() {
+			if err := rep.Close(); err != nil {
+				t.Error(err)
+			}
+		}
+	case *recordDir != "":
+		projectID, bucket = os.Getenv(envProject), os.Getenv(envBucket)
+		if projectID == "" || bucket == "" {
+			t.Fatal("no project ID or bucket specified")
+		}
+		ts, err := tokenSource(ctx, storage.DevstorageFullControlScope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		initial, err := json.Marshal(replayInitial{ProjectID: projectID, Bucket: bucket})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec, err := httpreplay.NewRecorder(filepath.Join(*recordDir, t.Name()+".replay"), initial)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, err := rec.Client(ctx, option.WithTokenSource(ts))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s, err = storage.NewService(ctx, option.WithHTTPClient(client)); err != nil {
+			t.Fatal(err)
+		}
+		return s, func() {
+			if err := rec.Close(); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+	if s = createService(); s == nil {
+		t.Fatal("Could not create service")
+	}
+	return s, func() {}
+}
+
 func TestMain(m *testing.M) {
+	flag.Parse()
+	// Replayed tests do not use the bucket. Recorded ones use it like live
+	// ones, but the cleanup is not recorded.
+	if *replayDir != "" {
+		os.Exit(m.Run())
+	}
 	if err := cleanup(); err != nil {
 		log.Fatalf("Pre-test cleanup failed: %v", err)
 	}
@@ -165,10 +248,8 @@ func TestMain(m *testing.M) {
 }
 
 func TestContentType(t *testing.T) {
-	s := createService()
-	if s == nil {
-		t.Fatal("Could not create service")
-	}
+	s, done := testService(t)
+	defer done()
 
 	type testCase struct {
 		objectContentType    string
@@ -256,10 +337,8 @@ func TestContentType(t *testing.T) {
 }
 
 func TestFunctions(t *testing.T) {
-	s := createService()
-	if s == nil {
-		t.Fatal("Could not create service")
-	}
+	s, done := testService(t)
+	defer done()
 
 	t.Logf("Listing buckets for project %q", projectID)
 	var numBuckets int
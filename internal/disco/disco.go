@@ -20,16 +20,36 @@ type Document struct {
 	Version           string             `json:"version"`
 	Title             string             `json:"title"`
 	RootURL           string             `json:"rootUrl"`
+	MTLSRootURL       string             `json:"mtlsRootUrl"`
 	ServicePath       string             `json:"servicePath"`
 	BasePath          string             `json:"basePath"`
+	BatchPath         string             `json:"batchPath"`
 	DocumentationLink string             `json:"documentationLink"`
 	Auth              Auth               `json:"auth"`
 	Features          []string           `json:"features"`
+	Parameters        ParameterList      `json:"parameters"`
 	Methods           MethodList         `json:"methods"`
 	Schemas           map[string]*Schema `json:"schemas"`
 	Resources         ResourceList       `json:"resources"`
 }
 
+// EmulatorHostEnv returns the name of the environment variable that holds the
+// address of a local emulator of the API, like "STORAGE_EMULATOR_HOST" for the
+// API named "storage".
+func (d *Document) EmulatorHostEnv() string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, d.Name)
+	return name + "_EMULATOR_HOST"
+}
+
 // init performs additional initialization and checks that
 // were not done during unmarshaling.
 func (d *Document) init() error {
@@ -139,6 +159,8 @@ type Schema struct {
 	// Google extensions to JSON Schema
 	EnumDescriptions []string
 	Variant          *Variant
+	ReadOnly         bool
+	Deprecated       bool
 
 	RefSchema *Schema `json:"-"` // Schema referred to by $ref
 	Name      string  `json:"-"` // Schema name, if top level
@@ -367,6 +389,7 @@ type Method struct {
 	Scopes                []string
 	MediaUpload           *MediaUpload
 	SupportsMediaDownload bool
+	Deprecated            bool
 
 	JSONMap map[string]interface{} `json:"-"`
 }
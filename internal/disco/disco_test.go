@@ -31,8 +31,10 @@ func TestDocument(t *testing.T) {
 		Version:           "v1",
 		Title:             "Cloud Storage JSON API",
 		RootURL:           "https://www.googleapis.com/",
+		MTLSRootURL:       "https://www.mtls.googleapis.com/",
 		ServicePath:       "storage/v1/",
 		BasePath:          "/storage/v1/",
+		BatchPath:         "batch",
 		DocumentationLink: "https://developers.google.com/storage/docs/json_api/",
 		Auth: Auth{
 			OAuth2Scopes: []Scope{
@@ -49,6 +51,68 @@ func TestDocument(t *testing.T) {
 			},
 		},
 		Features: []string{"dataWrapper"},
+		Parameters: ParameterList{
+			&Parameter{
+				Name: "alt",
+				Schema: Schema{
+					Type:             "string",
+					Description:      "Data format for the response.",
+					Default:          "json",
+					Enums:            []string{"json"},
+					EnumDescriptions: []string{"Responses with Content-Type of application/json"},
+				},
+				Location: "query",
+			},
+			&Parameter{
+				Name: "fields",
+				Schema: Schema{
+					Type:        "string",
+					Description: "Selector specifying which fields to include in a partial response.",
+				},
+				Location: "query",
+			},
+			&Parameter{
+				Name: "key",
+				Schema: Schema{
+					Type:        "string",
+					Description: "API key. Your API key identifies your project and provides you with API access, quota, and reports. Required unless you provide an OAuth 2.0 token.",
+				},
+				Location: "query",
+			},
+			&Parameter{
+				Name: "oauth_token",
+				Schema: Schema{
+					Type:        "string",
+					Description: "OAuth 2.0 token for the current user.",
+				},
+				Location: "query",
+			},
+			&Parameter{
+				Name: "prettyPrint",
+				Schema: Schema{
+					Type:        "boolean",
+					Description: "Returns response with indentations and line breaks.",
+					Default:     "true",
+				},
+				Location: "query",
+			},
+			&Parameter{
+				Name: "quotaUser",
+				Schema: Schema{
+					Type:        "string",
+					Description: "Available to use for quota purposes for server-side applications. Can be any arbitrary string assigned to a user, but should not exceed 40 characters. Overrides userIp if both are provided.",
+				},
+				Location: "query",
+			},
+			&Parameter{
+				Name: "userIp",
+				Schema: Schema{
+					Type:        "string",
+					Description: "IP address of the site where the request originates. Use this if you want to enforce per-user limits.",
+				},
+				Location: "query",
+			},
+		},
 		Schemas: map[string]*Schema{
 			"Bucket": {
 				Name:        "Bucket",
@@ -77,7 +141,11 @@ func TestDocument(t *testing.T) {
 							},
 						},
 					}},
-					{"id", stringSchema},
+					{"id", &Schema{
+						Type:     "string",
+						Kind:     SimpleKind,
+						ReadOnly: true,
+					}},
 					{"kind", &Schema{
 						Type:    "string",
 						Kind:    SimpleKind,
@@ -123,6 +191,7 @@ func TestDocument(t *testing.T) {
 				Path:       "oauth2/v1/certs",
 				HTTPMethod: "GET",
 				Response:   &Schema{Ref: "Bucket", Kind: ReferenceKind},
+				Deprecated: true,
 			},
 		},
 		Resources: ResourceList{
@@ -275,3 +344,19 @@ func TestErrorDoc(t *testing.T) {
 		t.Errorf("got %v, want 404", err)
 	}
 }
+
+func TestEmulatorHostEnv(t *testing.T) {
+	for _, test := range []struct {
+		name, want string
+	}{
+		{"storage", "STORAGE_EMULATOR_HOST"},
+		{"pubsub", "PUBSUB_EMULATOR_HOST"},
+		{"cloudResourceManager", "CLOUDRESOURCEMANAGER_EMULATOR_HOST"},
+		{"my-api2", "MY_API2_EMULATOR_HOST"},
+	} {
+		d := &Document{Name: test.name}
+		if got := d.EmulatorHostEnv(); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// A JSONDecoder decodes the JSON object of a schema one field at a time,
+// without reflecting over the schema. Generated UnmarshalJSON methods call
+// Next for each key of the object, then one of the value methods to decode
+// the value of the fields they know, and finally Err.
+//
+// Like encoding/json, it decodes JSON null as no change to a field, and
+// ignores unknown keys. Unlike encoding/json, keys are matched exactly, not
+// case-insensitively: the APIs send the exact field names. Integer fields
+// are decoded from JSON numbers or strings, and float fields also from the
+// strings "NaN", "Infinity" and "-Infinity".
+//
+// It is intended for use by generated code only.
+type JSONDecoder struct {
+	data     []byte
+	pos      int
+	key      string
+	started  bool
+	consumed bool // whether the value of key has been decoded
+	done     bool
+	err      error
+}
+
+// NewJSONDecoder returns a JSONDecoder for the JSON object data.
+func NewJSONDecoder(data []byte) *JSONDecoder {
+	d := &JSONDecoder{data: data}
+	if !json.Valid(data) {
+		// Report the same syntax error as encoding/json.
+		var v interface{}
+		d.err = json.Unmarshal(data, &v)
+		if d.err == nil {
+			d.err = fmt.Errorf("invalid JSON %q", data)
+		}
+		return d
+	}
+	d.skipSpace()
+	switch k := jsonKind(d.data[d.pos]); k {
+	case "object":
+	case "null":
+		d.done = true
+	default:
+		d.err = fmt.Errorf("json: cannot unmarshal %s into a schema", k)
+	}
+	return d
+}
+
+// Next advances to the next key of the object, skipping the value of the
+// current key if it was not decoded. It reports false at the end of the
+// object, or after an error.
+func (d *JSONDecoder) Next() bool {
+	if d.err != nil || d.done {
+		return false
+	}
+	if !d.started {
+		d.started = true
+		d.pos++ // '{'
+	} else {
+		if !d.consumed {
+			d.skip()
+		}
+		d.skipSpace()
+		if d.data[d.pos] == ',' {
+			d.pos++
+		}
+	}
+	d.skipSpace()
+	if d.data[d.pos] == '}' {
+		d.done = true
+		return false
+	}
+	d.key = unquote(d.skip())
+	d.skipSpace()
+	d.pos++ // ':'
+	d.skipSpace()
+	d.consumed = false
+	return true
+}
+
+// Key returns the current key.
+func (d *JSONDecoder) Key() string {
+	return d.key
+}
+
+// Err returns the first error decoding the object or its fields.
+func (d *JSONDecoder) Err() error {
+	return d.err
+}
+
+// Null reports whether the value of the current key is null, in which case
+// it is consumed.
+func (d *JSONDecoder) Null() bool {
+	if d.data[d.pos] != 'n' {
+		return false
+	}
+	d.skip()
+	return true
+}
+
+// String decodes the value of the current key as a string. It reports
+// false if the value is null, or on error.
+func (d *JSONDecoder) String() (string, bool) {
+	v, ok := d.scalar("string")
+	if !ok {
+		return "", false
+	}
+	return unquote(v), true
+}
+
+// Bool decodes the value of the current key as a bool. It reports false if
+// the value is null, or on error.
+func (d *JSONDecoder) Bool() (bool, bool) {
+	v, ok := d.scalar("bool")
+	if !ok {
+		return false, false
+	}
+	return v[0] == 't', true
+}
+
+// Float decodes the value of the current key as a float64. It reports false
+// if the value is null, or on error.
+func (d *JSONDecoder) Float() (float64, bool) {
+	v, ok := d.scalar("number", "string")
+	if !ok {
+		return 0, false
+	}
+	if v[0] != '"' {
+		f, err := strconv.ParseFloat(string(v), 64)
+		return f, d.fail(err)
+	}
+	switch s := unquote(v); s {
+	case "NaN":
+		return math.NaN(), true
+	case "Infinity":
+		return math.Inf(1), true
+	case "-Infinity":
+		return math.Inf(-1), true
+	default:
+		return 0, d.fail(fmt.Errorf("bad float string %q", s))
+	}
+}
+
+// Int decodes the value of the current key as a signed integer of the given
+// bit size. It reports false if the value is null, or on error.
+func (d *JSONDecoder) Int(bitSize int) (int64, bool) {
+	v, ok := d.scalar("number", "string")
+	if !ok {
+		return 0, false
+	}
+	i, err := strconv.ParseInt(unquote(v), 10, bitSize)
+	return i, d.fail(err)
+}
+
+// Uint decodes the value of the current key as an unsigned integer of the
+// given bit size. It reports false if the value is null, or on error.
+func (d *JSONDecoder) Uint(bitSize int) (uint64, bool) {
+	v, ok := d.scalar("number", "string")
+	if !ok {
+		return 0, false
+	}
+	i, err := strconv.ParseUint(unquote(v), 10, bitSize)
+	return i, d.fail(err)
+}
+
+// Strings decodes the value of the current key as a []string. It reports
+// false if the value is null, or on error.
+func (d *JSONDecoder) Strings() ([]string, bool) {
+	if !d.begin("array") {
+		return nil, false
+	}
+	l := []string{}
+	for d.more(']') {
+		e, ok := d.element()
+		if !ok {
+			return nil, false
+		}
+		l = append(l, e)
+	}
+	return l, true
+}
+
+// StringMap decodes the value of the current key as a map[string]string,
+// adding its entries to m, which is allocated if nil. It reports false if
+// the value is null, or on error.
+func (d *JSONDecoder) StringMap(m map[string]string) (map[string]string, bool) {
+	if !d.begin("object") {
+		return nil, false
+	}
+	if m == nil {
+		m = make(map[string]string)
+	}
+	for d.more('}') {
+		k := unquote(d.skip())
+		d.skipSpace()
+		d.pos++ // ':'
+		d.skipSpace()
+		e, ok := d.element()
+		if !ok {
+			return nil, false
+		}
+		m[k] = e
+	}
+	return m, true
+}
+
+// begin consumes the opening delimiter of the value of the current key,
+// and reports whether it is of the given kind, an object or an array.
+// Otherwise, it consumes the value, and records an error unless it is null.
+func (d *JSONDecoder) begin(kind string) bool {
+	if jsonKind(d.data[d.pos]) != kind {
+		d.scalar(kind)
+		return false
+	}
+	d.consumed = true
+	d.pos++
+	return true
+}
+
+// more advances to the next element of the array or object being decoded,
+// and reports whether there is one, or consumes the closing delimiter end.
+func (d *JSONDecoder) more(end byte) bool {
+	d.skipSpace()
+	if d.data[d.pos] == ',' {
+		d.pos++
+		d.skipSpace()
+	}
+	if d.data[d.pos] == end {
+		d.pos++
+		return false
+	}
+	return true
+}
+
+// element consumes a string element of the array or object being decoded.
+// null decodes as the empty string.
+func (d *JSONDecoder) element() (string, bool) {
+	v := d.skip()
+	switch k := jsonKind(v[0]); k {
+	case "string":
+		return unquote(v), true
+	case "null":
+		return "", true
+	default:
+		return "", d.fail(fmt.Errorf("cannot unmarshal %s into a string", k))
+	}
+}
+
+// Value decodes the value of the current key into v, a pointer to a field,
+// with encoding/json.
+func (d *JSONDecoder) Value(v interface{}) {
+	d.fail(json.Unmarshal(d.skip(), v))
+}
+
+// scalar consumes the value of the current key, and returns it if it is
+// not null and is one of the given kinds.
+func (d *JSONDecoder) scalar(kinds ...string) ([]byte, bool) {
+	v := d.skip()
+	k := jsonKind(v[0])
+	if k == "null" {
+		return nil, false
+	}
+	for _, want := range kinds {
+		if k == want {
+			return v, true
+		}
+	}
+	return nil, d.fail(fmt.Errorf("cannot unmarshal %s into a %s", k, kinds[0]))
+}
+
+// fail records err, if it is the first error, and reports whether err is
+// nil.
+func (d *JSONDecoder) fail(err error) bool {
+	if err == nil {
+		return true
+	}
+	if d.err == nil {
+		d.err = fmt.Errorf("json: field %q: %v", d.key, err)
+	}
+	return false
+}
+
+func (d *JSONDecoder) skipSpace() {
+	for d.pos < len(d.data) {
+		switch d.data[d.pos] {
+		case ' ', '\t', '\n', '\r':
+			d.pos++
+		default:
+			return
+		}
+	}
+}
+
+// skip consumes the value at the current position, which is valid JSON, and
+// returns it.
+func (d *JSONDecoder) skip() []byte {
+	d.consumed = true
+	start := d.pos
+	depth := 0
+	for d.pos < len(d.data) {
+		switch c := d.data[d.pos]; c {
+		case '"':
+			d.pos++
+			for d.data[d.pos] != '"' {
+				if d.data[d.pos] == '\\' {
+					d.pos++
+				}
+				d.pos++
+			}
+		case '{', '[':
+			depth++
+		case '}', ']':
+			if depth == 0 {
+				return d.data[start:d.pos]
+			}
+			depth--
+		case ',', ' ', '\t', '\n', '\r', ':':
+			if depth == 0 {
+				return d.data[start:d.pos]
+			}
+		}
+		d.pos++
+		if depth == 0 && (d.data[start] == '"' || d.data[start] == '{' || d.data[start] == '[') {
+			return d.data[start:d.pos]
+		}
+	}
+	return d.data[start:d.pos]
+}
+
+// jsonKind returns the kind of the JSON value starting with c, as named in the
+// errors of encoding/json.
+func jsonKind(c byte) string {
+	switch c {
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case '"':
+		return "string"
+	case 't', 'f':
+		return "bool"
+	case 'n':
+		return "null"
+	}
+	return "number"
+}
+
+// unquote returns the value of the JSON string v, or v itself if it is not
+// a string.
+func unquote(v []byte) string {
+	if len(v) == 0 || v[0] != '"' {
+		return string(v)
+	}
+	s := v[1 : len(v)-1]
+	if bytes.IndexByte(s, '\\') < 0 && utf8.Valid(s) {
+		return string(s)
+	}
+	var u string
+	json.Unmarshal(v, &u)
+	return u
+}
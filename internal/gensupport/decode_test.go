@@ -0,0 +1,184 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+)
+
+// decode decodes data into s with a JSONDecoder, as the UnmarshalJSON
+// method of a generated schema does.
+func (s *schema) decode(data []byte) error {
+	d := NewJSONDecoder(data)
+	for d.Next() {
+		switch d.Key() {
+		case "b":
+			if v, ok := d.Bool(); ok {
+				s.B = v
+			}
+		case "f":
+			if v, ok := d.Float(); ok {
+				s.F = v
+			}
+		case "i":
+			if v, ok := d.Int(64); ok {
+				s.I = v
+			}
+		case "istr":
+			if v, ok := d.Int(64); ok {
+				s.Istr = v
+			}
+		case "str":
+			if v, ok := d.String(); ok {
+				s.Str = v
+			}
+		case "pb":
+			if d.Null() {
+				s.PB = nil
+			} else if v, ok := d.Bool(); ok {
+				s.PB = &v
+			}
+		case "pf":
+			if d.Null() {
+				s.PF = nil
+			} else if v, ok := d.Float(); ok {
+				s.PF = &v
+			}
+		case "pi":
+			if d.Null() {
+				s.PI = nil
+			} else if v, ok := d.Int(64); ok {
+				s.PI = &v
+			}
+		case "pistr":
+			if d.Null() {
+				s.PIStr = nil
+			} else if v, ok := d.Int(64); ok {
+				s.PIStr = &v
+			}
+		case "pstr":
+			if d.Null() {
+				s.PStr = nil
+			} else if v, ok := d.String(); ok {
+				s.PStr = &v
+			}
+		case "i64s":
+			d.Value(&s.Int64s)
+		case "s":
+			d.Value(&s.S)
+		case "m":
+			if d.Null() {
+				s.M = nil
+			} else if v, ok := d.StringMap(s.M); ok {
+				s.M = v
+			}
+		case "any":
+			d.Value(&s.Any)
+		case "child":
+			d.Value(&s.Child)
+		case "maptoanyarray":
+			d.Value(&s.MapToAnyArray)
+		}
+	}
+	return d.Err()
+}
+
+func TestJSONDecoder(t *testing.T) {
+	for _, data := range []string{
+		`{}`,
+		`null`,
+		` { "b" : true , "f":-1.5e3, "i":-7, "istr":"9007199254740993", "str":"a\"é\n" } `,
+		`{"pb":false, "pf":0, "pi":0, "pistr":"0", "pstr":""}`,
+		`{"i64s":["1","-2"], "s":[1,2], "m":{"k":"v"}, "any":{"x":[1,"y",null]}, "child":{"childbool":true}}`,
+		`{"maptoanyarray":{"a":[{"b":{}}, []]}, "unknown":{"nested":["}", "]", "\\\""]}, "s":[]}`,
+		`{"b":null, "str":null, "pb":null, "s":null, "child":null}`,
+		`{"str":"first", "str":"second", "m":{"a":"1", "b":"2"}, "m":{"b":"3", "c":null}}`,
+		`{"m":{}, "m":null}`,
+		"{\"str\":\"bad\xffutf8\"}",
+	} {
+		var got, want schema
+		want.PB, got.PB = googleapi.Bool(true), googleapi.Bool(true)
+		want.Str, got.Str = "kept", "kept"
+		if err := json.Unmarshal([]byte(data), &want); err != nil {
+			t.Fatalf("json.Unmarshal(%s): %v", data, err)
+		}
+		if err := got.decode([]byte(data)); err != nil {
+			t.Errorf("decode(%s): %v", data, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("decode(%s):\ngot  %+v\nwant %+v", data, got, want)
+		}
+	}
+}
+
+func TestJSONDecoderValues(t *testing.T) {
+	var s schema
+	if err := s.decode([]byte(`{"f":"NaN", "pf":"-Infinity", "i":"12", "istr":34}`)); err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsNaN(s.F) || !math.IsInf(*s.PF, -1) || s.I != 12 || s.Istr != 34 {
+		t.Errorf("got %+v", s)
+	}
+}
+
+func TestJSONDecoderErrors(t *testing.T) {
+	for _, data := range []string{
+		``,
+		`{`,
+		`{"b":true,}`,
+		`[]`,
+		`"s"`,
+		`{"b":"true"}`,
+		`{"str":1}`,
+		`{"f":"1.5"}`,
+		`{"i":1.5}`,
+		`{"i":"9223372036854775808"}`,
+		`{"pi":true}`,
+		`{"s":{}}`,
+		`{"m":[]}`,
+		`{"m":{"a":1}}`,
+	} {
+		var s schema
+		if err := s.decode([]byte(data)); err == nil {
+			t.Errorf("decode(%s): got nil error, want error", data)
+		}
+	}
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	s := benchmarkSchema()
+	data, err := json.Marshal(s)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var s schema
+		if err := json.Unmarshal(data, &s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkJSONDecoder(b *testing.B) {
+	s := benchmarkSchema()
+	data, err := json.Marshal(s)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var s schema
+		if err := s.decode(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
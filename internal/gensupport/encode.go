@@ -0,0 +1,367 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A JSONEncoder builds the JSON encoding of a schema one field at a time,
+// following the same rules as MarshalJSON but without reflecting over the
+// schema. Generated MarshalJSON methods call Field or PtrField for each field
+// of the schema and, if it reports that the field is sent, one of the value
+// methods to write its value, then call Bytes.
+//
+// It is intended for use by generated code only.
+type JSONEncoder struct {
+	buf             []byte
+	n               int    // number of fields written
+	name, field     string // JSON and Go names of the field being written
+	hasNested       bool   // whether there are nested paths within the field
+	forceSendFields []string
+	nullFields      []string
+	err             error // error in the fields listed in NullFields
+
+	// valueErr is the error encoding the value of the field valueErrName.
+	// As with MarshalJSON, errors in the fields listed in NullFields take
+	// precedence.
+	valueErr     error
+	valueErrName string
+}
+
+// NewJSONEncoder returns a JSONEncoder for a schema with the given
+// ForceSendFields and NullFields.
+func NewJSONEncoder(forceSendFields, nullFields []string) *JSONEncoder {
+	return &JSONEncoder{
+		buf:             append(make([]byte, 0, 128), '{'),
+		forceSendFields: forceSendFields,
+		nullFields:      nullFields,
+	}
+}
+
+// Field reports whether the field with Go name field and JSON name name is
+// sent, in which case its key has been written and its value must be written
+// next. empty reports whether the field has an empty value. Empty fields are
+// sent only if they are listed in ForceSendFields; fields listed in NullFields
+// are written as null by Field itself.
+func (e *JSONEncoder) Field(name, field string, empty bool) bool {
+	if e.err != nil || e.null(name, field, empty) {
+		return false
+	}
+	if empty && !contains(e.forceSendFields, field) {
+		return false
+	}
+	return e.begin(name, field)
+}
+
+// PtrField is like Field for pointer and interface fields, which are never
+// sent when nil, even if they are listed in ForceSendFields.
+func (e *JSONEncoder) PtrField(name, field string, isNil bool) bool {
+	if e.err != nil || e.null(name, field, isNil) || isNil {
+		return false
+	}
+	return e.begin(name, field)
+}
+
+// StringMapField writes the map[string]string field with Go name field and
+// JSON name name if it is sent.
+func (e *JSONEncoder) StringMapField(name, field string, m map[string]string) {
+	if !e.Field(name, field, len(m) == 0) || e.hasNested && e.nested(m) {
+		return
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	e.buf = append(e.buf, '{')
+	for i, k := range keys {
+		if i > 0 {
+			e.buf = append(e.buf, ',')
+		}
+		e.buf = appendJSONString(e.buf, k)
+		e.buf = append(e.buf, ':')
+		e.buf = appendJSONString(e.buf, m[k])
+	}
+	e.buf = append(e.buf, '}')
+}
+
+// null writes field as null if it is listed in NullFields, and reports
+// whether it did. It is an error for such a field to be non-empty.
+func (e *JSONEncoder) null(name, field string, empty bool) bool {
+	if !contains(e.nullFields, field) {
+		return false
+	}
+	if !empty {
+		e.err = fmt.Errorf("field %q in NullFields has non-empty value", field)
+		return true
+	}
+	e.key(name)
+	e.buf = append(e.buf, "null"...)
+	return true
+}
+
+// begin writes the key of a sent field.
+func (e *JSONEncoder) begin(name, field string) bool {
+	e.name, e.field = name, field
+	e.hasNested = false
+	for _, l := range [][]string{e.forceSendFields, e.nullFields} {
+		for _, f := range l {
+			if strings.HasPrefix(f, field+".") {
+				e.hasNested = true
+			}
+		}
+	}
+	e.key(name)
+	return true
+}
+
+// nested writes v, the value of the current field, with the dotted paths in
+// ForceSendFields and NullFields that are nested within the field applied.
+// It reports whether there were any such paths. Writers of values for which
+// hasNested is true call it first.
+func (e *JSONEncoder) nested(v interface{}) bool {
+	force := nestedPaths("ForceSendFields", e.forceSendFields, e.field)
+	null := nestedPaths("NullFields", e.nullFields, e.field)
+	if len(force) == 0 && len(null) == 0 {
+		return false
+	}
+	nv, err := withNestedPaths(reflect.ValueOf(v), e.field, force, null)
+	if err != nil {
+		e.err = err
+		return true
+	}
+	e.marshal(nv)
+	return true
+}
+
+func (e *JSONEncoder) key(name string) {
+	if e.n > 0 {
+		e.buf = append(e.buf, ',')
+	}
+	e.n++
+	e.buf = appendJSONString(e.buf, name)
+	e.buf = append(e.buf, ':')
+}
+
+// String writes a string value.
+func (e *JSONEncoder) String(s string) {
+	if e.hasNested && e.nested(s) {
+		return
+	}
+	e.buf = appendJSONString(e.buf, s)
+}
+
+// Strings writes a list of strings. A nil list is written as [].
+func (e *JSONEncoder) Strings(ss []string) {
+	if e.hasNested && e.nested(ss) {
+		return
+	}
+	e.buf = append(e.buf, '[')
+	for i, s := range ss {
+		if i > 0 {
+			e.buf = append(e.buf, ',')
+		}
+		e.buf = appendJSONString(e.buf, s)
+	}
+	e.buf = append(e.buf, ']')
+}
+
+// Bool writes a boolean value.
+func (e *JSONEncoder) Bool(b bool) {
+	if e.hasNested && e.nested(b) {
+		return
+	}
+	e.buf = strconv.AppendBool(e.buf, b)
+}
+
+// Int writes an integer value. If quoted is true, it is written as a string,
+// as for fields with the ",string" JSON option.
+func (e *JSONEncoder) Int(i int64, quoted bool) {
+	if e.hasNested && e.nested(i) {
+		return
+	}
+	if quoted {
+		e.buf = append(e.buf, '"')
+	}
+	e.buf = strconv.AppendInt(e.buf, i, 10)
+	if quoted {
+		e.buf = append(e.buf, '"')
+	}
+}
+
+// Uint writes an unsigned integer value. If quoted is true, it is written as
+// a string.
+func (e *JSONEncoder) Uint(u uint64, quoted bool) {
+	if e.hasNested && e.nested(u) {
+		return
+	}
+	if quoted {
+		e.buf = append(e.buf, '"')
+	}
+	e.buf = strconv.AppendUint(e.buf, u, 10)
+	if quoted {
+		e.buf = append(e.buf, '"')
+	}
+}
+
+// Float writes a floating-point value in the form used by encoding/json.
+func (e *JSONEncoder) Float(f float64) {
+	if e.hasNested && e.nested(f) {
+		return
+	}
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		e.setValueErr(&json.UnsupportedValueError{
+			Value: reflect.ValueOf(f),
+			Str:   strconv.FormatFloat(f, 'g', -1, 64),
+		})
+		return
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	e.buf = strconv.AppendFloat(e.buf, f, format, -1, 64)
+	if format == 'e' {
+		// Clean up e-09 to e-9, as encoding/json does.
+		n := len(e.buf)
+		if n >= 4 && e.buf[n-4] == 'e' && e.buf[n-3] == '-' && e.buf[n-2] == '0' {
+			e.buf[n-2] = e.buf[n-1]
+			e.buf = e.buf[:n-1]
+		}
+	}
+}
+
+// Value writes v using encoding/json. It is used for nested schemas and
+// values of other types.
+func (e *JSONEncoder) Value(v interface{}) {
+	if e.hasNested && e.nested(v) {
+		return
+	}
+	e.marshal(v)
+}
+
+// List writes v, a slice, using encoding/json. A nil slice is written as [].
+func (e *JSONEncoder) List(v interface{}) {
+	if e.hasNested && e.nested(v) {
+		return
+	}
+	if reflect.ValueOf(v).IsNil() {
+		e.buf = append(e.buf, "[]"...)
+		return
+	}
+	e.marshal(v)
+}
+
+// Map writes v, a map, using encoding/json. A nil map is written as {}.
+func (e *JSONEncoder) Map(v interface{}) {
+	if e.hasNested && e.nested(v) {
+		return
+	}
+	if reflect.ValueOf(v).IsNil() {
+		e.buf = append(e.buf, "{}"...)
+		return
+	}
+	e.marshal(v)
+}
+
+func (e *JSONEncoder) marshal(v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		e.setValueErr(err)
+		return
+	}
+	e.buf = append(e.buf, b...)
+}
+
+// setValueErr records err, an error encoding the value of the current field.
+// When ForceSendFields or NullFields are set, MarshalJSON encodes the fields
+// in the order of their JSON names, so the error for the first name is kept;
+// otherwise the first error is kept.
+func (e *JSONEncoder) setValueErr(err error) {
+	sorted := len(e.forceSendFields) > 0 || len(e.nullFields) > 0
+	if e.valueErr == nil || sorted && e.name < e.valueErrName {
+		e.valueErr, e.valueErrName = err, e.name
+	}
+}
+
+// Bytes returns the encoding of the schema, or the error encountered while
+// encoding it.
+func (e *JSONEncoder) Bytes() ([]byte, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	if e.valueErr != nil {
+		return nil, e.valueErr
+	}
+	return append(e.buf, '}'), nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+const hex = "0123456789abcdef"
+
+// appendJSONString appends the JSON encoding of s to b, escaping the same
+// characters as encoding/json.
+func appendJSONString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', hex[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
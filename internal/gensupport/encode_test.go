@@ -0,0 +1,151 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+)
+
+// encode encodes s with a JSONEncoder, as the MarshalJSON method of a
+// generated schema does.
+func (s schema) encode(forceSendFields, nullFields []string) ([]byte, error) {
+	e := NewJSONEncoder(forceSendFields, nullFields)
+	if e.Field("b", "B", !s.B) {
+		e.Bool(s.B)
+	}
+	if e.Field("f", "F", s.F == 0) {
+		e.Float(s.F)
+	}
+	if e.Field("i", "I", s.I == 0) {
+		e.Int(s.I, false)
+	}
+	if e.Field("istr", "Istr", s.Istr == 0) {
+		e.Int(s.Istr, true)
+	}
+	if e.Field("str", "Str", s.Str == "") {
+		e.String(s.Str)
+	}
+	if e.PtrField("pb", "PB", s.PB == nil) {
+		e.Bool(*s.PB)
+	}
+	if e.PtrField("pf", "PF", s.PF == nil) {
+		e.Float(*s.PF)
+	}
+	if e.PtrField("pi", "PI", s.PI == nil) {
+		e.Int(*s.PI, false)
+	}
+	if e.PtrField("pistr", "PIStr", s.PIStr == nil) {
+		e.Int(*s.PIStr, true)
+	}
+	if e.PtrField("pstr", "PStr", s.PStr == nil) {
+		e.String(*s.PStr)
+	}
+	if e.Field("i64s", "Int64s", len(s.Int64s) == 0) {
+		e.List(s.Int64s)
+	}
+	if e.Field("s", "S", len(s.S) == 0) {
+		e.List(s.S)
+	}
+	e.StringMapField("m", "M", s.M)
+	if e.PtrField("any", "Any", s.Any == nil) {
+		e.Value(s.Any)
+	}
+	if e.PtrField("child", "Child", s.Child == nil) {
+		e.Value(s.Child)
+	}
+	if e.Field("maptoanyarray", "MapToAnyArray", len(s.MapToAnyArray) == 0) {
+		e.Map(s.MapToAnyArray)
+	}
+	return e.Bytes()
+}
+
+func TestJSONEncoderErrors(t *testing.T) {
+	for _, test := range []struct {
+		s         schema
+		nullField string
+		want      string
+	}{
+		{schema{Str: "a"}, "Str", `field "Str" in NullFields has non-empty value`},
+		{schema{PB: googleapi.Bool(false)}, "PB", `field "PB" in NullFields has non-empty value`},
+		{schema{Str: "a"}, "Str.x", `NullFields entry "Str.x": field "Str" is not a schema, map or list`},
+		{schema{S: []int{1}}, "S.x", `NullFields entry "S.x": "x" is not an index of list field "S"`},
+	} {
+		_, werr := MarshalJSON(test.s, nil, []string{test.nullField})
+		_, gerr := test.s.encode(nil, []string{test.nullField})
+		if gerr == nil || gerr.Error() != test.want {
+			t.Errorf("%s: JSONEncoder error: got %v, want %q", test.nullField, gerr, test.want)
+		}
+		if werr == nil || werr.Error() != test.want {
+			t.Errorf("%s: MarshalJSON error: got %v, want %q", test.nullField, werr, test.want)
+		}
+	}
+}
+
+func TestJSONEncoderValues(t *testing.T) {
+	// Values are encoded exactly as encoding/json encodes them.
+	for _, f := range []float64{0, 1, -1.5, 1e-7, 1e-6, 123456789, 1e20, 1e21, 1.5e300, math.SmallestNonzeroFloat64} {
+		e := NewJSONEncoder(nil, nil)
+		e.Float(f)
+		want, _ := json.Marshal(f)
+		if got := string(e.buf[1:]); got != string(want) {
+			t.Errorf("Float(%v): got %s, want %s", f, got, want)
+		}
+	}
+	for _, s := range []string{"", "abc", `"quoted\"`, "<a&b>", "tab\tnew\nline\r\x00\x1f", "é日本", "\u2028\u2029", "bad\xffutf8"} {
+		e := NewJSONEncoder(nil, nil)
+		e.String(s)
+		want, _ := json.Marshal(s)
+		if got := string(e.buf[1:]); got != string(want) {
+			t.Errorf("String(%q): got %s, want %s", s, got, want)
+		}
+	}
+	e := NewJSONEncoder(nil, nil)
+	e.Float(math.NaN())
+	if _, err := e.Bytes(); err == nil {
+		t.Error("Float(NaN): got nil error, want error")
+	}
+}
+
+func benchmarkSchema() schema {
+	return schema{
+		B:     true,
+		F:     1.5,
+		I:     1,
+		Istr:  2,
+		Str:   strings.Repeat("a", 20),
+		PStr:  googleapi.String("b"),
+		S:     []int{1, 2, 3},
+		M:     map[string]string{"k": "v"},
+		Child: &child{B: true},
+
+		ForceSendFields: []string{"PB"},
+		NullFields:      []string{"PI", "M.null"},
+	}
+}
+
+func BenchmarkMarshalJSON(b *testing.B) {
+	s := benchmarkSchema()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := MarshalJSON(s, s.ForceSendFields, s.NullFields); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkJSONEncoder(b *testing.B) {
+	s := benchmarkSchema()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.encode(s.ForceSendFields, s.NullFields); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
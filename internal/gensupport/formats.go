@@ -0,0 +1,124 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// The functions in this file convert between the string representations of
+// the well-known discovery formats and their Go types. The empty string
+// corresponds to the zero value in each case. They are intended for use by
+// generated code only.
+
+// ParseDateTime parses a value with the "google-datetime" or "date-time"
+// format, an RFC 3339 timestamp.
+func ParseDateTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// FormatDateTime formats t with the "google-datetime" format.
+func FormatDateTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// ParseDate parses a value with the "date" format, such as "2020-04-30".
+// The result is midnight UTC on that date.
+func ParseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
+
+// FormatDate formats the date of t with the "date" format.
+func FormatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
+
+var durationRE = regexp.MustCompile(`^-?\d+(\.\d{1,9})?s$`)
+
+// ParseDuration parses a value with the "google-duration" format, a
+// number of seconds with up to nine fractional digits followed by "s",
+// such as "3.5s".
+func ParseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if !durationRE.MatchString(s) {
+		return 0, fmt.Errorf("invalid duration %q: want seconds with up to nine fractional digits and suffix %q", s, "s")
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: %v", s, err)
+	}
+	return d, nil
+}
+
+// FormatDuration formats d with the "google-duration" format.
+func FormatDuration(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	sign := ""
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+	s := fmt.Sprintf("%s%d", sign, d/time.Second)
+	if ns := d % time.Second; ns != 0 {
+		s += strings.TrimRight(fmt.Sprintf(".%09d", ns), "0")
+	}
+	return s + "s"
+}
+
+// ParseFieldMask parses a value with the "google-fieldmask" format, a
+// comma-separated list of field paths.
+func ParseFieldMask(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// FormatFieldMask formats paths with the "google-fieldmask" format.
+func FormatFieldMask(paths []string) string {
+	return strings.Join(paths, ",")
+}
+
+// ParseBytes parses a value with the "byte" format, which is base64
+// encoded. Both the standard and URL-safe alphabets are accepted, with or
+// without padding.
+func ParseBytes(s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+	enc := base64.StdEncoding
+	if strings.ContainsAny(s, "-_") {
+		enc = base64.URLEncoding
+	}
+	if len(s)%4 != 0 {
+		enc = enc.WithPadding(base64.NoPadding)
+	}
+	return enc.DecodeString(s)
+}
+
+// FormatBytes formats b with the "byte" format.
+func FormatBytes(b []byte) string {
+	return base64.StdEncoding.EncodeToString(b)
+}
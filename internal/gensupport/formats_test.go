@@ -0,0 +1,110 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDateTime(t *testing.T) {
+	tm := time.Date(2020, 4, 30, 12, 34, 56, 789000000, time.UTC)
+	for _, test := range []struct {
+		s    string
+		want time.Time
+	}{
+		{"", time.Time{}},
+		{"2020-04-30T12:34:56.789Z", tm},
+		{"2020-04-30T14:34:56.789+02:00", tm},
+	} {
+		got, err := ParseDateTime(test.s)
+		if err != nil || !got.Equal(test.want) {
+			t.Errorf("ParseDateTime(%q) = %v, %v; want %v", test.s, got, err, test.want)
+		}
+	}
+	if got, want := FormatDateTime(tm), "2020-04-30T12:34:56.789Z"; got != want {
+		t.Errorf("FormatDateTime = %q, want %q", got, want)
+	}
+	if got := FormatDateTime(time.Time{}); got != "" {
+		t.Errorf("FormatDateTime(zero) = %q, want empty", got)
+	}
+	if _, err := ParseDateTime("yesterday"); err == nil {
+		t.Error("ParseDateTime: got nil error, want error")
+	}
+}
+
+func TestDate(t *testing.T) {
+	got, err := ParseDate("2020-04-30")
+	if want := time.Date(2020, 4, 30, 0, 0, 0, 0, time.UTC); err != nil || !got.Equal(want) {
+		t.Errorf("ParseDate = %v, %v; want %v", got, err, want)
+	}
+	if got, want := FormatDate(got), "2020-04-30"; got != want {
+		t.Errorf("FormatDate = %q, want %q", got, want)
+	}
+}
+
+func TestDuration(t *testing.T) {
+	for _, test := range []struct {
+		s string
+		d time.Duration
+	}{
+		{"", 0},
+		{"3s", 3 * time.Second},
+		{"3.5s", 3500 * time.Millisecond},
+		{"0.000000001s", time.Nanosecond},
+		{"-1.25s", -1250 * time.Millisecond},
+	} {
+		got, err := ParseDuration(test.s)
+		if err != nil || got != test.d {
+			t.Errorf("ParseDuration(%q) = %v, %v; want %v", test.s, got, err, test.d)
+		}
+		if got := FormatDuration(test.d); got != test.s {
+			t.Errorf("FormatDuration(%v) = %q, want %q", test.d, got, test.s)
+		}
+	}
+	for _, s := range []string{"3", "3m", "s", "1m30s", "1.5ms", "+3s", ".5s", "3.s", "1.0000000001s", " 3s"} {
+		if _, err := ParseDuration(s); err == nil {
+			t.Errorf("ParseDuration(%q): got nil error, want error", s)
+		}
+	}
+}
+
+func TestFieldMask(t *testing.T) {
+	paths := []string{"name", "labels.env"}
+	if got, want := FormatFieldMask(paths), "name,labels.env"; got != want {
+		t.Errorf("FormatFieldMask = %q, want %q", got, want)
+	}
+	if got := ParseFieldMask("name,labels.env"); !reflect.DeepEqual(got, paths) {
+		t.Errorf("ParseFieldMask = %q, want %q", got, paths)
+	}
+	if got := ParseFieldMask(""); got != nil {
+		t.Errorf("ParseFieldMask(\"\") = %q, want nil", got)
+	}
+}
+
+func TestBytes(t *testing.T) {
+	for _, test := range []struct {
+		s    string
+		want []byte
+	}{
+		{"", nil},
+		{"+/8B", []byte{0xfb, 0xff, 0x01}},
+		{"-_8B", []byte{0xfb, 0xff, 0x01}},
+		{"+/8=", []byte{0xfb, 0xff}},
+		{"-_8", []byte{0xfb, 0xff}},
+	} {
+		got, err := ParseBytes(test.s)
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseBytes(%q) = %v, %v; want %v", test.s, got, err, test.want)
+		}
+	}
+	if _, err := ParseBytes("!!"); err == nil {
+		t.Error("ParseBytes: got nil error, want error")
+	}
+	if got, want := FormatBytes([]byte{0xfb, 0xff, 0x01}), "+/8B"; got != want {
+		t.Errorf("FormatBytes = %q, want %q", got, want)
+	}
+}
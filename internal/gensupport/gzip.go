@@ -0,0 +1,27 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// NewGzipReader returns a reader of the gzip compression of r, which is
+// compressed as it is read rather than all at once. Close must be called if
+// reads are abandoned before reaching EOF.
+func NewGzipReader(r io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		zw := gzip.NewWriter(pw)
+		_, err := io.Copy(zw, r)
+		if cerr := zw.Close(); err == nil {
+			err = cerr
+		}
+		// A nil error makes reads return io.EOF.
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
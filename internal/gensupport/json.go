@@ -5,10 +5,14 @@
 package gensupport
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"reflect"
 	"strings"
+
+	"google.golang.org/api/googleapi"
 )
 
 // MarshalJSON returns a JSON encoding of schema containing only selected fields.
@@ -17,6 +21,9 @@ import (
 //   * its field name is present in forceSendFields and it is not a nil pointer or nil interface
 //   * its field name is present in nullFields.
 // The JSON key for each selected field is taken from the field's json: struct tag.
+// Entries of forceSendFields and nullFields may also be dotted paths to values
+// nested within selected fields, such as "Child.Field", "Map.key" or
+// "List.0.Field".
 func MarshalJSON(schema interface{}, forceSendFields, nullFields []string) ([]byte, error) {
 	if len(forceSendFields) == 0 && len(nullFields) == 0 {
 		return json.Marshal(schema)
@@ -27,28 +34,136 @@ func MarshalJSON(schema interface{}, forceSendFields, nullFields []string) ([]by
 		mustInclude[f] = true
 	}
 	useNull := make(map[string]bool)
-	useNullMaps := make(map[string]map[string]bool)
 	for _, nf := range nullFields {
-		parts := strings.SplitN(nf, ".", 2)
-		field := parts[0]
-		if len(parts) == 1 {
-			useNull[field] = true
-		} else {
-			if useNullMaps[field] == nil {
-				useNullMaps[field] = map[string]bool{}
-			}
-			useNullMaps[field][parts[1]] = true
-		}
+		useNull[nf] = true
 	}
 
-	dataMap, err := schemaToMap(schema, mustInclude, useNull, useNullMaps)
+	dataMap, err := schemaToMap(schema, mustInclude, useNull, forceSendFields, nullFields)
 	if err != nil {
 		return nil, err
 	}
 	return json.Marshal(dataMap)
 }
 
-func schemaToMap(schema interface{}, mustInclude, useNull map[string]bool, useNullMaps map[string]map[string]bool) (map[string]interface{}, error) {
+// JSONRequestReader returns the JSON encoding of the request body v in the
+// given style, omitting the fields of v and its nested schemas that are
+// tagged as read-only, which servers ignore or reject.
+// It is intended for use by generated code only.
+func JSONRequestReader(style googleapi.MarshalStyle, v interface{}) (io.Reader, error) {
+	if !stripReadOnly(reflect.ValueOf(v), nil) {
+		return style.JSONReader(v)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber() // preserve integer precision
+	var data interface{}
+	if err := dec.Decode(&data); err != nil {
+		return nil, err
+	}
+	stripReadOnly(reflect.ValueOf(v), data)
+	return style.JSONReader(data)
+}
+
+// stripReadOnly reports whether the encoding of v, a schema value, contains
+// read-only fields. If data is the decoded JSON encoding of v, those fields
+// are removed from it.
+func stripReadOnly(v reflect.Value, data interface{}) bool {
+	if !v.IsValid() || !mayHoldSchema(v.Type()) {
+		return false
+	}
+	found := false
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			found = stripReadOnly(v.Elem(), data)
+		}
+	case reflect.Slice, reflect.Array:
+		d, _ := data.([]interface{})
+		for i := 0; i < v.Len(); i++ {
+			var e interface{}
+			if i < len(d) {
+				e = d[i]
+			}
+			if stripReadOnly(v.Index(i), e) {
+				found = true
+			}
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			break
+		}
+		d, _ := data.(map[string]interface{})
+		for _, k := range v.MapKeys() {
+			if stripReadOnly(v.MapIndex(k), d[k.String()]) {
+				found = true
+			}
+		}
+	case reflect.Struct:
+		d, _ := data.(map[string]interface{})
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			jsonTag := f.Tag.Get("json")
+			if jsonTag == "" {
+				continue
+			}
+			tag, err := parseJSONTag(jsonTag)
+			if err != nil || tag.ignore {
+				continue
+			}
+			fv := v.Field(i)
+			if f.Tag.Get("googleapi") != "readonly" {
+				if stripReadOnly(fv, d[tag.apiName]) {
+					found = true
+				}
+				continue
+			}
+			if d != nil {
+				if _, ok := d[tag.apiName]; ok {
+					delete(d, tag.apiName)
+					found = true
+				}
+			} else if !isEmptyValue(fv) || listed(v, "ForceSendFields", f.Name) || listed(v, "NullFields", f.Name) {
+				found = true
+			}
+		}
+	}
+	return found
+}
+
+// mayHoldSchema reports whether values of type t may contain schema
+// structs, so that scalars, byte slices and collections of them are not
+// walked.
+func mayHoldSchema(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Struct, reflect.Interface:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return mayHoldSchema(t.Elem())
+	}
+	return false
+}
+
+// listed reports whether name is an element of the []string field list of
+// the struct v.
+func listed(v reflect.Value, list, name string) bool {
+	f := v.FieldByName(list)
+	if !f.IsValid() || !f.CanInterface() {
+		return false
+	}
+	ss, _ := f.Interface().([]string)
+	for _, s := range ss {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+func schemaToMap(schema interface{}, mustInclude, useNull map[string]bool, forceSendFields, nullFields []string) (map[string]interface{}, error) {
 	m := make(map[string]interface{})
 	s := reflect.ValueOf(schema)
 	st := s.Type()
@@ -81,20 +196,16 @@ func schemaToMap(schema interface{}, mustInclude, useNull map[string]bool, useNu
 			continue
 		}
 
-		// If map fields are explicitly set to null, use a map[string]interface{}.
-		if f.Type.Kind() == reflect.Map && useNullMaps[f.Name] != nil {
-			ms, ok := v.Interface().(map[string]string)
-			if !ok {
-				return nil, fmt.Errorf("field %q has keys in NullFields but is not a map[string]string", f.Name)
-			}
-			mi := map[string]interface{}{}
-			for k, v := range ms {
-				mi[k] = v
-			}
-			for k := range useNullMaps[f.Name] {
-				mi[k] = nil
+		// Dotted paths in ForceSendFields and NullFields apply to values
+		// nested within the field.
+		force := nestedPaths("ForceSendFields", forceSendFields, f.Name)
+		null := nestedPaths("NullFields", nullFields, f.Name)
+		if len(force) > 0 || len(null) > 0 {
+			nv, err := withNestedPaths(v, f.Name, force, null)
+			if err != nil {
+				return nil, err
 			}
-			m[tag.apiName] = mi
+			m[tag.apiName] = nv
 			continue
 		}
 
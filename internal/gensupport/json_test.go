@@ -6,7 +6,10 @@ package gensupport
 
 import (
 	"encoding/json"
+	"io/ioutil"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 
 	"google.golang.org/api/googleapi"
@@ -470,6 +473,129 @@ func doCheckMarshalJSON(t *testing.T, s schema, forceSendFields, nullFields []st
 	if !reflect.DeepEqual(got, want) {
 		t.Errorf("schemaToMap:\ngot :%v\nwant: %v", got, want)
 	}
+
+	// The JSONEncoder used by generated code must agree with MarshalJSON.
+	encoded, err = s.encode(forceSendFields, nullFields)
+	if err != nil {
+		t.Fatalf("JSONEncoder:\n got err: %v", err)
+	}
+	got = nil
+	if err := json.Unmarshal(encoded, &got); err != nil {
+		t.Fatalf("decoding JSONEncoder output %s:\n got err: %v", encoded, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("JSONEncoder:\ngot :%v\nwant: %v", got, want)
+	}
+}
+
+type readOnlyChild struct {
+	ID   string `json:"id,omitempty" googleapi:"readonly"`
+	Name string `json:"name,omitempty"`
+
+	ForceSendFields []string `json:"-"`
+	NullFields      []string `json:"-"`
+}
+
+func (s *readOnlyChild) MarshalJSON() ([]byte, error) {
+	type NoMethod readOnlyChild
+	raw := NoMethod(*s)
+	return MarshalJSON(raw, s.ForceSendFields, s.NullFields)
+}
+
+type readOnlySchema struct {
+	Created  string                    `json:"created,omitempty" googleapi:"readonly"`
+	Size     int64                     `json:"size,omitempty,string"`
+	Big      int64                     `json:"big,omitempty"`
+	Child    *readOnlyChild            `json:"child,omitempty"`
+	Children []*readOnlyChild          `json:"children,omitempty"`
+	ByName   map[string]readOnlyChild  `json:"byName,omitempty"`
+	Labels   map[string]string         `json:"labels,omitempty"`
+	Any      googleapi.RawMessage      `json:"any,omitempty"`
+	Pointers map[string]*readOnlyChild `json:"pointers,omitempty"`
+
+	ForceSendFields []string `json:"-"`
+	NullFields      []string `json:"-"`
+}
+
+func (s *readOnlySchema) MarshalJSON() ([]byte, error) {
+	type NoMethod readOnlySchema
+	raw := NoMethod(*s)
+	return MarshalJSON(raw, s.ForceSendFields, s.NullFields)
+}
+
+func TestJSONRequestReader(t *testing.T) {
+	for _, test := range []struct {
+		s    *readOnlySchema
+		want string
+	}{
+		{
+			s:    &readOnlySchema{Size: 3, Labels: map[string]string{"a": "b"}},
+			want: `{"size":"3","labels":{"a":"b"}}`,
+		},
+		{
+			s:    &readOnlySchema{Created: "2020-04-30", Size: 3},
+			want: `{"size":"3"}`,
+		},
+		{
+			s:    &readOnlySchema{ForceSendFields: []string{"Created"}},
+			want: `{}`,
+		},
+		{
+			s:    &readOnlySchema{Big: 1<<60 + 1, Any: googleapi.RawMessage(`{"id":"kept"}`), Child: &readOnlyChild{ID: "x", Name: "n"}},
+			want: `{"big":1152921504606846977,"any":{"id":"kept"},"child":{"name":"n"}}`,
+		},
+		{
+			s: &readOnlySchema{
+				Children: []*readOnlyChild{{ID: "1"}, {Name: "two"}},
+				ByName:   map[string]readOnlyChild{"k": {ID: "x", Name: "y"}},
+				Pointers: map[string]*readOnlyChild{"p": {NullFields: []string{"ID"}}},
+			},
+			want: `{"children":[{},{"name":"two"}],"byName":{"k":{"name":"y"}},"pointers":{"p":{}}}`,
+		},
+	} {
+		r, err := JSONRequestReader(googleapi.WithoutDataWrapper, test.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if big := strconv.FormatInt(test.s.Big, 10); test.s.Big != 0 && !strings.Contains(string(b), big) {
+			t.Errorf("JSONRequestReader(%+v) = %s, want it to contain %s", test.s, b, big)
+		}
+		var got, want interface{}
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(test.want), &want); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("JSONRequestReader(%+v) = %s, want %s", test.s, b, test.want)
+		}
+	}
+}
+
+func TestMayHoldSchema(t *testing.T) {
+	for _, test := range []struct {
+		v    interface{}
+		want bool
+	}{
+		{"", false},
+		{int64(0), false},
+		{[]byte(nil), false},
+		{googleapi.RawMessage(nil), false},
+		{map[string][]string(nil), false},
+		{[]*readOnlyChild(nil), true},
+		{map[string]readOnlyChild(nil), true},
+		{(*readOnlySchema)(nil), true},
+		{[]interface{}(nil), true},
+	} {
+		if got := mayHoldSchema(reflect.TypeOf(test.v)); got != test.want {
+			t.Errorf("mayHoldSchema(%T) = %t, want %t", test.v, got, test.want)
+		}
+	}
 }
 
 func TestParseJSONTag(t *testing.T) {
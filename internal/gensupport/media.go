@@ -223,14 +223,15 @@ type MediaInfo struct {
 	mType           string
 	size            int64 // mediaSize, if known.  Used only for calls to progressUpdater_.
 	progressUpdater googleapi.ProgressUpdater
+	gzip            bool // whether to compress single request uploads, from googleapi.Gzip
 }
 
 // NewInfoFromMedia should be invoked from the Media method of a call. It returns a
 // MediaInfo populated with chunk size and content type, and a reader or MediaBuffer
 // if needed.
 func NewInfoFromMedia(r io.Reader, options []googleapi.MediaOption) *MediaInfo {
-	mi := &MediaInfo{}
 	opts := googleapi.ProcessMediaOptions(options)
+	mi := &MediaInfo{gzip: opts.Gzip}
 	if !opts.ForceEmptyContentType {
 		r, mi.mType = DetermineContentType(r, opts.ContentType)
 	}
@@ -306,6 +307,26 @@ func (mi *MediaInfo) UploadRequest(reqHeaders http.Header, body io.Reader) (newB
 				return r, nil
 			}
 		}
+		body = combined
+		if mi.gzip {
+			// Compress the whole multipart body, including its JSON part.
+			zr := NewGzipReader(combined)
+			toCleanup = append(toCleanup, zr)
+			body = zr
+			if getBody != nil {
+				uncompressed := getBody
+				getBody = func() (io.ReadCloser, error) {
+					r, err := uncompressed()
+					if err != nil {
+						return nil, err
+					}
+					zr := NewGzipReader(r)
+					toCleanup = append(toCleanup, zr)
+					return zr, nil
+				}
+			}
+			reqHeaders.Set("Content-Encoding", "gzip")
+		}
 		cleanup = func() {
 			for _, closer := range toCleanup {
 				_ = closer.Close()
@@ -313,7 +334,6 @@ func (mi *MediaInfo) UploadRequest(reqHeaders http.Header, body io.Reader) (newB
 
 		}
 		reqHeaders.Set("Content-Type", ctype)
-		body = combined
 	}
 	if mi.buffer != nil && mi.mType != "" && !mi.singleChunk {
 		reqHeaders.Set("X-Upload-Content-Type", mi.mType)
@@ -6,6 +6,7 @@ package gensupport
 
 import (
 	"bytes"
+	"compress/gzip"
 	cryptorand "crypto/rand"
 	"io"
 	"io/ioutil"
@@ -334,6 +335,44 @@ func TestUploadRequestGetBody(t *testing.T) {
 	}
 }
 
+func TestUploadRequestGzip(t *testing.T) {
+	for _, chunkSize := range []int{0, 100} {
+		mi := NewInfoFromMedia(strings.NewReader("media data"), []googleapi.MediaOption{googleapi.ChunkSize(chunkSize), googleapi.Gzip()})
+		h := http.Header{}
+		r, getBody, cleanup := mi.UploadRequest(h, strings.NewReader(`{"name":"n"}`))
+		if got, want := h.Get("Content-Encoding"), "gzip"; got != want {
+			t.Errorf("chunk size %d: Content-Encoding: got %q, want %q", chunkSize, got, want)
+		}
+		readers := []io.Reader{r}
+		if chunkSize > 0 {
+			if getBody == nil {
+				t.Fatalf("chunk size %d: no getBody", chunkSize)
+			}
+			rc, err := getBody()
+			if err != nil {
+				t.Fatal(err)
+			}
+			readers = append(readers, rc)
+		}
+		for _, r := range readers {
+			zr, err := gzip.NewReader(r)
+			if err != nil {
+				t.Fatalf("chunk size %d: %v", chunkSize, err)
+			}
+			b, err := ioutil.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("chunk size %d: %v", chunkSize, err)
+			}
+			for _, want := range []string{`{"name":"n"}`, "media data"} {
+				if !bytes.Contains(b, []byte(want)) {
+					t.Errorf("chunk size %d: uncompressed body does not contain %q:\n%s", chunkSize, want, b)
+				}
+			}
+		}
+		cleanup()
+	}
+}
+
 func TestResumableUpload(t *testing.T) {
 	for _, test := range []struct {
 		desc                string
@@ -0,0 +1,284 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Entries of ForceSendFields and NullFields may be dotted paths that refer
+// to values nested within a field, such as "Config.Timeout" for a field of a
+// nested schema, "Labels.env" for an entry of a map, or "Rules.2.Action" for
+// a field of an element of a list. A nested path applies only if the field
+// it descends into is sent, as determined by the field's own value and the
+// top-level entries.
+//
+// Within nested schemas, the remainder of the path is added to the schema's
+// own ForceSendFields or NullFields. Map entries and list elements listed in
+// NullFields are sent as null; map entries listed in ForceSendFields are sent
+// with the zero value if they are missing from the map.
+
+// A nestedPath is an entry of ForceSendFields or NullFields that refers to
+// a value nested within a field.
+type nestedPath struct {
+	list  string // "ForceSendFields" or "NullFields", for error messages
+	entry string // the entry, for error messages
+	rest  string // the part of the path below the current value
+}
+
+// nestedPaths returns the entries of the list named name that are nested
+// paths within the field with Go name field.
+func nestedPaths(name string, list []string, field string) []nestedPath {
+	var ps []nestedPath
+	for _, e := range list {
+		if strings.HasPrefix(e, field+".") {
+			ps = append(ps, nestedPath{list: name, entry: e, rest: e[len(field)+1:]})
+		}
+	}
+	return ps
+}
+
+func (p nestedPath) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s entry %q: %s", p.list, p.entry, fmt.Sprintf(format, args...))
+}
+
+// split returns the first segment of the path p and the path below it.
+// If whole is true, the path has no further segments.
+func (p nestedPath) split(whole bool) (seg string, below nestedPath, last bool) {
+	if i := strings.IndexByte(p.rest, '.'); i >= 0 && !whole {
+		return p.rest[:i], nestedPath{list: p.list, entry: p.entry, rest: p.rest[i+1:]}, false
+	}
+	return p.rest, nestedPath{}, true
+}
+
+// withNestedPaths returns a value whose JSON encoding is that of v, the value
+// of the field with Go name field, with the nested paths force and null
+// applied. The paths are checked against the type of v before any is applied.
+func withNestedPaths(v reflect.Value, field string, force, null []nestedPath) (interface{}, error) {
+	for _, p := range append(force, null...) {
+		if err := checkPath(v.Type(), field, p); err != nil {
+			return nil, err
+		}
+	}
+	return nestedValue(v, field, force, null)
+}
+
+// checkPath checks that the path p can descend into values of type t, the
+// type of the field or element identified by path. As for top-level entries,
+// names that are not fields of a schema are ignored.
+func checkPath(t reflect.Type, path string, p nestedPath) error {
+	if !descends(t) {
+		return p.errorf("field %q is not a schema, map or list", path)
+	}
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Struct:
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		seg, rest, last := p.split(false)
+		f, ok := t.FieldByName(seg)
+		if last || !ok {
+			return nil
+		}
+		return checkPath(f.Type, path+"."+seg, rest)
+	case reflect.Map:
+		seg, rest, last := p.split(!descends(t.Elem()))
+		if last {
+			return nil
+		}
+		return checkPath(t.Elem(), path+"."+seg, rest)
+	default: // reflect.Slice
+		seg, rest, last := p.split(false)
+		if n, err := strconv.Atoi(seg); err != nil || n < 0 {
+			return p.errorf("%q is not an index of list field %q", seg, path)
+		}
+		if last {
+			return nil
+		}
+		return checkPath(t.Elem(), path+"."+seg, rest)
+	}
+}
+
+// nestedValue returns a value whose JSON encoding is that of v, the value of
+// the field or element identified by path, with the nested paths force and
+// null applied.
+func nestedValue(v reflect.Value, path string, force, null []nestedPath) (interface{}, error) {
+	if !descends(v.Type()) {
+		return nil, append(null, force...)[0].errorf("field %q is not a schema, map or list", path)
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v = reflect.New(v.Type().Elem())
+		}
+		return schemaWithPaths(v.Elem(), path, force, null)
+	case reflect.Struct:
+		return schemaWithPaths(v, path, force, null)
+	case reflect.Map:
+		return mapWithPaths(v, path, force, null)
+	default: // reflect.Slice
+		return listWithPaths(v, path, force, null)
+	}
+}
+
+// schemaWithPaths returns a pointer to a copy of the schema v with the paths
+// force and null added to its ForceSendFields and NullFields.
+func schemaWithPaths(v reflect.Value, path string, force, null []nestedPath) (interface{}, error) {
+	c := reflect.New(v.Type())
+	c.Elem().Set(v)
+	for _, l := range []struct {
+		name  string
+		paths []nestedPath
+	}{{"ForceSendFields", force}, {"NullFields", null}} {
+		if len(l.paths) == 0 {
+			continue
+		}
+		f := c.Elem().FieldByName(l.name)
+		if !f.IsValid() || f.Type() != reflect.TypeOf([]string(nil)) {
+			return nil, l.paths[0].errorf("field %q is not a schema with %s", path, l.name)
+		}
+		list := append([]string(nil), f.Interface().([]string)...)
+		for _, p := range l.paths {
+			list = append(list, p.rest)
+		}
+		f.Set(reflect.ValueOf(list))
+	}
+	return c.Interface(), nil
+}
+
+var marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// descends reports whether nested paths may descend into values of type t:
+// schemas, maps with string keys and lists. Lists with their own encoding,
+// such as googleapi.Int64s, are treated as single values.
+func descends(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return t.Elem().Kind() == reflect.Struct
+	case reflect.Struct:
+		return true
+	case reflect.Map:
+		return t.Key().Kind() == reflect.String
+	case reflect.Slice:
+		return !t.Implements(marshalerType)
+	}
+	return false
+}
+
+// mapWithPaths returns the entries of the map v, with the entries listed in
+// null replaced by nil and the paths below entries applied to them.
+func mapWithPaths(v reflect.Value, path string, force, null []nestedPath) (interface{}, error) {
+	// Keys of maps whose values are not traversed may contain dots.
+	whole := !descends(v.Type().Elem())
+	m := make(map[string]interface{}, v.Len())
+	for _, k := range v.MapKeys() {
+		m[k.String()] = v.MapIndex(k).Interface()
+	}
+	nulls := map[string]bool{}
+	below := map[string][2][]nestedPath{}
+	var keys []string
+	for i, paths := range [][]nestedPath{force, null} {
+		for _, p := range paths {
+			key, rest, last := p.split(whole)
+			switch {
+			case !last:
+				b, ok := below[key]
+				if !ok {
+					keys = append(keys, key)
+				}
+				b[i] = append(b[i], rest)
+				below[key] = b
+			case i == 1:
+				nulls[key] = true
+			default:
+				if _, ok := m[key]; !ok {
+					m[key] = zeroElem(v.Type().Elem())
+				}
+			}
+		}
+	}
+	for _, key := range keys {
+		if nulls[key] {
+			continue
+		}
+		e := v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key()))
+		if !e.IsValid() {
+			e = reflect.Zero(v.Type().Elem())
+		}
+		b := below[key]
+		nv, err := nestedValue(e, path+"."+key, b[0], b[1])
+		if err != nil {
+			return nil, err
+		}
+		m[key] = nv
+	}
+	for key := range nulls {
+		m[key] = nil
+	}
+	return m, nil
+}
+
+// zeroElem returns the value sent for a missing map entry listed in
+// ForceSendFields. Nested schemas are sent as empty objects.
+func zeroElem(t reflect.Type) interface{} {
+	if t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct {
+		return reflect.New(t.Elem()).Interface()
+	}
+	return reflect.Zero(t).Interface()
+}
+
+// listWithPaths returns the elements of the list v, with the elements listed
+// in null replaced by nil and the paths below elements applied to them.
+func listWithPaths(v reflect.Value, path string, force, null []nestedPath) (interface{}, error) {
+	l := make([]interface{}, v.Len())
+	for i := range l {
+		l[i] = v.Index(i).Interface()
+	}
+	nulls := map[int]bool{}
+	below := map[int][2][]nestedPath{}
+	var indexes []int
+	for i, paths := range [][]nestedPath{force, null} {
+		for _, p := range paths {
+			seg, rest, last := p.split(false)
+			n, err := strconv.Atoi(seg)
+			if err != nil || n < 0 {
+				return nil, p.errorf("%q is not an index of list field %q", seg, path)
+			}
+			if n >= len(l) {
+				return nil, p.errorf("index %d is out of range for list field %q of length %d", n, path, len(l))
+			}
+			switch {
+			case !last:
+				b, ok := below[n]
+				if !ok {
+					indexes = append(indexes, n)
+				}
+				b[i] = append(b[i], rest)
+				below[n] = b
+			case i == 1:
+				nulls[n] = true
+			}
+		}
+	}
+	for _, n := range indexes {
+		if nulls[n] {
+			continue
+		}
+		b := below[n]
+		nv, err := nestedValue(v.Index(n), path+"."+strconv.Itoa(n), b[0], b[1])
+		if err != nil {
+			return nil, err
+		}
+		l[n] = nv
+	}
+	for n := range nulls {
+		l[n] = nil
+	}
+	return l, nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+)
+
+type nestedSchema struct {
+	Child    *nestedChild            `json:"child,omitempty"`
+	Children []*nestedChild          `json:"children,omitempty"`
+	ByName   map[string]*nestedChild `json:"byName,omitempty"`
+	Labels   map[string]string       `json:"labels,omitempty"`
+	Ints     googleapi.Int64s        `json:"ints,omitempty"`
+	Name     string                  `json:"name,omitempty"`
+
+	ForceSendFields []string `json:"-"`
+	NullFields      []string `json:"-"`
+}
+
+// encode encodes s with a JSONEncoder, as the MarshalJSON method of a
+// generated schema does.
+func (s *nestedSchema) encode() ([]byte, error) {
+	e := NewJSONEncoder(s.ForceSendFields, s.NullFields)
+	if e.PtrField("child", "Child", s.Child == nil) {
+		e.Value(s.Child)
+	}
+	if e.Field("children", "Children", len(s.Children) == 0) {
+		e.List(s.Children)
+	}
+	if e.Field("byName", "ByName", len(s.ByName) == 0) {
+		e.Map(s.ByName)
+	}
+	e.StringMapField("labels", "Labels", s.Labels)
+	if e.Field("ints", "Ints", len(s.Ints) == 0) {
+		e.List(s.Ints)
+	}
+	if e.Field("name", "Name", s.Name == "") {
+		e.String(s.Name)
+	}
+	return e.Bytes()
+}
+
+type nestedChild struct {
+	Size int64    `json:"size,omitempty"`
+	Tags []string `json:"tags,omitempty"`
+
+	ForceSendFields []string `json:"-"`
+	NullFields      []string `json:"-"`
+}
+
+func (s *nestedChild) MarshalJSON() ([]byte, error) {
+	type NoMethod nestedChild
+	return MarshalJSON(NoMethod(*s), s.ForceSendFields, s.NullFields)
+}
+
+func TestNestedPaths(t *testing.T) {
+	two := func() []*nestedChild { return []*nestedChild{{Size: 1}, {Size: 2}} }
+	for _, test := range []struct {
+		s       nestedSchema
+		want    string
+		wantErr string
+	}{
+		{
+			s:    nestedSchema{Child: &nestedChild{Size: 1}, NullFields: []string{"Child.Tags"}},
+			want: `{"child":{"size":1,"tags":null}}`,
+		},
+		{
+			s:    nestedSchema{Child: &nestedChild{Tags: []string{"a"}}, ForceSendFields: []string{"Child.Size"}},
+			want: `{"child":{"size":0,"tags":["a"]}}`,
+		},
+		{
+			// Nested paths apply only to fields that are sent.
+			s:    nestedSchema{NullFields: []string{"Child.Size", "Children.0", "Labels.a"}},
+			want: `{}`,
+		},
+		{
+			s:    nestedSchema{Children: two(), NullFields: []string{"Children.0"}, ForceSendFields: []string{"Children.1.Tags"}},
+			want: `{"children":[null,{"size":2,"tags":[]}]}`,
+		},
+		{
+			s: nestedSchema{
+				ByName:          map[string]*nestedChild{"a": {Size: 1}},
+				NullFields:      []string{"ByName.b"},
+				ForceSendFields: []string{"ByName.a.Tags", "ByName.c"},
+			},
+			want: `{"byName":{"a":{"size":1,"tags":[]},"b":null,"c":{}}}`,
+		},
+		{
+			s: nestedSchema{
+				ByName:          map[string]*nestedChild{},
+				NullFields:      []string{"ByName.a.Tags"},
+				ForceSendFields: []string{"ByName"},
+			},
+			want: `{"byName":{"a":{"tags":null}}}`,
+		},
+		{
+			// Keys of maps of simple values may contain dots.
+			s: nestedSchema{
+				Labels:          map[string]string{"a": "b"},
+				ForceSendFields: []string{"Labels.c"},
+				NullFields:      []string{"Labels.d.e"},
+			},
+			want: `{"labels":{"a":"b","c":"","d.e":null}}`,
+		},
+		{
+			s:       nestedSchema{Name: "n", NullFields: []string{"Name.x"}},
+			wantErr: `NullFields entry "Name.x": field "Name" is not a schema, map or list`,
+		},
+		{
+			s:       nestedSchema{Ints: googleapi.Int64s{1}, ForceSendFields: []string{"Ints.0"}},
+			wantErr: `ForceSendFields entry "Ints.0": field "Ints" is not a schema, map or list`,
+		},
+		{
+			s:       nestedSchema{Children: two(), NullFields: []string{"Children.x"}},
+			wantErr: `NullFields entry "Children.x": "x" is not an index of list field "Children"`,
+		},
+		{
+			s:       nestedSchema{Children: two(), ForceSendFields: []string{"Children.5.Size"}},
+			wantErr: `ForceSendFields entry "Children.5.Size": index 5 is out of range for list field "Children" of length 2`,
+		},
+		{
+			s:       nestedSchema{Children: two(), NullFields: []string{"Children.0.Tags.x"}},
+			wantErr: `NullFields entry "Children.0.Tags.x": "x" is not an index of list field "Children.0.Tags"`,
+		},
+		{
+			s:       nestedSchema{Children: two(), NullFields: []string{"Children.0.Size.x"}},
+			wantErr: `NullFields entry "Children.0.Size.x": field "Children.0.Size" is not a schema, map or list`,
+		},
+	} {
+		type NoMethod nestedSchema
+		reflective, err := MarshalJSON(NoMethod(test.s), test.s.ForceSendFields, test.s.NullFields)
+		checkNested(t, "MarshalJSON", test.s, reflective, err, test.want, test.wantErr)
+		encoded, err := test.s.encode()
+		checkNested(t, "JSONEncoder", test.s, encoded, err, test.want, test.wantErr)
+	}
+}
+
+func checkNested(t *testing.T, name string, s nestedSchema, got []byte, err error, want, wantErr string) {
+	t.Helper()
+	if wantErr != "" {
+		if err == nil || err.Error() != wantErr {
+			t.Errorf("%s(%+v): got error %v, want %q", name, s, err, wantErr)
+		}
+		return
+	}
+	if err != nil {
+		t.Errorf("%s(%+v): %v", name, s, err)
+		return
+	}
+	var g, w interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("%s(%+v):\ngot  %s\nwant %s", name, s, got, want)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+)
+
+// operationBackoff returns the backoff used between polls of a long-running
+// operation. It is declared as a variable so that tests can overwrite it.
+var operationBackoff = func() Backoff {
+	return &gax.Backoff{
+		Initial:    time.Second,
+		Max:        30 * time.Second,
+		Multiplier: 2,
+	}
+}
+
+// PollOperation calls poll until it reports that the operation is done or
+// returns an error, pausing between calls with exponential backoff. It
+// returns ctx.Err() if ctx is done before the operation completes.
+// It is intended for use by generated code only.
+func PollOperation(ctx context.Context, poll func() (done bool, err error)) error {
+	bo := operationBackoff()
+	for {
+		done, err := poll()
+		if err != nil || done {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(bo.Pause()):
+		}
+	}
+}
+
+var (
+	patternMu sync.Mutex
+	patterns  = map[string]*regexp.Regexp{}
+)
+
+// matchPattern reports whether s matches the regular expression pattern.
+// Compiled patterns are cached, since generated code calls this on every poll.
+func matchPattern(pattern, s string) bool {
+	patternMu.Lock()
+	re, ok := patterns[pattern]
+	if !ok {
+		re, _ = regexp.Compile(pattern)
+		patterns[pattern] = re
+	}
+	patternMu.Unlock()
+	return re != nil && re.MatchString(s)
+}
+
+// MatchPath matches the resource name or URL s against the method path
+// template, as found in a discovery document, and returns the values of
+// the template's variables.
+//
+// The segments of s are matched against the trailing segments of template;
+// any leading template segments that are not matched must be literals, such
+// as an API version. If s is an absolute URL, such as an operation's self
+// link, the trailing segments of its path are matched and any remaining
+// leading segments are taken to be the API's base path.
+// A reserved expansion such as "{+name}" matches all of s, provided s is
+// not a URL and matches pattern (if pattern is non-empty).
+//
+// It is intended for use by generated code only.
+func MatchPath(template, pattern, s string) (map[string]string, bool) {
+	if s == "" {
+		return nil, false
+	}
+	isURL := strings.Contains(s, "://")
+	if isURL {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, false
+		}
+		s = u.Path
+	}
+	s = strings.Trim(s, "/")
+	tsegs := strings.Split(strings.Trim(template, "/"), "/")
+	if last := tsegs[len(tsegs)-1]; strings.HasPrefix(last, "{+") && strings.HasSuffix(last, "}") {
+		if isURL || pattern != "" && !matchPattern(pattern, s) {
+			return nil, false
+		}
+		return map[string]string{last[2 : len(last)-1]: s}, true
+	}
+	ssegs := strings.Split(s, "/")
+	off := len(tsegs) - len(ssegs)
+	if off < 0 {
+		if !isURL {
+			return nil, false
+		}
+		// The leading segments of a URL path hold the API's base path.
+		ssegs, off = ssegs[-off:], 0
+	}
+	vars := map[string]string{}
+	for i, t := range tsegs {
+		isVar := strings.HasPrefix(t, "{") && strings.HasSuffix(t, "}")
+		if i < off {
+			if isVar {
+				return nil, false
+			}
+			continue
+		}
+		seg := ssegs[i-off]
+		switch {
+		case isVar && seg != "":
+			vars[t[1:len(t)-1]] = seg
+		case t != seg:
+			return nil, false
+		}
+	}
+	return vars, true
+}
@@ -0,0 +1,130 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// fakeOperation is an operation that completes after a fixed number of polls.
+type fakeOperation struct {
+	polls     int
+	doneAfter int
+	err       error
+}
+
+func (op *fakeOperation) poll() (bool, error) {
+	op.polls++
+	if op.polls < op.doneAfter {
+		return false, nil
+	}
+	return true, op.err
+}
+
+func TestPollOperation(t *testing.T) {
+	defer func(old func() Backoff) { operationBackoff = old }(operationBackoff)
+	operationBackoff = func() Backoff { return new(NoPauseBackoff) }
+
+	errFailed := errors.New("operation failed")
+	for _, test := range []struct {
+		op        *fakeOperation
+		wantPolls int
+		wantErr   error
+	}{
+		{&fakeOperation{doneAfter: 1}, 1, nil},
+		{&fakeOperation{doneAfter: 5}, 5, nil},
+		{&fakeOperation{doneAfter: 3, err: errFailed}, 3, errFailed},
+	} {
+		err := PollOperation(context.Background(), test.op.poll)
+		if err != test.wantErr {
+			t.Errorf("doneAfter=%d: got error %v, want %v", test.op.doneAfter, err, test.wantErr)
+		}
+		if test.op.polls != test.wantPolls {
+			t.Errorf("doneAfter=%d: got %d polls, want %d", test.op.doneAfter, test.op.polls, test.wantPolls)
+		}
+	}
+}
+
+func TestPollOperationCanceled(t *testing.T) {
+	defer func(old func() Backoff) { operationBackoff = old }(operationBackoff)
+	operationBackoff = func() Backoff { return new(PauseForeverBackoff) }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	op := &fakeOperation{doneAfter: 10}
+	err := PollOperation(ctx, func() (bool, error) {
+		cancel()
+		return op.poll()
+	})
+	if err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+	if op.polls != 1 {
+		t.Errorf("got %d polls, want 1", op.polls)
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	for _, test := range []struct {
+		template, pattern, s string
+		want                 map[string]string
+	}{
+		{
+			template: "v1/apps/{appsId}/operations/{operationsId}",
+			s:        "apps/my-app/operations/1234",
+			want:     map[string]string{"appsId": "my-app", "operationsId": "1234"},
+		},
+		{
+			template: "{project}/zones/{zone}/operations/{operation}",
+			s:        "https://www.googleapis.com/compute/v1/projects/p/zones/us-east1-b/operations/op-1",
+			want:     map[string]string{"project": "p", "zone": "us-east1-b", "operation": "op-1"},
+		},
+		{
+			template: "{project}/regions/{region}/operations/{operation}",
+			s:        "https://www.googleapis.com/compute/v1/projects/p/zones/us-east1-b/operations/op-1",
+		},
+		{
+			template: "{project}/global/operations/{operation}",
+			s:        "https://www.googleapis.com/compute/v1/projects/p/global/operations/op-1",
+			want:     map[string]string{"project": "p", "operation": "op-1"},
+		},
+		{
+			// A bare name cannot satisfy variables that precede it.
+			template: "{project}/global/operations/{operation}",
+			s:        "op-1",
+		},
+		{
+			template: "v1/{+name}",
+			pattern:  "^projects/[^/]+/locations/[^/]+/operations/[^/]+$",
+			s:        "projects/p/locations/l/operations/o",
+			want:     map[string]string{"name": "projects/p/locations/l/operations/o"},
+		},
+		{
+			template: "v1/{+name}",
+			pattern:  "^operations/.*$",
+			s:        "projects/p/locations/l/operations/o",
+		},
+		{
+			template: "v1/{+name}",
+			s:        "operations/o",
+			want:     map[string]string{"name": "operations/o"},
+		},
+		{
+			template: "v1/{+name}",
+			s:        "https://container.googleapis.com/v1/projects/p/zones/z/operations/o",
+		},
+		{
+			template: "v1/apps/{appsId}/operations/{operationsId}",
+			s:        "",
+		},
+	} {
+		got, ok := MatchPath(test.template, test.pattern, test.s)
+		if ok != (test.want != nil) || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("MatchPath(%q, %q, %q) = %v, %t; want %v", test.template, test.pattern, test.s, got, ok, test.want)
+		}
+	}
+}
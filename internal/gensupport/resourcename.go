@@ -0,0 +1,39 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseResourceName parses name according to template, a resource name
+// template made of literal segments and variable segments such as
+// "projects/{projectsId}/secrets/{secretsId}". It returns the values of the
+// variable segments in the order they appear in template.
+//
+// It is intended for use by generated code only.
+func ParseResourceName(template, name string) ([]string, error) {
+	tsegs := strings.Split(template, "/")
+	nsegs := strings.Split(name, "/")
+	if len(nsegs) != len(tsegs) {
+		return nil, fmt.Errorf("invalid resource name %q: got %d segments, want %d for %q", name, len(nsegs), len(tsegs), template)
+	}
+	var vals []string
+	for i, t := range tsegs {
+		seg := nsegs[i]
+		if strings.HasPrefix(t, "{") && strings.HasSuffix(t, "}") {
+			if seg == "" {
+				return nil, fmt.Errorf("invalid resource name %q: empty value for %s", name, t)
+			}
+			vals = append(vals, seg)
+			continue
+		}
+		if seg != t {
+			return nil, fmt.Errorf("invalid resource name %q: got segment %q, want %q", name, seg, t)
+		}
+	}
+	return vals, nil
+}
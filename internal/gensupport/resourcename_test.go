@@ -0,0 +1,35 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gensupport
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseResourceName(t *testing.T) {
+	const template = "projects/{projectsId}/secrets/{secretsId}"
+	for _, test := range []struct {
+		name    string
+		want    []string
+		wantErr bool
+	}{
+		{name: "projects/p/secrets/s", want: []string{"p", "s"}},
+		{name: "projects/p/secrets", wantErr: true},
+		{name: "projects/p/secrets/s/versions/1", wantErr: true},
+		{name: "projects//secrets/s", wantErr: true},
+		{name: "projects/p/topics/s", wantErr: true},
+		{name: "", wantErr: true},
+	} {
+		got, err := ParseResourceName(template, test.name)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseResourceName(%q): got error %v, want error: %t", test.name, err, test.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseResourceName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
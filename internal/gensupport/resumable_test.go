@@ -14,6 +14,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"google.golang.org/api/googleapi"
 )
 
 type unexpectedReader struct{}
@@ -204,6 +206,49 @@ func TestInterruptedTransferChunks(t *testing.T) {
 	}
 }
 
+func TestGzipChunksUncompressed(t *testing.T) {
+	const data = "aaaaaaaaaabbbbbbbbbbcccc"
+	var got []string
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		got = append(got, fmt.Sprintf("%s %q %s", req.Header.Get("Content-Range"), req.Header.Get("Content-Encoding"), b))
+		if req.ContentLength != int64(len(b)) {
+			return nil, fmt.Errorf("Content-Length is %d, sent %d bytes", req.ContentLength, len(b))
+		}
+		h := http.Header{}
+		if !strings.HasSuffix(req.Header.Get("Content-Range"), "/24") {
+			h.Set("X-Http-Status-Code-Override", "308")
+		}
+		return &http.Response{StatusCode: 200, Header: h, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	})}
+	// Media larger than a chunk makes a resumable upload; use smaller chunks
+	// of data for the test.
+	mi := NewInfoFromMedia(&nullReader{2 * googleapi.MinUploadChunkSize}, []googleapi.MediaOption{googleapi.ChunkSize(1), googleapi.Gzip()})
+	rx := mi.ResumableUpload("https://example.com/upload")
+	rx.Client = client
+	rx.Media = NewMediaBuffer(strings.NewReader(data), 10)
+	res, err := rx.Upload(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	want := []string{
+		`bytes 0-9/* "" aaaaaaaaaa`,
+		`bytes 10-19/* "" bbbbbbbbbb`,
+		`bytes 20-23/24 "" cccc`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got requests %q, want %q", got, want)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
 func TestCancelUploadFast(t *testing.T) {
 	const (
 		chunkSize = 90
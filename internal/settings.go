@@ -6,9 +6,11 @@
 package internal
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"net/http"
+	"time"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
@@ -18,25 +20,36 @@ import (
 // DialSettings holds information needed to establish a connection with a
 // Google API service.
 type DialSettings struct {
-	Endpoint          string
-	DefaultEndpoint   string
-	Scopes            []string
-	TokenSource       oauth2.TokenSource
-	Credentials       *google.Credentials
-	CredentialsFile   string // if set, Token Source is ignored.
-	CredentialsJSON   []byte
-	UserAgent         string
-	APIKey            string
-	Audiences         []string
-	HTTPClient        *http.Client
-	GRPCDialOpts      []grpc.DialOption
-	GRPCConn          *grpc.ClientConn
-	GRPCConnPool      ConnPool
-	GRPCConnPoolSize  int
-	NoAuth            bool
-	TelemetryDisabled bool
-	ClientCertSource  func(*tls.CertificateRequestInfo) (*tls.Certificate, error)
-	CustomClaims      map[string]interface{}
+	Endpoint            string
+	DefaultEndpoint     string
+	DefaultMTLSEndpoint string
+	EmulatorHostEnv     string
+	Scopes              []string
+	TokenSource         oauth2.TokenSource
+	Credentials         *google.Credentials
+	CredentialsFile     string // if set, Token Source is ignored.
+	CredentialsJSON     []byte
+	UserAgent           string
+	APIKey              string
+	Audiences           []string
+	HTTPClient          *http.Client
+	GRPCDialOpts        []grpc.DialOption
+	GRPCConn            *grpc.ClientConn
+	GRPCConnPool        ConnPool
+	GRPCConnPoolSize    int
+	NoAuth              bool
+	TelemetryDisabled   bool
+	ClientCertSource    func(*tls.CertificateRequestInfo) (*tls.Certificate, error)
+	CustomClaims        map[string]interface{}
+	HTTPCache           HTTPCache
+	GzipRequests        bool
+	RateLimiter         RateLimiter
+
+	// Circuit breaking and hedging of HTTP requests.
+	CircuitBreakerFailures int
+	CircuitBreakerOpenFor  time.Duration
+	HedgePercentile        float64
+	HedgeInitialDelay      time.Duration
 
 	// Google API system parameters. For more information please read:
 	// https://cloud.google.com/apis/docs/system-parameters
@@ -44,6 +57,21 @@ type DialSettings struct {
 	RequestReason string
 }
 
+// HTTPCache stores HTTP responses for reuse. It has the same methods as
+// option.HTTPCache.
+type HTTPCache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte)
+	Delete(key string)
+}
+
+// RateLimiter limits the rate of requests. It has the same methods as
+// option.RateLimiter.
+type RateLimiter interface {
+	Wait(ctx context.Context, method string) error
+	Observe(method string, err error)
+}
+
 // Validate reports an error if ds is invalid.
 func (ds *DialSettings) Validate() error {
 	hasCreds := ds.APIKey != "" || ds.TokenSource != nil || ds.CredentialsFile != "" || ds.Credentials != nil
@@ -94,6 +122,27 @@ func (ds *DialSettings) Validate() error {
 	if ds.HTTPClient != nil && ds.RequestReason != "" {
 		return errors.New("WithHTTPClient is incompatible with RequestReason")
 	}
+	if ds.HTTPClient != nil && ds.HTTPCache != nil {
+		return errors.New("WithHTTPClient is incompatible with WithHTTPCache")
+	}
+	if ds.HTTPClient != nil && ds.GzipRequests {
+		return errors.New("WithHTTPClient is incompatible with WithGzipRequests")
+	}
+	if ds.HTTPClient != nil && ds.RateLimiter != nil {
+		return errors.New("WithHTTPClient is incompatible with WithRateLimiter")
+	}
+	if (ds.GRPCConn != nil || ds.GRPCConnPool != nil) && ds.RateLimiter != nil {
+		return errors.New("WithGRPCConn and WithConnPool are incompatible with WithRateLimiter")
+	}
+	if ds.HTTPClient != nil && (ds.CircuitBreakerFailures != 0 || ds.HedgePercentile != 0) {
+		return errors.New("WithHTTPClient is incompatible with WithCircuitBreaker and WithHedgedRequests")
+	}
+	if ds.CircuitBreakerFailures < 0 || ds.CircuitBreakerOpenFor < 0 {
+		return errors.New("WithCircuitBreaker requires a positive number of failures and a non-negative duration")
+	}
+	if ds.HedgePercentile < 0 || ds.HedgePercentile > 1 || ds.HedgeInitialDelay < 0 {
+		return errors.New("WithHedgedRequests requires a percentile between 0 and 1 and a non-negative delay")
+	}
 	if ds.HTTPClient != nil && ds.ClientCertSource != nil {
 		return errors.New("WithHTTPClient is incompatible with WithClientCertSource")
 	}
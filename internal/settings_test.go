@@ -9,6 +9,7 @@ import (
 	"crypto/tls"
 	"net/http"
 	"testing"
+	"time"
 
 	"google.golang.org/grpc"
 
@@ -35,6 +36,11 @@ func TestSettingsValidate(t *testing.T) {
 		// the check feasible.
 		{NoAuth: true, Scopes: []string{"s"}},
 		{ClientCertSource: dummyGetClientCertificate},
+		{HTTPCache: struct{ HTTPCache }{}},
+		{GzipRequests: true},
+		{RateLimiter: struct{ RateLimiter }{}},
+		{CircuitBreakerFailures: 5, CircuitBreakerOpenFor: time.Second},
+		{HedgePercentile: 0.95, HedgeInitialDelay: time.Second},
 	} {
 		err := ds.Validate()
 		if err != nil {
@@ -59,6 +65,17 @@ func TestSettingsValidate(t *testing.T) {
 		{HTTPClient: &http.Client{}, QuotaProject: "foo"},
 		{HTTPClient: &http.Client{}, RequestReason: "foo"},
 		{HTTPClient: &http.Client{}, ClientCertSource: dummyGetClientCertificate},
+		{HTTPClient: &http.Client{}, HTTPCache: struct{ HTTPCache }{}},
+		{HTTPClient: &http.Client{}, GzipRequests: true},
+		{HTTPClient: &http.Client{}, RateLimiter: struct{ RateLimiter }{}},
+		{GRPCConn: &grpc.ClientConn{}, RateLimiter: struct{ RateLimiter }{}},
+		{GRPCConnPool: struct{ ConnPool }{}, RateLimiter: struct{ RateLimiter }{}},
+		{HTTPClient: &http.Client{}, CircuitBreakerFailures: 5},
+		{HTTPClient: &http.Client{}, HedgePercentile: 0.95},
+		{CircuitBreakerFailures: -1},
+		{CircuitBreakerFailures: 5, CircuitBreakerOpenFor: -time.Second},
+		{HedgePercentile: 1.5},
+		{HedgePercentile: 0.5, HedgeInitialDelay: -time.Second},
 		{ClientCertSource: dummyGetClientCertificate, GRPCConn: &grpc.ClientConn{}},
 		{ClientCertSource: dummyGetClientCertificate, GRPCConnPool: struct{ ConnPool }{}},
 		{ClientCertSource: dummyGetClientCertificate, GRPCDialOpts: []grpc.DialOption{grpc.WithInsecure()}},
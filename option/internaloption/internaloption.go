@@ -24,3 +24,37 @@ func (o defaultEndpointOption) Apply(settings *internal.DialSettings) {
 func WithDefaultEndpoint(url string) option.ClientOption {
 	return defaultEndpointOption(url)
 }
+
+type defaultMTLSEndpointOption string
+
+func (o defaultMTLSEndpointOption) Apply(settings *internal.DialSettings) {
+	settings.DefaultMTLSEndpoint = string(o)
+}
+
+// WithDefaultMTLSEndpoint is an option that indicates the default mTLS endpoint.
+//
+// It should only be used internally by generated clients.
+//
+// It is used instead of the default endpoint when a client certificate is
+// configured and the user has not overridden the endpoint.
+func WithDefaultMTLSEndpoint(url string) option.ClientOption {
+	return defaultMTLSEndpointOption(url)
+}
+
+type emulatorHostEnvOption string
+
+func (o emulatorHostEnvOption) Apply(settings *internal.DialSettings) {
+	settings.EmulatorHostEnv = string(o)
+}
+
+// WithEmulatorHostEnv is an option that names the environment variable, like
+// STORAGE_EMULATOR_HOST, holding the address of a local emulator of the API.
+//
+// It should only be used internally by generated clients.
+//
+// If the variable is set and the user has not overridden the endpoint,
+// requests are sent without authentication to the emulator instead of the
+// default endpoint.
+func WithEmulatorHostEnv(name string) option.ClientOption {
+	return emulatorHostEnvOption(name)
+}
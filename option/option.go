@@ -6,8 +6,10 @@
 package option
 
 import (
+	"context"
 	"crypto/tls"
 	"net/http"
+	"time"
 
 	"golang.org/x/oauth2"
 	"google.golang.org/api/internal"
@@ -269,3 +271,158 @@ type withClientCertSource struct{ s ClientCertSource }
 func (w withClientCertSource) Apply(o *internal.DialSettings) {
 	o.ClientCertSource = w.s
 }
+
+// HTTPCache stores the responses of HTTP clients created with WithHTTPCache.
+// Keys and values are opaque; a value stored with Set should be returned by
+// Get for the same key until it is deleted or evicted. Implementations must
+// be safe for concurrent use. See google.golang.org/api/transport/http/httpcache
+// for in-memory and on-disk implementations.
+//
+// This is an EXPERIMENTAL API and may be changed or removed in the future.
+type HTTPCache interface {
+	// Get returns the value stored for key, if any.
+	Get(key string) (value []byte, ok bool)
+	// Set stores value for key.
+	Set(key string, value []byte)
+	// Delete removes the value stored for key, if any.
+	Delete(key string)
+}
+
+// WithHTTPCache returns a ClientOption that caches the responses to GET
+// requests in c. Cached responses are kept apart for different credentials.
+// Responses with an ETag are revalidated with If-None-Match, and a response
+// of 304 Not Modified is replaced by the cached response, unless the caller
+// set If-None-Match itself. Responses are reused without revalidation while
+// they are fresh according to their Cache-Control or Expires headers, and are
+// not stored if either the request or the response has Cache-Control:
+// no-store. Other requests to a URL remove its cached response.
+//
+// WithHTTPCache applies to HTTP clients only, and is incompatible with
+// WithHTTPClient.
+//
+// This is an EXPERIMENTAL API and may be changed or removed in the future.
+func WithHTTPCache(c HTTPCache) ClientOption {
+	return withHTTPCache{c}
+}
+
+type withHTTPCache struct{ c HTTPCache }
+
+func (w withHTTPCache) Apply(o *internal.DialSettings) {
+	o.HTTPCache = w.c
+}
+
+// WithGzipRequests returns a ClientOption that compresses the bodies of HTTP
+// requests with gzip as they are sent, and sets their Content-Encoding header
+// to "gzip". Bodies of unknown length, such as media uploads, and bodies of
+// at least 1 KiB are compressed; requests whose Content-Encoding is already
+// set, and the chunks of resumable uploads, are sent unchanged. Only use it
+// with APIs that accept compressed requests. To compress only media uploads,
+// use googleapi.Gzip instead.
+//
+// WithGzipRequests applies to HTTP clients only, and is incompatible with
+// WithHTTPClient.
+//
+// This is an EXPERIMENTAL API and may be changed or removed in the future.
+func WithGzipRequests() ClientOption {
+	return withGzipRequests{}
+}
+
+type withGzipRequests struct{}
+
+func (w withGzipRequests) Apply(o *internal.DialSettings) {
+	o.GzipRequests = true
+}
+
+// RateLimiter limits the rate of requests made by clients created with
+// WithRateLimiter. Implementations must be safe for concurrent use. See
+// google.golang.org/api/transport/ratelimit for a token bucket implementation.
+//
+// This is an EXPERIMENTAL API and may be changed or removed in the future.
+type RateLimiter interface {
+	// Wait blocks until a request of method may be made, or returns an error
+	// if it may not be made before ctx is done. The method of HTTP requests
+	// made by generated clients is the method ID in the discovery document,
+	// like "compute.instances.insert"; it is "" for other HTTP requests. The
+	// method of gRPC calls is their full method name.
+	Wait(ctx context.Context, method string) error
+	// Observe is called with the result of each request of method that Wait
+	// allowed. For HTTP requests, err is a *googleapi.Error if the response
+	// status code is 400 or higher.
+	Observe(method string, err error)
+}
+
+// WithRateLimiter returns a ClientOption that makes each request wait for l
+// before it is sent, and reports its result to l. It applies to HTTP clients
+// and to gRPC connections dialed by the transport, where it is installed as
+// unary and stream interceptors. Fresh responses from the cache configured by
+// WithHTTPCache are returned without waiting.
+//
+// WithRateLimiter is incompatible with WithHTTPClient, WithGRPCConn and
+// WithConnPool.
+//
+// This is an EXPERIMENTAL API and may be changed or removed in the future.
+func WithRateLimiter(l RateLimiter) ClientOption {
+	return withRateLimiter{l}
+}
+
+type withRateLimiter struct{ l RateLimiter }
+
+func (w withRateLimiter) Apply(o *internal.DialSettings) {
+	o.RateLimiter = w.l
+}
+
+// WithCircuitBreaker returns a ClientOption that stops sending requests with
+// idempotent methods (GET, HEAD, OPTIONS, PUT and DELETE) to a host after
+// failures consecutive such requests to it have timed out or received a 5xx
+// response. While the circuit is open, requests to the host fail immediately
+// with an error whose Err field, if it is a *url.Error, is
+// google.golang.org/api/transport/http.ErrCircuitOpen. After openFor, a single
+// request is let through as a probe: the circuit closes if it succeeds, and
+// opens again if it fails. Requests with other methods are not affected.
+//
+// The circuit breaker applies to HTTP clients only, and is incompatible with
+// WithHTTPClient. Unless telemetry is disabled, its decisions are recorded
+// as OpenCensus trace annotations and measurements; see
+// google.golang.org/api/transport/http.ResilienceDecisionsView.
+//
+// This is an EXPERIMENTAL API and may be changed or removed in the future.
+func WithCircuitBreaker(failures int, openFor time.Duration) ClientOption {
+	return withCircuitBreaker{failures, openFor}
+}
+
+type withCircuitBreaker struct {
+	failures int
+	openFor  time.Duration
+}
+
+func (w withCircuitBreaker) Apply(o *internal.DialSettings) {
+	o.CircuitBreakerFailures = w.failures
+	o.CircuitBreakerOpenFor = w.openFor
+}
+
+// WithHedgedRequests returns a ClientOption that sends a second, identical
+// GET or HEAD request if the first has not received a response after the
+// given percentile, like 0.95, of the latencies of recent requests to the
+// same host, or after initialDelay until enough latencies are known. The
+// first response received is returned, and the other request is canceled.
+// Requests with other methods or with a body are not hedged.
+//
+// Hedged requests apply to HTTP clients only, and are incompatible with
+// WithHTTPClient. Unless telemetry is disabled, hedging decisions are
+// recorded as OpenCensus trace annotations and measurements; see
+// google.golang.org/api/transport/http.ResilienceDecisionsView.
+//
+// This is an EXPERIMENTAL API and may be changed or removed in the future.
+func WithHedgedRequests(percentile float64, initialDelay time.Duration) ClientOption {
+	return withHedgedRequests{percentile, initialDelay}
+}
+
+type withHedgedRequests struct {
+	percentile   float64
+	initialDelay time.Duration
+}
+
+func (w withHedgedRequests) Apply(o *internal.DialSettings) {
+	o.HedgePercentile = w.percentile
+	o.HedgeInitialDelay = w.initialDelay
+}
@@ -0,0 +1,471 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pubsubpublish publishes messages to a topic in batches, with the
+// REST calls of the pubsub/v1 package.
+//
+// A Publisher collects the messages passed to Publish into batches, which it
+// sends once they hold enough messages or bytes, or once their first
+// message waited long enough. Publish returns a Result, which reports the ID
+// that the server assigns to the message:
+//
+//	p := &pubsubpublish.Publisher{
+//		Service: svc,
+//		Topic:   "projects/my-project/topics/my-topic",
+//	}
+//	defer p.Stop()
+//	r := p.Publish(&pubsubpublish.Message{Data: []byte("hello")})
+//	id, err := r.Get(ctx)
+//
+// The messages with the same non-empty ordering key are sent with their
+// ordering key, in the order they are published, one batch at a time, so
+// that the subscriptions with message ordering receive them in order. Once a
+// batch of an ordering key fails, the messages of that key fail until
+// ResumePublish is called. The pubsub/v1 package does not have the
+// orderingKey field of messages, so the Publisher builds the requests of
+// these batches itself, and sends them with its HTTPClient, which must be
+// set to publish messages with ordering keys:
+//
+//	client, _, err := htransport.NewClient(ctx, option.WithScopes(pubsub.PubsubScope))
+//	...
+//	svc, err := pubsub.NewService(ctx, option.WithHTTPClient(client))
+//	...
+//	p := &pubsubpublish.Publisher{Service: svc, HTTPClient: client, Topic: topic}
+//
+// This is an EXPERIMENTAL API and may be changed or removed in the future.
+package pubsubpublish
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/internal/gensupport"
+	pubsub "google.golang.org/api/pubsub/v1"
+)
+
+// The defaults of the thresholds of a Publisher.
+const (
+	DefaultCountThreshold = 100
+	DefaultByteThreshold  = 1000000
+	DefaultDelayThreshold = 10 * time.Millisecond
+)
+
+// The limits of a publish request.
+const (
+	MaxPublishRequestCount = 1000
+	MaxPublishRequestBytes = 10000000
+)
+
+var (
+	// ErrOversizedMessage is the error of a message too large to be
+	// published.
+	ErrOversizedMessage = errors.New("pubsubpublish: message larger than the maximum request size")
+
+	// ErrStopped is the error of the messages published after Stop.
+	ErrStopped = errors.New("pubsubpublish: publisher stopped")
+
+	// ErrNoHTTPClient is the error of the messages published with an
+	// ordering key by a Publisher without HTTPClient.
+	ErrNoHTTPClient = errors.New("pubsubpublish: publishing with an ordering key requires Publisher.HTTPClient")
+)
+
+// A PausedError is the error of the messages published with an ordering key
+// whose publication failed, until ResumePublish is called.
+type PausedError struct {
+	// OrderingKey is the paused ordering key.
+	OrderingKey string
+
+	// Err is the error that paused the ordering key.
+	Err error
+}
+
+func (e *PausedError) Error() string {
+	return fmt.Sprintf("pubsubpublish: publishing paused for ordering key %q after error: %v", e.OrderingKey, e.Err)
+}
+
+// A Message is a message to publish.
+type Message struct {
+	// Data is the data of the message.
+	Data []byte
+
+	// Attributes are the attributes of the message.
+	Attributes map[string]string
+
+	// OrderingKey, if not empty, is the key of the messages that are
+	// published in order.
+	OrderingKey string
+}
+
+// A Result is the result of publishing a message.
+type Result struct {
+	ready chan struct{}
+	id    string
+	err   error
+}
+
+func newResult() *Result {
+	return &Result{ready: make(chan struct{})}
+}
+
+func (r *Result) set(id string, err error) {
+	r.id, r.err = id, err
+	close(r.ready)
+}
+
+// Ready returns a channel that is closed once the message is published, or
+// failed.
+func (r *Result) Ready() <-chan struct{} {
+	return r.ready
+}
+
+// Get waits until the message is published or failed, or ctx is done, and
+// returns the ID assigned to the message by the server.
+func (r *Result) Get(ctx context.Context) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-r.ready:
+		return r.id, r.err
+	}
+}
+
+// A Publisher publishes messages to a topic in batches. Its zero thresholds
+// use the defaults.
+type Publisher struct {
+	// Service is the service used to publish messages.
+	Service *pubsub.Service
+
+	// HTTPClient is the client used to publish the messages with an ordering
+	// key, in requests built like those of Service. It must authorize the
+	// requests like the client of Service, such as a client returned by
+	// google.golang.org/api/transport/http.NewClient.
+	HTTPClient *http.Client
+
+	// Topic is the name of the topic, in the form
+	// "projects/{project}/topics/{topic}".
+	Topic string
+
+	// CountThreshold is the number of messages of a batch that is sent. It
+	// is at most MaxPublishRequestCount.
+	CountThreshold int
+
+	// ByteThreshold is the size of the messages of a batch that is sent.
+	// Batches are also sent before they grow over MaxPublishRequestBytes.
+	ByteThreshold int
+
+	// DelayThreshold is how long the first message of a batch waits for
+	// others before the batch is sent.
+	DelayThreshold time.Duration
+
+	mu      sync.Mutex
+	keys    map[string]*orderingKey
+	stopped bool
+	pending int        // batches being sent or queued
+	idle    *sync.Cond // signaled when pending drops to zero
+}
+
+// An orderingKey is the state of the messages with an ordering key.
+type orderingKey struct {
+	batch   *batch   // batch being filled, if any
+	queue   []*batch // full batches waiting to be sent, for ordered keys
+	sending bool     // whether a batch of an ordered key is being sent
+	err     error    // error that paused an ordered key
+}
+
+// A batch is the messages of a publish request.
+type batch struct {
+	key      string
+	messages []*message
+	results  []*Result
+	size     int
+	timer    *time.Timer
+}
+
+func (p *Publisher) countThreshold() int {
+	if p.CountThreshold > 0 && p.CountThreshold < MaxPublishRequestCount {
+		return p.CountThreshold
+	}
+	if p.CountThreshold > 0 {
+		return MaxPublishRequestCount
+	}
+	return DefaultCountThreshold
+}
+
+func (p *Publisher) byteThreshold() int {
+	if p.ByteThreshold > 0 && p.ByteThreshold < MaxPublishRequestBytes {
+		return p.ByteThreshold
+	}
+	if p.ByteThreshold > 0 {
+		return MaxPublishRequestBytes
+	}
+	return DefaultByteThreshold
+}
+
+func (p *Publisher) delayThreshold() time.Duration {
+	if p.DelayThreshold > 0 {
+		return p.DelayThreshold
+	}
+	return DefaultDelayThreshold
+}
+
+// publishRequest is the body of a publish request. Unlike
+// pubsub.PublishRequest, it has the ordering keys of the messages.
+type publishRequest struct {
+	Messages []*message `json:"messages"`
+}
+
+type message struct {
+	Data        string            `json:"data,omitempty"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	OrderingKey string            `json:"orderingKey,omitempty"`
+}
+
+// requestOverhead is the size of a publish request without messages:
+// {"messages":[]}.
+const requestOverhead = 15
+
+// Publish adds m to a batch, and returns its result. It does not block.
+func (p *Publisher) Publish(m *Message) *Result {
+	r := newResult()
+	if m.OrderingKey != "" && p.HTTPClient == nil {
+		r.set("", ErrNoHTTPClient)
+		return r
+	}
+	msg := &message{
+		Data:        base64.StdEncoding.EncodeToString(m.Data),
+		Attributes:  m.Attributes,
+		OrderingKey: m.OrderingKey,
+	}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		r.set("", err)
+		return r
+	}
+	// The size of the message in the request, with a separating comma.
+	size := len(b) + 1
+	if requestOverhead+size > MaxPublishRequestBytes {
+		r.set("", ErrOversizedMessage)
+		return r
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped {
+		r.set("", ErrStopped)
+		return r
+	}
+	p.init()
+	k := p.keys[m.OrderingKey]
+	if k == nil {
+		k = &orderingKey{}
+		p.keys[m.OrderingKey] = k
+	}
+	if k.err != nil {
+		r.set("", &PausedError{OrderingKey: m.OrderingKey, Err: k.err})
+		return r
+	}
+	if k.batch != nil && requestOverhead+k.batch.size+size > MaxPublishRequestBytes {
+		p.flush(k)
+	}
+	if k.batch == nil {
+		b := &batch{key: m.OrderingKey}
+		b.timer = time.AfterFunc(p.delayThreshold(), func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if k := p.keys[b.key]; k != nil && k.batch == b {
+				p.flush(k)
+			}
+		})
+		k.batch = b
+	}
+	k.batch.messages = append(k.batch.messages, msg)
+	k.batch.results = append(k.batch.results, r)
+	k.batch.size += size
+	if len(k.batch.messages) >= p.countThreshold() || k.batch.size >= p.byteThreshold() {
+		p.flush(k)
+	}
+	return r
+}
+
+// init initializes p on first use. p.mu must be held.
+func (p *Publisher) init() {
+	if p.keys == nil {
+		p.keys = make(map[string]*orderingKey)
+		p.idle = sync.NewCond(&p.mu)
+	}
+}
+
+// done records that n batches were sent or failed. p.mu must be held.
+func (p *Publisher) done(n int) {
+	p.pending -= n
+	if p.pending == 0 {
+		p.idle.Broadcast()
+	}
+}
+
+// flush sends the batch being filled for k, or queues it behind the batch
+// being sent for an ordered key. p.mu must be held.
+func (p *Publisher) flush(k *orderingKey) {
+	b := k.batch
+	if b == nil {
+		return
+	}
+	k.batch = nil
+	b.timer.Stop()
+	p.pending++
+	if b.key == "" {
+		go func() {
+			p.send(b)
+			p.mu.Lock()
+			p.done(1)
+			p.mu.Unlock()
+		}()
+		return
+	}
+	k.queue = append(k.queue, b)
+	if !k.sending {
+		k.sending = true
+		go p.sendQueue(b.key, k)
+	}
+}
+
+// sendQueue sends the queued batches of the ordered key k, one at a time,
+// until its queue is empty.
+func (p *Publisher) sendQueue(key string, k *orderingKey) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(k.queue) > 0 {
+		b := k.queue[0]
+		k.queue = k.queue[1:]
+		p.mu.Unlock()
+		err := p.send(b)
+		p.mu.Lock()
+		p.done(1)
+		if err != nil {
+			// The later messages of the key fail, so that none of them is
+			// published out of order.
+			k.err = err
+			failed := k.queue
+			k.queue = nil
+			if k.batch != nil {
+				k.batch.timer.Stop()
+				failed = append(failed, k.batch)
+				k.batch = nil
+				p.pending++
+			}
+			for _, b := range failed {
+				for _, r := range b.results {
+					r.set("", &PausedError{OrderingKey: b.key, Err: err})
+				}
+			}
+			p.done(len(failed))
+		}
+	}
+	k.sending = false
+	// Keys are dropped once idle, unless they are paused.
+	if k.batch == nil && k.err == nil {
+		delete(p.keys, key)
+	}
+}
+
+// send publishes the messages of b, and sets their results.
+func (p *Publisher) send(b *batch) error {
+	var res *pubsub.PublishResponse
+	var err error
+	if b.key == "" {
+		req := &pubsub.PublishRequest{}
+		for _, m := range b.messages {
+			req.Messages = append(req.Messages, &pubsub.PubsubMessage{Data: m.Data, Attributes: m.Attributes})
+		}
+		res, err = p.Service.Projects.Topics.Publish(p.Topic, req).Do()
+	} else {
+		res, err = p.publishOrdered(b.messages)
+	}
+	if err == nil && len(res.MessageIds) != len(b.messages) {
+		err = fmt.Errorf("pubsubpublish: got %d message IDs for %d messages", len(res.MessageIds), len(b.messages))
+	}
+	for i, r := range b.results {
+		if err != nil {
+			r.set("", err)
+		} else {
+			r.set(res.MessageIds[i], nil)
+		}
+	}
+	return err
+}
+
+// publishOrdered publishes messages with their ordering key, which
+// pubsub.PubsubMessage does not have, with a request built like that of
+// ProjectsTopicsPublishCall.
+func (p *Publisher) publishOrdered(messages []*message) (*pubsub.PublishResponse, error) {
+	body, err := googleapi.WithoutDataWrapper.JSONReader(&publishRequest{Messages: messages})
+	if err != nil {
+		return nil, err
+	}
+	urls := googleapi.ResolveRelative(p.Service.BasePath, "v1/{+topic}:publish") + "?alt=json&prettyPrint=false"
+	req, err := http.NewRequest("POST", urls, body)
+	if err != nil {
+		return nil, err
+	}
+	googleapi.Expand(req.URL, map[string]string{"topic": p.Topic})
+	req.Header.Set("Content-Type", "application/json")
+	ua := googleapi.UserAgent
+	if p.Service.UserAgent != "" {
+		ua += " " + p.Service.UserAgent
+	}
+	req.Header.Set("User-Agent", ua)
+	res, err := gensupport.SendRequest(context.Background(), p.HTTPClient, req)
+	if err != nil {
+		return nil, err
+	}
+	defer googleapi.CloseBody(res)
+	if err := googleapi.CheckResponse(res); err != nil {
+		return nil, err
+	}
+	ret := &pubsub.PublishResponse{}
+	if err := gensupport.DecodeResponse(ret, res); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ResumePublish resumes publishing the messages with the ordering key,
+// after a failure paused it.
+func (p *Publisher) ResumePublish(orderingKey string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if k := p.keys[orderingKey]; k != nil {
+		k.err = nil
+	}
+}
+
+// Flush sends the batches being filled, and waits until all the messages
+// published before are published or failed.
+func (p *Publisher) Flush() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.init()
+	for _, k := range p.keys {
+		p.flush(k)
+	}
+	for p.pending > 0 {
+		p.idle.Wait()
+	}
+}
+
+// Stop flushes the publisher. The messages published after Stop fail with
+// ErrStopped.
+func (p *Publisher) Stop() {
+	p.mu.Lock()
+	p.stopped = true
+	p.mu.Unlock()
+	p.Flush()
+}
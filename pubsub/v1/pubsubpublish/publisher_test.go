@@ -0,0 +1,308 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pubsubpublish
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+	pubsub "google.golang.org/api/pubsub/v1"
+)
+
+const topic = "projects/p/topics/t"
+
+// fakeServer serves the publish calls of a topic, failing the requests with
+// a message whose data is "fail".
+type fakeServer struct {
+	t     *testing.T
+	delay time.Duration
+
+	mu       sync.Mutex
+	next     int
+	requests [][]string // message data
+	keys     []string   // ordering key of the messages of each request
+	maxSize  int
+	inFlight int
+	maxIn    int
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/"+topic+":publish" {
+		f.t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		http.Error(w, "unexpected", http.StatusBadRequest)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		f.t.Error(err)
+	}
+	var req struct {
+		Messages []struct {
+			Data        string `json:"data"`
+			OrderingKey string `json:"orderingKey"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		f.t.Error(err)
+	}
+	f.mu.Lock()
+	f.inFlight++
+	if f.inFlight > f.maxIn {
+		f.maxIn = f.inFlight
+	}
+	if len(body) > f.maxSize {
+		f.maxSize = len(body)
+	}
+	var data []string
+	fail := false
+	for _, m := range req.Messages {
+		d, err := base64.StdEncoding.DecodeString(m.Data)
+		if err != nil {
+			f.t.Error(err)
+		}
+		if len(d) > 20 {
+			d = d[:20]
+		}
+		data = append(data, string(d))
+		fail = fail || string(d) == "fail"
+	}
+	for _, m := range req.Messages[1:] {
+		if m.OrderingKey != req.Messages[0].OrderingKey {
+			f.t.Errorf("request with ordering keys %q and %q", req.Messages[0].OrderingKey, m.OrderingKey)
+		}
+	}
+	f.requests = append(f.requests, data)
+	f.keys = append(f.keys, req.Messages[0].OrderingKey)
+	f.mu.Unlock()
+
+	time.Sleep(f.delay)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inFlight--
+	if fail {
+		http.Error(w, `{"error": {"code": 400, "message": "invalid"}}`, http.StatusBadRequest)
+		return
+	}
+	res := &pubsub.PublishResponse{}
+	for range req.Messages {
+		f.next++
+		res.MessageIds = append(res.MessageIds, fmt.Sprintf("id%d", f.next))
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+func newPublisher(t *testing.T, f *fakeServer) (*Publisher, func()) {
+	srv := httptest.NewServer(f)
+	svc, err := pubsub.NewService(context.Background(), option.WithHTTPClient(http.DefaultClient), option.WithEndpoint(srv.URL+"/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Publisher{
+		Service:        svc,
+		HTTPClient:     http.DefaultClient,
+		Topic:          topic,
+		DelayThreshold: time.Hour,
+	}
+	return p, srv.Close
+}
+
+func publish(p *Publisher, key string, data ...string) []*Result {
+	var rs []*Result
+	for _, d := range data {
+		rs = append(rs, p.Publish(&Message{Data: []byte(d), Attributes: map[string]string{"k": "v"}, OrderingKey: key}))
+	}
+	return rs
+}
+
+func TestThresholds(t *testing.T) {
+	f := &fakeServer{t: t}
+	p, done := newPublisher(t, f)
+	defer done()
+	p.CountThreshold = 3
+	rs := publish(p, "", "a", "b", "c", "d", "e", "f", "g")
+	p.Flush()
+	want := [][]string{{"a", "b", "c"}, {"d", "e", "f"}, {"g"}}
+	// Batches without ordering keys may be sent in any order.
+	sort.Slice(f.requests, func(i, j int) bool { return f.requests[i][0] < f.requests[j][0] })
+	if diff := cmp.Diff(want, f.requests); diff != "" {
+		t.Errorf("requests mismatch (-want +got):\n%s", diff)
+	}
+	ids := make(map[string]bool)
+	for _, r := range rs {
+		select {
+		case <-r.Ready():
+		default:
+			t.Fatal("result not ready after Flush")
+		}
+		id, err := r.Get(context.Background())
+		if err != nil || id == "" || ids[id] {
+			t.Errorf("got ID %q, %v", id, err)
+		}
+		ids[id] = true
+	}
+
+	// The byte threshold counts the size of the messages in the request.
+	f.requests = nil
+	p.CountThreshold = 0
+	p.ByteThreshold = 70
+	publish(p, "", "a", "b", "c")
+	p.Flush()
+	sort.Slice(f.requests, func(i, j int) bool { return f.requests[i][0] < f.requests[j][0] })
+	if diff := cmp.Diff([][]string{{"a", "b"}, {"c"}}, f.requests); diff != "" {
+		t.Errorf("requests mismatch (-want +got):\n%s", diff)
+	}
+
+	// The delay threshold sends the batch without Flush.
+	f.requests = nil
+	p.DelayThreshold = 10 * time.Millisecond
+	r := publish(p, "", "late")[0]
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := r.Get(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRequestLimit(t *testing.T) {
+	f := &fakeServer{t: t}
+	p, done := newPublisher(t, f)
+	defer done()
+	p.ByteThreshold = 2 * MaxPublishRequestBytes
+	large := bytes.Repeat([]byte("x"), 4e6)
+	rs := []*Result{
+		p.Publish(&Message{Data: large}),
+		p.Publish(&Message{Data: large}),
+		p.Publish(&Message{Data: bytes.Repeat([]byte("x"), 8e6)}),
+	}
+	p.Flush()
+	if len(f.requests) != 2 || f.maxSize > MaxPublishRequestBytes {
+		t.Errorf("sent %d requests of at most %d bytes, want 2 of at most %d", len(f.requests), f.maxSize, MaxPublishRequestBytes)
+	}
+	for i, want := range []error{nil, nil, ErrOversizedMessage} {
+		if _, err := rs[i].Get(context.Background()); err != want {
+			t.Errorf("message %d: got error %v, want %v", i, err, want)
+		}
+	}
+}
+
+func TestOrderingKeys(t *testing.T) {
+	f := &fakeServer{t: t, delay: 5 * time.Millisecond}
+	p, done := newPublisher(t, f)
+	defer done()
+	p.CountThreshold = 2
+	var data []string
+	for i := 0; i < 10; i++ {
+		data = append(data, fmt.Sprint(i))
+	}
+	rs := publish(p, "k", data...)
+	p.Flush()
+	if f.maxIn != 1 {
+		t.Errorf("sent %d batches of the key concurrently, want 1", f.maxIn)
+	}
+	var got []string
+	for _, r := range f.requests {
+		got = append(got, r...)
+	}
+	if diff := cmp.Diff(data, got); diff != "" {
+		t.Errorf("published data mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"k", "k", "k", "k", "k"}, f.keys); diff != "" {
+		t.Errorf("sent ordering keys mismatch (-want +got):\n%s", diff)
+	}
+	for i, r := range rs {
+		if id, err := r.Get(context.Background()); err != nil || id != fmt.Sprintf("id%d", i+1) {
+			t.Errorf("message %d: got ID %q, %v", i, id, err)
+		}
+	}
+}
+
+func TestPause(t *testing.T) {
+	f := &fakeServer{t: t, delay: 5 * time.Millisecond}
+	p, done := newPublisher(t, f)
+	defer done()
+	p.CountThreshold = 1
+	rs := publish(p, "k", "a", "fail", "b", "c")
+	other := publish(p, "other", "d")
+	p.Flush()
+	if _, err := rs[0].Get(context.Background()); err != nil {
+		t.Errorf("got error %v before the failure", err)
+	}
+	if _, err := rs[1].Get(context.Background()); err == nil {
+		t.Error("got nil error for the failed message")
+	}
+	for _, r := range rs[2:] {
+		if _, err := r.Get(context.Background()); err == nil {
+			t.Error("got nil error after the failure")
+		} else if pe, ok := err.(*PausedError); !ok || pe.OrderingKey != "k" {
+			t.Errorf("got error %v, want a PausedError", err)
+		}
+	}
+	if _, err := other[0].Get(context.Background()); err != nil {
+		t.Errorf("got error %v for another key", err)
+	}
+	for _, r := range f.requests {
+		if r[0] == "b" || r[0] == "c" {
+			t.Errorf("sent %q after the failure", r[0])
+		}
+	}
+
+	r := publish(p, "k", "e")[0]
+	if _, err := r.Get(context.Background()); err == nil {
+		t.Error("got nil error for a paused key")
+	}
+	p.ResumePublish("k")
+	r = publish(p, "k", "f")[0]
+	p.Flush()
+	if _, err := r.Get(context.Background()); err != nil {
+		t.Errorf("got error %v after ResumePublish", err)
+	}
+}
+
+func TestStop(t *testing.T) {
+	f := &fakeServer{t: t}
+	p, done := newPublisher(t, f)
+	defer done()
+	r := publish(p, "", "a")[0]
+	p.Stop()
+	if _, err := r.Get(context.Background()); err != nil {
+		t.Errorf("got error %v for a message published before Stop", err)
+	}
+	r = publish(p, "", "b")[0]
+	if _, err := r.Get(context.Background()); err != ErrStopped {
+		t.Errorf("got error %v, want %v", err, ErrStopped)
+	}
+}
+
+func TestOrderingKeyWithoutHTTPClient(t *testing.T) {
+	f := &fakeServer{t: t}
+	p, done := newPublisher(t, f)
+	defer done()
+	p.HTTPClient = nil
+	rs := publish(p, "k", "a")
+	rs = append(rs, publish(p, "", "b")...)
+	p.Flush()
+	if _, err := rs[0].Get(context.Background()); err != ErrNoHTTPClient {
+		t.Errorf("got error %v, want %v", err, ErrNoHTTPClient)
+	}
+	if _, err := rs[1].Get(context.Background()); err != nil {
+		t.Errorf("got error %v for a message without ordering key", err)
+	}
+	if diff := cmp.Diff([]string{""}, f.keys); diff != "" {
+		t.Errorf("sent ordering keys mismatch (-want +got):\n%s", diff)
+	}
+}
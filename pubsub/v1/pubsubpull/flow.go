@@ -0,0 +1,82 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pubsubpull
+
+import (
+	"context"
+	"sync"
+)
+
+// A flowController limits the number and total size of the messages being
+// handled.
+type flowController struct {
+	maxCount, maxBytes int
+
+	mu      sync.Mutex
+	count   int
+	bytes   int
+	changed chan struct{} // closed and replaced when messages are released
+}
+
+func newFlowController(maxCount, maxBytes int) *flowController {
+	return &flowController{
+		maxCount: maxCount,
+		maxBytes: maxBytes,
+		changed:  make(chan struct{}),
+	}
+}
+
+// wait blocks until fewer than the maximum number of messages and bytes are
+// outstanding, or ctx is done, and returns the number of messages that can
+// be acquired.
+func (f *flowController) wait(ctx context.Context) (int, error) {
+	for {
+		f.mu.Lock()
+		n := f.maxCount - f.count
+		full := n <= 0 || f.bytes >= f.maxBytes
+		changed := f.changed
+		f.mu.Unlock()
+		if !full {
+			return n, nil
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// acquire blocks until a message of size bytes can be handled, or ctx is
+// done. A message larger than the maximum number of bytes can be handled
+// once no other message is.
+func (f *flowController) acquire(ctx context.Context, size int) error {
+	for {
+		f.mu.Lock()
+		if f.count == 0 || (f.count < f.maxCount && f.bytes+size <= f.maxBytes) {
+			f.count++
+			f.bytes += size
+			f.mu.Unlock()
+			return nil
+		}
+		changed := f.changed
+		f.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// release releases a message of size bytes acquired before.
+func (f *flowController) release(size int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.count--
+	f.bytes -= size
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
@@ -0,0 +1,514 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pubsubpull receives the messages of pull subscriptions with the
+// REST calls of the pubsub/v1 package, for environments that cannot use
+// the gRPC streaming pull of the Cloud Pub/Sub client library.
+//
+// A Subscriber runs concurrent pull loops, and calls a function with each
+// message it receives, limiting the number and size of the messages being
+// handled. It extends the ack deadlines of the messages until they are
+// acked or nacked, and sends their acks in batches:
+//
+//	s := &pubsubpull.Subscriber{
+//		Service:                svc,
+//		Subscription:           "projects/my-project/subscriptions/my-sub",
+//		MaxOutstandingMessages: 100,
+//	}
+//	err := s.Receive(ctx, func(ctx context.Context, m *pubsubpull.Message) {
+//		log.Printf("message %s: %s", m.ID, m.Data)
+//		m.Ack()
+//	})
+//
+// This is an EXPERIMENTAL API and may be changed or removed in the future.
+package pubsubpull
+
+import (
+	"context"
+	"encoding/base64"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/googleapi"
+	pubsub "google.golang.org/api/pubsub/v1"
+)
+
+// The defaults of the settings of a Subscriber.
+const (
+	DefaultNumPullers             = 2
+	DefaultMaxOutstandingMessages = 1000
+	DefaultMaxOutstandingBytes    = 1e9 // 1G
+	DefaultMaxPullMessages        = 100
+	DefaultAckDeadline            = time.Minute
+	DefaultMaxExtension           = time.Hour
+	DefaultAckBatchSize           = 1000
+	DefaultAckDelay               = 100 * time.Millisecond
+)
+
+// rpcTimeout bounds the acknowledge and modifyAckDeadline calls.
+const rpcTimeout = 30 * time.Second
+
+// A Subscriber receives the messages of a subscription. Its zero settings
+// use the defaults.
+type Subscriber struct {
+	// Service is the service used to pull and ack messages.
+	Service *pubsub.Service
+
+	// Subscription is the name of the subscription, in the form
+	// "projects/{project}/subscriptions/{subscription}".
+	Subscription string
+
+	// NumPullers is the number of concurrent pull loops.
+	NumPullers int
+
+	// MaxOutstandingMessages is the maximum number of messages that are
+	// received but not yet acked or nacked.
+	MaxOutstandingMessages int
+
+	// MaxOutstandingBytes is the maximum total size of the data of the
+	// messages that are received but not yet acked or nacked. A message
+	// larger than that is handled once no other message is.
+	MaxOutstandingBytes int
+
+	// MaxPullMessages is the maximum number of messages returned by a pull.
+	MaxPullMessages int
+
+	// AckDeadline is the ack deadline set on received messages, and
+	// extended while they are handled. It must be between 10 seconds and
+	// 10 minutes.
+	AckDeadline time.Duration
+
+	// MaxExtension is how long the ack deadline of a message is extended.
+	// Once it is over, the message may be delivered again even though it
+	// is still being handled.
+	MaxExtension time.Duration
+
+	// AckBatchSize is the maximum number of ack IDs sent in a request.
+	AckBatchSize int
+
+	// AckDelay is how long acks and nacks wait to be sent with others.
+	AckDelay time.Duration
+
+	// Backoff is the backoff between the retries of failed pulls.
+	Backoff gax.Backoff
+
+	// extendPeriod, if not zero, is the period of the ack deadline
+	// extensions, for tests. It is half the ack deadline by default.
+	extendPeriod time.Duration
+}
+
+func (s *Subscriber) numPullers() int {
+	if s.NumPullers > 0 {
+		return s.NumPullers
+	}
+	return DefaultNumPullers
+}
+
+func (s *Subscriber) maxOutstandingMessages() int {
+	if s.MaxOutstandingMessages > 0 {
+		return s.MaxOutstandingMessages
+	}
+	return DefaultMaxOutstandingMessages
+}
+
+func (s *Subscriber) maxOutstandingBytes() int {
+	if s.MaxOutstandingBytes > 0 {
+		return s.MaxOutstandingBytes
+	}
+	return DefaultMaxOutstandingBytes
+}
+
+func (s *Subscriber) maxPullMessages() int {
+	if s.MaxPullMessages > 0 {
+		return s.MaxPullMessages
+	}
+	return DefaultMaxPullMessages
+}
+
+func (s *Subscriber) ackDeadline() time.Duration {
+	if s.AckDeadline > 0 {
+		return s.AckDeadline
+	}
+	return DefaultAckDeadline
+}
+
+func (s *Subscriber) maxExtension() time.Duration {
+	if s.MaxExtension > 0 {
+		return s.MaxExtension
+	}
+	return DefaultMaxExtension
+}
+
+func (s *Subscriber) ackBatchSize() int {
+	if s.AckBatchSize > 0 {
+		return s.AckBatchSize
+	}
+	return DefaultAckBatchSize
+}
+
+func (s *Subscriber) ackDelay() time.Duration {
+	if s.AckDelay > 0 {
+		return s.AckDelay
+	}
+	return DefaultAckDelay
+}
+
+// A Message is a message received from a subscription. It must be acked or
+// nacked once it is handled.
+type Message struct {
+	// ID is the ID of the message.
+	ID string
+
+	// Data is the decoded data of the message.
+	Data []byte
+
+	// Attributes are the attributes of the message.
+	Attributes map[string]string
+
+	// PublishTime is the time the message was published.
+	PublishTime time.Time
+
+	// DeliveryAttempt is the number of times the message was delivered,
+	// including this time, if the subscription has a dead letter policy, or
+	// else zero.
+	DeliveryAttempt int64
+
+	ackID string
+	r     *receiver
+	done  int32 // set atomically once the message is acked or nacked
+}
+
+// Ack acks m, so that it is not delivered again. Calls after the first call
+// to Ack or Nack have no effect.
+func (m *Message) Ack() {
+	m.finish(true)
+}
+
+// Nack nacks m, so that it is delivered again. Calls after the first call
+// to Ack or Nack have no effect.
+func (m *Message) Nack() {
+	m.finish(false)
+}
+
+func (m *Message) finish(ack bool) {
+	if !atomic.CompareAndSwapInt32(&m.done, 0, 1) {
+		return
+	}
+	m.r.finish(m, ack)
+}
+
+// An ackRequest is an ack or a nack of the message with ackID.
+type ackRequest struct {
+	ackID string
+	ack   bool
+}
+
+// A receiver is the state of a call to Receive.
+type receiver struct {
+	s    *Subscriber
+	flow *flowController
+	f    func(context.Context, *Message)
+
+	handlers sync.WaitGroup
+
+	mu      sync.Mutex
+	leases  map[string]time.Time // ack ID -> time received
+	closed  bool
+	pending []ackRequest  // acks not yet taken by sendAcks
+	ready   chan struct{} // signals pending acks, or closed
+}
+
+// Receive pulls the messages of the subscription and calls f with each of
+// them, concurrently, until ctx is done or a pull fails with an error that
+// cannot be retried. It then waits for the calls of f to return, and sends
+// the pending acks, before returning the error, or nil if ctx is done.
+//
+// The context passed to f is done when Receive stops. f must call the Ack
+// or Nack method of the message once it is handled, possibly after it
+// returns.
+func (s *Subscriber) Receive(ctx context.Context, f func(ctx context.Context, m *Message)) error {
+	r := &receiver{
+		s:      s,
+		flow:   newFlowController(s.maxOutstandingMessages(), s.maxOutstandingBytes()),
+		f:      f,
+		leases: make(map[string]time.Time),
+		ready:  make(chan struct{}, 1),
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ackerDone := make(chan struct{})
+	go func() {
+		r.sendAcks()
+		close(ackerDone)
+	}()
+	keeperDone := make(chan struct{})
+	go func() {
+		r.keepLeases(ctx)
+		close(keeperDone)
+	}()
+
+	errc := make(chan error, s.numPullers())
+	for i := 0; i < s.numPullers(); i++ {
+		go func() { errc <- r.pull(ctx) }()
+	}
+	var err error
+	for i := 0; i < s.numPullers(); i++ {
+		if perr := <-errc; perr != nil && err == nil {
+			err = perr
+			cancel()
+		}
+	}
+	cancel()
+	r.handlers.Wait()
+	<-keeperDone
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+	r.signal()
+	<-ackerDone
+	return err
+}
+
+// pull pulls messages and dispatches them until ctx is done, or a pull fails
+// with an error that cannot be retried.
+func (r *receiver) pull(ctx context.Context) error {
+	bo := r.s.Backoff
+	for {
+		n, err := r.flow.wait(ctx)
+		if err != nil {
+			return nil
+		}
+		if max := r.s.maxPullMessages(); n > max {
+			n = max
+		}
+		res, err := r.s.Service.Projects.Subscriptions.Pull(r.s.Subscription, &pubsub.PullRequest{MaxMessages: int64(n)}).Context(ctx).Do()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if !retryable(err) {
+				return err
+			}
+			if sleep(ctx, bo.Pause()) != nil {
+				return nil
+			}
+			continue
+		}
+		bo = r.s.Backoff
+		if len(res.ReceivedMessages) == 0 {
+			continue
+		}
+		ids := make([]string, len(res.ReceivedMessages))
+		now := time.Now()
+		r.mu.Lock()
+		for i, rm := range res.ReceivedMessages {
+			ids[i] = rm.AckId
+			r.leases[rm.AckId] = now
+		}
+		r.mu.Unlock()
+		// The ack deadline of the subscription may be shorter than that of
+		// the subscriber.
+		r.modifyAckDeadline(ctx, ids, r.s.ackDeadline())
+		for _, rm := range res.ReceivedMessages {
+			m := r.message(rm)
+			if m == nil {
+				continue
+			}
+			if err := r.flow.acquire(ctx, len(m.Data)); err != nil {
+				// The messages not dispatched are delivered again once
+				// their ack deadline expires.
+				return nil
+			}
+			r.handlers.Add(1)
+			go func() {
+				defer r.handlers.Done()
+				r.f(ctx, m)
+			}()
+		}
+	}
+}
+
+// message returns the message of rm, or nil if its data cannot be decoded,
+// in which case it is nacked.
+func (r *receiver) message(rm *pubsub.ReceivedMessage) *Message {
+	var data []byte
+	var err error
+	if rm.Message != nil {
+		data, err = base64.StdEncoding.DecodeString(rm.Message.Data)
+	}
+	if rm.Message == nil || err != nil {
+		r.mu.Lock()
+		r.release(rm.AckId, false)
+		r.mu.Unlock()
+		return nil
+	}
+	m := &Message{
+		ID:              rm.Message.MessageId,
+		Data:            data,
+		Attributes:      rm.Message.Attributes,
+		DeliveryAttempt: rm.DeliveryAttempt,
+		ackID:           rm.AckId,
+		r:               r,
+	}
+	if t, err := time.Parse(time.RFC3339Nano, rm.Message.PublishTime); err == nil {
+		m.PublishTime = t
+	}
+	return m
+}
+
+// finish releases the flow control of the dispatched message m, and queues
+// its ack or nack.
+func (r *receiver) finish(m *Message, ack bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.flow.release(len(m.Data))
+	r.release(m.ackID, ack)
+}
+
+// release stops extending the ack deadline of the message with ackID, and
+// queues its ack or nack, unless Receive has returned. r.mu must be held.
+func (r *receiver) release(ackID string, ack bool) {
+	delete(r.leases, ackID)
+	if !r.closed {
+		r.pending = append(r.pending, ackRequest{ackID: ackID, ack: ack})
+		r.signal()
+	}
+}
+
+// signal wakes up sendAcks, without blocking.
+func (r *receiver) signal() {
+	select {
+	case r.ready <- struct{}{}:
+	default:
+	}
+}
+
+// keepLeases extends the ack deadlines of the messages being handled, until
+// ctx is done.
+func (r *receiver) keepLeases(ctx context.Context) {
+	period := r.s.extendPeriod
+	if period == 0 {
+		period = r.s.ackDeadline() / 2
+	}
+	t := time.NewTicker(period)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		var ids []string
+		now := time.Now()
+		r.mu.Lock()
+		for id, received := range r.leases {
+			if now.Sub(received) < r.s.maxExtension() {
+				ids = append(ids, id)
+			}
+		}
+		r.mu.Unlock()
+		for len(ids) > 0 {
+			n := len(ids)
+			if n > r.s.ackBatchSize() {
+				n = r.s.ackBatchSize()
+			}
+			r.modifyAckDeadline(ctx, ids[:n], r.s.ackDeadline())
+			ids = ids[n:]
+		}
+	}
+}
+
+// sendAcks sends the acks and nacks in batches, until Receive has returned
+// and the pending ones are sent.
+func (r *receiver) sendAcks() {
+	var acks, nacks []string
+	var timer *time.Timer
+	var timeout <-chan time.Time
+	flush := func() {
+		if len(acks) > 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+			r.s.Service.Projects.Subscriptions.Acknowledge(r.s.Subscription, &pubsub.AcknowledgeRequest{AckIds: acks}).Context(ctx).Do()
+			cancel()
+			acks = nil
+		}
+		if len(nacks) > 0 {
+			r.modifyAckDeadline(context.Background(), nacks, 0)
+			nacks = nil
+		}
+		if timer != nil {
+			timer.Stop()
+			timer, timeout = nil, nil
+		}
+	}
+	for {
+		select {
+		case <-r.ready:
+		case <-timeout:
+			flush()
+			continue
+		}
+		r.mu.Lock()
+		pending, closed := r.pending, r.closed
+		r.pending = nil
+		r.mu.Unlock()
+		for _, a := range pending {
+			if a.ack {
+				acks = append(acks, a.ackID)
+			} else {
+				nacks = append(nacks, a.ackID)
+			}
+			if len(acks) >= r.s.ackBatchSize() || len(nacks) >= r.s.ackBatchSize() {
+				flush()
+			}
+		}
+		if closed {
+			flush()
+			return
+		}
+		if timer == nil && len(acks)+len(nacks) > 0 {
+			timer = time.NewTimer(r.s.ackDelay())
+			timeout = timer.C
+		}
+	}
+}
+
+// modifyAckDeadline sets the ack deadline of the messages with the given ack
+// IDs. Errors are ignored: the messages are then delivered again.
+func (r *receiver) modifyAckDeadline(ctx context.Context, ids []string, d time.Duration) {
+	req := &pubsub.ModifyAckDeadlineRequest{AckIds: ids, AckDeadlineSeconds: int64(d / time.Second)}
+	if d == 0 {
+		req.ForceSendFields = []string{"AckDeadlineSeconds"}
+	}
+	ctx, cancel := context.WithTimeout(ctx, rpcTimeout)
+	defer cancel()
+	r.s.Service.Projects.Subscriptions.ModifyAckDeadline(r.s.Subscription, req).Context(ctx).Do()
+}
+
+func retryable(err error) bool {
+	e, ok := err.(*googleapi.Error)
+	if !ok {
+		// Network errors.
+		return true
+	}
+	switch e.Code {
+	case 429, 500, 502, 503, 504:
+		return true
+	}
+	return false
+}
+
+// sleep pauses for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
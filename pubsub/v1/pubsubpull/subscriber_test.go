@@ -0,0 +1,329 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pubsubpull
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	gax "github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/option"
+	pubsub "google.golang.org/api/pubsub/v1"
+)
+
+const subscription = "projects/p/subscriptions/s"
+
+// fakeServer serves the pull, acknowledge and modifyAckDeadline calls of a
+// subscription, delivering each of its messages once.
+type fakeServer struct {
+	t *testing.T
+
+	mu       sync.Mutex
+	pending  []string // message data
+	next     int
+	failures []int // status codes of the next pulls
+	acks     [][]string
+	modAcks  []*pubsub.ModifyAckDeadlineRequest
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.URL.Path {
+	case "/v1/" + subscription + ":pull":
+		if len(f.failures) > 0 {
+			code := f.failures[0]
+			f.failures = f.failures[1:]
+			http.Error(w, fmt.Sprintf(`{"error": {"code": %d, "message": "failed"}}`, code), code)
+			return
+		}
+		var req pubsub.PullRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			f.t.Error(err)
+		}
+		res := &pubsub.PullResponse{}
+		for len(f.pending) > 0 && int64(len(res.ReceivedMessages)) < req.MaxMessages {
+			f.next++
+			res.ReceivedMessages = append(res.ReceivedMessages, &pubsub.ReceivedMessage{
+				AckId: fmt.Sprintf("a%d", f.next),
+				Message: &pubsub.PubsubMessage{
+					MessageId:   fmt.Sprintf("m%d", f.next),
+					Data:        base64.StdEncoding.EncodeToString([]byte(f.pending[0])),
+					Attributes:  map[string]string{"k": "v"},
+					PublishTime: "2020-05-01T12:00:00Z",
+				},
+			})
+			f.pending = f.pending[1:]
+		}
+		if len(res.ReceivedMessages) == 0 {
+			// Pulls without messages return after a while.
+			f.mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			f.mu.Lock()
+		}
+		json.NewEncoder(w).Encode(res)
+	case "/v1/" + subscription + ":acknowledge":
+		var req pubsub.AcknowledgeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			f.t.Error(err)
+		}
+		f.acks = append(f.acks, req.AckIds)
+		w.Write([]byte("{}"))
+	case "/v1/" + subscription + ":modifyAckDeadline":
+		var req pubsub.ModifyAckDeadlineRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			f.t.Error(err)
+		}
+		f.modAcks = append(f.modAcks, &req)
+		w.Write([]byte("{}"))
+	default:
+		f.t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		http.Error(w, "unexpected", http.StatusBadRequest)
+	}
+}
+
+// acked returns the sorted acked IDs.
+func (f *fakeServer) acked() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ids []string
+	for _, batch := range f.acks {
+		ids = append(ids, batch...)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// modAcked returns the ack IDs of the modifyAckDeadline calls with the given
+// deadline.
+func (f *fakeServer) modAcked(seconds int64) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ids []string
+	for _, req := range f.modAcks {
+		if req.AckDeadlineSeconds == seconds {
+			ids = append(ids, req.AckIds...)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func newSubscriber(t *testing.T, f *fakeServer) (*Subscriber, func()) {
+	srv := httptest.NewServer(f)
+	svc, err := pubsub.NewService(context.Background(), option.WithHTTPClient(http.DefaultClient), option.WithEndpoint(srv.URL+"/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Subscriber{
+		Service:      svc,
+		Subscription: subscription,
+		AckDelay:     10 * time.Millisecond,
+	}
+	return s, srv.Close
+}
+
+// receiveAll receives messages until n of them are handled, calling handle
+// with each.
+func receiveAll(t *testing.T, s *Subscriber, n int, handle func(*Message)) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	return s.Receive(ctx, func(ctx context.Context, m *Message) {
+		handle(m)
+		mu.Lock()
+		defer mu.Unlock()
+		if n--; n == 0 {
+			cancel()
+		}
+	})
+}
+
+func TestReceive(t *testing.T) {
+	f := &fakeServer{t: t}
+	for i := 0; i < 20; i++ {
+		f.pending = append(f.pending, fmt.Sprintf("data %d", i))
+	}
+	s, done := newSubscriber(t, f)
+	defer done()
+	s.MaxOutstandingMessages = 3
+	s.AckBatchSize = 4
+
+	var mu sync.Mutex
+	outstanding, maxOutstanding := 0, 0
+	var got []string
+	err := receiveAll(t, s, 20, func(m *Message) {
+		mu.Lock()
+		outstanding++
+		if outstanding > maxOutstanding {
+			maxOutstanding = outstanding
+		}
+		got = append(got, string(m.Data))
+		if m.ID == "" || m.Attributes["k"] != "v" || !m.PublishTime.Equal(time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)) {
+			t.Errorf("got message %+v", m)
+		}
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		outstanding--
+		mu.Unlock()
+		m.Ack()
+		m.Nack() // ignored
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 20 {
+		t.Errorf("handled %d messages, want 20", len(got))
+	}
+	if maxOutstanding > 3 {
+		t.Errorf("handled %d messages concurrently, want at most 3", maxOutstanding)
+	}
+	var want []string
+	for i := 1; i <= 20; i++ {
+		want = append(want, fmt.Sprintf("a%d", i))
+	}
+	sort.Strings(want)
+	if diff := cmp.Diff(want, f.acked()); diff != "" {
+		t.Errorf("acked IDs mismatch (-want +got):\n%s", diff)
+	}
+	for _, batch := range f.acks {
+		if len(batch) > 4 {
+			t.Errorf("got an ack batch of %d IDs, want at most 4", len(batch))
+		}
+	}
+	if diff := cmp.Diff(want, f.modAcked(60)); diff != "" {
+		t.Errorf("received IDs mismatch (-want +got):\n%s", diff)
+	}
+	if got := f.modAcked(0); len(got) != 0 {
+		t.Errorf("nacked %v", got)
+	}
+}
+
+func TestNack(t *testing.T) {
+	f := &fakeServer{t: t, pending: []string{"a", "b"}}
+	s, done := newSubscriber(t, f)
+	defer done()
+	err := receiveAll(t, s, 2, func(m *Message) {
+		if string(m.Data) == "a" {
+			m.Nack()
+		} else {
+			m.Ack()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"a1"}, f.modAcked(0)); diff != "" {
+		t.Errorf("nacked IDs mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"a2"}, f.acked()); diff != "" {
+		t.Errorf("acked IDs mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestExtension(t *testing.T) {
+	f := &fakeServer{t: t, pending: []string{"slow"}}
+	s, done := newSubscriber(t, f)
+	defer done()
+	s.AckDeadline = 10 * time.Second
+	s.extendPeriod = 10 * time.Millisecond
+	err := receiveAll(t, s, 1, func(m *Message) {
+		time.Sleep(100 * time.Millisecond)
+		m.Ack()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The deadline is set once when the message is received, and extended
+	// while it is handled.
+	if got := f.modAcked(10); len(got) < 3 {
+		t.Errorf("got deadline modifications %v, want the receipt and extensions", got)
+	}
+	if diff := cmp.Diff([]string{"a1"}, f.acked()); diff != "" {
+		t.Errorf("acked IDs mismatch (-want +got):\n%s", diff)
+	}
+
+	// Messages are not extended after MaxExtension.
+	f = &fakeServer{t: t, pending: []string{"slow"}}
+	s, done = newSubscriber(t, f)
+	defer done()
+	s.AckDeadline = 10 * time.Second
+	s.MaxExtension = time.Millisecond
+	s.extendPeriod = 10 * time.Millisecond
+	err = receiveAll(t, s, 1, func(m *Message) {
+		time.Sleep(100 * time.Millisecond)
+		m.Ack()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := f.modAcked(10); len(got) != 1 {
+		t.Errorf("got deadline modifications %v, want only the receipt", got)
+	}
+}
+
+func TestMaxOutstandingBytes(t *testing.T) {
+	f := &fakeServer{t: t, pending: []string{"aaaa", "bbbb", "cccc", strings.Repeat("d", 20)}}
+	s, done := newSubscriber(t, f)
+	defer done()
+	s.MaxOutstandingBytes = 10
+	var mu sync.Mutex
+	outstanding, maxOutstanding := 0, 0
+	err := receiveAll(t, s, 4, func(m *Message) {
+		mu.Lock()
+		outstanding += len(m.Data)
+		if outstanding > maxOutstanding {
+			maxOutstanding = outstanding
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		outstanding -= len(m.Data)
+		mu.Unlock()
+		m.Ack()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The large message is handled alone.
+	if maxOutstanding != 20 {
+		t.Errorf("handled %d bytes concurrently, want 20", maxOutstanding)
+	}
+	if got := f.acked(); len(got) != 4 {
+		t.Errorf("acked %v, want 4 messages", got)
+	}
+}
+
+func TestPullErrors(t *testing.T) {
+	f := &fakeServer{t: t, pending: []string{"a"}, failures: []int{503, 503}}
+	s, done := newSubscriber(t, f)
+	defer done()
+	s.NumPullers = 1
+	s.Backoff = gax.Backoff{Initial: time.Millisecond}
+	if err := receiveAll(t, s, 1, func(m *Message) { m.Ack() }); err != nil {
+		t.Fatalf("got error %v, want the unavailable pulls retried", err)
+	}
+
+	f.failures = []int{404}
+	f.pending = []string{"b"}
+	err := receiveAll(t, s, 1, func(m *Message) {
+		t.Errorf("handled message %s", m.ID)
+		m.Ack()
+	})
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("got error %v, want a 404 error", err)
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pubsubpush receives the messages of the push subscriptions of the
+// pubsub/v1 package.
+//
+// A Handler decodes the messages pushed to an endpoint, verifies the OIDC
+// token that the subscription sends with them, as configured by the
+// OidcToken field of its PushConfig, and acks each message that its handler
+// function handles without error:
+//
+//	http.Handle("/push", &pubsubpush.Handler{
+//		Audience:            "https://example.com/push",
+//		ServiceAccountEmail: "pusher@my-project.iam.gserviceaccount.com",
+//		Handle: func(ctx context.Context, d *pubsubpush.Delivery) error {
+//			log.Printf("message %s: %s", d.Message.MessageId, d.Data)
+//			return nil
+//		},
+//	})
+//
+// This is an EXPERIMENTAL API and may be changed or removed in the future.
+package pubsubpush
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/api/idtoken"
+	pubsub "google.golang.org/api/pubsub/v1"
+)
+
+// A Delivery is a message pushed to an endpoint.
+type Delivery struct {
+	// Message is the message as pushed, with its data in base64.
+	Message *pubsub.PubsubMessage
+
+	// Data is the decoded data of the message.
+	Data []byte
+
+	// OrderingKey is the ordering key of the message, if any.
+	OrderingKey string
+
+	// PublishTime is the time the message was published.
+	PublishTime time.Time
+
+	// Subscription is the name of the subscription, in the form
+	// "projects/{project}/subscriptions/{subscription}".
+	Subscription string
+
+	// DeliveryAttempt is the number of times the message was delivered,
+	// including this time, if the subscription has a dead letter policy, or
+	// else zero.
+	DeliveryAttempt int64
+
+	// Token is the payload of the verified OIDC token of the request, or
+	// nil if the Handler does not verify tokens.
+	Token *idtoken.Payload
+}
+
+// pushRequest is the body of a push request. Some fields are sent in two
+// spellings.
+type pushRequest struct {
+	Message *struct {
+		Attributes       map[string]string `json:"attributes"`
+		Data             string            `json:"data"`
+		MessageID        string            `json:"messageId"`
+		MessageIDSnake   string            `json:"message_id"`
+		PublishTime      string            `json:"publishTime"`
+		PublishTimeSnake string            `json:"publish_time"`
+		OrderingKey      string            `json:"orderingKey"`
+	} `json:"message"`
+	Subscription    string `json:"subscription"`
+	DeliveryAttempt int64  `json:"deliveryAttempt"`
+}
+
+// permanentError is an error for which a message is acked.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+// Permanent returns an error that reports err, and that makes a Handler ack
+// the message, so that it is not delivered again. A handler function
+// returns it for the messages it will never be able to handle.
+func Permanent(err error) error {
+	return &permanentError{err}
+}
+
+// maxBodySize is the maximum size of a push request: that of a message of
+// 10MB in base64, and its attributes.
+const maxBodySize = 16 << 20
+
+// tokenIssuers are the issuers of the OIDC tokens of push requests.
+var tokenIssuers = map[string]bool{
+	"accounts.google.com":         true,
+	"https://accounts.google.com": true,
+}
+
+// A Handler receives the messages pushed to an endpoint.
+//
+// A Handler responds with 204 No Content, which acks the message, if Handle
+// returns nil or an error returned by Permanent, and with 500 Internal
+// Server Error, which nacks the message so that it is delivered again
+// later, for other errors. It responds with 400 Bad Request to malformed
+// requests, and with 401 Unauthorized to requests without a valid token.
+type Handler struct {
+	// Audience is the audience of the OIDC tokens of the subscription: the
+	// Audience of its OidcToken, or else its push endpoint URL. It must be
+	// set unless AllowUnauthenticated is true.
+	Audience string
+
+	// ServiceAccountEmail, if not empty, is the email of the service
+	// account of the OIDC tokens of the subscription.
+	ServiceAccountEmail string
+
+	// Validator validates OIDC tokens. If it is nil, idtoken.Validate is
+	// used.
+	Validator *idtoken.Validator
+
+	// AllowUnauthenticated disables the verification of OIDC tokens, for
+	// endpoints that are otherwise protected.
+	AllowUnauthenticated bool
+
+	// Handle handles a message. It is called concurrently for the messages
+	// pushed concurrently.
+	Handle func(ctx context.Context, d *Delivery) error
+}
+
+// ServeHTTP handles a push request.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var token *idtoken.Payload
+	if !h.AllowUnauthenticated {
+		if h.Audience == "" {
+			http.Error(w, "pubsubpush: Handler has no Audience", http.StatusInternalServerError)
+			return
+		}
+		var err error
+		token, err = h.verify(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+	d, err := decode(r, w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	d.Token = token
+	if err := h.Handle(r.Context(), d); err != nil {
+		if _, ok := err.(*permanentError); !ok {
+			http.Error(w, "handling message failed", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verify verifies the OIDC token of r, and returns its payload.
+func (h *Handler) verify(r *http.Request) (*idtoken.Payload, error) {
+	auth := r.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return nil, errors.New("missing bearer token")
+	}
+	raw := strings.TrimSpace(auth[7:])
+	var p *idtoken.Payload
+	var err error
+	if h.Validator != nil {
+		p, err = h.Validator.Validate(r.Context(), raw, h.Audience)
+	} else {
+		p, err = idtoken.Validate(r.Context(), raw, h.Audience)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !tokenIssuers[p.Issuer] {
+		return nil, fmt.Errorf("invalid token issuer %q", p.Issuer)
+	}
+	if time.Now().Unix() > p.Expires {
+		return nil, errors.New("token expired")
+	}
+	if h.ServiceAccountEmail != "" {
+		if email, _ := p.Claims["email"].(string); email != h.ServiceAccountEmail {
+			return nil, fmt.Errorf("invalid token email %q", email)
+		}
+		if verified, _ := p.Claims["email_verified"].(bool); !verified {
+			return nil, errors.New("token email not verified")
+		}
+	}
+	return p, nil
+}
+
+// decode decodes the body of a push request.
+func decode(r *http.Request, w http.ResponseWriter) (*Delivery, error) {
+	var req pushRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&req); err != nil {
+		return nil, fmt.Errorf("decoding push request: %v", err)
+	}
+	if req.Message == nil {
+		return nil, errors.New("push request has no message")
+	}
+	m := req.Message
+	msg := &pubsub.PubsubMessage{
+		Attributes:  m.Attributes,
+		Data:        m.Data,
+		MessageId:   m.MessageID,
+		PublishTime: m.PublishTime,
+	}
+	if msg.MessageId == "" {
+		msg.MessageId = m.MessageIDSnake
+	}
+	if msg.PublishTime == "" {
+		msg.PublishTime = m.PublishTimeSnake
+	}
+	if msg.MessageId == "" {
+		return nil, errors.New("push request message has no ID")
+	}
+	d := &Delivery{
+		Message:         msg,
+		OrderingKey:     m.OrderingKey,
+		Subscription:    req.Subscription,
+		DeliveryAttempt: req.DeliveryAttempt,
+	}
+	var err error
+	if d.Data, err = base64.StdEncoding.DecodeString(msg.Data); err != nil {
+		return nil, fmt.Errorf("decoding message data: %v", err)
+	}
+	if msg.PublishTime != "" {
+		if d.PublishTime, err = time.Parse(time.RFC3339Nano, msg.PublishTime); err != nil {
+			return nil, fmt.Errorf("invalid publish time %q", msg.PublishTime)
+		}
+	}
+	return d, nil
+}
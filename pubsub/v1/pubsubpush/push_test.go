@@ -0,0 +1,221 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pubsubpush
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/idtoken"
+	"google.golang.org/api/option"
+	pubsub "google.golang.org/api/pubsub/v1"
+)
+
+const (
+	audience = "https://example.com/push"
+	email    = "pusher@p.iam.gserviceaccount.com"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// newValidator returns a validator that knows the public key of key, with
+// ID "k1".
+func newValidator(t *testing.T, key *rsa.PrivateKey) *idtoken.Validator {
+	certs := fmt.Sprintf(`{"keys": [{"kid": "k1", "alg": "RS256", "kty": "RSA", "n": %q, "e": %q}]}`,
+		base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()))
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     make(http.Header),
+			Body:       ioutil.NopCloser(strings.NewReader(certs)),
+		}, nil
+	})}
+	v, err := idtoken.NewValidator(context.Background(), option.WithHTTPClient(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// signToken returns a token with the given claims signed by key.
+func signToken(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	enc := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := enc(map[string]string{"alg": "RS256", "kid": "k1", "typ": "JWT"}) + "." + enc(claims)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func claims(modify func(map[string]interface{})) map[string]interface{} {
+	c := map[string]interface{}{
+		"iss":            "https://accounts.google.com",
+		"aud":            audience,
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"email":          email,
+		"email_verified": true,
+		"sub":            "123",
+	}
+	if modify != nil {
+		modify(c)
+	}
+	return c
+}
+
+const body = `{
+  "message": {
+    "attributes": {"k": "v"},
+    "data": "aGVsbG8=",
+    "messageId": "m1",
+    "message_id": "m1",
+    "publishTime": "2020-05-01T12:00:00.123Z",
+    "publish_time": "2020-05-01T12:00:00.123Z",
+    "orderingKey": "key1"
+  },
+  "subscription": "projects/p/subscriptions/s",
+  "deliveryAttempt": 2
+}`
+
+func TestHandler(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got *Delivery
+	var handleErr error
+	h := &Handler{
+		Audience:            audience,
+		ServiceAccountEmail: email,
+		Validator:           newValidator(t, key),
+		Handle: func(ctx context.Context, d *Delivery) error {
+			got = d
+			return handleErr
+		},
+	}
+	serve := func(token, body string) int {
+		r := httptest.NewRequest("POST", "/push", strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	valid := signToken(t, key, claims(nil))
+	if code := serve(valid, body); code != http.StatusNoContent {
+		t.Fatalf("got status %d, want %d", code, http.StatusNoContent)
+	}
+	want := &Delivery{
+		Message: &pubsub.PubsubMessage{
+			Attributes:  map[string]string{"k": "v"},
+			Data:        "aGVsbG8=",
+			MessageId:   "m1",
+			PublishTime: "2020-05-01T12:00:00.123Z",
+		},
+		Data:            []byte("hello"),
+		OrderingKey:     "key1",
+		PublishTime:     time.Date(2020, 5, 1, 12, 0, 0, 123e6, time.UTC),
+		Subscription:    "projects/p/subscriptions/s",
+		DeliveryAttempt: 2,
+	}
+	if diff := cmp.Diff(want, got, cmp.FilterPath(func(p cmp.Path) bool { return p.String() == "Token" }, cmp.Ignore())); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if got.Token == nil || got.Token.Subject != "123" {
+		t.Errorf("got token %+v", got.Token)
+	}
+
+	for _, test := range []struct {
+		name  string
+		token string
+		body  string
+		want  int
+	}{
+		{"no token", "", body, http.StatusUnauthorized},
+		{"malformed token", "x.y.z", body, http.StatusUnauthorized},
+		{"wrong audience", signToken(t, key, claims(func(c map[string]interface{}) { c["aud"] = "other" })), body, http.StatusUnauthorized},
+		{"wrong issuer", signToken(t, key, claims(func(c map[string]interface{}) { c["iss"] = "example.com" })), body, http.StatusUnauthorized},
+		{"expired", signToken(t, key, claims(func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Minute).Unix() })), body, http.StatusUnauthorized},
+		{"wrong email", signToken(t, key, claims(func(c map[string]interface{}) { c["email"] = "x@example.com" })), body, http.StatusUnauthorized},
+		{"unverified email", signToken(t, key, claims(func(c map[string]interface{}) { delete(c, "email_verified") })), body, http.StatusUnauthorized},
+		{"malformed body", valid, "{", http.StatusBadRequest},
+		{"no message", valid, `{"subscription": "s"}`, http.StatusBadRequest},
+		{"no message ID", valid, `{"message": {"data": ""}}`, http.StatusBadRequest},
+		{"invalid data", valid, `{"message": {"messageId": "m", "data": "!"}}`, http.StatusBadRequest},
+		{"snake case", valid, `{"message": {"message_id": "m", "publish_time": "2020-05-01T12:00:00Z"}}`, http.StatusNoContent},
+	} {
+		got = nil
+		if code := serve(test.token, test.body); code != test.want {
+			t.Errorf("%s: got status %d, want %d", test.name, code, test.want)
+		}
+		if test.want != http.StatusNoContent && got != nil {
+			t.Errorf("%s: message was handled", test.name)
+		}
+	}
+
+	handleErr = errors.New("failed")
+	if code := serve(valid, body); code != http.StatusInternalServerError {
+		t.Errorf("got status %d for a failed message, want %d", code, http.StatusInternalServerError)
+	}
+	handleErr = Permanent(errors.New("cannot handle"))
+	if code := serve(valid, body); code != http.StatusNoContent {
+		t.Errorf("got status %d for a permanently failed message, want %d", code, http.StatusNoContent)
+	}
+}
+
+func TestHandlerUnauthenticated(t *testing.T) {
+	handled := false
+	h := &Handler{Handle: func(ctx context.Context, d *Delivery) error {
+		handled = true
+		return nil
+	}}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/push", bytes.NewReader([]byte(body))))
+	if w.Code != http.StatusInternalServerError || handled {
+		t.Errorf("got status %d without audience, want %d", w.Code, http.StatusInternalServerError)
+	}
+
+	h.AllowUnauthenticated = true
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/push", bytes.NewReader([]byte(body))))
+	if w.Code != http.StatusNoContent || !handled {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusNoContent)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/push", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("got status %d for GET, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,390 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package cells helps read and edit spreadsheets with the sheets/v4 package.
+//
+// It parses and formats ranges in A1 and R1C1 notation, converts between
+// rows of cell values and Go structs, and builds the requests of common
+// edits for SpreadsheetsService.BatchUpdate.
+//
+//	type Item struct {
+//		Name  string
+//		Price float64 `sheets:"Unit price"`
+//	}
+//	var items []Item
+//	err := cells.Read(ctx, svc, spreadsheetID, "Items!A:C", &items)
+//	...
+//	r, err := cells.ParseA1("Items!B2:C")
+//	...
+//	_, err = svc.Spreadsheets.BatchUpdate(spreadsheetID, cells.BatchUpdate(
+//		cells.FreezeRows(sheetID, 1),
+//		cells.SortRange(r.GridRange(sheetID), 1, true),
+//	)).Do()
+//
+// This is an EXPERIMENTAL API and may be changed or removed in the future.
+package cells
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	sheets "google.golang.org/api/sheets/v4"
+)
+
+// A Range is a rectangular range of cells in a sheet.
+//
+// Like those of a sheets.GridRange, the row and column indexes of a Range
+// are zero-based, and its start indexes are inclusive and its end indexes
+// exclusive. An end index of zero means that the range is unbounded in that
+// direction: the range A5:B, for example, has a StartRow of 4 and an EndRow
+// of 0.
+type Range struct {
+	// Sheet is the name of the sheet, or empty for the first visible sheet.
+	Sheet string
+
+	StartRow    int64
+	EndRow      int64
+	StartColumn int64
+	EndColumn   int64
+}
+
+// Cell returns the range of the single cell at the given zero-based row and
+// column of sheet.
+func Cell(sheet string, row, column int64) Range {
+	return Range{Sheet: sheet, StartRow: row, EndRow: row + 1, StartColumn: column, EndColumn: column + 1}
+}
+
+// GridRange returns r as a GridRange of the sheet with the given ID.
+func (r Range) GridRange(sheetID int64) *sheets.GridRange {
+	return &sheets.GridRange{
+		SheetId:          sheetID,
+		StartRowIndex:    r.StartRow,
+		EndRowIndex:      r.EndRow,
+		StartColumnIndex: r.StartColumn,
+		EndColumnIndex:   r.EndColumn,
+	}
+}
+
+// FromGridRange returns the range of g in the sheet with the given name.
+func FromGridRange(sheet string, g *sheets.GridRange) Range {
+	return Range{
+		Sheet:       sheet,
+		StartRow:    g.StartRowIndex,
+		EndRow:      g.EndRowIndex,
+		StartColumn: g.StartColumnIndex,
+		EndColumn:   g.EndColumnIndex,
+	}
+}
+
+// maxColumnLetters is the maximum number of letters of a column name. The
+// last column of a sheet is ZZZ.
+const maxColumnLetters = 3
+
+// ColumnName returns the name of the column with the given zero-based index:
+// A for 0, Z for 25, AA for 26 and so on.
+func ColumnName(index int64) string {
+	var b []byte
+	for n := index + 1; n > 0; n = (n - 1) / 26 {
+		b = append(b, byte('A'+(n-1)%26))
+	}
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return string(b)
+}
+
+// ColumnIndex returns the zero-based index of the column with the given
+// name, ignoring case.
+func ColumnIndex(name string) (int64, error) {
+	if name == "" || len(name) > maxColumnLetters {
+		return 0, fmt.Errorf("cells: invalid column name %q", name)
+	}
+	var n int64
+	for _, c := range strings.ToUpper(name) {
+		if c < 'A' || c > 'Z' {
+			return 0, fmt.Errorf("cells: invalid column name %q", name)
+		}
+		n = n*26 + int64(c-'A'+1)
+	}
+	return n - 1, nil
+}
+
+// A point is one side of a range, like A5, A or 5, with the zero-based
+// indexes of its row and column, if present.
+type point struct {
+	row, column       int64
+	hasRow, hasColumn bool
+}
+
+// ParseA1 parses a range in A1 notation, such as Sheet1!A1:B2, 'My sheet'!A:A,
+// B5:C, 2:3 or C4, or the name of a whole sheet. Absolute references like
+// $A$1 are accepted.
+func ParseA1(s string) (Range, error) {
+	return parse(s, parseA1Point)
+}
+
+// ParseR1C1 parses a range in R1C1 notation, such as Sheet1!R1C1:R2C2,
+// 'My sheet'!C1:C1, R5C2:C3, R2:R3 or R4C3, or the name of a whole sheet.
+// Relative references like R[1]C[1] are not supported.
+func ParseR1C1(s string) (Range, error) {
+	return parse(s, parseR1C1Point)
+}
+
+func parse(s string, parsePoint func(string) (point, error)) (Range, error) {
+	sheet, ref, quoted, err := splitSheet(s)
+	if err != nil {
+		return Range{}, err
+	}
+	if ref == "" {
+		return Range{Sheet: sheet}, nil
+	}
+	r, err := parseRef(ref, parsePoint)
+	if err != nil {
+		if sheet == "" && !quoted && !strings.Contains(s, "!") {
+			// An unquoted sheet name.
+			return Range{Sheet: s}, nil
+		}
+		return Range{}, fmt.Errorf("cells: invalid range %q", s)
+	}
+	r.Sheet = sheet
+	return r, nil
+}
+
+// splitSheet splits s into the sheet name and the reference to the cells,
+// and reports whether the sheet name is quoted.
+func splitSheet(s string) (sheet, ref string, quoted bool, err error) {
+	if !strings.HasPrefix(s, "'") {
+		if i := strings.IndexByte(s, '!'); i >= 0 {
+			return s[:i], s[i+1:], false, nil
+		}
+		return "", s, false, nil
+	}
+	var b strings.Builder
+	i := 1
+	for {
+		j := strings.IndexByte(s[i:], '\'')
+		if j < 0 {
+			return "", "", false, fmt.Errorf("cells: unterminated sheet name in %q", s)
+		}
+		b.WriteString(s[i : i+j])
+		i += j + 1
+		if i < len(s) && s[i] == '\'' {
+			// A quote in the name is doubled.
+			b.WriteByte('\'')
+			i++
+			continue
+		}
+		break
+	}
+	switch {
+	case i == len(s):
+		return b.String(), "", true, nil
+	case s[i] != '!':
+		return "", "", false, fmt.Errorf("cells: invalid range %q", s)
+	}
+	return b.String(), s[i+1:], true, nil
+}
+
+var errInvalidRef = errors.New("invalid reference")
+
+// parseRef parses a reference to the cells of a range, without a sheet name.
+func parseRef(ref string, parsePoint func(string) (point, error)) (Range, error) {
+	parts := strings.Split(ref, ":")
+	if len(parts) > 2 {
+		return Range{}, errInvalidRef
+	}
+	start, err := parsePoint(parts[0])
+	if err != nil {
+		return Range{}, err
+	}
+	if len(parts) == 1 {
+		if !start.hasRow || !start.hasColumn {
+			return Range{}, errInvalidRef
+		}
+		return Range{StartRow: start.row, EndRow: start.row + 1, StartColumn: start.column, EndColumn: start.column + 1}, nil
+	}
+	end, err := parsePoint(parts[1])
+	if err != nil {
+		return Range{}, err
+	}
+	var r Range
+	if start.hasRow {
+		r.StartRow = start.row
+	}
+	if start.hasColumn {
+		r.StartColumn = start.column
+	}
+	if end.hasRow {
+		r.EndRow = end.row + 1
+		if r.EndRow <= r.StartRow {
+			r.StartRow, r.EndRow = end.row, r.StartRow+1
+		}
+	}
+	if end.hasColumn {
+		r.EndColumn = end.column + 1
+		if r.EndColumn <= r.StartColumn {
+			r.StartColumn, r.EndColumn = end.column, r.StartColumn+1
+		}
+	}
+	return r, nil
+}
+
+// parseA1Point parses a point like A1, $A$1, A or 1.
+func parseA1Point(s string) (point, error) {
+	var p point
+	s = strings.TrimPrefix(s, "$")
+	i := 0
+	for i < len(s) && isLetter(s[i]) {
+		i++
+	}
+	if i > 0 {
+		col, err := ColumnIndex(s[:i])
+		if err != nil {
+			return point{}, err
+		}
+		p.column, p.hasColumn = col, true
+	}
+	s = strings.TrimPrefix(s[i:], "$")
+	if s != "" {
+		row, err := parseIndex(s)
+		if err != nil {
+			return point{}, err
+		}
+		p.row, p.hasRow = row, true
+	}
+	if !p.hasRow && !p.hasColumn {
+		return point{}, errInvalidRef
+	}
+	return p, nil
+}
+
+// parseR1C1Point parses a point like R1C1, R1 or C1.
+func parseR1C1Point(s string) (point, error) {
+	var p point
+	s = strings.ToUpper(s)
+	if strings.HasPrefix(s, "R") {
+		i := strings.IndexByte(s, 'C')
+		if i < 0 {
+			i = len(s)
+		}
+		row, err := parseIndex(s[1:i])
+		if err != nil {
+			return point{}, err
+		}
+		p.row, p.hasRow = row, true
+		s = s[i:]
+	}
+	if strings.HasPrefix(s, "C") {
+		col, err := parseIndex(s[1:])
+		if err != nil {
+			return point{}, err
+		}
+		p.column, p.hasColumn = col, true
+		s = ""
+	}
+	if s != "" || !p.hasRow && !p.hasColumn {
+		return point{}, errInvalidRef
+	}
+	return p, nil
+}
+
+func isLetter(c byte) bool {
+	return 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z'
+}
+
+// parseIndex parses a one-based row or column number, and returns its
+// zero-based index.
+func parseIndex(s string) (int64, error) {
+	if s == "" || s[0] < '0' || s[0] > '9' {
+		return 0, errInvalidRef
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 1 {
+		return 0, errInvalidRef
+	}
+	return n - 1, nil
+}
+
+// String returns r in A1 notation.
+func (r Range) String() string {
+	return r.A1()
+}
+
+// A1 returns r in A1 notation, quoting the sheet name if needed. A range
+// that is unbounded both below and to the right, and does not start at A1,
+// has no A1 notation.
+func (r Range) A1() string {
+	return r.format(func(p point) string {
+		var s string
+		if p.hasColumn {
+			s = ColumnName(p.column)
+		}
+		if p.hasRow {
+			s += strconv.FormatInt(p.row+1, 10)
+		}
+		return s
+	})
+}
+
+// R1C1 returns r in R1C1 notation, quoting the sheet name if needed. A range
+// that is unbounded both below and to the right, and does not start at
+// R1C1, has no R1C1 notation.
+func (r Range) R1C1() string {
+	return r.format(func(p point) string {
+		var s string
+		if p.hasRow {
+			s = "R" + strconv.FormatInt(p.row+1, 10)
+		}
+		if p.hasColumn {
+			s += "C" + strconv.FormatInt(p.column+1, 10)
+		}
+		return s
+	})
+}
+
+func (r Range) format(formatPoint func(point) string) string {
+	rowsBounded, columnsBounded := r.EndRow > 0, r.EndColumn > 0
+	var ref string
+	if rowsBounded || columnsBounded || r.StartRow > 0 || r.StartColumn > 0 {
+		start := point{
+			row:       r.StartRow,
+			column:    r.StartColumn,
+			hasRow:    rowsBounded || r.StartRow > 0,
+			hasColumn: columnsBounded || r.StartColumn > 0,
+		}
+		ref = formatPoint(start)
+		if !rowsBounded || !columnsBounded || r.EndRow != r.StartRow+1 || r.EndColumn != r.StartColumn+1 {
+			end := point{row: r.EndRow - 1, column: r.EndColumn - 1, hasRow: rowsBounded, hasColumn: columnsBounded}
+			ref += ":" + formatPoint(end)
+		}
+	}
+	switch {
+	case r.Sheet == "":
+		return ref
+	case ref == "":
+		return quoteSheet(r.Sheet)
+	}
+	return quoteSheet(r.Sheet) + "!" + ref
+}
+
+// quoteSheet returns the sheet name as it appears in ranges, quoted if it
+// contains characters other than letters, digits and underscores, or if it
+// could be mistaken for a reference to cells.
+func quoteSheet(name string) string {
+	simple := name != "" && !('0' <= name[0] && name[0] <= '9')
+	for i := 0; simple && i < len(name); i++ {
+		c := name[i]
+		simple = isLetter(c) || '0' <= c && c <= '9' || c == '_'
+	}
+	if simple {
+		if _, err := parseRef(name, parseA1Point); err != nil {
+			if _, err := parseRef(name, parseR1C1Point); err != nil {
+				return name
+			}
+		}
+	}
+	return "'" + strings.Replace(name, "'", "''", -1) + "'"
+}
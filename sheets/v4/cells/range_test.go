@@ -0,0 +1,145 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cells
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	sheets "google.golang.org/api/sheets/v4"
+)
+
+func TestColumnName(t *testing.T) {
+	for _, test := range []struct {
+		index int64
+		name  string
+	}{
+		{0, "A"},
+		{25, "Z"},
+		{26, "AA"},
+		{51, "AZ"},
+		{52, "BA"},
+		{701, "ZZ"},
+		{702, "AAA"},
+		{18277, "ZZZ"},
+	} {
+		if got := ColumnName(test.index); got != test.name {
+			t.Errorf("ColumnName(%d) = %q, want %q", test.index, got, test.name)
+		}
+		if got, err := ColumnIndex(test.name); err != nil || got != test.index {
+			t.Errorf("ColumnIndex(%q) = %d, %v, want %d", test.name, got, err, test.index)
+		}
+	}
+	if got, err := ColumnIndex("ab"); err != nil || got != 27 {
+		t.Errorf(`ColumnIndex("ab") = %d, %v, want 27`, got, err)
+	}
+	for _, name := range []string{"", "A1", "AAAA"} {
+		if _, err := ColumnIndex(name); err == nil {
+			t.Errorf("ColumnIndex(%q): got nil error", name)
+		}
+	}
+}
+
+func TestA1(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want Range
+		out  string // if different from in
+	}{
+		{"A1", Range{EndRow: 1, EndColumn: 1}, ""},
+		{"Sheet1!B2:C3", Range{Sheet: "Sheet1", StartRow: 1, EndRow: 3, StartColumn: 1, EndColumn: 3}, ""},
+		{"c3:b2", Range{StartRow: 1, EndRow: 3, StartColumn: 1, EndColumn: 3}, "B2:C3"},
+		{"$A$1:$B$2", Range{EndRow: 2, EndColumn: 2}, "A1:B2"},
+		{"A:B", Range{EndColumn: 2}, ""},
+		{"B:B", Range{StartColumn: 1, EndColumn: 2}, ""},
+		{"2:3", Range{StartRow: 1, EndRow: 3}, ""},
+		{"A5:B", Range{StartRow: 4, EndColumn: 2}, ""},
+		{"C4:5", Range{StartRow: 3, EndRow: 5, StartColumn: 2}, ""},
+		{"Sheet1", Range{Sheet: "Sheet1"}, ""},
+		{"Data!", Range{Sheet: "Data"}, "Data"},
+		{"'My sheet'!A1:A", Range{Sheet: "My sheet", EndColumn: 1}, "'My sheet'!A:A"},
+		{"'It''s'!ZZ10", Range{Sheet: "It's", StartRow: 9, EndRow: 10, StartColumn: 701, EndColumn: 702}, ""},
+		{"'A1'", Range{Sheet: "A1"}, ""},
+		{"'R1C1'!A1", Range{Sheet: "R1C1", EndRow: 1, EndColumn: 1}, ""},
+		{"'1st'", Range{Sheet: "1st"}, ""},
+	} {
+		got, err := ParseA1(test.in)
+		if err != nil {
+			t.Errorf("ParseA1(%q): %v", test.in, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseA1(%q) = %+v, want %+v", test.in, got, test.want)
+		}
+		out := test.out
+		if out == "" {
+			out = test.in
+		}
+		if s := got.A1(); s != out {
+			t.Errorf("ParseA1(%q).A1() = %q, want %q", test.in, s, out)
+		}
+	}
+	for _, s := range []string{"'Sheet1", "'Sheet1'A1", "Sheet1!A1:B2:C3", "Sheet1!1A", "Sheet1!A0", "Sheet1!AAAA1", "Sheet1!A"} {
+		if r, err := ParseA1(s); err == nil {
+			t.Errorf("ParseA1(%q) = %+v, want error", s, r)
+		}
+	}
+}
+
+func TestR1C1(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want Range
+		out  string // if different from in
+	}{
+		{"R1C1", Range{EndRow: 1, EndColumn: 1}, ""},
+		{"Sheet1!R2C2:R3C3", Range{Sheet: "Sheet1", StartRow: 1, EndRow: 3, StartColumn: 1, EndColumn: 3}, ""},
+		{"r3c3:r2c2", Range{StartRow: 1, EndRow: 3, StartColumn: 1, EndColumn: 3}, "R2C2:R3C3"},
+		{"C1:C2", Range{EndColumn: 2}, ""},
+		{"R2:R3", Range{StartRow: 1, EndRow: 3}, ""},
+		{"R5C1:C2", Range{StartRow: 4, EndColumn: 2}, ""},
+		{"'My sheet'!R1C1:R10C1", Range{Sheet: "My sheet", EndRow: 10, EndColumn: 1}, ""},
+		{"Sheet1", Range{Sheet: "Sheet1"}, ""},
+	} {
+		got, err := ParseR1C1(test.in)
+		if err != nil {
+			t.Errorf("ParseR1C1(%q): %v", test.in, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseR1C1(%q) = %+v, want %+v", test.in, got, test.want)
+		}
+		out := test.out
+		if out == "" {
+			out = test.in
+		}
+		if s := got.R1C1(); s != out {
+			t.Errorf("ParseR1C1(%q).R1C1() = %q, want %q", test.in, s, out)
+		}
+	}
+	for _, s := range []string{"Sheet1!R[1]C[1]", "Sheet1!R0C1", "Sheet1!RC", "Sheet1!A1"} {
+		if r, err := ParseR1C1(s); err == nil {
+			t.Errorf("ParseR1C1(%q) = %+v, want error", s, r)
+		}
+	}
+}
+
+func TestGridRange(t *testing.T) {
+	r, err := ParseA1("Data!B2:C")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := r.GridRange(7)
+	want := &sheets.GridRange{SheetId: 7, StartRowIndex: 1, StartColumnIndex: 1, EndColumnIndex: 3}
+	if diff := cmp.Diff(want, g); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if got := FromGridRange("Data", g); got != r {
+		t.Errorf("FromGridRange = %+v, want %+v", got, r)
+	}
+	if got, want := Cell("x y", 0, 2).String(), "'x y'!C1"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cells
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	sheets "google.golang.org/api/sheets/v4"
+)
+
+// BatchUpdate returns a request for SpreadsheetsService.BatchUpdate that
+// makes the given edits, in order.
+func BatchUpdate(requests ...*sheets.Request) *sheets.BatchUpdateSpreadsheetRequest {
+	return &sheets.BatchUpdateSpreadsheetRequest{Requests: requests}
+}
+
+// AddSheet returns a request that adds a sheet with the given title.
+func AddSheet(title string) *sheets.Request {
+	return &sheets.Request{AddSheet: &sheets.AddSheetRequest{
+		Properties: &sheets.SheetProperties{Title: title},
+	}}
+}
+
+// DeleteSheet returns a request that deletes the sheet with the given ID.
+func DeleteSheet(sheetID int64) *sheets.Request {
+	return &sheets.Request{DeleteSheet: &sheets.DeleteSheetRequest{SheetId: sheetID}}
+}
+
+// RenameSheet returns a request that sets the title of the sheet with the
+// given ID.
+func RenameSheet(sheetID int64, title string) *sheets.Request {
+	return &sheets.Request{UpdateSheetProperties: &sheets.UpdateSheetPropertiesRequest{
+		Properties: &sheets.SheetProperties{SheetId: sheetID, Title: title},
+		Fields:     "title",
+	}}
+}
+
+// dimensionRange returns the range of count rows or columns from the
+// zero-based index start.
+func dimensionRange(sheetID int64, dimension string, start, count int64) *sheets.DimensionRange {
+	return &sheets.DimensionRange{SheetId: sheetID, Dimension: dimension, StartIndex: start, EndIndex: start + count}
+}
+
+// InsertRows returns a request that inserts count empty rows before the row
+// with the zero-based index start. The new rows have the format of the row
+// before them, if there is one.
+func InsertRows(sheetID, start, count int64) *sheets.Request {
+	return &sheets.Request{InsertDimension: &sheets.InsertDimensionRequest{
+		Range:             dimensionRange(sheetID, "ROWS", start, count),
+		InheritFromBefore: start > 0,
+	}}
+}
+
+// InsertColumns returns a request that inserts count empty columns before the
+// column with the zero-based index start. The new columns have the format of
+// the column before them, if there is one.
+func InsertColumns(sheetID, start, count int64) *sheets.Request {
+	return &sheets.Request{InsertDimension: &sheets.InsertDimensionRequest{
+		Range:             dimensionRange(sheetID, "COLUMNS", start, count),
+		InheritFromBefore: start > 0,
+	}}
+}
+
+// DeleteRows returns a request that deletes count rows from the row with the
+// zero-based index start.
+func DeleteRows(sheetID, start, count int64) *sheets.Request {
+	return &sheets.Request{DeleteDimension: &sheets.DeleteDimensionRequest{
+		Range: dimensionRange(sheetID, "ROWS", start, count),
+	}}
+}
+
+// DeleteColumns returns a request that deletes count columns from the column
+// with the zero-based index start.
+func DeleteColumns(sheetID, start, count int64) *sheets.Request {
+	return &sheets.Request{DeleteDimension: &sheets.DeleteDimensionRequest{
+		Range: dimensionRange(sheetID, "COLUMNS", start, count),
+	}}
+}
+
+// AutoResizeColumns returns a request that resizes count columns from the
+// column with the zero-based index start to fit their contents.
+func AutoResizeColumns(sheetID, start, count int64) *sheets.Request {
+	return &sheets.Request{AutoResizeDimensions: &sheets.AutoResizeDimensionsRequest{
+		Dimensions: dimensionRange(sheetID, "COLUMNS", start, count),
+	}}
+}
+
+// FreezeRows returns a request that freezes the first n rows of a sheet, or
+// unfreezes them if n is zero.
+func FreezeRows(sheetID, n int64) *sheets.Request {
+	return &sheets.Request{UpdateSheetProperties: &sheets.UpdateSheetPropertiesRequest{
+		Properties: &sheets.SheetProperties{
+			SheetId:        sheetID,
+			GridProperties: &sheets.GridProperties{FrozenRowCount: n},
+		},
+		Fields: "gridProperties.frozenRowCount",
+	}}
+}
+
+// FreezeColumns returns a request that freezes the first n columns of a
+// sheet, or unfreezes them if n is zero.
+func FreezeColumns(sheetID, n int64) *sheets.Request {
+	return &sheets.Request{UpdateSheetProperties: &sheets.UpdateSheetPropertiesRequest{
+		Properties: &sheets.SheetProperties{
+			SheetId:        sheetID,
+			GridProperties: &sheets.GridProperties{FrozenColumnCount: n},
+		},
+		Fields: "gridProperties.frozenColumnCount",
+	}}
+}
+
+// SortRange returns a request that sorts the rows of r by the column with the
+// zero-based index column.
+func SortRange(r *sheets.GridRange, column int64, ascending bool) *sheets.Request {
+	order := "DESCENDING"
+	if ascending {
+		order = "ASCENDING"
+	}
+	return &sheets.Request{SortRange: &sheets.SortRangeRequest{
+		Range:     r,
+		SortSpecs: []*sheets.SortSpec{{DimensionIndex: column, SortOrder: order}},
+	}}
+}
+
+// MergeCells returns a request that merges the cells of r into one.
+func MergeCells(r *sheets.GridRange) *sheets.Request {
+	return &sheets.Request{MergeCells: &sheets.MergeCellsRequest{Range: r, MergeType: "MERGE_ALL"}}
+}
+
+// FindReplace returns a request that replaces find by replacement in the
+// cells of r, or of all sheets if r is nil.
+func FindReplace(find, replacement string, r *sheets.GridRange) *sheets.Request {
+	return &sheets.Request{FindReplace: &sheets.FindReplaceRequest{
+		Find:        find,
+		Replacement: replacement,
+		Range:       r,
+		AllSheets:   r == nil,
+	}}
+}
+
+// FormatCells returns a request that applies format to the cells of r.
+// fields is a comma-separated list of the fields of format to apply, such as
+// "textFormat.bold,backgroundColor"; other fields keep their format.
+func FormatCells(r *sheets.GridRange, format *sheets.CellFormat, fields string) *sheets.Request {
+	paths := strings.Split(fields, ",")
+	for i, p := range paths {
+		paths[i] = "userEnteredFormat." + strings.TrimSpace(p)
+	}
+	return &sheets.Request{RepeatCell: &sheets.RepeatCellRequest{
+		Range:  r,
+		Cell:   &sheets.CellData{UserEnteredFormat: format},
+		Fields: strings.Join(paths, ","),
+	}}
+}
+
+// A Formula is a formula entered in a cell by UpdateCells, such as
+// "=SUM(A1:A3)".
+type Formula string
+
+// UpdateCells returns a request that sets the values of the cells from the
+// cell at the given zero-based row and column, a row of values for each row
+// of cells. Values can be strings, Formulas, bools, numbers, time.Time and
+// nil, which clears the cell. Times are entered as serial numbers, which
+// sheets display as dates and times if the cells have a date or time format.
+func UpdateCells(sheetID, row, column int64, values [][]interface{}) (*sheets.Request, error) {
+	rows := make([]*sheets.RowData, len(values))
+	for i, vs := range values {
+		rows[i] = &sheets.RowData{Values: make([]*sheets.CellData, len(vs))}
+		for j, v := range vs {
+			ev, err := extendedValue(v)
+			if err != nil {
+				return nil, fmt.Errorf("cells: row %d, value %d: %v", i, j, err)
+			}
+			rows[i].Values[j] = &sheets.CellData{UserEnteredValue: ev}
+		}
+	}
+	return &sheets.Request{UpdateCells: &sheets.UpdateCellsRequest{
+		Start:  &sheets.GridCoordinate{SheetId: sheetID, RowIndex: row, ColumnIndex: column},
+		Rows:   rows,
+		Fields: "userEnteredValue",
+	}}, nil
+}
+
+// extendedValue returns the value of a cell for v, or nil for a nil v.
+func extendedValue(v interface{}) (*sheets.ExtendedValue, error) {
+	switch x := v.(type) {
+	case nil:
+		return nil, nil
+	case Formula:
+		return &sheets.ExtendedValue{FormulaValue: string(x)}, nil
+	case string:
+		return &sheets.ExtendedValue{StringValue: x, ForceSendFields: []string{"StringValue"}}, nil
+	case bool:
+		return &sheets.ExtendedValue{BoolValue: x, ForceSendFields: []string{"BoolValue"}}, nil
+	case time.Time:
+		// Sheets have no time zones: the serial number is that of the wall
+		// clock time of x.
+		wall := time.Date(x.Year(), x.Month(), x.Day(), x.Hour(), x.Minute(), x.Second(), x.Nanosecond(), time.UTC)
+		serial := float64(wall.Sub(epoch)) / float64(24*time.Hour)
+		return &sheets.ExtendedValue{NumberValue: serial, ForceSendFields: []string{"NumberValue"}}, nil
+	}
+	rv := reflect.ValueOf(v)
+	var f float64
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f = float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		f = float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		f = rv.Float()
+	default:
+		return nil, fmt.Errorf("unsupported type %T", v)
+	}
+	return &sheets.ExtendedValue{NumberValue: f, ForceSendFields: []string{"NumberValue"}}, nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cells
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	sheets "google.golang.org/api/sheets/v4"
+)
+
+func TestBatchUpdate(t *testing.T) {
+	update, err := UpdateCells(3, 1, 0, [][]interface{}{
+		{"a", 0, false, nil},
+		{Formula("=SUM(A1:A2)"), time.Date(2020, 5, 1, 12, 0, 0, 0, time.FixedZone("x", 3600))},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := Range{StartRow: 1, EndRow: 5, EndColumn: 2}
+	req := BatchUpdate(
+		AddSheet("New"),
+		InsertRows(3, 0, 2),
+		DeleteColumns(3, 4, 1),
+		FreezeRows(3, 0),
+		SortRange(r.GridRange(3), 1, false),
+		FormatCells(r.GridRange(3), &sheets.CellFormat{TextFormat: &sheets.TextFormat{Bold: true}}, "textFormat.bold, horizontalAlignment"),
+		FindReplace("x", "y", nil),
+		update,
+	)
+	b, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"requests":[` +
+		`{"addSheet":{"properties":{"title":"New"}}},` +
+		`{"insertDimension":{"range":{"dimension":"ROWS","endIndex":2,"sheetId":3}}},` +
+		`{"deleteDimension":{"range":{"dimension":"COLUMNS","endIndex":5,"sheetId":3,"startIndex":4}}},` +
+		`{"updateSheetProperties":{"fields":"gridProperties.frozenRowCount","properties":{"gridProperties":{},"sheetId":3}}},` +
+		`{"sortRange":{"range":{"endColumnIndex":2,"endRowIndex":5,"sheetId":3,"startRowIndex":1},"sortSpecs":[{"dimensionIndex":1,"sortOrder":"DESCENDING"}]}},` +
+		`{"repeatCell":{"cell":{"userEnteredFormat":{"textFormat":{"bold":true}}},"fields":"userEnteredFormat.textFormat.bold,userEnteredFormat.horizontalAlignment","range":{"endColumnIndex":2,"endRowIndex":5,"sheetId":3,"startRowIndex":1}}},` +
+		`{"findReplace":{"allSheets":true,"find":"x","replacement":"y"}},` +
+		`{"updateCells":{"fields":"userEnteredValue","rows":[` +
+		`{"values":[{"userEnteredValue":{"stringValue":"a"}},{"userEnteredValue":{"numberValue":0}},{"userEnteredValue":{"boolValue":false}},{}]},` +
+		`{"values":[{"userEnteredValue":{"formulaValue":"=SUM(A1:A2)"}},{"userEnteredValue":{"numberValue":43952.5}}]}` +
+		`],"start":{"rowIndex":1,"sheetId":3}}}` +
+		`]}`
+	if string(b) != want {
+		t.Errorf("got\n%s\nwant\n%s", b, want)
+	}
+
+	if _, err := UpdateCells(0, 0, 0, [][]interface{}{{struct{}{}}}); err == nil {
+		t.Error("got nil error for an unsupported value")
+	}
+}
@@ -0,0 +1,366 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cells
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	sheets "google.golang.org/api/sheets/v4"
+)
+
+// epoch is the date of the serial number 0 of dates and times in sheets.
+var epoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// timeLayouts are the layouts of the strings that are decoded to time.Time.
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02"}
+
+// timeLayout is the layout of encoded time.Time values, which sheets
+// recognize as dates and times when they are entered by users.
+const timeLayout = "2006-01-02 15:04:05"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// A field is a struct field that is mapped to a column.
+type field struct {
+	header string
+	index  []int
+}
+
+// structFields returns the fields of the struct type t that are mapped to
+// columns, in order. A field is mapped to the column with the header in its
+// sheets tag, or else with its name; fields tagged "-" and unexported fields
+// are not mapped.
+func structFields(t reflect.Type) []field {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		header := sf.Tag.Get("sheets")
+		switch header {
+		case "-":
+			continue
+		case "":
+			header = sf.Name
+		}
+		fields = append(fields, field{header: header, index: sf.Index})
+	}
+	return fields
+}
+
+// normalizeHeader returns the form of header that is compared to match
+// columns to fields.
+func normalizeHeader(header string) string {
+	return strings.ToLower(strings.TrimSpace(header))
+}
+
+// structSlice returns the slice pointed to by ptr, and the struct type of
+// its elements.
+func structSlice(ptr interface{}, fn string) (reflect.Value, reflect.Type, error) {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return reflect.Value{}, nil, fmt.Errorf("cells: %s needs a non-nil pointer to a slice, got %T", fn, ptr)
+	}
+	t := v.Elem().Type().Elem()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return reflect.Value{}, nil, fmt.Errorf("cells: %s needs a slice of structs, got %T", fn, ptr)
+	}
+	return v.Elem(), t, nil
+}
+
+// Decode decodes values, the rows of a ValueRange whose first row is a
+// header, and appends them to the slice pointed to by dst, whose elements
+// must be structs or pointers to structs.
+//
+// The columns are matched to the fields of the struct by their header,
+// ignoring case and surrounding spaces. A field is matched to the column with
+// the header in its sheets tag, or else with its name; fields tagged
+// `sheets:"-"` are ignored, as are columns without a matching field.
+//
+// Cells are decoded to fields of type string, bool, integer and float types,
+// time.Time, pointers to these types, and interface{}. Numbers and strings
+// are converted to each other as needed; dates and times are decoded from
+// serial numbers, as returned with the SERIAL_NUMBER date time render option,
+// or from strings in RFC 3339 format, YYYY-MM-DD or YYYY-MM-DD HH:MM:SS.
+// Empty and missing cells leave fields zero, and pointers nil.
+func Decode(values [][]interface{}, dst interface{}) error {
+	s, t, err := structSlice(dst, "Decode")
+	if err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	byHeader := make(map[string][]int)
+	for _, f := range structFields(t) {
+		byHeader[normalizeHeader(f.header)] = f.index
+	}
+	// The field indexes of the columns, nil for unmatched columns.
+	columns := make([][]int, len(values[0]))
+	for i, h := range values[0] {
+		columns[i] = byHeader[normalizeHeader(fmt.Sprint(h))]
+	}
+	for i, row := range values[1:] {
+		e := reflect.New(t).Elem()
+		for j, cell := range row {
+			if j >= len(columns) || columns[j] == nil {
+				continue
+			}
+			if err := decodeCell(e.FieldByIndex(columns[j]), cell); err != nil {
+				return fmt.Errorf("cells: row %d, column %s: %v", i+2, ColumnName(int64(j)), err)
+			}
+		}
+		if s.Type().Elem().Kind() == reflect.Ptr {
+			e = e.Addr()
+		}
+		s.Set(reflect.Append(s, e))
+	}
+	return nil
+}
+
+func decodeCell(dst reflect.Value, cell interface{}) error {
+	if cell == nil || cell == "" {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	switch {
+	case dst.Kind() == reflect.Interface && dst.NumMethod() == 0:
+		dst.Set(reflect.ValueOf(cell))
+		return nil
+	case dst.Kind() == reflect.Ptr:
+		p := reflect.New(dst.Type().Elem())
+		if err := decodeCell(p.Elem(), cell); err != nil {
+			return err
+		}
+		dst.Set(p)
+		return nil
+	case dst.Type() == timeType:
+		t, err := decodeTime(cell)
+		if err != nil {
+			return err
+		}
+		dst.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch x := cell.(type) {
+	case string:
+		return decodeString(dst, x)
+	case float64:
+		return decodeNumber(dst, x)
+	case int64:
+		// As returned by Encode.
+		return decodeNumber(dst, float64(x))
+	case uint64:
+		return decodeNumber(dst, float64(x))
+	case bool:
+		switch dst.Kind() {
+		case reflect.Bool:
+			dst.SetBool(x)
+			return nil
+		case reflect.String:
+			dst.SetString(strings.ToUpper(strconv.FormatBool(x)))
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot decode %T into %s", cell, dst.Type())
+}
+
+func decodeString(dst reflect.Value, s string) error {
+	switch dst.Kind() {
+	case reflect.String:
+		dst.SetString(s)
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		dst.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(s), 10, dst.Type().Bits())
+		if err != nil {
+			return err
+		}
+		dst.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(strings.TrimSpace(s), 10, dst.Type().Bits())
+		if err != nil {
+			return err
+		}
+		dst.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), dst.Type().Bits())
+		if err != nil {
+			return err
+		}
+		dst.SetFloat(f)
+		return nil
+	}
+	return fmt.Errorf("cannot decode string into %s", dst.Type())
+}
+
+func decodeNumber(dst reflect.Value, f float64) error {
+	switch dst.Kind() {
+	case reflect.String:
+		dst.SetString(strconv.FormatFloat(f, 'f', -1, 64))
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 || dst.OverflowInt(int64(f)) {
+			return fmt.Errorf("cannot decode %v into %s", f, dst.Type())
+		}
+		dst.SetInt(int64(f))
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 || dst.OverflowUint(uint64(f)) {
+			return fmt.Errorf("cannot decode %v into %s", f, dst.Type())
+		}
+		dst.SetUint(uint64(f))
+		return nil
+	case reflect.Float32, reflect.Float64:
+		dst.SetFloat(f)
+		return nil
+	}
+	return fmt.Errorf("cannot decode number into %s", dst.Type())
+}
+
+// decodeTime decodes a serial number or a string into a time in UTC.
+func decodeTime(cell interface{}) (time.Time, error) {
+	switch x := cell.(type) {
+	case float64:
+		// Serial numbers are days since the epoch; sheets store times with
+		// millisecond precision.
+		return epoch.Add(time.Duration(math.Round(x*24*60*60*1000)) * time.Millisecond), nil
+	case string:
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, x); err == nil {
+				return t.UTC(), nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("cannot parse %q as a time", x)
+	}
+	return time.Time{}, fmt.Errorf("cannot decode %T into time.Time", cell)
+}
+
+// Encode returns the rows of values of the elements of src, which must be a
+// slice of structs or pointers to structs. The fields of the structs are
+// mapped to columns in order, as described for Decode. If header is true,
+// the first row is the header of the columns.
+//
+// Strings, bools and numbers are encoded as themselves, and times as strings
+// that sheets recognize as dates and times when the values are entered with
+// the USER_ENTERED value input option. Nil pointers and zero times are
+// encoded as empty cells.
+func Encode(src interface{}, header bool) ([][]interface{}, error) {
+	v := reflect.ValueOf(src)
+	if v.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("cells: Encode needs a slice, got %T", src)
+	}
+	t := v.Type().Elem()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cells: Encode needs a slice of structs, got %T", src)
+	}
+	fields := structFields(t)
+	var values [][]interface{}
+	if header {
+		row := make([]interface{}, len(fields))
+		for i, f := range fields {
+			row[i] = f.header
+		}
+		values = append(values, row)
+	}
+	for i := 0; i < v.Len(); i++ {
+		e := v.Index(i)
+		if e.Kind() == reflect.Ptr {
+			if e.IsNil() {
+				return nil, fmt.Errorf("cells: element %d is nil", i)
+			}
+			e = e.Elem()
+		}
+		row := make([]interface{}, len(fields))
+		for j, f := range fields {
+			cell, err := encodeCell(e.FieldByIndex(f.index))
+			if err != nil {
+				return nil, fmt.Errorf("cells: element %d, field %s: %v", i, f.header, err)
+			}
+			row[j] = cell
+		}
+		values = append(values, row)
+	}
+	return values, nil
+}
+
+func encodeCell(v reflect.Value) (interface{}, error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+	if v.Type() == timeType {
+		t := v.Interface().(time.Time)
+		if t.IsZero() {
+			return "", nil
+		}
+		return t.Format(timeLayout), nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	}
+	return nil, fmt.Errorf("cannot encode %s", v.Type())
+}
+
+// Read gets the values of the range rng of a spreadsheet, whose first row is
+// a header, and decodes them into dst as described for Decode. Values are
+// read unformatted, and dates and times as serial numbers.
+func Read(ctx context.Context, svc *sheets.Service, spreadsheetID, rng string, dst interface{}) error {
+	vr, err := svc.Spreadsheets.Values.Get(spreadsheetID, rng).
+		ValueRenderOption("UNFORMATTED_VALUE").
+		DateTimeRenderOption("SERIAL_NUMBER").
+		Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	return Decode(vr.Values, dst)
+}
+
+// Append encodes the elements of src without a header, as described for
+// Encode, and appends them in new rows after the table in the range rng of a
+// spreadsheet. The values are entered as if typed by a user, so that strings
+// like "=A1" are entered as formulas.
+func Append(ctx context.Context, svc *sheets.Service, spreadsheetID, rng string, src interface{}) (*sheets.AppendValuesResponse, error) {
+	values, err := Encode(src, false)
+	if err != nil {
+		return nil, err
+	}
+	return svc.Spreadsheets.Values.Append(spreadsheetID, rng, &sheets.ValueRange{Values: values}).
+		ValueInputOption("USER_ENTERED").
+		InsertDataOption("INSERT_ROWS").
+		Context(ctx).Do()
+}
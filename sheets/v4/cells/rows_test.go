@@ -0,0 +1,178 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cells
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/option"
+	sheets "google.golang.org/api/sheets/v4"
+)
+
+type item struct {
+	Name     string
+	Price    float64 `sheets:"Unit price"`
+	Count    int
+	InStock  *bool `sheets:"In stock"`
+	Added    time.Time
+	Code     string
+	Internal string `sheets:"-"`
+}
+
+func boolPtr(b bool) *bool { return &b }
+
+// unformatted are values as returned with the UNFORMATTED_VALUE value render
+// option and SERIAL_NUMBER date time render option.
+const unformatted = `{
+  "range": "Items!A1:G4",
+  "majorDimension": "ROWS",
+  "values": [
+    ["Name", " unit PRICE ", "Count", "In stock", "Added", "Notes", "Code"],
+    ["apple", 1.25, 3, true, 43952.5, "fresh", 123],
+    ["pear", "2", "4", "FALSE", "2020-05-02"],
+    [],
+    ["plum", "", "", "", "", "", "007"]
+  ]
+}`
+
+func TestDecode(t *testing.T) {
+	var vr sheets.ValueRange
+	if err := json.Unmarshal([]byte(unformatted), &vr); err != nil {
+		t.Fatal(err)
+	}
+	var got []item
+	if err := Decode(vr.Values, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []item{
+		{Name: "apple", Price: 1.25, Count: 3, InStock: boolPtr(true), Added: time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC), Code: "123"},
+		{Name: "pear", Price: 2, Count: 4, InStock: boolPtr(false), Added: time.Date(2020, 5, 2, 0, 0, 0, 0, time.UTC)},
+		{},
+		{Name: "plum", Code: "007"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	var ptrs []*item
+	if err := Decode(vr.Values, &ptrs); err != nil {
+		t.Fatal(err)
+	}
+	if len(ptrs) != 4 || ptrs[1].Name != "pear" {
+		t.Errorf("got %+v", ptrs)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	header := []interface{}{"Name", "Count"}
+	for _, test := range []struct {
+		values [][]interface{}
+		dst    interface{}
+		want   string
+	}{
+		{nil, []item{}, "pointer to a slice"},
+		{nil, &[]int{}, "slice of structs"},
+		{[][]interface{}{header, {"a", 1.5}}, &[]item{}, "row 2, column B: cannot decode 1.5 into int"},
+		{[][]interface{}{header, {"a", "x"}}, &[]item{}, "row 2, column B: strconv.ParseInt"},
+		{[][]interface{}{header, {"a", true}}, &[]item{}, "row 2, column B: cannot decode bool into int"},
+		{[][]interface{}{header, {"a", 300.0}}, &[]struct{ Count int8 }{}, "cannot decode 300 into int8"},
+	} {
+		err := Decode(test.values, test.dst)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("Decode(%v): got error %v, want one containing %q", test.values, err, test.want)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	items := []*item{
+		{Name: "apple", Price: 1.25, Count: 3, InStock: boolPtr(true), Added: time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC), Code: "123", Internal: "x"},
+		{Name: "plum"},
+	}
+	got, err := Encode(items, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]interface{}{
+		{"Name", "Unit price", "Count", "In stock", "Added", "Code"},
+		{"apple", 1.25, int64(3), true, "2020-05-01 12:00:00", "123"},
+		{"plum", 0.0, int64(0), "", "", ""},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	// The header matches the fields when the values are decoded.
+	var decoded []item
+	if err := Decode(got, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded[0].Name != "apple" || decoded[0].InStock == nil || !*decoded[0].InStock || !decoded[0].Added.Equal(items[0].Added) {
+		t.Errorf("got %+v", decoded[0])
+	}
+
+	if _, err := Encode([]struct{ C chan int }{{}}, false); err == nil {
+		t.Error("got nil error for an unsupported type")
+	}
+	if _, err := Encode([]*item{nil}, false); err == nil {
+		t.Error("got nil error for a nil element")
+	}
+}
+
+func TestReadAppend(t *testing.T) {
+	var appended sheets.ValueRange
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/v4/spreadsheets/s/values/Items!A:G":
+			if q.Get("valueRenderOption") != "UNFORMATTED_VALUE" || q.Get("dateTimeRenderOption") != "SERIAL_NUMBER" {
+				t.Errorf("got query %v", q)
+			}
+			w.Write([]byte(unformatted))
+		case r.Method == "POST" && r.URL.Path == "/v4/spreadsheets/s/values/Items!A:G:append":
+			if q.Get("valueInputOption") != "USER_ENTERED" {
+				t.Errorf("got query %v", q)
+			}
+			if err := json.NewDecoder(r.Body).Decode(&appended); err != nil {
+				t.Error(err)
+			}
+			w.Write([]byte(`{"updates": {"updatedRows": 1}}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			http.Error(w, "unexpected", http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+	svc, err := sheets.NewService(ctx, option.WithHTTPClient(http.DefaultClient), option.WithEndpoint(srv.URL+"/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var items []item
+	if err := Read(ctx, svc, "s", "Items!A:G", &items); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 4 || items[0].Name != "apple" {
+		t.Errorf("got %+v", items)
+	}
+	res, err := Append(ctx, svc, "s", "Items!A:G", items[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Updates.UpdatedRows != 1 {
+		t.Errorf("got %d updated rows, want 1", res.Updates.UpdatedRows)
+	}
+	if len(appended.Values) != 1 || appended.Values[0][0] != "apple" {
+		t.Errorf("appended %v", appended.Values)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package signedurl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// The test vectors of testdata/v4_signatures.json are the V4 signing
+// conformance tests of Cloud Storage, from
+// https://github.com/googleapis/conformance-tests, signed with the inactive
+// key of testdata/service-account.json.
+
+type signingTest struct {
+	Description          string
+	Bucket               string
+	Object               string
+	Headers              map[string]string
+	QueryParameters      map[string]string
+	Method               string
+	Expiration           int64
+	Timestamp            time.Time
+	Scheme               string
+	URLStyle             string `json:"urlStyle"`
+	BucketBoundHostname  string
+	ExpectedURL          string `json:"expectedUrl"`
+	ExpectedStringToSign string
+}
+
+type postPolicyTest struct {
+	Description string
+	PolicyInput struct {
+		Scheme              string
+		URLStyle            string `json:"urlStyle"`
+		BucketBoundHostname string
+		Bucket              string
+		Object              string
+		Expiration          int64
+		Timestamp           time.Time
+		Conditions          struct {
+			StartsWith         []string
+			ContentLengthRange []uint64
+		}
+		Fields map[string]string
+	}
+	PolicyOutput struct {
+		URL    string `json:"url"`
+		Fields map[string]string
+	}
+}
+
+// conformanceSigner returns the Signer of the conformance tests, which
+// records the bytes it signs.
+func conformanceSigner(t *testing.T, signed *[]byte) *Signer {
+	jsonKey, err := ioutil.ReadFile("testdata/service-account.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSignerFromJSON(jsonKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := s.SignBytes
+	s.SignBytes = func(ctx context.Context, b []byte) ([]byte, error) {
+		*signed = b
+		return sign(ctx, b)
+	}
+	return s
+}
+
+func conformanceTests(t *testing.T) (signing []signingTest, policies []postPolicyTest) {
+	b, err := ioutil.ReadFile("testdata/v4_signatures.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests struct {
+		SigningV4Tests    []signingTest
+		PostPolicyV4Tests []postPolicyTest
+	}
+	if err := json.Unmarshal(b, &tests); err != nil {
+		t.Fatal(err)
+	}
+	return tests.SigningV4Tests, tests.PostPolicyV4Tests
+}
+
+func urlStyle(style, hostname string) URLStyle {
+	switch style {
+	case "VIRTUAL_HOSTED_STYLE":
+		return VirtualHostedStyle()
+	case "BUCKET_BOUND_HOSTNAME":
+		return BucketBoundHostname(hostname)
+	}
+	return PathStyle()
+}
+
+func TestSignedURLConformance(t *testing.T) {
+	signing, _ := conformanceTests(t)
+	if len(signing) == 0 {
+		t.Fatal("no signing tests")
+	}
+	defer func() { now = time.Now }()
+	var signed []byte
+	s := conformanceSigner(t, &signed)
+	for _, test := range signing {
+		setNow(test.Timestamp)
+		var headers []string
+		for k, v := range test.Headers {
+			headers = append(headers, k+":"+v)
+		}
+		query := make(url.Values)
+		for k, v := range test.QueryParameters {
+			query.Set(k, v)
+		}
+		got, err := s.SignedURL(context.Background(), test.Bucket, test.Object, &Options{
+			Method:          test.Method,
+			Expires:         test.Timestamp.Add(time.Duration(test.Expiration) * time.Second),
+			Headers:         headers,
+			QueryParameters: query,
+			Style:           urlStyle(test.URLStyle, test.BucketBoundHostname),
+			Insecure:        test.Scheme == "http",
+		})
+		if err != nil {
+			t.Errorf("%s: %v", test.Description, err)
+			continue
+		}
+		if diff := cmp.Diff(test.ExpectedStringToSign, string(signed)); diff != "" {
+			t.Errorf("%s: signed string mismatch (-want +got):\n%s", test.Description, diff)
+		}
+		if got != test.ExpectedURL {
+			t.Errorf("%s: got URL\n%s\nwant\n%s", test.Description, got, test.ExpectedURL)
+		}
+	}
+}
+
+func TestPostPolicyConformance(t *testing.T) {
+	_, policies := conformanceTests(t)
+	if len(policies) == 0 {
+		t.Fatal("no POST policy tests")
+	}
+	defer func() { now = time.Now }()
+	var signed []byte
+	s := conformanceSigner(t, &signed)
+	for _, test := range policies {
+		in := test.PolicyInput
+		setNow(in.Timestamp)
+		var conditions []PostPolicyCondition
+		if sw := in.Conditions.StartsWith; len(sw) == 2 {
+			if len(sw[0]) == 0 || sw[0][0] != '$' {
+				t.Fatalf("%s: invalid starts-with field %q", test.Description, sw[0])
+			}
+			conditions = append(conditions, ConditionStartsWith(sw[0][1:], sw[1]))
+		}
+		if r := in.Conditions.ContentLengthRange; len(r) == 2 {
+			conditions = append(conditions, ConditionContentLengthRange(r[0], r[1]))
+		}
+		got, err := s.PostPolicy(context.Background(), in.Bucket, in.Object, &PostPolicyOptions{
+			Expires:    in.Timestamp.Add(time.Duration(in.Expiration) * time.Second),
+			Fields:     in.Fields,
+			Conditions: conditions,
+			Style:      urlStyle(in.URLStyle, in.BucketBoundHostname),
+			Insecure:   in.Scheme == "http",
+		})
+		if err != nil {
+			t.Errorf("%s: %v", test.Description, err)
+			continue
+		}
+		want := &PostPolicy{URL: test.PolicyOutput.URL, Fields: test.PolicyOutput.Fields}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("%s: mismatch (-want +got):\n%s", test.Description, diff)
+		}
+		if string(signed) != want.Fields["policy"] {
+			t.Errorf("%s: signed %q, want the policy", test.Description, fmt.Sprintf("%.40s", signed))
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package signedurl
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// A PostPolicyCondition is a condition that the forms of a POST policy must
+// meet, besides the values of its fields.
+type PostPolicyCondition interface {
+	condition() []interface{}
+}
+
+type startsWith struct {
+	field, prefix string
+}
+
+func (c startsWith) condition() []interface{} {
+	return []interface{}{"starts-with", "$" + c.field, c.prefix}
+}
+
+// ConditionStartsWith returns a condition that the value of the form field
+// starts with prefix, or is any value if prefix is empty.
+func ConditionStartsWith(field, prefix string) PostPolicyCondition {
+	return startsWith{field: field, prefix: prefix}
+}
+
+type contentLengthRange struct {
+	min, max uint64
+}
+
+func (c contentLengthRange) condition() []interface{} {
+	return []interface{}{"content-length-range", c.min, c.max}
+}
+
+// ConditionContentLengthRange returns a condition that the size of the
+// uploaded object is between min and max bytes, inclusive.
+func ConditionContentLengthRange(min, max uint64) PostPolicyCondition {
+	return contentLengthRange{min: min, max: max}
+}
+
+// PostPolicyOptions are the options of a POST policy.
+type PostPolicyOptions struct {
+	// Expires is the expiration time of the policy, at most 7 days from
+	// now. It is required.
+	Expires time.Time
+
+	// Fields are form fields that the forms must send with the given
+	// values, such as "content-type", "acl", "success_action_redirect" or
+	// "x-goog-meta-owner".
+	Fields map[string]string
+
+	// Conditions are other conditions of the forms.
+	Conditions []PostPolicyCondition
+
+	// Style is the form of the URL of the forms. It is PathStyle if nil.
+	Style URLStyle
+
+	// Insecure makes a URL with the http scheme instead of https.
+	Insecure bool
+}
+
+// A PostPolicy is a signed policy that allows to upload an object with an
+// HTML form.
+type PostPolicy struct {
+	// URL is the action URL of the forms.
+	URL string
+
+	// Fields are the form fields that the forms must send, before the file
+	// field.
+	Fields map[string]string
+}
+
+// reservedFields are the form fields set by the Signer.
+var reservedFields = map[string]bool{
+	"bucket":            true,
+	"key":               true,
+	"policy":            true,
+	"x-goog-algorithm":  true,
+	"x-goog-credential": true,
+	"x-goog-date":       true,
+	"x-goog-signature":  true,
+}
+
+// PostPolicy returns a V4 signed POST policy for uploading the object to
+// the bucket.
+func (s *Signer) PostPolicy(ctx context.Context, bucket, object string, opts *PostPolicyOptions) (*PostPolicy, error) {
+	if bucket == "" {
+		return nil, errors.New("signedurl: missing bucket name")
+	}
+	if object == "" {
+		return nil, errors.New("signedurl: missing object name")
+	}
+	if s.GoogleAccessID == "" || s.SignBytes == nil {
+		return nil, errors.New("signedurl: Signer has no GoogleAccessID or SignBytes")
+	}
+	t := now().UTC()
+	if opts.Expires.IsZero() {
+		return nil, errors.New("signedurl: missing expiration time")
+	}
+	if d := opts.Expires.Sub(t); d <= 0 || d > maxExpiration {
+		return nil, fmt.Errorf("signedurl: expiration time must be less than %v from now", maxExpiration)
+	}
+	style := opts.Style
+	if style == nil {
+		style = PathStyle()
+	}
+
+	fields := map[string]string{
+		"key":               object,
+		"x-goog-algorithm":  algorithm,
+		"x-goog-credential": s.GoogleAccessID + "/" + credentialScope(t),
+		"x-goog-date":       t.Format(dateFormat),
+	}
+	var names []string
+	for name := range opts.Fields {
+		if reservedFields[strings.ToLower(name)] {
+			return nil, fmt.Errorf("signedurl: field %q is reserved", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var conditions []interface{}
+	for _, name := range names {
+		fields[name] = opts.Fields[name]
+		conditions = append(conditions, map[string]string{name: opts.Fields[name]})
+	}
+	for _, c := range opts.Conditions {
+		conditions = append(conditions, c.condition())
+	}
+	conditions = append(conditions,
+		map[string]string{"bucket": bucket},
+		map[string]string{"key": object},
+		map[string]string{"x-goog-date": fields["x-goog-date"]},
+		map[string]string{"x-goog-credential": fields["x-goog-credential"]},
+		map[string]string{"x-goog-algorithm": algorithm},
+	)
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(struct {
+		Conditions []interface{} `json:"conditions"`
+		Expiration string        `json:"expiration"`
+	}{conditions, opts.Expires.UTC().Format(time.RFC3339)})
+	if err != nil {
+		return nil, fmt.Errorf("signedurl: encoding policy: %v", err)
+	}
+	policy := base64.StdEncoding.EncodeToString(escapeNonASCII(bytes.TrimSuffix(buf.Bytes(), []byte("\n"))))
+	sig, err := s.SignBytes(ctx, []byte(policy))
+	if err != nil {
+		return nil, err
+	}
+	fields["policy"] = policy
+	fields["x-goog-signature"] = hex.EncodeToString(sig)
+
+	scheme := "https"
+	if opts.Insecure {
+		scheme = "http"
+	}
+	path := style.path(bucket, "")
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+	return &PostPolicy{
+		URL:    scheme + "://" + style.host(bucket) + path,
+		Fields: fields,
+	}, nil
+}
+
+// escapeNonASCII replaces the non-ASCII characters of the JSON document doc
+// with \u escapes, as the policies signed by Cloud Storage do.
+func escapeNonASCII(doc []byte) []byte {
+	var b bytes.Buffer
+	for _, r := range string(doc) {
+		if r < utf8.RuneSelf {
+			b.WriteRune(r)
+			continue
+		}
+		if r1, r2 := utf16.EncodeRune(r); r1 != utf8.RuneError {
+			fmt.Fprintf(&b, "\\u%04x\\u%04x", r1, r2)
+		} else {
+			fmt.Fprintf(&b, "\\u%04x", r)
+		}
+	}
+	return b.Bytes()
+}
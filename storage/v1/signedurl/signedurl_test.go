@@ -0,0 +1,234 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package signedurl
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	iamcredentials "google.golang.org/api/iamcredentials/v1"
+	"google.golang.org/api/option"
+)
+
+const email = "test-iam-credentials@dummy-project-id.iam.gserviceaccount.com"
+
+var signTime = time.Date(2019, 2, 1, 9, 0, 0, 0, time.UTC)
+
+// fakeSigner returns a Signer whose signatures are 0xabcd, and that records
+// the bytes it signs.
+func fakeSigner(signed *[]byte) *Signer {
+	return &Signer{
+		GoogleAccessID: email,
+		SignBytes: func(ctx context.Context, b []byte) ([]byte, error) {
+			*signed = b
+			return []byte{0xab, 0xcd}, nil
+		},
+	}
+}
+
+func setNow(t time.Time) func() {
+	now = func() time.Time { return t }
+	return func() { now = time.Now }
+}
+
+// stringToSign returns the string signed for the canonical request creq.
+func stringToSign(creq string) string {
+	sum := sha256.Sum256([]byte(creq))
+	return "GOOG4-RSA-SHA256\n20190201T090000Z\n20190201/auto/storage/goog4_request\n" + hex.EncodeToString(sum[:])
+}
+
+func TestSignedURLOptions(t *testing.T) {
+	defer setNow(signTime)()
+	// The options that set headers sign the same URL as the headers.
+	for _, test := range []struct {
+		opts, want *Options
+	}{
+		{
+			&Options{Method: "RESUMABLE"},
+			&Options{Method: "POST", Headers: []string{"X-Goog-Resumable:start"}},
+		},
+		{
+			&Options{Method: "PUT", ContentType: "text/plain", MD5: "1B2M2Y8AsgTpgAmY7PhCfg=="},
+			&Options{Method: "PUT", Headers: []string{"content-type:text/plain", "content-md5:1B2M2Y8AsgTpgAmY7PhCfg=="}},
+		},
+	} {
+		test.opts.Expires = signTime.Add(time.Minute)
+		test.want.Expires = signTime.Add(time.Minute)
+		var signed, wantSigned []byte
+		got, err := fakeSigner(&signed).SignedURL(context.Background(), "test-bucket", "test-object", test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := fakeSigner(&wantSigned).SignedURL(context.Background(), "test-bucket", "test-object", test.want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want || string(signed) != string(wantSigned) {
+			t.Errorf("got URL %s for %+v, want %s", got, test.opts, want)
+		}
+	}
+}
+
+func TestSignedURLErrors(t *testing.T) {
+	defer setNow(signTime)()
+	var signed []byte
+	s := fakeSigner(&signed)
+	for _, test := range []struct {
+		bucket string
+		opts   *Options
+	}{
+		{"", &Options{Expires: signTime.Add(time.Minute)}},
+		{"b", &Options{}},
+		{"b", &Options{Expires: signTime.Add(-time.Minute)}},
+		{"b", &Options{Expires: signTime.Add(7*24*time.Hour + time.Second)}},
+		{"b", &Options{Expires: signTime.Add(time.Minute), Headers: []string{"no-colon"}}},
+	} {
+		if _, err := s.SignedURL(context.Background(), test.bucket, "o", test.opts); err == nil {
+			t.Errorf("SignedURL(%q, %+v): got nil error", test.bucket, test.opts)
+		}
+	}
+	if _, err := (&Signer{}).SignedURL(context.Background(), "b", "o", &Options{Expires: signTime.Add(time.Minute)}); err == nil {
+		t.Error("got nil error for a Signer without key")
+	}
+}
+
+func TestSignRequest(t *testing.T) {
+	defer setNow(signTime)()
+	req, err := http.NewRequest("PUT", "https://storage.googleapis.com/test-bucket/test-object?x=1", strings.NewReader("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("X-Goog-Meta-A", "b")
+	req.Header.Set("User-Agent", "unsigned")
+	var signed []byte
+	if err := fakeSigner(&signed).SignRequest(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	wantReq := "PUT\n" +
+		"/test-bucket/test-object\n" +
+		"x=1\n" +
+		"content-type:text/plain\n" +
+		"host:storage.googleapis.com\n" +
+		"x-goog-content-sha256:UNSIGNED-PAYLOAD\n" +
+		"x-goog-date:20190201T090000Z\n" +
+		"x-goog-meta-a:b\n" +
+		"\n" +
+		"content-type;host;x-goog-content-sha256;x-goog-date;x-goog-meta-a\n" +
+		"UNSIGNED-PAYLOAD"
+	if diff := cmp.Diff(stringToSign(wantReq), string(signed)); diff != "" {
+		t.Errorf("signed string mismatch (-want +got):\n%s", diff)
+	}
+	want := "GOOG4-RSA-SHA256 Credential=" + email + "/20190201/auto/storage/goog4_request, " +
+		"SignedHeaders=content-type;host;x-goog-content-sha256;x-goog-date;x-goog-meta-a, Signature=abcd"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("got Authorization\n%s\nwant\n%s", got, want)
+	}
+	if got := req.Header.Get("X-Goog-Date"); got != "20190201T090000Z" {
+		t.Errorf("got X-Goog-Date %q", got)
+	}
+}
+
+func TestPostPolicyErrors(t *testing.T) {
+	defer setNow(signTime)()
+	var signed []byte
+	s := fakeSigner(&signed)
+	for _, test := range []struct {
+		object string
+		opts   *PostPolicyOptions
+	}{
+		{"", &PostPolicyOptions{Expires: signTime.Add(time.Minute)}},
+		{"o", &PostPolicyOptions{}},
+		{"o", &PostPolicyOptions{Expires: signTime.Add(8 * 24 * time.Hour)}},
+		{"o", &PostPolicyOptions{Expires: signTime.Add(time.Minute), Fields: map[string]string{"Policy": "mine"}}},
+	} {
+		if _, err := s.PostPolicy(context.Background(), "b", test.object, test.opts); err == nil {
+			t.Errorf("PostPolicy(%q, %+v): got nil error", test.object, test.opts)
+		}
+	}
+}
+
+func TestSigners(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify := func(name string, s *Signer) {
+		sig, err := s.SignBytes(context.Background(), []byte("blob"))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			return
+		}
+		sum := sha256.Sum256([]byte("blob"))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, sum[:], sig); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if s.GoogleAccessID != email {
+			t.Errorf("%s: got GoogleAccessID %q", name, s.GoogleAccessID)
+		}
+	}
+	verify("NewSignerFromKey", NewSignerFromKey(email, key))
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonKey, err := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": email,
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSignerFromJSON(jsonKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify("NewSignerFromJSON", s)
+	if _, err := NewSignerFromJSON([]byte(`{"type": "service_account", "private_key": "none"}`)); err == nil {
+		t.Error("got nil error for an invalid private key")
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if want := "/v1/projects/-/serviceAccounts/" + email + ":signBlob"; r.URL.Path != want {
+			t.Errorf("got path %q, want %q", r.URL.Path, want)
+		}
+		var req iamcredentials.SignBlobRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		payload, err := base64.StdEncoding.DecodeString(req.Payload)
+		if err != nil {
+			t.Error(err)
+		}
+		sig, err := NewSignerFromKey(email, key).SignBytes(r.Context(), payload)
+		if err != nil {
+			t.Error(err)
+		}
+		fmt.Fprintf(w, `{"keyId": "k1", "signedBlob": %q}`, base64.StdEncoding.EncodeToString(sig))
+	}))
+	defer srv.Close()
+	svc, err := iamcredentials.NewService(context.Background(), option.WithHTTPClient(http.DefaultClient), option.WithEndpoint(srv.URL+"/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify("NewIAMSigner", NewIAMSigner(svc, email))
+}
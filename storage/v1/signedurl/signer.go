@@ -0,0 +1,113 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package signedurl creates V4 signed URLs and signed POST policies for the
+// objects of Cloud Storage, which give access to them without credentials
+// until they expire.
+//
+// A Signer signs with the private key of a service account, read from its
+// credentials JSON file, or with the SignBlob call of the iamcredentials/v1
+// package, which signs as a service account that the caller can impersonate:
+//
+//	s, err := signedurl.NewSignerFromJSON(jsonKey)
+//	...
+//	u, err := s.SignedURL(ctx, "my-bucket", "cat.jpeg", &signedurl.Options{
+//		Method:  "GET",
+//		Expires: time.Now().Add(15 * time.Minute),
+//	})
+//
+// This is an EXPERIMENTAL API and may be changed or removed in the future.
+package signedurl
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"golang.org/x/oauth2/google"
+	iamcredentials "google.golang.org/api/iamcredentials/v1"
+)
+
+// A Signer signs URLs and POST policies as a service account.
+type Signer struct {
+	// GoogleAccessID is the email of the service account.
+	GoogleAccessID string
+
+	// SignBytes signs b with the RSA SHA-256 key of the service account.
+	SignBytes func(ctx context.Context, b []byte) ([]byte, error)
+}
+
+// NewSignerFromJSON returns a Signer that signs with the private key of the
+// service account credentials JSON file jsonKey.
+func NewSignerFromJSON(jsonKey []byte) (*Signer, error) {
+	cfg, err := google.JWTConfigFromJSON(jsonKey)
+	if err != nil {
+		return nil, fmt.Errorf("signedurl: %v", err)
+	}
+	key, err := parseKey(cfg.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return NewSignerFromKey(cfg.Email, key), nil
+}
+
+// NewSignerFromKey returns a Signer that signs with the private key of the
+// service account with the given email.
+func NewSignerFromKey(email string, key *rsa.PrivateKey) *Signer {
+	return &Signer{
+		GoogleAccessID: email,
+		SignBytes: func(ctx context.Context, b []byte) ([]byte, error) {
+			sum := sha256.Sum256(b)
+			return rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+		},
+	}
+}
+
+// NewIAMSigner returns a Signer that signs as the service account with the
+// given email, with the SignBlob call of svc. The credentials of svc must
+// be allowed to create tokens for the service account.
+func NewIAMSigner(svc *iamcredentials.Service, email string) *Signer {
+	return &Signer{
+		GoogleAccessID: email,
+		SignBytes: func(ctx context.Context, b []byte) ([]byte, error) {
+			req := &iamcredentials.SignBlobRequest{Payload: base64.StdEncoding.EncodeToString(b)}
+			res, err := svc.Projects.ServiceAccounts.SignBlob("projects/-/serviceAccounts/"+email, req).Context(ctx).Do()
+			if err != nil {
+				return nil, fmt.Errorf("signedurl: signing blob: %v", err)
+			}
+			sig, err := base64.StdEncoding.DecodeString(res.SignedBlob)
+			if err != nil {
+				return nil, fmt.Errorf("signedurl: decoding signed blob: %v", err)
+			}
+			return sig, nil
+		},
+	}
+}
+
+// parseKey parses a PEM encoded PKCS #8 or PKCS #1 RSA private key.
+func parseKey(b []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("signedurl: private key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("signedurl: parsing private key: %v", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("signedurl: private key is not an RSA key")
+	}
+	return rsaKey, nil
+}
@@ -0,0 +1,310 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package signedurl
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	algorithm        = "GOOG4-RSA-SHA256"
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+	dateFormat       = "20060102T150405Z"
+	maxExpiration    = 7 * 24 * time.Hour
+	defaultHostname  = "storage.googleapis.com"
+	resumableMethod  = "RESUMABLE"
+	credentialSuffix = "auto/storage/goog4_request"
+)
+
+// now returns the time of the signatures, for tests.
+var now = time.Now
+
+// A URLStyle is the form of the URLs of objects.
+type URLStyle interface {
+	host(bucket string) string
+	path(bucket, object string) string
+}
+
+type pathStyle struct{}
+
+func (pathStyle) host(bucket string) string { return defaultHostname }
+func (pathStyle) path(bucket, object string) string {
+	if object == "" {
+		return "/" + bucket
+	}
+	return "/" + bucket + "/" + object
+}
+
+type virtualHostedStyle struct{}
+
+func (virtualHostedStyle) host(bucket string) string         { return bucket + "." + defaultHostname }
+func (virtualHostedStyle) path(bucket, object string) string { return "/" + object }
+
+type bucketBoundHostname struct {
+	hostname string
+}
+
+func (s bucketBoundHostname) host(bucket string) string         { return s.hostname }
+func (s bucketBoundHostname) path(bucket, object string) string { return "/" + object }
+
+// PathStyle returns the URL style of the form
+// "storage.googleapis.com/{bucket}/{object}". It is the default.
+func PathStyle() URLStyle {
+	return pathStyle{}
+}
+
+// VirtualHostedStyle returns the URL style of the form
+// "{bucket}.storage.googleapis.com/{object}".
+func VirtualHostedStyle() URLStyle {
+	return virtualHostedStyle{}
+}
+
+// BucketBoundHostname returns the URL style of the form
+// "{hostname}/{object}", for a hostname mapped to the bucket, such as a
+// CNAME or a load balancer.
+func BucketBoundHostname(hostname string) URLStyle {
+	return bucketBoundHostname{hostname: hostname}
+}
+
+// Options are the options of a signed URL.
+type Options struct {
+	// Method is the HTTP method of the requests of the URL. It is "GET" if
+	// empty. "RESUMABLE" signs a POST request that initiates a resumable
+	// upload, with the header "x-goog-resumable: start".
+	Method string
+
+	// Expires is the expiration time of the URL, at most 7 days from now.
+	// It is required.
+	Expires time.Time
+
+	// ContentType, if not empty, is the Content-Type header that the
+	// requests must send.
+	ContentType string
+
+	// MD5, if not empty, is the base64 MD5 digest of the content, sent in
+	// the Content-MD5 header of the requests.
+	MD5 string
+
+	// Headers are other headers that the requests must send, in the form
+	// "name:value", such as "x-goog-meta-owner:alice".
+	Headers []string
+
+	// QueryParameters are other query parameters of the URL, such as
+	// "generation" or "response-content-disposition".
+	QueryParameters url.Values
+
+	// Style is the form of the URL. It is PathStyle if nil.
+	Style URLStyle
+
+	// Insecure makes a URL with the http scheme instead of https.
+	Insecure bool
+}
+
+// SignedURL returns a V4 signed URL for the object of the bucket, signed
+// with the query parameters of the URL. If object is empty, the URL is that
+// of the bucket, which lists its objects.
+func (s *Signer) SignedURL(ctx context.Context, bucket, object string, opts *Options) (string, error) {
+	if bucket == "" {
+		return "", errors.New("signedurl: missing bucket name")
+	}
+	if s.GoogleAccessID == "" || s.SignBytes == nil {
+		return "", errors.New("signedurl: Signer has no GoogleAccessID or SignBytes")
+	}
+	t := now().UTC()
+	if opts.Expires.IsZero() {
+		return "", errors.New("signedurl: missing expiration time")
+	}
+	expires := opts.Expires.Sub(t)
+	if expires <= 0 || expires > maxExpiration {
+		return "", fmt.Errorf("signedurl: expiration time must be less than %v from now", maxExpiration)
+	}
+	style := opts.Style
+	if style == nil {
+		style = PathStyle()
+	}
+	method := opts.Method
+	if method == "" {
+		method = "GET"
+	}
+	headers := make(http.Header)
+	for _, h := range opts.Headers {
+		i := strings.Index(h, ":")
+		if i <= 0 {
+			return "", fmt.Errorf("signedurl: invalid header %q", h)
+		}
+		headers.Add(h[:i], h[i+1:])
+	}
+	if opts.ContentType != "" {
+		headers.Set("Content-Type", opts.ContentType)
+	}
+	if opts.MD5 != "" {
+		headers.Set("Content-MD5", opts.MD5)
+	}
+	if method == resumableMethod {
+		method = "POST"
+		headers.Set("X-Goog-Resumable", "start")
+	}
+	host := style.host(bucket)
+	headers.Set("Host", host)
+	canonical := canonicalizeHeaders(headers)
+
+	query := make(url.Values)
+	for k, vs := range opts.QueryParameters {
+		query[k] = append([]string(nil), vs...)
+	}
+	query.Set("X-Goog-Algorithm", algorithm)
+	query.Set("X-Goog-Credential", s.GoogleAccessID+"/"+credentialScope(t))
+	query.Set("X-Goog-Date", t.Format(dateFormat))
+	query.Set("X-Goog-Expires", fmt.Sprint(int64(expires/time.Second)))
+	query.Set("X-Goog-SignedHeaders", canonical.signed)
+	path := encodePath(style.path(bucket, object))
+	payload := unsignedPayload
+	if v := headers.Get("X-Goog-Content-SHA256"); v != "" {
+		payload = v
+	}
+	sig, err := s.sign(ctx, t, canonicalRequest(method, path, query, canonical, payload))
+	if err != nil {
+		return "", err
+	}
+	scheme := "https"
+	if opts.Insecure {
+		scheme = "http"
+	}
+	// The signature follows the signed query parameters.
+	return scheme + "://" + host + path + "?" + encodeQuery(query) + "&X-Goog-Signature=" + sig, nil
+}
+
+// SignRequest signs req with its Authorization header, so that it can be
+// sent without other credentials. It signs the Host, Content-Type and
+// Content-MD5 headers, and the headers starting with "X-Goog-", which must
+// not change afterwards; the body is not signed. req must be sent within 15
+// minutes.
+func (s *Signer) SignRequest(ctx context.Context, req *http.Request) error {
+	if s.GoogleAccessID == "" || s.SignBytes == nil {
+		return errors.New("signedurl: Signer has no GoogleAccessID or SignBytes")
+	}
+	t := now().UTC()
+	req.Header.Set("X-Goog-Date", t.Format(dateFormat))
+	if req.Header.Get("X-Goog-Content-SHA256") == "" {
+		req.Header.Set("X-Goog-Content-SHA256", unsignedPayload)
+	}
+	headers := make(http.Header)
+	for k, vs := range req.Header {
+		k = http.CanonicalHeaderKey(k)
+		if k == "Content-Type" || k == "Content-Md5" || strings.HasPrefix(k, "X-Goog-") {
+			headers[k] = vs
+		}
+	}
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers.Set("Host", host)
+	canonical := canonicalizeHeaders(headers)
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	creq := canonicalRequest(req.Method, path, req.URL.Query(), canonical, req.Header.Get("X-Goog-Content-SHA256"))
+	sig, err := s.sign(ctx, t, creq)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, s.GoogleAccessID, credentialScope(t), canonical.signed, sig))
+	return nil
+}
+
+// credentialScope returns the scope of the credentials of a signature at t.
+func credentialScope(t time.Time) string {
+	return t.Format("20060102") + "/" + credentialSuffix
+}
+
+// sign returns the hex signature of the canonical request creq at t.
+func (s *Signer) sign(ctx context.Context, t time.Time, creq string) (string, error) {
+	sum := sha256.Sum256([]byte(creq))
+	toSign := strings.Join([]string{
+		algorithm,
+		t.Format(dateFormat),
+		credentialScope(t),
+		hex.EncodeToString(sum[:]),
+	}, "\n")
+	sig, err := s.SignBytes(ctx, []byte(toSign))
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sig), nil
+}
+
+// canonicalHeaders are the canonical form of the signed headers of a
+// request.
+type canonicalHeaders struct {
+	lines  string // "name:value\n" lines, sorted by name
+	signed string // names separated by ";"
+}
+
+// canonicalizeHeaders returns the canonical form of h: lowercase names,
+// with values joined by commas, trimmed, and with spaces collapsed.
+func canonicalizeHeaders(h http.Header) canonicalHeaders {
+	var names []string
+	values := make(map[string]string)
+	for k, vs := range h {
+		name := strings.ToLower(k)
+		var parts []string
+		for _, v := range vs {
+			parts = append(parts, strings.Join(strings.Fields(v), " "))
+		}
+		if prev, ok := values[name]; ok {
+			parts = append([]string{prev}, parts...)
+		} else {
+			names = append(names, name)
+		}
+		values[name] = strings.Join(parts, ",")
+	}
+	sort.Strings(names)
+	var lines strings.Builder
+	for _, name := range names {
+		lines.WriteString(name + ":" + values[name] + "\n")
+	}
+	return canonicalHeaders{lines: lines.String(), signed: strings.Join(names, ";")}
+}
+
+// canonicalRequest returns the canonical form of a request, which is
+// signed.
+func canonicalRequest(method, path string, query url.Values, headers canonicalHeaders, payload string) string {
+	return strings.Join([]string{
+		method,
+		path,
+		encodeQuery(query),
+		headers.lines,
+		headers.signed,
+		payload,
+	}, "\n")
+}
+
+// encodePath percent-encodes the segments of path, except for the
+// unreserved characters of RFC 3986.
+func encodePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+	}
+	return strings.Join(segments, "/")
+}
+
+// encodeQuery encodes query sorted by key, percent-encoding all but the
+// unreserved characters of RFC 3986.
+func encodeQuery(query url.Values) string {
+	return strings.Replace(query.Encode(), "+", "%20", -1)
+}
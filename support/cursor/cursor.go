@@ -0,0 +1,123 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package cursor stores the cursors of incremental syncs, such as the page
+// tokens of drive/v3 changes and the history IDs of gmail/v1 mailboxes, so
+// that a sync resumes where the previous one stopped.
+//
+// The sync helpers, such as those of the drivesync and gmailsync packages,
+// load a cursor from a Store before listing changes, and save the cursor of
+// the next sync once the changes were handled. Sync and Run implement the
+// loop they share: a sync resumes from the saved cursor, or starts over if
+// there is none or it has expired, and runs periodically, retrying transient
+// errors of the API.
+//
+// This is an EXPERIMENTAL package and may be changed or removed in the future.
+package cursor // import "google.golang.org/api/support/cursor"
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// A Store stores cursors by key. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	// Load returns the cursor saved for key, or "" if there is none.
+	Load(ctx context.Context, key string) (string, error)
+
+	// Save saves cursor for key, replacing the previous one.
+	Save(ctx context.Context, key, cursor string) error
+}
+
+var (
+	_ Store = (*MemoryStore)(nil)
+	_ Store = (*FileStore)(nil)
+)
+
+// MemoryStore is a Store that keeps cursors in memory.
+type MemoryStore struct {
+	mu      sync.Mutex
+	cursors map[string]string
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{cursors: make(map[string]string)}
+}
+
+// Load returns the cursor saved for key, or "" if there is none.
+func (s *MemoryStore) Load(ctx context.Context, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cursors[key], nil
+}
+
+// Save saves cursor for key.
+func (s *MemoryStore) Save(ctx context.Context, key, cursor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cursors[key] = cursor
+	return nil
+}
+
+// FileStore is a Store that keeps each cursor in a file in a directory. It
+// may be shared by the processes that use the directory.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore returns a FileStore that stores cursors in dir, creating it
+// if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// path returns the name of the file holding the cursor for key. Keys are
+// hashed, since they may contain any characters.
+func (s *FileStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
+
+// Load returns the cursor saved for key, or "" if there is none.
+func (s *FileStore) Load(ctx context.Context, key string) (string, error) {
+	b, err := ioutil.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Save saves cursor for key. The cursor is written to a temporary file that
+// then replaces the file for key, so that a crash never leaves a partial
+// cursor.
+func (s *FileStore) Save(ctx context.Context, key, cursor string) error {
+	f, err := ioutil.TempFile(s.dir, "tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(cursor)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.path(key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
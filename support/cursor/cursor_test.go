@@ -0,0 +1,69 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cursor
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+	if got, err := s.Load(ctx, "a"); err != nil || got != "" {
+		t.Errorf(`Load("a") = %q, %v, want ""`, got, err)
+	}
+	for _, c := range []string{"1", "22"} {
+		if err := s.Save(ctx, "a", c); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := s.Load(ctx, "a"); err != nil || got != c {
+			t.Errorf(`Load("a") = %q, %v, want %q`, got, err, c)
+		}
+	}
+	if err := s.Save(ctx, "b/c:d", "3"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Load(ctx, "b/c:d"); err != nil || got != "3" {
+		t.Errorf(`Load("b/c:d") = %q, %v, want "3"`, got, err)
+	}
+	if got, err := s.Load(ctx, "a"); err != nil || got != "22" {
+		t.Errorf(`Load("a") = %q, %v, want "22"`, got, err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cursor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+
+	// Another store on the same directory sees the saved cursors.
+	s2, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s2.Load(context.Background(), "a"); err != nil || got != "22" {
+		t.Errorf(`Load("a") = %q, %v, want "22"`, got, err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("got %d files, want 2 without temporary files", len(files))
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cursor
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/googleapi"
+)
+
+// MaxRetries is the number of times Run retries a sync that fails with a
+// retryable error before returning the error.
+const MaxRetries = 5
+
+// retryBackoff is the backoff between the retries of Run. Its pauses are
+// capped by the interval of Run.
+var retryBackoff = gax.Backoff{Initial: time.Second, Max: time.Minute, Multiplier: 2}
+
+// Sync runs an incremental sync from the cursor saved for key in store, by
+// calling incremental with it. If there is no cursor, or incremental fails
+// with an error for which expired reports true, Sync runs a full sync by
+// calling full instead. incremental and full save the cursor of the next
+// sync.
+func Sync(ctx context.Context, store Store, key string, incremental func(cursor string) error, full func() error, expired func(error) bool) error {
+	c, err := store.Load(ctx, key)
+	if err != nil {
+		return err
+	}
+	if c != "" {
+		err := incremental(c)
+		if err == nil || !expired(err) {
+			return err
+		}
+	}
+	return full()
+}
+
+// Run calls sync every interval until ctx is done, and returns the error of
+// ctx. If sync fails with a retryable error, a *googleapi.Error with status
+// 429 or 5xx, it is called again after a pause that grows exponentially, up
+// to MaxRetries times. Run returns the other errors, and the retryable
+// error of the last retry.
+func Run(ctx context.Context, interval time.Duration, sync func() error) error {
+	bo := retryBackoff
+	if bo.Max > interval {
+		bo.Max = interval
+	}
+	retries := 0
+	for {
+		pause := interval
+		if err := sync(); err != nil {
+			if !retryable(err) || retries == MaxRetries {
+				return err
+			}
+			retries++
+			pause = bo.Pause()
+		} else {
+			bo = retryBackoff
+			if bo.Max > interval {
+				bo.Max = interval
+			}
+			retries = 0
+		}
+		t := time.NewTimer(pause)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// retryable reports whether err is a transient error of an API.
+func retryable(err error) bool {
+	e, ok := err.(*googleapi.Error)
+	return ok && (e.Code == http.StatusTooManyRequests || e.Code >= 500)
+}
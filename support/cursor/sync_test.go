@@ -0,0 +1,119 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cursor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/googleapi"
+)
+
+func TestSync(t *testing.T) {
+	errExpired := errors.New("expired")
+	errOther := errors.New("other")
+	for _, test := range []struct {
+		cursor  string
+		incErr  error
+		wantErr error
+		want    string
+	}{
+		{cursor: "", want: "full"},
+		{cursor: "c", want: "incremental c"},
+		{cursor: "c", incErr: errExpired, want: "incremental c, full"},
+		{cursor: "c", incErr: errOther, wantErr: errOther, want: "incremental c"},
+	} {
+		ctx := context.Background()
+		store := NewMemoryStore()
+		if test.cursor != "" {
+			if err := store.Save(ctx, "k", test.cursor); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var calls []string
+		err := Sync(ctx, store, "k", func(c string) error {
+			calls = append(calls, "incremental "+c)
+			return test.incErr
+		}, func() error {
+			calls = append(calls, "full")
+			return nil
+		}, func(err error) bool { return err == errExpired })
+		if err != test.wantErr {
+			t.Errorf("cursor %q, incremental error %v: got error %v, want %v", test.cursor, test.incErr, err, test.wantErr)
+		}
+		if got := strings.Join(calls, ", "); got != test.want {
+			t.Errorf("cursor %q, incremental error %v: got calls %q, want %q", test.cursor, test.incErr, got, test.want)
+		}
+	}
+}
+
+func TestRunRetries(t *testing.T) {
+	defer func(bo gax.Backoff) { retryBackoff = bo }(retryBackoff)
+	retryBackoff = gax.Backoff{Initial: time.Millisecond, Max: time.Millisecond}
+
+	errFatal := errors.New("fatal")
+	errForbidden := &googleapi.Error{Code: 403}
+	for _, test := range []struct {
+		errs      []error
+		wantErr   error
+		wantCalls int
+	}{
+		// Transient errors are retried, and a success resets the retries.
+		{
+			errs:      []error{&googleapi.Error{Code: 503}, &googleapi.Error{Code: 429}, nil, &googleapi.Error{Code: 500}, errFatal},
+			wantErr:   errFatal,
+			wantCalls: 5,
+		},
+		// Other errors are returned at once.
+		{
+			errs:      []error{errForbidden},
+			wantErr:   errForbidden,
+			wantCalls: 1,
+		},
+	} {
+		calls := 0
+		err := Run(context.Background(), time.Millisecond, func() error {
+			err := test.errs[calls]
+			calls++
+			return err
+		})
+		if err != test.wantErr {
+			t.Errorf("got error %v, want %v", err, test.wantErr)
+		}
+		if calls != test.wantCalls {
+			t.Errorf("got %d calls, want %d", calls, test.wantCalls)
+		}
+	}
+
+	// A transient error is returned once the retries are exhausted.
+	calls := 0
+	err := Run(context.Background(), time.Millisecond, func() error {
+		calls++
+		return &googleapi.Error{Code: 502}
+	})
+	if e, ok := err.(*googleapi.Error); !ok || e.Code != 502 {
+		t.Errorf("got error %v, want the 502 error", err)
+	}
+	if calls != MaxRetries+1 {
+		t.Errorf("got %d calls, want %d", calls, MaxRetries+1)
+	}
+}
+
+func TestRunCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := Run(ctx, time.Hour, func() error {
+		calls++
+		cancel()
+		return nil
+	})
+	if err != context.Canceled || calls != 1 {
+		t.Errorf("got %v after %d calls, want %v after 1", err, calls, context.Canceled)
+	}
+}
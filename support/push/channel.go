@@ -0,0 +1,148 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package push manages the push notification channels of the APIs that
+// watch resources, such as drive/v3, calendar/v3 and admin/directory/v1,
+// and receives their notifications.
+//
+// A Manager creates a channel with the Watch call of an API, renews it
+// before it expires, and stops it with the Stop call of the API's
+// ChannelsService. The channel types of the APIs are converted to and from
+// Channel by ChannelFrom and Channel.CopyTo:
+//
+//	m := &push.Manager{
+//		Address: "https://example.com/notifications",
+//		Watch: func(ctx context.Context, c *push.Channel) (*push.Channel, error) {
+//			var dc drive.Channel
+//			if err := c.CopyTo(&dc); err != nil {
+//				return nil, err
+//			}
+//			res, err := svc.Files.Watch(fileID, &dc).Context(ctx).Do()
+//			if err != nil {
+//				return nil, err
+//			}
+//			return push.ChannelFrom(res)
+//		},
+//		Stop: func(ctx context.Context, c *push.Channel) error {
+//			var dc drive.Channel
+//			if err := c.CopyTo(&dc); err != nil {
+//				return err
+//			}
+//			return svc.Channels.Stop(&dc).Context(ctx).Do()
+//		},
+//	}
+//	http.Handle("/notifications", &push.Handler{
+//		Channels: m,
+//		Handle: func(ctx context.Context, n *push.Notification) error {
+//			...
+//		},
+//	})
+//	go m.Run(ctx)
+//
+// This is an EXPERIMENTAL package and may be changed or removed in the future.
+package push // import "google.golang.org/api/support/push"
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// A Channel is a push notification channel.
+type Channel struct {
+	// ID is the ID of the channel, unique for the project.
+	ID string
+
+	// Token is sent with each notification of the channel, to verify that
+	// the notification comes from the API.
+	Token string
+
+	// Address is the HTTPS URL the notifications are sent to.
+	Address string
+
+	// Expiration is the time the channel expires, or zero if it does not.
+	Expiration time.Time
+
+	// Params are the parameters of the delivery method, such as "ttl".
+	Params map[string]string
+
+	// ResourceID and ResourceURI identify the watched resource. They are
+	// set by the API.
+	ResourceID  string
+	ResourceURI string
+}
+
+// apiChannel has the JSON form of the Channel types of the APIs.
+type apiChannel struct {
+	Address     string            `json:"address,omitempty"`
+	Expiration  int64             `json:"expiration,omitempty,string"`
+	ID          string            `json:"id,omitempty"`
+	Params      map[string]string `json:"params,omitempty"`
+	ResourceID  string            `json:"resourceId,omitempty"`
+	ResourceURI string            `json:"resourceUri,omitempty"`
+	Token       string            `json:"token,omitempty"`
+	Type        string            `json:"type,omitempty"`
+}
+
+// ChannelFrom returns the Channel of src, a channel of an API such as a
+// *drive.Channel.
+func ChannelFrom(src interface{}) (*Channel, error) {
+	b, err := json.Marshal(src)
+	if err != nil {
+		return nil, fmt.Errorf("push: converting %T: %v", src, err)
+	}
+	var ac apiChannel
+	if err := json.Unmarshal(b, &ac); err != nil {
+		return nil, fmt.Errorf("push: converting %T: %v", src, err)
+	}
+	c := &Channel{
+		ID:          ac.ID,
+		Token:       ac.Token,
+		Address:     ac.Address,
+		Params:      ac.Params,
+		ResourceID:  ac.ResourceID,
+		ResourceURI: ac.ResourceURI,
+	}
+	if ac.Expiration != 0 {
+		c.Expiration = time.Unix(0, ac.Expiration*int64(time.Millisecond))
+	}
+	return c, nil
+}
+
+// CopyTo sets the fields of dst, a pointer to a channel of an API such as a
+// *drive.Channel, to those of c, with the "web_hook" type.
+func (c *Channel) CopyTo(dst interface{}) error {
+	ac := apiChannel{
+		Address:     c.Address,
+		ID:          c.ID,
+		Params:      c.Params,
+		ResourceID:  c.ResourceID,
+		ResourceURI: c.ResourceURI,
+		Token:       c.Token,
+		Type:        "web_hook",
+	}
+	if !c.Expiration.IsZero() {
+		ac.Expiration = c.Expiration.UnixNano() / int64(time.Millisecond)
+	}
+	b, err := json.Marshal(ac)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, dst); err != nil {
+		return fmt.Errorf("push: converting to %T: %v", dst, err)
+	}
+	return nil
+}
+
+// randomID returns a random string of 32 hexadecimal digits, suitable for
+// the IDs and tokens of channels.
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,225 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package push
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A State is the state of a resource given by a notification.
+type State string
+
+// The states of the notifications of the APIs. Other APIs, such as
+// admin/directory/v1, use their own states.
+const (
+	// Sync is the state of the first notification of a channel, sent when
+	// it is created.
+	Sync State = "sync"
+
+	// The states of notifications about a single resource.
+	Exists    State = "exists"
+	NotExists State = "not_exists"
+
+	// The states of notifications about a collection of resources.
+	Add     State = "add"
+	Remove  State = "remove"
+	Update  State = "update"
+	Trash   State = "trash"
+	Untrash State = "untrash"
+	Change  State = "change"
+)
+
+// A Notification is a notification received on a channel.
+type Notification struct {
+	// Channel is the channel the notification was received on.
+	Channel *Channel
+
+	// State is the state of the resource.
+	State State
+
+	// MessageNumber is the number of the notification on its channel. The
+	// "sync" notification has number 1, and the numbers of the following
+	// notifications increase, but not necessarily by one.
+	MessageNumber int64
+
+	// ResourceID and ResourceURI identify the resource.
+	ResourceID  string
+	ResourceURI string
+
+	// Changed lists what changed about the resource, such as "content" or
+	// "permissions", for the APIs that give it.
+	Changed []string
+
+	// Expiration is the time the channel expires, or zero if it does not.
+	Expiration time.Time
+
+	// Body is the body of the notification, for the APIs that send one.
+	Body []byte
+}
+
+// A ChannelSet returns the channels whose notifications are accepted by a
+// Handler. It is implemented by Manager.
+type ChannelSet interface {
+	Lookup(id string) (*Channel, bool)
+}
+
+// maxBodySize is the maximum size of the body of a notification.
+const maxBodySize = 1 << 20
+
+// recentNumbers is the number of the message numbers of the last handled
+// notifications that are remembered for each channel, to recognize the
+// notifications that are delivered again.
+const recentNumbers = 64
+
+// A Handler receives the notifications of channels. It checks that each
+// notification has the ID and token of one of its channels, and a message
+// number and state, and ignores the notifications it has already handled.
+//
+// A Handler responds with 400 Bad Request to malformed notifications, 404
+// Not Found to notifications of unknown channels, 403 Forbidden to
+// notifications with the wrong token, and 500 Internal Server Error if Handle
+// fails, which makes the API send the notification again later.
+type Handler struct {
+	// Channels are the channels whose notifications are accepted.
+	Channels ChannelSet
+
+	// Handle handles a notification. It is called concurrently for the
+	// notifications received concurrently.
+	Handle func(ctx context.Context, n *Notification) error
+
+	mu      sync.Mutex
+	handled map[string][]int64 // by channel ID, the last handled message numbers
+}
+
+// seen reports whether the notification with the given number was handled.
+func (h *Handler) seen(id string, number int64) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, n := range h.handled[id] {
+		if n == number {
+			return true
+		}
+	}
+	return false
+}
+
+// markHandled remembers that the notification with the given number was
+// handled. The first time a channel has a notification handled, the numbers
+// of the channels that Channels no longer returns, such as renewed channels,
+// are forgotten.
+func (h *Handler) markHandled(id string, number int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.handled == nil {
+		h.handled = make(map[string][]int64)
+	}
+	if _, ok := h.handled[id]; !ok {
+		for old := range h.handled {
+			if _, ok := h.Channels.Lookup(old); !ok {
+				delete(h.handled, old)
+			}
+		}
+	}
+	ns := append(h.handled[id], number)
+	if len(ns) > recentNumbers {
+		ns = ns[len(ns)-recentNumbers:]
+	}
+	h.handled[id] = ns
+}
+
+// ServeHTTP handles a notification.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	n, err := parseNotification(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id := r.Header.Get("X-Goog-Channel-Id")
+	c, ok := h.Channels.Lookup(id)
+	if !ok {
+		http.Error(w, "unknown channel", http.StatusNotFound)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Goog-Channel-Token")), []byte(c.Token)) != 1 {
+		http.Error(w, "invalid channel token", http.StatusForbidden)
+		return
+	}
+	n.Channel = c
+	if h.seen(id, n.MessageNumber) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	n.Body, err = ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.Handle(r.Context(), n); err != nil {
+		http.Error(w, "handling notification failed", http.StatusInternalServerError)
+		return
+	}
+	h.markHandled(id, n.MessageNumber)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseNotification parses the headers of a notification.
+func parseNotification(r *http.Request) (*Notification, error) {
+	if r.Header.Get("X-Goog-Channel-Id") == "" {
+		return nil, fmt.Errorf("missing X-Goog-Channel-ID header")
+	}
+	state := r.Header.Get("X-Goog-Resource-State")
+	if !validState(state) {
+		return nil, fmt.Errorf("invalid X-Goog-Resource-State header %q", state)
+	}
+	number, err := strconv.ParseInt(r.Header.Get("X-Goog-Message-Number"), 10, 64)
+	if err != nil || number < 1 {
+		return nil, fmt.Errorf("invalid X-Goog-Message-Number header %q", r.Header.Get("X-Goog-Message-Number"))
+	}
+	n := &Notification{
+		State:         State(state),
+		MessageNumber: number,
+		ResourceID:    r.Header.Get("X-Goog-Resource-Id"),
+		ResourceURI:   r.Header.Get("X-Goog-Resource-Uri"),
+	}
+	if changed := r.Header.Get("X-Goog-Changed"); changed != "" {
+		for _, c := range strings.Split(changed, ",") {
+			n.Changed = append(n.Changed, strings.TrimSpace(c))
+		}
+	}
+	if exp := r.Header.Get("X-Goog-Channel-Expiration"); exp != "" {
+		t, err := http.ParseTime(exp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid X-Goog-Channel-Expiration header %q", exp)
+		}
+		n.Expiration = t
+	}
+	return n, nil
+}
+
+// validState reports whether s is a state: a non-empty word of letters and
+// underscores.
+func validState(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,131 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package push
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func notification(number, state string) *http.Request {
+	r := httptest.NewRequest("POST", "/n", strings.NewReader(`{"kind": "admin#directory#user"}`))
+	r.Header.Set("X-Goog-Channel-ID", "c1")
+	r.Header.Set("X-Goog-Channel-Token", "secret")
+	r.Header.Set("X-Goog-Channel-Expiration", "Fri, 01 May 2020 12:00:00 GMT")
+	r.Header.Set("X-Goog-Resource-ID", "r1")
+	r.Header.Set("X-Goog-Resource-URI", "https://www.googleapis.com/drive/v3/files/f1")
+	r.Header.Set("X-Goog-Resource-State", state)
+	r.Header.Set("X-Goog-Message-Number", number)
+	r.Header.Set("X-Goog-Changed", "content, properties")
+	return r
+}
+
+func TestHandler(t *testing.T) {
+	m := &Manager{}
+	c := &Channel{ID: "c1", Token: "secret"}
+	m.Add(c)
+	var got []*Notification
+	fail := false
+	h := &Handler{
+		Channels: m,
+		Handle: func(ctx context.Context, n *Notification) error {
+			if fail {
+				return errors.New("failed")
+			}
+			got = append(got, n)
+			return nil
+		},
+	}
+	serve := func(r *http.Request) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := serve(notification("1", "sync")); code != http.StatusNoContent {
+		t.Errorf("got status %d for the sync notification", code)
+	}
+	want := &Notification{
+		Channel:       c,
+		State:         Sync,
+		MessageNumber: 1,
+		ResourceID:    "r1",
+		ResourceURI:   "https://www.googleapis.com/drive/v3/files/f1",
+		Changed:       []string{"content", "properties"},
+		Expiration:    time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC),
+		Body:          []byte(`{"kind": "admin#directory#user"}`),
+	}
+	if diff := cmp.Diff([]*Notification{want}, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	fail = true
+	if code := serve(notification("5", "update")); code != http.StatusInternalServerError {
+		t.Errorf("got status %d for a failed notification", code)
+	}
+	fail = false
+	if code := serve(notification("5", "update")); code != http.StatusNoContent {
+		t.Errorf("got status %d for a notification delivered again", code)
+	}
+	if code := serve(notification("5", "update")); code != http.StatusNoContent {
+		t.Errorf("got status %d for a handled notification", code)
+	}
+	if len(got) != 2 || got[1].State != Update || got[1].MessageNumber != 5 {
+		t.Errorf("got notifications %+v, want the sync and one update", got)
+	}
+
+	for _, test := range []struct {
+		modify func(*http.Request)
+		want   int
+	}{
+		{func(r *http.Request) { r.Method = "GET" }, http.StatusMethodNotAllowed},
+		{func(r *http.Request) { r.Header.Del("X-Goog-Channel-ID") }, http.StatusBadRequest},
+		{func(r *http.Request) { r.Header.Set("X-Goog-Resource-State", "") }, http.StatusBadRequest},
+		{func(r *http.Request) { r.Header.Set("X-Goog-Resource-State", "a b") }, http.StatusBadRequest},
+		{func(r *http.Request) { r.Header.Set("X-Goog-Message-Number", "x") }, http.StatusBadRequest},
+		{func(r *http.Request) { r.Header.Set("X-Goog-Message-Number", "0") }, http.StatusBadRequest},
+		{func(r *http.Request) { r.Header.Set("X-Goog-Channel-Expiration", "soon") }, http.StatusBadRequest},
+		{func(r *http.Request) { r.Header.Set("X-Goog-Channel-ID", "c2") }, http.StatusNotFound},
+		{func(r *http.Request) { r.Header.Set("X-Goog-Channel-Token", "guess") }, http.StatusForbidden},
+		{func(r *http.Request) { r.Header.Del("X-Goog-Channel-Token") }, http.StatusForbidden},
+	} {
+		r := notification("9", "exists")
+		test.modify(r)
+		if code := serve(r); code != test.want {
+			t.Errorf("got status %d, want %d", code, test.want)
+		}
+	}
+	if len(got) != 2 {
+		t.Errorf("got %d notifications, want 2", len(got))
+	}
+}
+
+func TestHandlerForgetsChannels(t *testing.T) {
+	m := &Manager{}
+	m.Add(&Channel{ID: "c1", Token: "secret"})
+	h := &Handler{
+		Channels: m,
+		Handle:   func(context.Context, *Notification) error { return nil },
+	}
+	h.ServeHTTP(httptest.NewRecorder(), notification("1", "sync"))
+
+	// c1 is renewed by c2.
+	m.remove("c1")
+	m.Add(&Channel{ID: "c2", Token: "secret"})
+	r := notification("1", "sync")
+	r.Header.Set("X-Goog-Channel-ID", "c2")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if _, ok := h.handled["c1"]; ok || len(h.handled) != 1 {
+		t.Errorf("got handled numbers %v, want only those of c2", h.handled)
+	}
+}
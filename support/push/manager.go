@@ -0,0 +1,213 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package push
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+)
+
+// A Manager keeps a channel watching a resource open, by renewing it before
+// it expires. It is safe for concurrent use.
+type Manager struct {
+	// Address is the HTTPS URL the notifications are sent to.
+	Address string
+
+	// TTL is the requested lifetime of the channels. If it is zero, the
+	// API default is used. APIs may limit the lifetime of channels.
+	TTL time.Duration
+
+	// RenewBefore is how long before a channel expires it is renewed. If
+	// it is zero, channels are renewed when a tenth of their lifetime is
+	// left.
+	RenewBefore time.Duration
+
+	// Watch creates c with the Watch call of an API, and returns the
+	// created channel.
+	Watch func(ctx context.Context, c *Channel) (*Channel, error)
+
+	// Stop stops c with the Stop call of the API's ChannelsService.
+	Stop func(ctx context.Context, c *Channel) error
+
+	// Backoff is the backoff between the retries of failed renewals.
+	Backoff gax.Backoff
+
+	mu       sync.Mutex
+	channels map[string]*Channel // by ID
+}
+
+// Add adds c to the channels of m, so that their notifications are
+// accepted by a Handler, for instance after a restart.
+func (m *Manager) Add(c *Channel) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.channels == nil {
+		m.channels = make(map[string]*Channel)
+	}
+	m.channels[c.ID] = c
+}
+
+func (m *Manager) remove(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.channels, id)
+}
+
+// Lookup returns the channel of m with the given ID, if any.
+func (m *Manager) Lookup(id string) (*Channel, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.channels[id]
+	return c, ok
+}
+
+// Channels returns the open channels of m.
+func (m *Manager) Channels() []*Channel {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var cs []*Channel
+	for _, c := range m.channels {
+		cs = append(cs, c)
+	}
+	return cs
+}
+
+// Start creates a channel with a random ID and token, and adds it to the
+// channels of m. The channel is added before it is created, so that the
+// "sync" notification that the API sends when it creates the channel is
+// accepted.
+func (m *Manager) Start(ctx context.Context) (*Channel, error) {
+	if m.Watch == nil {
+		return nil, errors.New("push: Manager has no Watch function")
+	}
+	id, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	token, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	c := &Channel{ID: id, Token: token, Address: m.Address}
+	if m.TTL > 0 {
+		c.Params = map[string]string{"ttl": strconv.FormatInt(int64(m.TTL/time.Second), 10)}
+	}
+	m.Add(c)
+	created, err := m.Watch(ctx, c)
+	if err != nil {
+		m.remove(id)
+		return nil, err
+	}
+	// The API does not return the token and address.
+	created.ID = id
+	created.Token = token
+	created.Address = m.Address
+	m.Add(created)
+	return created, nil
+}
+
+// StopChannel stops c and removes it from the channels of m.
+func (m *Manager) StopChannel(ctx context.Context, c *Channel) error {
+	if m.Stop == nil {
+		return errors.New("push: Manager has no Stop function")
+	}
+	if err := m.Stop(ctx, c); err != nil {
+		return err
+	}
+	m.remove(c.ID)
+	return nil
+}
+
+// Renew replaces c by a new channel. The new channel is created before c is
+// stopped, so that no notification is missed, but notifications may be
+// received from both channels in between. c is removed from the channels
+// of m even if stopping it fails, as it expires anyway; Renew then returns
+// the new channel and the error.
+func (m *Manager) Renew(ctx context.Context, c *Channel) (*Channel, error) {
+	created, err := m.Start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = m.StopChannel(ctx, c)
+	m.remove(c.ID)
+	return created, err
+}
+
+// StopAll stops all the channels of m.
+func (m *Manager) StopAll(ctx context.Context) error {
+	var firstErr error
+	for _, c := range m.Channels() {
+		if err := m.StopChannel(ctx, c); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// renewAt returns the time c must be renewed, or zero if it does not
+// expire.
+func (m *Manager) renewAt(c *Channel, created time.Time) time.Time {
+	if c.Expiration.IsZero() {
+		return time.Time{}
+	}
+	before := m.RenewBefore
+	if before == 0 {
+		before = c.Expiration.Sub(created) / 10
+	}
+	return c.Expiration.Add(-before)
+}
+
+// Run starts a channel and renews it until ctx is done, then returns
+// ctx.Err(). Failed renewals are retried until the channel expires; Run
+// then returns the error of the last renewal. Run does not stop the
+// channels when it returns: StopAll does.
+func (m *Manager) Run(ctx context.Context) error {
+	c, err := m.Start(ctx)
+	if err != nil {
+		return err
+	}
+	created := time.Now()
+	for {
+		at := m.renewAt(c, created)
+		if at.IsZero() {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		if err := sleep(ctx, time.Until(at)); err != nil {
+			return err
+		}
+		bo := m.Backoff
+		for {
+			nc, err := m.Renew(ctx, c)
+			if nc != nil {
+				c, created = nc, time.Now()
+				break
+			}
+			if time.Now().After(c.Expiration) {
+				return err
+			}
+			if err := sleep(ctx, bo.Pause()); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	drive "google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+func TestChannelConversion(t *testing.T) {
+	c := &Channel{
+		ID:          "id",
+		Token:       "token",
+		Address:     "https://example.com/n",
+		Expiration:  time.Unix(1588334400, 123e6),
+		Params:      map[string]string{"ttl": "60"},
+		ResourceID:  "r",
+		ResourceURI: "https://example.com/r",
+	}
+	var dc drive.Channel
+	if err := c.CopyTo(&dc); err != nil {
+		t.Fatal(err)
+	}
+	want := drive.Channel{
+		Id:          "id",
+		Token:       "token",
+		Address:     "https://example.com/n",
+		Expiration:  1588334400123,
+		Params:      map[string]string{"ttl": "60"},
+		ResourceId:  "r",
+		ResourceUri: "https://example.com/r",
+		Type:        "web_hook",
+	}
+	if diff := cmp.Diff(want, dc); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	got, err := ChannelFrom(&dc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(c, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if err := c.CopyTo(&[]int{}); err == nil {
+		t.Error("got nil error converting to a slice")
+	}
+}
+
+// fakeWatch serves the Watch and Stop calls of drive/v3, creating channels
+// that expire after lifetime.
+type fakeWatch struct {
+	t        *testing.T
+	lifetime time.Duration
+
+	mu      sync.Mutex
+	watched []drive.Channel
+	stopped []string
+	fail    bool
+}
+
+func (f *fakeWatch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var c drive.Channel
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		f.t.Error(err)
+	}
+	switch r.URL.Path {
+	case "/drive/v3/files/f1/watch":
+		if f.fail {
+			http.Error(w, `{"error": {"code": 503, "message": "unavailable"}}`, http.StatusServiceUnavailable)
+			return
+		}
+		f.watched = append(f.watched, c)
+		exp := time.Now().Add(f.lifetime).UnixNano() / 1e6
+		fmt.Fprintf(w, `{"kind": "api#channel", "id": %q, "resourceId": "r1", "resourceUri": "https://www.googleapis.com/drive/v3/files/f1", "expiration": "%d"}`, c.Id, exp)
+	case "/drive/v3/channels/stop":
+		if c.ResourceId != "r1" {
+			f.t.Errorf("got resource ID %q, want r1", c.ResourceId)
+		}
+		f.stopped = append(f.stopped, c.Id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		f.t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		http.Error(w, "unexpected", http.StatusBadRequest)
+	}
+}
+
+func newManager(t *testing.T, f *fakeWatch) (*Manager, func()) {
+	srv := httptest.NewServer(f)
+	svc, err := drive.NewService(context.Background(), option.WithHTTPClient(http.DefaultClient), option.WithEndpoint(srv.URL+"/drive/v3/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Manager{
+		Address: "https://example.com/n",
+		TTL:     time.Hour,
+		Watch: func(ctx context.Context, c *Channel) (*Channel, error) {
+			var dc drive.Channel
+			if err := c.CopyTo(&dc); err != nil {
+				return nil, err
+			}
+			res, err := svc.Files.Watch("f1", &dc).Context(ctx).Do()
+			if err != nil {
+				return nil, err
+			}
+			return ChannelFrom(res)
+		},
+		Stop: func(ctx context.Context, c *Channel) error {
+			var dc drive.Channel
+			if err := c.CopyTo(&dc); err != nil {
+				return err
+			}
+			return svc.Channels.Stop(&dc).Context(ctx).Do()
+		},
+	}
+	return m, srv.Close
+}
+
+func TestManager(t *testing.T) {
+	f := &fakeWatch{t: t, lifetime: time.Hour}
+	m, done := newManager(t, f)
+	defer done()
+	ctx := context.Background()
+
+	c1, err := m.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c1.ID) != 32 || len(c1.Token) != 32 || c1.Address != m.Address || c1.ResourceID != "r1" || c1.Expiration.IsZero() {
+		t.Errorf("got channel %+v", c1)
+	}
+	if w := f.watched[0]; w.Id != c1.ID || w.Token != c1.Token || w.Type != "web_hook" || w.Params["ttl"] != "3600" {
+		t.Errorf("watched channel %+v", w)
+	}
+	if got, ok := m.Lookup(c1.ID); !ok || got != c1 {
+		t.Errorf("Lookup(%q) = %v, %t", c1.ID, got, ok)
+	}
+
+	c2, err := m.Renew(ctx, c1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c2.ID == c1.ID || c2.Token == c1.Token {
+		t.Errorf("renewed channel has the ID or token of the old one")
+	}
+	if _, ok := m.Lookup(c1.ID); ok {
+		t.Error("Lookup found the renewed channel")
+	}
+	if diff := cmp.Diff([]string{c1.ID}, f.stopped); diff != "" {
+		t.Errorf("stopped channels mismatch (-want +got):\n%s", diff)
+	}
+
+	f.fail = true
+	if _, err := m.Start(ctx); err == nil {
+		t.Error("got nil error for a failed watch")
+	}
+	if got := m.Channels(); len(got) != 1 || got[0] != c2 {
+		t.Errorf("got channels %v, want only the renewed one", got)
+	}
+
+	if err := m.StopAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Channels()) != 0 || len(f.stopped) != 2 {
+		t.Errorf("got channels %v and stopped %v after StopAll", m.Channels(), f.stopped)
+	}
+
+	// A channel that cannot be stopped is removed when it is renewed.
+	f.fail = false
+	c3, err := m.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Stop = func(context.Context, *Channel) error { return errors.New("stop failed") }
+	c4, err := m.Renew(ctx, c3)
+	if err == nil || c4 == nil {
+		t.Fatalf("Renew = %v, %v, want the new channel and an error", c4, err)
+	}
+	if got := m.Channels(); len(got) != 1 || got[0] != c4 {
+		t.Errorf("got channels %v, want only the renewed one", got)
+	}
+}
+
+func TestManagerRun(t *testing.T) {
+	f := &fakeWatch{t: t, lifetime: 100 * time.Millisecond}
+	m, done := newManager(t, f)
+	defer done()
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- m.Run(ctx) }()
+	for {
+		time.Sleep(10 * time.Millisecond)
+		f.mu.Lock()
+		n := len(f.stopped)
+		f.mu.Unlock()
+		if n >= 2 {
+			break
+		}
+	}
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// Each channel was renewed before it expired, and only the last one
+	// is still open.
+	if len(f.watched) != len(f.stopped)+1 {
+		t.Errorf("watched %d channels and stopped %d", len(f.watched), len(f.stopped))
+	}
+	if got := m.Channels(); len(got) != 1 || got[0].ID != f.watched[len(f.watched)-1].Id {
+		t.Errorf("got channels %v, want the last watched one", got)
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package grpc
+
+import (
+	"context"
+
+	"google.golang.org/api/internal"
+	"google.golang.org/grpc"
+)
+
+// rateLimitInterceptors returns dial options installing interceptors that wait
+// for l before each call, as described by option.WithRateLimiter. Stream calls
+// wait before the stream is created, and only the error creating it is
+// reported to l.
+func rateLimitInterceptors(l internal.RateLimiter) []grpc.DialOption {
+	unary := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := l.Wait(ctx, method); err != nil {
+			return err
+		}
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		l.Observe(method, err)
+		return err
+	}
+	stream := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if err := l.Wait(ctx, method); err != nil {
+			return nil, err
+		}
+		s, err := streamer(ctx, desc, cc, method, opts...)
+		l.Observe(method, err)
+		return s, err
+	}
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(unary),
+		grpc.WithChainStreamInterceptor(stream),
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package grpc
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// recordingLimiter is an option.RateLimiter that records its calls.
+type recordingLimiter struct {
+	mu       sync.Mutex
+	waits    []string
+	observed []error
+}
+
+func (l *recordingLimiter) Wait(ctx context.Context, method string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.waits = append(l.waits, method)
+	return nil
+}
+
+func (l *recordingLimiter) Observe(method string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.observed = append(l.observed, err)
+}
+
+func TestRateLimiter(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	l := &recordingLimiter{}
+	conn, err := DialInsecure(context.Background(),
+		option.WithEndpoint(lis.Addr().String()),
+		option.WithoutAuthentication(),
+		option.WithRateLimiter(l))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+	if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "unknown"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("got %v, want NotFound", err)
+	}
+
+	const method = "/grpc.health.v1.Health/Check"
+	if len(l.waits) != 2 || l.waits[0] != method || l.waits[1] != method {
+		t.Errorf("got waits %q, want %q twice", l.waits, method)
+	}
+	if len(l.observed) != 2 || l.observed[0] != nil || status.Code(l.observed[1]) != codes.NotFound {
+		t.Errorf("got observed errors %v, want [nil, NotFound]", l.observed)
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/internal"
+)
+
+// Headers added to stored responses. They are removed from the responses
+// returned to callers.
+const (
+	storedAtHeader = "X-Googleapi-Cache-Stored-At" // time the response was stored or revalidated
+	variedPrefix   = "X-Googleapi-Cache-Varied-"   // request headers named by Vary
+)
+
+// cachingTransport is an http.RoundTripper that stores the responses to GET
+// requests in an internal.HTTPCache, as described by option.WithHTTPCache.
+type cachingTransport struct {
+	base  http.RoundTripper
+	cache internal.HTTPCache
+	scope string // identifies the credentials used by base
+	now   func() time.Time
+}
+
+func newCachingTransport(base http.RoundTripper, settings *internal.DialSettings, creds *google.Credentials) *cachingTransport {
+	return &cachingTransport{
+		base:  base,
+		cache: settings.HTTPCache,
+		scope: cacheScope(settings, creds),
+		now:   time.Now,
+	}
+}
+
+// cacheScope returns a string identifying the credentials and other settings
+// that may affect the responses to requests made with settings and creds.
+// Responses are only reused for requests with the same scope.
+func cacheScope(settings *internal.DialSettings, creds *google.Credentials) string {
+	h := sha256.New()
+	switch {
+	case settings.NoAuth:
+		io.WriteString(h, "none")
+	case settings.APIKey != "":
+		fmt.Fprintf(h, "key %s", settings.APIKey)
+	case creds != nil && len(creds.JSON) > 0:
+		fmt.Fprintf(h, "json %s", creds.JSON)
+	case creds != nil && settings.TokenSource == nil && settings.Credentials == nil:
+		// Default credentials without JSON, from the metadata server.
+		fmt.Fprintf(h, "default %s", creds.ProjectID)
+	case creds != nil && reflect.ValueOf(creds.TokenSource).Kind() == reflect.Ptr:
+		fmt.Fprintf(h, "token source %p", creds.TokenSource)
+	default:
+		// There is no way to identify the credentials, so don't share the
+		// cache with any other transport.
+		var nonce [16]byte
+		rand.Read(nonce[:])
+		fmt.Fprintf(h, "unknown %x", nonce)
+	}
+	fmt.Fprintf(h, "\x00%q\x00%q\x00%s\x00%s", settings.Scopes, settings.Audiences, settings.QuotaProject, settings.UserAgent)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (t *cachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := t.scope + " " + req.URL.String()
+	if req.Method == "HEAD" {
+		return t.base.RoundTrip(req)
+	}
+	if req.Method != "GET" {
+		// Other requests may change the resource.
+		resp, err := t.base.RoundTrip(req)
+		t.cache.Delete(key)
+		return resp, err
+	}
+	if req.Header.Get("Range") != "" || hasDirective(req.Header, "no-store") {
+		return t.base.RoundTrip(req)
+	}
+	callerETag := req.Header.Get("If-None-Match")
+	cached, storedAt := t.load(key, req)
+	if cached != nil && callerETag == "" && !hasDirective(req.Header, "no-cache") && t.fresh(cached, storedAt) {
+		return cached, nil
+	}
+
+	outReq := req
+	if cached != nil && callerETag == "" {
+		if etag := cached.Header.Get("Etag"); etag != "" {
+			outReq = cloneRequest(req)
+			outReq.Header.Set("If-None-Match", etag)
+		} else {
+			cached = nil
+		}
+	}
+	resp, err := t.base.RoundTrip(outReq)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil && outReq != req:
+		// The cached response is still valid: refresh its headers and
+		// return it in place of the 304.
+		resp.Body.Close()
+		for k, v := range resp.Header {
+			if k != "Content-Length" {
+				cached.Header[k] = v
+			}
+		}
+		body, err := ioutil.ReadAll(cached.Body)
+		if err != nil {
+			return nil, err
+		}
+		t.store(key, req, cached, body)
+		cached.Body = ioutil.NopCloser(bytes.NewReader(body))
+		return cached, nil
+	case resp.StatusCode == http.StatusOK && t.storable(req, resp):
+		resp.Body = &cachingBody{ReadCloser: resp.Body, done: func(body []byte) {
+			t.store(key, req, resp, body)
+		}}
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		t.cache.Delete(key)
+	}
+	return resp, nil
+}
+
+// storable reports whether resp, the response to req, may be stored.
+func (t *cachingTransport) storable(req *http.Request, resp *http.Response) bool {
+	if hasDirective(resp.Header, "no-store") || resp.Header.Get("Vary") == "*" {
+		return false
+	}
+	return resp.Header.Get("Etag") != "" || t.lifetime(resp.Header) > 0
+}
+
+// store stores resp, the response to req, with the given body.
+func (t *cachingTransport) store(key string, req *http.Request, resp *http.Response, body []byte) {
+	h := make(http.Header, len(resp.Header)+2)
+	for k, v := range resp.Header {
+		h[k] = v
+	}
+	h.Set(storedAtHeader, strconv.FormatInt(t.now().UnixNano(), 10))
+	for _, name := range varyHeaders(resp.Header) {
+		h.Set(variedPrefix+name, req.Header.Get(name))
+	}
+	stored := &http.Response{
+		Status:        resp.Status,
+		StatusCode:    resp.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+	var buf bytes.Buffer
+	if err := stored.Write(&buf); err != nil {
+		return
+	}
+	t.cache.Set(key, buf.Bytes())
+}
+
+// load returns the response stored for key and the time it was stored, or
+// nil if there is none or it varies with headers whose values in req differ.
+func (t *cachingTransport) load(key string, req *http.Request) (*http.Response, time.Time) {
+	b, ok := t.cache.Get(key)
+	if !ok {
+		return nil, time.Time{}
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(b)), req)
+	if err != nil {
+		t.cache.Delete(key)
+		return nil, time.Time{}
+	}
+	for _, name := range varyHeaders(resp.Header) {
+		if resp.Header.Get(variedPrefix+name) != req.Header.Get(name) {
+			return nil, time.Time{}
+		}
+		resp.Header.Del(variedPrefix + name)
+	}
+	var storedAt time.Time
+	if n, err := strconv.ParseInt(resp.Header.Get(storedAtHeader), 10, 64); err == nil {
+		storedAt = time.Unix(0, n)
+	}
+	resp.Header.Del(storedAtHeader)
+	return resp, storedAt
+}
+
+// fresh reports whether resp, stored at storedAt, may be returned without
+// revalidating it.
+func (t *cachingTransport) fresh(resp *http.Response, storedAt time.Time) bool {
+	lifetime := t.lifetime(resp.Header)
+	if lifetime <= 0 || storedAt.IsZero() {
+		return false
+	}
+	return t.now().Sub(storedAt) < lifetime
+}
+
+// lifetime returns the time for which a response with headers h is fresh,
+// from its Cache-Control max-age directive or its Expires header.
+func (t *cachingTransport) lifetime(h http.Header) time.Duration {
+	if hasDirective(h, "no-cache") {
+		return 0
+	}
+	var lifetime time.Duration
+	if v, ok := directive(h, "max-age"); ok {
+		secs, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0
+		}
+		lifetime = time.Duration(secs) * time.Second
+	} else if h.Get("Expires") != "" {
+		expires, err := http.ParseTime(h.Get("Expires"))
+		if err != nil {
+			return 0
+		}
+		date, err := http.ParseTime(h.Get("Date"))
+		if err != nil {
+			date = t.now()
+		}
+		lifetime = expires.Sub(date)
+	}
+	if age, err := strconv.ParseInt(h.Get("Age"), 10, 64); err == nil {
+		lifetime -= time.Duration(age) * time.Second
+	}
+	return lifetime
+}
+
+// directive returns the value of the Cache-Control directive name in h, and
+// whether it is present.
+func directive(h http.Header, name string) (string, bool) {
+	for _, cc := range h["Cache-Control"] {
+		for _, d := range strings.Split(cc, ",") {
+			d = strings.TrimSpace(d)
+			v := ""
+			if i := strings.IndexByte(d, '='); i >= 0 {
+				d, v = d[:i], strings.Trim(d[i+1:], `"`)
+			}
+			if strings.EqualFold(d, name) {
+				return v, true
+			}
+		}
+	}
+	return "", false
+}
+
+func hasDirective(h http.Header, name string) bool {
+	_, ok := directive(h, name)
+	return ok
+}
+
+// varyHeaders returns the canonical names of the headers listed in the Vary
+// header of h.
+func varyHeaders(h http.Header) []string {
+	var names []string
+	for _, v := range h["Vary"] {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+// cloneRequest returns a shallow copy of req with a copy of its header.
+func cloneRequest(req *http.Request) *http.Request {
+	r := *req
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	return &r
+}
+
+// cachingBody is a response body that calls done with the contents of the
+// body once it has been read to the end.
+type cachingBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	done func([]byte)
+}
+
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	if err == io.EOF && b.done != nil {
+		b.done(b.buf.Bytes())
+		b.done = nil
+	}
+	return n, err
+}
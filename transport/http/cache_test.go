@@ -0,0 +1,259 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/internal"
+	"google.golang.org/api/option"
+	"google.golang.org/api/transport/http/httpcache"
+)
+
+// cacheServer serves a resource whose body and ETag are its version, with
+// the given Cache-Control header, and records the requests it receives.
+type cacheServer struct {
+	*httptest.Server
+	cacheControl string
+
+	mu       sync.Mutex
+	version  int
+	requests []string // method and If-None-Match of each request
+}
+
+func newCacheServer(cacheControl string) *cacheServer {
+	s := &cacheServer{cacheControl: cacheControl, version: 1}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests = append(s.requests, strings.TrimSpace(r.Method+" "+r.Header.Get("If-None-Match")))
+		if r.Method != "GET" {
+			s.version++
+			return
+		}
+		etag := fmt.Sprintf(`"v%d"`, s.version)
+		w.Header().Set("Etag", etag)
+		if s.cacheControl != "" {
+			w.Header().Set("Cache-Control", s.cacheControl)
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprintf(w, "version %d", s.version)
+	}))
+	return s
+}
+
+// takeRequests returns the requests received since the last call.
+func (s *cacheServer) takeRequests() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := strings.Join(s.requests, ", ")
+	s.requests = nil
+	return r
+}
+
+func get(t *testing.T, c *http.Client, url string, header ...string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k := range res.Header {
+		if strings.HasPrefix(k, "X-Googleapi-Cache-") {
+			t.Errorf("response has internal header %s", k)
+		}
+	}
+	return res.StatusCode, string(b)
+}
+
+func newCachingClient(t *testing.T, cache option.HTTPCache, opts ...option.ClientOption) *http.Client {
+	opts = append([]option.ClientOption{option.WithHTTPCache(cache), option.WithTelemetryDisabled()}, opts...)
+	c, _, err := NewClient(context.Background(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCacheRevalidate(t *testing.T) {
+	s := newCacheServer("")
+	defer s.Close()
+	c := newCachingClient(t, httpcache.NewMemoryCache(1<<20), option.WithoutAuthentication())
+
+	for i, want := range []string{"GET", `GET "v1"`} {
+		if code, body := get(t, c, s.URL); code != 200 || body != "version 1" {
+			t.Errorf("request %d: got %d %q, want 200 %q", i, code, body, "version 1")
+		}
+		if got := s.takeRequests(); got != want {
+			t.Errorf("request %d: server got %q, want %q", i, got, want)
+		}
+	}
+
+	// Callers that send If-None-Match themselves get the 304.
+	if code, _ := get(t, c, s.URL, "If-None-Match", `"v1"`); code != http.StatusNotModified {
+		t.Errorf("got %d with If-None-Match, want 304", code)
+	}
+	s.takeRequests()
+
+	// Other requests invalidate the cached response.
+	req, _ := http.NewRequest("POST", s.URL, nil)
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if code, body := get(t, c, s.URL); code != 200 || body != "version 2" {
+		t.Errorf("after POST: got %d %q, want 200 %q", code, body, "version 2")
+	}
+	if got, want := s.takeRequests(), "POST, GET"; got != want {
+		t.Errorf("after POST: server got %q, want %q", got, want)
+	}
+}
+
+func TestCacheFresh(t *testing.T) {
+	s := newCacheServer("private, max-age=60")
+	defer s.Close()
+	now := time.Now()
+	trans := &cachingTransport{
+		base:  http.DefaultTransport,
+		cache: httpcache.NewMemoryCache(1 << 20),
+		scope: "test",
+		now:   func() time.Time { return now },
+	}
+	c := &http.Client{Transport: trans}
+
+	get(t, c, s.URL)
+	s.takeRequests()
+	now = now.Add(59 * time.Second)
+	if code, body := get(t, c, s.URL); code != 200 || body != "version 1" {
+		t.Errorf("fresh: got %d %q", code, body)
+	}
+	if got := s.takeRequests(); got != "" {
+		t.Errorf("fresh: server got %q, want no requests", got)
+	}
+	get(t, c, s.URL, "Cache-Control", "no-cache")
+	if got, want := s.takeRequests(), `GET "v1"`; got != want {
+		t.Errorf("no-cache request: server got %q, want %q", got, want)
+	}
+
+	// The revalidation restarted the lifetime of the response.
+	now = now.Add(59 * time.Second)
+	get(t, c, s.URL)
+	if got := s.takeRequests(); got != "" {
+		t.Errorf("after revalidation: server got %q, want no requests", got)
+	}
+	now = now.Add(2 * time.Second)
+	if code, body := get(t, c, s.URL); code != 200 || body != "version 1" {
+		t.Errorf("stale: got %d %q", code, body)
+	}
+	if got, want := s.takeRequests(), `GET "v1"`; got != want {
+		t.Errorf("stale: server got %q, want %q", got, want)
+	}
+}
+
+func TestCacheNoStore(t *testing.T) {
+	s := newCacheServer("no-store")
+	defer s.Close()
+	cache := httpcache.NewMemoryCache(1 << 20)
+	c := newCachingClient(t, cache, option.WithoutAuthentication())
+	get(t, c, s.URL)
+	get(t, c, s.URL)
+	if got, want := s.takeRequests(), "GET, GET"; got != want {
+		t.Errorf("server got %q, want %q", got, want)
+	}
+	if cache.Size() != 0 {
+		t.Errorf("cache has size %d, want 0", cache.Size())
+	}
+}
+
+func TestCacheScope(t *testing.T) {
+	s := newCacheServer("")
+	defer s.Close()
+	cache := httpcache.NewMemoryCache(1 << 20)
+	get(t, newCachingClient(t, cache, option.WithAPIKey("a")), s.URL)
+	get(t, newCachingClient(t, cache, option.WithAPIKey("b")), s.URL)
+	get(t, newCachingClient(t, cache, option.WithAPIKey("a")), s.URL)
+	if got, want := s.takeRequests(), `GET, GET, GET "v1"`; got != want {
+		t.Errorf("server got %q, want %q", got, want)
+	}
+}
+
+func TestCacheVary(t *testing.T) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Header.Get("Accept-Language")+" "+r.Header.Get("If-None-Match"))
+		w.Header().Set("Etag", `"`+r.Header.Get("Accept-Language")+`"`)
+		w.Header().Set("Vary", "Accept-Language")
+		if r.Header.Get("If-None-Match") != "" {
+			w.WriteHeader(http.StatusNotModified)
+		}
+	}))
+	defer srv.Close()
+	c := newCachingClient(t, httpcache.NewMemoryCache(1<<20), option.WithoutAuthentication())
+	get(t, c, srv.URL, "Accept-Language", "en")
+	get(t, c, srv.URL, "Accept-Language", "en")
+	get(t, c, srv.URL, "Accept-Language", "fr")
+	if got, want := strings.Join(requests, ", "), `en , en "en", fr `; got != want {
+		t.Errorf("server got %q, want %q", got, want)
+	}
+}
+
+func TestCacheIncompatibleWithHTTPClient(t *testing.T) {
+	_, _, err := NewClient(context.Background(), option.WithHTTPClient(http.DefaultClient), option.WithHTTPCache(httpcache.NewMemoryCache(1)))
+	if err == nil {
+		t.Error("got nil error")
+	}
+}
+
+func TestCacheScopeCredentials(t *testing.T) {
+	ts := oauth2.ReuseTokenSource(nil, fixedTS{})
+	scope := cacheScope
+	json1 := &google.Credentials{JSON: []byte(`{"client_email": "a"}`)}
+	json2 := &google.Credentials{JSON: []byte(`{"client_email": "b"}`)}
+	for _, test := range []struct {
+		desc  string
+		a, b  string
+		equal bool
+	}{
+		{"same JSON", scope(&internal.DialSettings{}, json1), scope(&internal.DialSettings{}, json1), true},
+		{"different JSON", scope(&internal.DialSettings{}, json1), scope(&internal.DialSettings{}, json2), false},
+		{"different quota projects", scope(&internal.DialSettings{}, json1), scope(&internal.DialSettings{QuotaProject: "p"}, json1), false},
+		{"same token source", scope(&internal.DialSettings{TokenSource: ts}, &google.Credentials{TokenSource: ts}), scope(&internal.DialSettings{TokenSource: ts}, &google.Credentials{TokenSource: ts}), true},
+		{"metadata server", scope(&internal.DialSettings{}, &google.Credentials{ProjectID: "p"}), scope(&internal.DialSettings{}, &google.Credentials{ProjectID: "p"}), true},
+		{"unknown token source", scope(&internal.DialSettings{TokenSource: fixedTS{}}, &google.Credentials{TokenSource: fixedTS{}}), scope(&internal.DialSettings{TokenSource: fixedTS{}}, &google.Credentials{TokenSource: fixedTS{}}), false},
+	} {
+		if got := test.a == test.b; got != test.equal {
+			t.Errorf("%s: got equal %t, want %t", test.desc, got, test.equal)
+		}
+	}
+}
+
+type fixedTS struct{}
+
+func (fixedTS) Token() (*oauth2.Token, error) { return &oauth2.Token{AccessToken: "t"}, nil }
@@ -17,6 +17,7 @@ import (
 
 	"go.opencensus.io/plugin/ochttp"
 	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
 	"google.golang.org/api/googleapi/transport"
 	"google.golang.org/api/internal"
 	"google.golang.org/api/option"
@@ -72,7 +73,14 @@ func newTransport(ctx context.Context, base http.RoundTripper, settings *interna
 		requestReason: settings.RequestReason,
 	}
 	var trans http.RoundTripper = paramTransport
+	if endpoint, prefix, _ := emulatorEndpoint(settings); prefix != "" && endpoint == settings.Endpoint {
+		trans = &emulatorTransport{base: trans, prefix: prefix}
+	}
+	if settings.GzipRequests {
+		trans = &gzipTransport{base: trans}
+	}
 	trans = addOCTransport(trans, settings)
+	var creds *google.Credentials
 	switch {
 	case settings.NoAuth:
 		// Do nothing.
@@ -82,7 +90,8 @@ func newTransport(ctx context.Context, base http.RoundTripper, settings *interna
 			Key:       settings.APIKey,
 		}
 	default:
-		creds, err := internal.Creds(ctx, settings)
+		var err error
+		creds, err = internal.Creds(ctx, settings)
 		if err != nil {
 			return nil, err
 		}
@@ -94,6 +103,18 @@ func newTransport(ctx context.Context, base http.RoundTripper, settings *interna
 			Source: creds.TokenSource,
 		}
 	}
+	if settings.RateLimiter != nil {
+		trans = &rateLimitTransport{base: trans, limiter: settings.RateLimiter}
+	}
+	if settings.HedgePercentile > 0 {
+		trans = newHedgingTransport(trans, settings)
+	}
+	if settings.CircuitBreakerFailures > 0 {
+		trans = newCircuitBreakerTransport(trans, settings)
+	}
+	if settings.HTTPCache != nil {
+		trans = newCachingTransport(trans, settings, creds)
+	}
 	return trans, nil
 }
 
@@ -102,6 +123,9 @@ func newSettings(opts []option.ClientOption) (*internal.DialSettings, error) {
 	for _, opt := range opts {
 		opt.Apply(&o)
 	}
+	if err := useEmulator(&o); err != nil {
+		return nil, err
+	}
 	if err := o.Validate(); err != nil {
 		return nil, err
 	}
@@ -230,6 +254,9 @@ func getClientCertificateSource(settings *internal.DialSettings) (cert.Source, e
 func getEndpoint(settings *internal.DialSettings, clientCertSource cert.Source) (string, error) {
 	if settings.Endpoint == "" {
 		if clientCertSource != nil {
+			if settings.DefaultMTLSEndpoint != "" {
+				return settings.DefaultMTLSEndpoint, nil
+			}
 			return generateDefaultMtlsEndpoint(settings.DefaultEndpoint), nil
 		}
 		return settings.DefaultEndpoint, nil
@@ -262,9 +289,9 @@ func mergeEndpoints(base, newHost string) (string, error) {
 // 1. pubsub.googleapis.com to pubsub.mtls.googleapis.com
 // 2. pubsub.sandbox.googleapis.com to pubsub.mtls.sandbox.googleapis.com
 //
-// TODO(andyzhao): In the future, the mTLS endpoint will be read from the Discovery Document
-// and passed in as defaultMtlsEndpoint instead of generated from defaultEndpoint,
-// and this function will be removed.
+// Clients generated from a Discovery Document with an mtlsRootUrl pass the
+// mTLS endpoint in with internaloption.WithDefaultMTLSEndpoint instead; this
+// function is only used for clients that predate that option.
 func generateDefaultMtlsEndpoint(defaultEndpoint string) string {
 	var domains = []string{
 		".sandbox.googleapis.com", // must come first because .googleapis.com is a substring
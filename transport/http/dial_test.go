@@ -63,15 +63,27 @@ func TestGetEndpoint(t *testing.T) {
 func TestGetEndpointWithClientCertSource(t *testing.T) {
 	dummyClientCertSource := func(info *tls.CertificateRequestInfo) (*tls.Certificate, error) { return nil, nil }
 	testCases := []struct {
-		UserEndpoint    string
-		DefaultEndpoint string
-		Want            string
-		WantErr         bool
+		UserEndpoint        string
+		DefaultEndpoint     string
+		DefaultMTLSEndpoint string
+		Want                string
+		WantErr             bool
 	}{
 		{
 			DefaultEndpoint: "https://foo.googleapis.com/bar/baz",
 			Want:            "https://foo.mtls.googleapis.com/bar/baz",
 		},
+		{
+			DefaultEndpoint:     "https://foo.googleapis.com/bar/baz",
+			DefaultMTLSEndpoint: "https://foo.mtls.example.com/bar/baz",
+			Want:                "https://foo.mtls.example.com/bar/baz",
+		},
+		{
+			UserEndpoint:        "myhost:3999",
+			DefaultEndpoint:     "https://foo.googleapis.com/bar/baz",
+			DefaultMTLSEndpoint: "https://foo.mtls.example.com/bar/baz",
+			Want:                "https://myhost:3999/bar/baz",
+		},
 		{
 			DefaultEndpoint: "https://staging-foo.sandbox.googleapis.com/bar/baz",
 			Want:            "https://staging-foo.mtls.sandbox.googleapis.com/bar/baz",
@@ -95,8 +107,9 @@ func TestGetEndpointWithClientCertSource(t *testing.T) {
 
 	for _, tc := range testCases {
 		got, err := getEndpoint(&internal.DialSettings{
-			Endpoint:        tc.UserEndpoint,
-			DefaultEndpoint: tc.DefaultEndpoint,
+			Endpoint:            tc.UserEndpoint,
+			DefaultEndpoint:     tc.DefaultEndpoint,
+			DefaultMTLSEndpoint: tc.DefaultMTLSEndpoint,
 		}, dummyClientCertSource)
 		if tc.WantErr && err == nil {
 			t.Errorf("want err, got nil err")
@@ -0,0 +1,90 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"google.golang.org/api/internal"
+)
+
+// emulatorEndpoint returns the endpoint of the emulator whose address is in
+// the environment variable named by settings.EmulatorHostEnv, and the path
+// prefix of that address, or "" if the variable is not set.
+//
+// The address is a host and port, like "localhost:9000", or a URL, like
+// "http://localhost:9000/prefix". The endpoint is the address with the path
+// of the default endpoint appended.
+func emulatorEndpoint(settings *internal.DialSettings) (endpoint, prefix string, err error) {
+	if settings.EmulatorHostEnv == "" {
+		return "", "", nil
+	}
+	host := os.Getenv(settings.EmulatorHostEnv)
+	if host == "" {
+		return "", "", nil
+	}
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid %s: %v", settings.EmulatorHostEnv, err)
+	}
+	def, err := url.Parse(settings.DefaultEndpoint)
+	if err != nil {
+		return "", "", err
+	}
+	prefix = strings.TrimSuffix(u.Path, "/")
+	u.Path = prefix + def.Path
+	return u.String(), prefix, nil
+}
+
+// useEmulator changes settings to send requests to the emulator named by
+// settings.EmulatorHostEnv, if the variable is set and the user has not
+// overridden the endpoint or the client. Emulators do not authenticate
+// requests, so credentials are dropped.
+func useEmulator(settings *internal.DialSettings) error {
+	if settings.Endpoint != "" || settings.HTTPClient != nil {
+		return nil
+	}
+	endpoint, _, err := emulatorEndpoint(settings)
+	if err != nil || endpoint == "" {
+		return err
+	}
+	settings.Endpoint = endpoint
+	settings.NoAuth = true
+	settings.APIKey = ""
+	settings.TokenSource = nil
+	settings.Credentials = nil
+	settings.CredentialsFile = ""
+	settings.CredentialsJSON = nil
+	return nil
+}
+
+// emulatorTransport is an http.RoundTripper that adds the path prefix of an
+// emulator address to requests whose paths lack it, like the media uploads of
+// generated clients, whose paths are relative to the host of the endpoint.
+type emulatorTransport struct {
+	base   http.RoundTripper
+	prefix string
+}
+
+func (t *emulatorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.HasPrefix(req.URL.Path, t.prefix+"/") {
+		return t.base.RoundTrip(req)
+	}
+	r := *req
+	u := *req.URL
+	u.Path = t.prefix + u.Path
+	if u.RawPath != "" {
+		u.RawPath = t.prefix + u.RawPath
+	}
+	r.URL = &u
+	return t.base.RoundTrip(&r)
+}
@@ -0,0 +1,119 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/internal"
+	"google.golang.org/api/option"
+	"google.golang.org/api/option/internaloption"
+)
+
+const testEmulatorEnv = "TRANSPORT_HTTP_TEST_EMULATOR_HOST"
+
+func setEmulatorEnv(t *testing.T, value string) func() {
+	t.Helper()
+	old, ok := os.LookupEnv(testEmulatorEnv)
+	if err := os.Setenv(testEmulatorEnv, value); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		if ok {
+			os.Setenv(testEmulatorEnv, old)
+		} else {
+			os.Unsetenv(testEmulatorEnv)
+		}
+	}
+}
+
+func TestEmulatorEndpoint(t *testing.T) {
+	for _, test := range []struct {
+		host, wantEndpoint, wantPrefix string
+	}{
+		{"", "", ""},
+		{"localhost:9000", "http://localhost:9000/storage/v1/", ""},
+		{"https://localhost:9000", "https://localhost:9000/storage/v1/", ""},
+		{"http://localhost:9000/fake/", "http://localhost:9000/fake/storage/v1/", "/fake"},
+	} {
+		restore := setEmulatorEnv(t, test.host)
+		endpoint, prefix, err := emulatorEndpoint(&internal.DialSettings{
+			DefaultEndpoint: "https://storage.googleapis.com/storage/v1/",
+			EmulatorHostEnv: testEmulatorEnv,
+		})
+		restore()
+		if err != nil {
+			t.Errorf("%q: %v", test.host, err)
+			continue
+		}
+		if endpoint != test.wantEndpoint || prefix != test.wantPrefix {
+			t.Errorf("%q: got (%q, %q), want (%q, %q)", test.host, endpoint, prefix, test.wantEndpoint, test.wantPrefix)
+		}
+	}
+}
+
+func TestEmulator(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "" || r.URL.Query().Get("key") != "" {
+			t.Errorf("%s: request was authenticated", r.URL.Path)
+		}
+		paths = append(paths, r.URL.Path)
+	}))
+	defer srv.Close()
+	opts := []option.ClientOption{
+		option.WithAPIKey("key"),
+		option.WithTelemetryDisabled(),
+		internaloption.WithDefaultEndpoint("https://storage.googleapis.com/storage/v1/"),
+		internaloption.WithEmulatorHostEnv(testEmulatorEnv),
+	}
+
+	for _, test := range []struct {
+		host      string
+		wantPaths []string
+	}{
+		{strings.TrimPrefix(srv.URL, "http://"), []string{"/storage/v1/b", "/upload/storage/v1/b"}},
+		{srv.URL + "/fake", []string{"/fake/storage/v1/b", "/fake/upload/storage/v1/b"}},
+	} {
+		restore := setEmulatorEnv(t, test.host)
+		c, endpoint, err := NewClient(context.Background(), opts...)
+		restore()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(endpoint, srv.URL) {
+			t.Errorf("%q: got endpoint %q, want emulator", test.host, endpoint)
+		}
+		paths = nil
+		// Generated clients resolve upload paths against the host of the
+		// endpoint.
+		for _, u := range []string{endpoint + "b", srv.URL + "/upload/storage/v1/b"} {
+			res, err := c.Get(u)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+		}
+		if strings.Join(paths, " ") != strings.Join(test.wantPaths, " ") {
+			t.Errorf("%q: got paths %q, want %q", test.host, paths, test.wantPaths)
+		}
+	}
+
+	// The emulator is not used if the endpoint is overridden.
+	restore := setEmulatorEnv(t, srv.URL)
+	defer restore()
+	_, endpoint, err := NewClient(context.Background(), append(opts, option.WithEndpoint("https://example.com/"))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if endpoint != "https://example.com/" {
+		t.Errorf("got endpoint %q, want https://example.com/", endpoint)
+	}
+}
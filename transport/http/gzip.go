@@ -0,0 +1,76 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/internal/gensupport"
+)
+
+// gzipMinSize is the size below which request bodies of known length are not
+// worth compressing.
+const gzipMinSize = 1024
+
+// gzipTransport is an http.RoundTripper that compresses request bodies, as
+// described by option.WithGzipRequests.
+type gzipTransport struct {
+	base http.RoundTripper
+}
+
+func (t *gzipTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || req.Body == http.NoBody || !compressible(req.Header) ||
+		req.ContentLength > 0 && req.ContentLength < gzipMinSize {
+		return t.base.RoundTrip(req)
+	}
+	newReq := cloneRequest(req)
+	newReq.Header.Set("Content-Encoding", "gzip")
+	newReq.Body = newGzipBody(req.Body)
+	newReq.ContentLength = -1
+	if req.GetBody != nil {
+		newReq.GetBody = func() (io.ReadCloser, error) {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			return newGzipBody(body), nil
+		}
+	}
+	return t.base.RoundTrip(newReq)
+}
+
+// compressible reports whether a request with header h may be compressed.
+// Requests whose Content-Encoding is already set are not, nor are the chunks
+// of resumable uploads: their Content-Range and upload headers describe the
+// uncompressed bytes of the body.
+func compressible(h http.Header) bool {
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	for k := range h {
+		if strings.HasPrefix(http.CanonicalHeaderKey(k), "X-Goog-Upload-") {
+			return false
+		}
+	}
+	return true
+}
+
+// gzipBody is a reader of the gzip compression of a request body, which is
+// closed when the reader is.
+type gzipBody struct {
+	io.ReadCloser
+	body io.Closer
+}
+
+func newGzipBody(body io.ReadCloser) io.ReadCloser {
+	return &gzipBody{ReadCloser: gensupport.NewGzipReader(body), body: body}
+}
+
+func (b *gzipBody) Close() error {
+	b.ReadCloser.Close()
+	return b.body.Close()
+}
@@ -0,0 +1,120 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/option"
+)
+
+func TestGzipRequests(t *testing.T) {
+	type received struct {
+		encoding string
+		body     string
+	}
+	var got received
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = received{encoding: r.Header.Get("Content-Encoding")}
+		var body io.Reader = r.Body
+		if got.encoding == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Errorf("reading gzip body: %v", err)
+				return
+			}
+			body = zr
+		}
+		b, err := ioutil.ReadAll(body)
+		if err != nil {
+			t.Errorf("reading body: %v", err)
+		}
+		got.body = string(b)
+	}))
+	defer srv.Close()
+	c, _, err := NewClient(context.Background(), option.WithoutAuthentication(), option.WithTelemetryDisabled(), option.WithGzipRequests())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	large := strings.Repeat("x", gzipMinSize)
+	for _, test := range []struct {
+		desc   string
+		body   io.Reader
+		header string // header set by the caller, as "name:value"
+		want   received
+	}{
+		{"small body", strings.NewReader("small"), "", received{"", "small"}},
+		{"large body", strings.NewReader(large), "", received{"gzip", large}},
+		{"unknown length", ioutil.NopCloser(strings.NewReader("small")), "", received{"gzip", "small"}},
+		{"already encoded", strings.NewReader(large), "Content-Encoding:identity", received{"identity", large}},
+		{"resumable chunk", ioutil.NopCloser(strings.NewReader(large)), "Content-Range:bytes 0-1023/*", received{"", large}},
+		{"upload protocol", strings.NewReader(large), "X-Goog-Upload-Command:upload, finalize", received{"", large}},
+	} {
+		req, err := http.NewRequest("POST", srv.URL, test.body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i := strings.Index(test.header, ":"); i > 0 {
+			req.Header.Set(test.header[:i], test.header[i+1:])
+		}
+		res, err := c.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", test.desc, err)
+		}
+		res.Body.Close()
+		if got != test.want {
+			t.Errorf("%s: server got %+v, want %+v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestGzipRequestsGetBody(t *testing.T) {
+	var bodies []string
+	trans := &gzipTransport{base: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		for _, get := range []func() (io.ReadCloser, error){
+			func() (io.ReadCloser, error) { return req.Body, nil },
+			req.GetBody,
+		} {
+			body, err := get()
+			if err != nil {
+				return nil, err
+			}
+			zr, err := gzip.NewReader(body)
+			if err != nil {
+				return nil, err
+			}
+			b, err := ioutil.ReadAll(zr)
+			if err != nil {
+				return nil, err
+			}
+			bodies = append(bodies, string(b))
+		}
+		return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+	})}
+	req, err := http.NewRequest("POST", "https://example.com", bytes.NewReader(bytes.Repeat([]byte("y"), 2*gzipMinSize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := trans.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Repeat("y", 2*gzipMinSize)
+	if len(bodies) != 2 || bodies[0] != want || bodies[1] != want {
+		t.Errorf("got bodies of lengths %d, want two bodies of length %d", len(bodies), len(want))
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
@@ -0,0 +1,70 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// DiskCache is an option.HTTPCache that keeps each value in a file in a
+// directory. It may be shared by the processes that use the directory.
+// Errors reading and writing files are treated as cache misses.
+type DiskCache struct {
+	dir string
+}
+
+// NewDiskCache returns a DiskCache that stores values in dir, creating it
+// if needed.
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+// path returns the name of the file holding the value for key. Keys are
+// hashed, since they may be longer than file names and contain any
+// characters.
+func (c *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+// Get returns the value stored for key, if any.
+func (c *DiskCache) Get(key string) ([]byte, bool) {
+	b, err := ioutil.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+// Set stores value for key. The value is written to a temporary file that
+// then replaces the file for key, so that readers never see partial values.
+func (c *DiskCache) Set(key string, value []byte) {
+	f, err := ioutil.TempFile(c.dir, "tmp-")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(value)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), c.path(key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+// Delete removes the value stored for key, if any.
+func (c *DiskCache) Delete(key string) {
+	os.Remove(c.path(key))
+}
@@ -0,0 +1,111 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package httpcache provides storage for the responses cached by HTTP clients
+// created with option.WithHTTPCache.
+//
+// For example, to cache the responses of a client in memory:
+//
+//	cache := httpcache.NewMemoryCache(64 << 20)
+//	computeService, err := compute.NewService(ctx, option.WithHTTPCache(cache))
+//
+// This is an EXPERIMENTAL package and may be changed or removed in the future.
+package httpcache // import "google.golang.org/api/transport/http/httpcache"
+
+import (
+	"container/list"
+	"sync"
+
+	"google.golang.org/api/option"
+)
+
+var (
+	_ option.HTTPCache = (*MemoryCache)(nil)
+	_ option.HTTPCache = (*DiskCache)(nil)
+)
+
+// MemoryCache is an option.HTTPCache that keeps values in memory, evicting
+// the least recently used values when their total size exceeds a limit.
+// It is safe for concurrent use.
+type MemoryCache struct {
+	maxBytes int64
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List               // of *memoryEntry, most recently used first
+	entries map[string]*list.Element // key -> element of lru
+}
+
+type memoryEntry struct {
+	key   string
+	value []byte
+}
+
+// NewMemoryCache returns a MemoryCache that holds at most maxBytes bytes of
+// keys and values. Values larger than that are not stored.
+func NewMemoryCache(maxBytes int64) *MemoryCache {
+	return &MemoryCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// Get returns the value stored for key, if any, and marks it as recently
+// used.
+func (c *MemoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return el.Value.(*memoryEntry).value, true
+}
+
+// Set stores value for key, evicting the least recently used values if
+// needed to stay within the size limit.
+func (c *MemoryCache) Set(key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(key)
+	n := entrySize(key, value)
+	if n > c.maxBytes {
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&memoryEntry{key: key, value: value})
+	c.size += n
+	for c.size > c.maxBytes {
+		c.remove(c.lru.Back().Value.(*memoryEntry).key)
+	}
+}
+
+// Delete removes the value stored for key, if any.
+func (c *MemoryCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(key)
+}
+
+// Size returns the total size of the keys and values held by c.
+func (c *MemoryCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+func (c *MemoryCache) remove(key string) {
+	el, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	e := c.lru.Remove(el).(*memoryEntry)
+	delete(c.entries, key)
+	c.size -= entrySize(e.key, e.value)
+}
+
+func entrySize(key string, value []byte) int64 {
+	return int64(len(key) + len(value))
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpcache
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"google.golang.org/api/option"
+)
+
+func testCache(t *testing.T, c option.HTTPCache) {
+	t.Helper()
+	if _, ok := c.Get("a"); ok {
+		t.Error("Get of missing key: got ok")
+	}
+	c.Set("a", []byte("1"))
+	c.Set("b", []byte("2"))
+	c.Set("a", []byte("3"))
+	if v, ok := c.Get("a"); !ok || string(v) != "3" {
+		t.Errorf(`Get("a") = %q, %t, want "3", true`, v, ok)
+	}
+	c.Delete("a")
+	if _, ok := c.Get("a"); ok {
+		t.Error("Get of deleted key: got ok")
+	}
+	if v, ok := c.Get("b"); !ok || string(v) != "2" {
+		t.Errorf(`Get("b") = %q, %t, want "2", true`, v, ok)
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	testCache(t, NewMemoryCache(100))
+}
+
+func TestMemoryCacheEviction(t *testing.T) {
+	c := NewMemoryCache(6)
+	c.Set("a", []byte("12"))
+	c.Set("b", []byte("34"))
+	c.Get("a") // b is now the least recently used
+	c.Set("c", []byte("56"))
+	if _, ok := c.Get("b"); ok {
+		t.Error("b was not evicted")
+	}
+	for _, k := range []string{"a", "c"} {
+		if _, ok := c.Get(k); !ok {
+			t.Errorf("%s was evicted", k)
+		}
+	}
+	if got := c.Size(); got != 6 {
+		t.Errorf("Size() = %d, want 6", got)
+	}
+	c.Set("d", []byte("too large"))
+	if _, ok := c.Get("d"); ok {
+		t.Error("value larger than the cache was stored")
+	}
+	if got := c.Size(); got != 6 {
+		t.Errorf("Size() = %d after storing too large value, want 6", got)
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c, err := NewDiskCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCache(t, c)
+
+	// Values persist across caches using the same directory.
+	c2, err := NewDiskCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := c2.Get("b"); !ok || string(v) != "2" {
+		t.Errorf(`Get("b") from second cache = %q, %t, want "2", true`, v, ok)
+	}
+}
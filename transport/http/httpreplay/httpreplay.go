@@ -0,0 +1,374 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package httpreplay records the HTTP requests made by clients of Google APIs
+// and their responses to a file, and replays them, so that tests can run
+// without credentials or network access.
+//
+// To record, create a client from a Recorder and pass it to the service with
+// option.WithHTTPClient:
+//
+//	rec, err := httpreplay.NewRecorder("testdata/storage.replay", nil)
+//	...
+//	client, err := rec.Client(ctx, option.WithCredentialsFile(keyFile))
+//	...
+//	svc, err := storage.NewService(ctx, option.WithHTTPClient(client))
+//	...
+//	err = rec.Close() // writes the file
+//
+// To replay, create a client from a Replayer:
+//
+//	rep, err := httpreplay.NewReplayer("testdata/storage.replay")
+//	...
+//	svc, err := storage.NewService(ctx, option.WithHTTPClient(rep.Client()))
+//
+// Requests are matched to recorded ones by method, path, query and body;
+// identical requests are replayed in the order they were recorded. Credentials
+// are not recorded: the Authorization and X-Goog-Api-Key headers and the key
+// and access_token query parameters are removed. The random boundaries of
+// multipart requests, like those made by the Media method of generated calls,
+// and the upload IDs of resumable uploads are replaced by deterministic ones.
+//
+// This is an EXPERIMENTAL API and may be changed or removed in the future.
+package httpreplay
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+)
+
+// fileVersion is the version of the format of recorded files.
+const fileVersion = 1
+
+// boundary replaces the boundaries of recorded multipart requests.
+const boundary = "httpreplay-boundary"
+
+// A file is the contents of a recorded file.
+type file struct {
+	Version int
+	Initial []byte   `json:",omitempty"`
+	Entries []*entry `json:",omitempty"`
+}
+
+// An entry is a request and its response.
+type entry struct {
+	Request  *request
+	Response *response
+}
+
+type request struct {
+	Method string
+	URL    string // normalized by normalizeURL
+	Header http.Header
+	Body   []byte
+}
+
+type response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// scrubbedHeaders are removed from recorded requests and responses.
+var scrubbedHeaders = []string{"Authorization", "X-Goog-Api-Key", "Cookie", "Set-Cookie"}
+
+// scrubbedParams are removed from the query of recorded requests.
+var scrubbedParams = []string{"key", "access_token"}
+
+// A Recorder is an http.RoundTripper that records requests and their
+// responses. It is safe for concurrent use.
+type Recorder struct {
+	filename string
+	base     http.RoundTripper
+
+	mu        sync.Mutex
+	f         file
+	uploadIDs map[string]string // real upload IDs to recorded ones
+}
+
+// NewRecorder returns a Recorder that sends requests with
+// http.DefaultTransport, and writes them with their responses
+// to filename when it is closed. An existing file is only replaced then.
+// initial is stored in the file and returned by the Initial method of a
+// Replayer; tests can use it to record values like random names that must be
+// the same when the file is replayed.
+func NewRecorder(filename string, initial []byte) (*Recorder, error) {
+	return &Recorder{
+		filename:  filename,
+		base:      http.DefaultTransport,
+		f:         file{Version: fileVersion, Initial: initial},
+		uploadIDs: make(map[string]string),
+	}, nil
+}
+
+// Client returns an HTTP client that authenticates requests as configured by
+// opts, and sends them through r. It is the client returned by
+// google.golang.org/api/transport/http.NewClient, with r as its base
+// transport.
+func (r *Recorder) Client(ctx context.Context, opts ...option.ClientOption) (*http.Client, error) {
+	trans, err := htransport.NewTransport(ctx, r, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: trans}, nil
+}
+
+// RoundTrip sends req and records it with its response.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resBody, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(resBody))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	recReq := newRequest(req, body, r.uploadID)
+	recRes := &response{StatusCode: res.StatusCode, Header: scrubHeader(res.Header), Body: resBody}
+	if loc := recRes.Header.Get("Location"); loc != "" {
+		recRes.Header.Set("Location", replaceUploadID(loc, r.uploadID))
+	}
+	r.f.Entries = append(r.f.Entries, &entry{Request: recReq, Response: recRes})
+	return res, nil
+}
+
+// uploadID returns the recorded upload ID for id.
+func (r *Recorder) uploadID(id string) string {
+	rid, ok := r.uploadIDs[id]
+	if !ok {
+		rid = "upload-" + strconv.Itoa(len(r.uploadIDs)+1)
+		r.uploadIDs[id] = rid
+	}
+	return rid
+}
+
+// Close writes the recorded requests and responses to the file. They are
+// written to a temporary file first, which then replaces the file, so that a
+// failed write does not lose an existing recording.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, err := json.MarshalIndent(&r.f, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(r.filename), filepath.Base(r.filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), r.filename)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// A Replayer is an http.RoundTripper that replays the responses recorded by a
+// Recorder. It is safe for concurrent use.
+type Replayer struct {
+	mu      sync.Mutex
+	initial []byte
+	entries []*entry // unused entries, in recorded order
+}
+
+// NewReplayer returns a Replayer for the requests and responses recorded in
+// filename.
+func NewReplayer(filename string) (*Replayer, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var f file
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("httpreplay: reading %s: %v", filename, err)
+	}
+	if f.Version != fileVersion {
+		return nil, fmt.Errorf("httpreplay: %s has version %d, want %d", filename, f.Version, fileVersion)
+	}
+	return &Replayer{initial: f.Initial, entries: f.Entries}, nil
+}
+
+// Initial returns the initial value passed to NewRecorder.
+func (r *Replayer) Initial() []byte {
+	return r.initial
+}
+
+// Client returns an HTTP client that replays requests with r.
+func (r *Replayer) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// RoundTrip returns the response recorded for the first unused request that
+// matches req, or an error if there is none.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	// Upload IDs in requests are already the recorded ones, from the
+	// recorded Location headers.
+	want := newRequest(req, body, func(id string) string { return id })
+	wantURL, err := url.Parse(want.URL)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, e := range r.entries {
+		if e.Request.Method != want.Method || !bytes.Equal(e.Request.Body, want.Body) {
+			continue
+		}
+		// Only the path and query of URLs are matched.
+		if u, err := url.Parse(e.Request.URL); err != nil || u.Path != wantURL.Path || u.RawQuery != wantURL.RawQuery {
+			continue
+		}
+		r.entries = append(r.entries[:i:i], r.entries[i+1:]...)
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", e.Response.StatusCode, http.StatusText(e.Response.StatusCode)),
+			StatusCode:    e.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        e.Response.Header,
+			Body:          ioutil.NopCloser(bytes.NewReader(e.Response.Body)),
+			ContentLength: int64(len(e.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("httpreplay: no recorded request matches %s %s", want.Method, want.URL)
+}
+
+// Close reports an error if some recorded requests were not replayed.
+func (r *Replayer) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.entries) == 0 {
+		return nil
+	}
+	var msgs []string
+	for _, e := range r.entries {
+		msgs = append(msgs, e.Request.Method+" "+e.Request.URL)
+	}
+	return errors.New("httpreplay: recorded requests not replayed: " + strings.Join(msgs, ", "))
+}
+
+// readBody reads the body of req, and replaces it with one that returns the
+// same bytes.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// newRequest returns the recorded form of req with the given body, mapping
+// upload IDs with uploadID. Compressed bodies are recorded uncompressed.
+func newRequest(req *http.Request, body []byte, uploadID func(string) string) *request {
+	h := scrubHeader(req.Header)
+	if h.Get("Content-Encoding") == "gzip" {
+		if zr, err := gzip.NewReader(bytes.NewReader(body)); err == nil {
+			if b, err := ioutil.ReadAll(zr); err == nil {
+				body = b
+			}
+		}
+	}
+	if ct := h.Get("Content-Type"); ct != "" {
+		mediaType, params, err := mime.ParseMediaType(ct)
+		if err == nil && strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "" {
+			body = bytes.Replace(body, []byte(params["boundary"]), []byte(boundary), -1)
+			params["boundary"] = boundary
+			h.Set("Content-Type", mime.FormatMediaType(mediaType, params))
+		}
+	}
+	return &request{
+		Method: req.Method,
+		URL:    normalizeURL(req.URL, uploadID),
+		Header: h,
+		Body:   body,
+	}
+}
+
+// scrubHeader returns a copy of h without the scrubbed headers.
+func scrubHeader(h http.Header) http.Header {
+	c := make(http.Header, len(h))
+	for k, v := range h {
+		c[k] = v
+	}
+	for _, k := range scrubbedHeaders {
+		c.Del(k)
+	}
+	return c
+}
+
+// normalizeURL returns u without the scrubbed parameters, with its upload ID
+// mapped by uploadID and its parameters sorted.
+func normalizeURL(u *url.URL, uploadID func(string) string) string {
+	q := u.Query()
+	for _, p := range scrubbedParams {
+		q.Del(p)
+	}
+	if id := q.Get("upload_id"); id != "" {
+		q.Set("upload_id", uploadID(id))
+	}
+	c := *u
+	c.RawQuery = q.Encode() // sorted by key
+	return c.String()
+}
+
+// replaceUploadID returns the URL rawurl with its upload ID mapped by
+// uploadID.
+func replaceUploadID(rawurl string, uploadID func(string) string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return rawurl
+	}
+	q := u.Query()
+	id := q.Get("upload_id")
+	if id == "" {
+		return rawurl
+	}
+	q.Set("upload_id", uploadID(id))
+	u.RawQuery = q.Encode()
+	return u.String()
+}
@@ -0,0 +1,233 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpreplay
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"google.golang.org/api/option"
+	storage "google.golang.org/api/storage/v1"
+)
+
+// fakeStorage serves the requests made by storageCalls, giving each resumable
+// upload a new ID.
+func fakeStorage(t *testing.T) *httptest.Server {
+	var uploads int32
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != "secret" {
+			t.Errorf("%s %s: missing API key", r.Method, r.URL)
+		}
+		q := r.URL.Query()
+		switch {
+		case r.Method == "POST" && q.Get("uploadType") == "multipart":
+			if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/related; boundary=") {
+				t.Errorf("got Content-Type %q, want multipart", r.Header.Get("Content-Type"))
+			}
+			fmt.Fprint(w, `{"name": "multi"}`)
+		case r.Method == "POST" && q.Get("upload_id") != "":
+			body, _ := ioutil.ReadAll(r.Body)
+			fmt.Fprintf(w, `{"name": "resumable", "size": "%d"}`, len(body))
+		case r.Method == "POST" && q.Get("uploadType") == "resumable":
+			n := atomic.AddInt32(&uploads, 1)
+			w.Header().Set("Location", fmt.Sprintf("%s%s?uploadType=resumable&upload_id=real-%d-%p", srv.URL, r.URL.Path, n, r))
+		case r.Method == "GET":
+			fmt.Fprint(w, `{"name": "multi", "size": "5"}`)
+		default:
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+		}
+	}))
+	return srv
+}
+
+// storageCalls makes some calls with s and returns a summary of their
+// results.
+func storageCalls(s *storage.Service) (string, error) {
+	var results []string
+	o, err := s.Objects.Insert("bucket", &storage.Object{Name: "multi"}).Media(strings.NewReader("hello")).Do()
+	if err != nil {
+		return "", err
+	}
+	results = append(results, o.Name)
+	for i := 0; i < 2; i++ {
+		o, err = s.Objects.Insert("bucket", &storage.Object{Name: "resumable"}).
+			ResumableMedia(context.Background(), strings.NewReader("resumable media"), 15, "text/plain").Do()
+		if err != nil {
+			return "", err
+		}
+		results = append(results, fmt.Sprintf("%s %d", o.Name, o.Size))
+	}
+	o, err = s.Objects.Get("bucket", "multi").Do()
+	if err != nil {
+		return "", err
+	}
+	results = append(results, fmt.Sprintf("%s %d", o.Name, o.Size))
+	return strings.Join(results, ", "), nil
+}
+
+func TestRecordReplay(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "httpreplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "storage.replay")
+	srv := fakeStorage(t)
+	endpoint := option.WithEndpoint(srv.URL + "/storage/v1/")
+
+	rec, err := NewRecorder(filename, []byte("initial"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := rec.Client(ctx, option.WithAPIKey("secret"), option.WithTelemetryDisabled())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := storage.NewService(ctx, option.WithHTTPClient(client), endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded, err := storageCalls(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"secret", "real-"} {
+		if bytes.Contains(b, []byte(s)) {
+			t.Errorf("recorded file contains %q", s)
+		}
+	}
+	for _, s := range []string{"upload_id=upload-1", "upload_id=upload-2", boundary} {
+		if !bytes.Contains(b, []byte(s)) {
+			t.Errorf("recorded file does not contain %q", s)
+		}
+	}
+
+	// Replay twice, to check the replay is deterministic.
+	for i := 0; i < 2; i++ {
+		rep, err := NewReplayer(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(rep.Initial()), "initial"; got != want {
+			t.Errorf("Initial() = %q, want %q", got, want)
+		}
+		s, err := storage.NewService(ctx, option.WithHTTPClient(rep.Client()), endpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		replayed, err := storageCalls(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if replayed != recorded {
+			t.Errorf("replayed %q, recorded %q", replayed, recorded)
+		}
+		if err := rep.Close(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestReplayMismatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpreplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "empty.replay")
+	rec, err := NewRecorder(filename, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.f.Entries = append(rec.f.Entries, &entry{
+		Request:  &request{Method: "POST", URL: "https://example.com/a?x=1", Body: []byte("body")},
+		Response: &response{StatusCode: 200},
+	})
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	rep, err := NewReplayer(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, req := range []*http.Request{
+		httptest.NewRequest("GET", "https://example.com/a?x=1", strings.NewReader("body")),
+		httptest.NewRequest("POST", "https://example.com/b?x=1", strings.NewReader("body")),
+		httptest.NewRequest("POST", "https://example.com/a?x=2", strings.NewReader("body")),
+		httptest.NewRequest("POST", "https://example.com/a?x=1", strings.NewReader("other")),
+	} {
+		if _, err := rep.RoundTrip(req); err == nil {
+			t.Errorf("%s %s: got nil error", req.Method, req.URL)
+		}
+	}
+	if err := rep.Close(); err == nil {
+		t.Error("Close: got nil error with unreplayed requests")
+	}
+	// The host and scrubbed parameters are ignored.
+	req := httptest.NewRequest("POST", "https://other.example.com/a?key=k&x=1", strings.NewReader("body"))
+	res, err := rep.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != 200 {
+		t.Errorf("got status %d, want 200", res.StatusCode)
+	}
+	if err := rep.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRecorderKeepsFileUntilClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpreplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "storage.replay")
+	if err := ioutil.WriteFile(filename, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := NewRecorder(filename, []byte("new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(filename); err != nil || string(b) != "old" {
+		t.Fatalf("before Close, got file %q, %v, want the old one", b, err)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	rep, err := NewReplayer(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(rep.Initial()), "new"; got != want {
+		t.Errorf("Initial() = %q, want %q", got, want)
+	}
+	// Only the recorded file is left in the directory.
+	if fis, err := ioutil.ReadDir(dir); err != nil || len(fis) != 1 {
+		t.Errorf("got %d files, %v, want 1", len(fis), err)
+	}
+}
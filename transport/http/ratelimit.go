@@ -0,0 +1,61 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/internal"
+)
+
+// methodToken prefixes the method ID in the x-goog-api-client header of
+// requests made by generated clients.
+const methodToken = "gdcl-method/"
+
+// rateLimitTransport is an http.RoundTripper that waits for a rate limiter
+// before each request, as described by option.WithRateLimiter.
+type rateLimitTransport struct {
+	base    http.RoundTripper
+	limiter internal.RateLimiter
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	method := apiMethod(req.Header)
+	if err := t.limiter.Wait(req.Context(), method); err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode < 400 {
+		t.limiter.Observe(method, err)
+		return resp, err
+	}
+	// Report the error in the body, restoring it for the caller.
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.limiter.Observe(method, err)
+		return nil, err
+	}
+	checked := *resp
+	checked.Body = ioutil.NopCloser(bytes.NewReader(body))
+	t.limiter.Observe(method, googleapi.CheckResponse(&checked))
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// apiMethod returns the method ID in the x-goog-api-client header h, or "" if
+// there is none.
+func apiMethod(h http.Header) string {
+	for _, f := range strings.Fields(h.Get("x-goog-api-client")) {
+		if strings.HasPrefix(f, methodToken) {
+			return f[len(methodToken):]
+		}
+	}
+	return ""
+}
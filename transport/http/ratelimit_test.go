@@ -0,0 +1,100 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// recordingLimiter is an option.RateLimiter that records its calls.
+type recordingLimiter struct {
+	mu       sync.Mutex
+	waits    []string
+	observed []error
+}
+
+func (l *recordingLimiter) Wait(ctx context.Context, method string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.waits = append(l.waits, method)
+	return nil
+}
+
+func (l *recordingLimiter) Observe(method string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.observed = append(l.observed, err)
+}
+
+func TestRateLimiter(t *testing.T) {
+	const errBody = `{"error":{"code":403,"message":"slow down","errors":[{"reason":"rateLimitExceeded"}]}}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/limited" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(errBody))
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	l := &recordingLimiter{}
+	c, _, err := NewClient(context.Background(), option.WithoutAuthentication(), option.WithTelemetryDisabled(), option.WithRateLimiter(l))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		path, apiClient, wantBody string
+	}{
+		{"/ok", "gl-go/1.14 gdcl/20200503 gdcl-method/storage.buckets.get", "ok"},
+		{"/limited", "gl-go/1.14 gdcl/20200503 gdcl-method/storage.buckets.list", errBody},
+		{"/ok", "", "ok"},
+	} {
+		req, err := http.NewRequest("GET", srv.URL+test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.apiClient != "" {
+			req.Header.Set("X-Goog-Api-Client", test.apiClient)
+		}
+		res, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != test.wantBody {
+			t.Errorf("%s: got body %q, want %q", test.path, body, test.wantBody)
+		}
+	}
+
+	wantWaits := []string{"storage.buckets.get", "storage.buckets.list", ""}
+	if len(l.waits) != len(wantWaits) {
+		t.Fatalf("got waits %q, want %q", l.waits, wantWaits)
+	}
+	for i := range wantWaits {
+		if l.waits[i] != wantWaits[i] {
+			t.Errorf("got waits %q, want %q", l.waits, wantWaits)
+		}
+	}
+	if len(l.observed) != 3 || l.observed[0] != nil || l.observed[2] != nil {
+		t.Fatalf("got observed errors %v, want [nil, error, nil]", l.observed)
+	}
+	e, ok := l.observed[1].(*googleapi.Error)
+	if !ok || e.Code != 403 || len(e.Errors) != 1 || e.Errors[0].Reason != "rateLimitExceeded" {
+		t.Errorf("got observed error %#v, want rateLimitExceeded *googleapi.Error", l.observed[1])
+	}
+}
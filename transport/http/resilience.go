@@ -0,0 +1,341 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+	"google.golang.org/api/internal"
+)
+
+// ErrCircuitOpen is returned for requests that are not sent because the
+// circuit breaker configured by option.WithCircuitBreaker is open for their
+// host.
+var ErrCircuitOpen = errors.New("transport/http: circuit breaker open")
+
+// Decisions made by the circuit breaker and hedging transports, as recorded
+// in ResilienceDecisionsView.
+const (
+	decisionCircuitOpened   = "circuit_opened"
+	decisionCircuitRejected = "circuit_rejected"
+	decisionCircuitProbe    = "circuit_probe"
+	decisionCircuitClosed   = "circuit_closed"
+	decisionHedgeSent       = "hedge_sent"
+	decisionHedgeWon        = "hedge_won"
+)
+
+var (
+	decisionKey = tag.MustNewKey("decision")
+	hostKey     = tag.MustNewKey("host")
+
+	resilienceDecisions = stats.Int64(
+		"google.golang.org/api/transport/http/resilience_decisions",
+		"Decisions of circuit breakers and hedged requests",
+		stats.UnitDimensionless)
+
+	// ResilienceDecisionsView counts the decisions made by the transports
+	// configured by option.WithCircuitBreaker and option.WithHedgedRequests,
+	// by host and decision. The decisions are "circuit_opened",
+	// "circuit_rejected", "circuit_probe", "circuit_closed", "hedge_sent" and
+	// "hedge_won". Register it with view.Register to collect them.
+	ResilienceDecisionsView = &view.View{
+		Name:        "google.golang.org/api/transport/http/resilience_decisions",
+		Description: "Count of decisions of circuit breakers and hedged requests, by host and decision",
+		Measure:     resilienceDecisions,
+		TagKeys:     []tag.Key{hostKey, decisionKey},
+		Aggregation: view.Count(),
+	}
+)
+
+// reporter records decisions, unless telemetry is disabled.
+type reporter struct {
+	disabled bool
+}
+
+func (r reporter) report(ctx context.Context, host, decision string) {
+	if r.disabled {
+		return
+	}
+	trace.FromContext(ctx).Annotate([]trace.Attribute{trace.StringAttribute("host", host)}, "transport/http: "+decision)
+	stats.RecordWithTags(ctx, []tag.Mutator{tag.Upsert(hostKey, host), tag.Upsert(decisionKey, decision)}, resilienceDecisions.M(1))
+}
+
+// idempotent reports whether requests with method may be repeated without
+// changing their effect.
+func idempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+// circuitBreakerTransport is an http.RoundTripper that stops sending requests
+// to hosts that are failing, as described by option.WithCircuitBreaker.
+type circuitBreakerTransport struct {
+	base     http.RoundTripper
+	failures int
+	openFor  time.Duration
+	reporter reporter
+	now      func() time.Time
+
+	mu    sync.Mutex
+	hosts map[string]*circuit
+}
+
+// A circuit is the state of the circuit breaker for a host. It is closed if
+// openUntil is zero, open until openUntil, and half-open after it.
+type circuit struct {
+	failures  int       // consecutive failures
+	openUntil time.Time // zero if closed
+	probing   bool      // whether a probe request is in flight while half-open
+}
+
+func newCircuitBreakerTransport(base http.RoundTripper, settings *internal.DialSettings) *circuitBreakerTransport {
+	return &circuitBreakerTransport{
+		base:     base,
+		failures: settings.CircuitBreakerFailures,
+		openFor:  settings.CircuitBreakerOpenFor,
+		reporter: reporter{disabled: settings.TelemetryDisabled},
+		now:      time.Now,
+		hosts:    make(map[string]*circuit),
+	}
+}
+
+func (t *circuitBreakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !idempotent(req.Method) {
+		return t.base.RoundTrip(req)
+	}
+	ctx, host := req.Context(), req.URL.Host
+	t.mu.Lock()
+	c := t.hosts[host]
+	if c == nil {
+		c = &circuit{}
+		t.hosts[host] = c
+	}
+	probe := false
+	if !c.openUntil.IsZero() {
+		if t.now().Before(c.openUntil) || c.probing {
+			t.mu.Unlock()
+			t.reporter.report(ctx, host, decisionCircuitRejected)
+			return nil, ErrCircuitOpen
+		}
+		c.probing, probe = true, true
+	}
+	t.mu.Unlock()
+	if probe {
+		t.reporter.report(ctx, host, decisionCircuitProbe)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+
+	failed := err != nil && isTimeout(err) || err == nil && resp.StatusCode >= 500
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if probe {
+		c.probing = false
+	}
+	switch {
+	case failed:
+		c.failures++
+		if probe || c.failures >= t.failures {
+			c.openUntil = t.now().Add(t.openFor)
+			t.reporter.report(ctx, host, decisionCircuitOpened)
+		}
+	case err == nil:
+		if !c.openUntil.IsZero() {
+			t.reporter.report(ctx, host, decisionCircuitClosed)
+		}
+		*c = circuit{}
+	}
+	return resp, err
+}
+
+// isTimeout reports whether err reports a timeout.
+func isTimeout(err error) bool {
+	if err == context.DeadlineExceeded {
+		return true
+	}
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
+
+// hedgingTransport is an http.RoundTripper that sends a second request if the
+// first is slow, as described by option.WithHedgedRequests.
+type hedgingTransport struct {
+	base         http.RoundTripper
+	percentile   float64
+	initialDelay time.Duration
+	reporter     reporter
+
+	mu        sync.Mutex
+	latencies map[string]*latencies
+}
+
+// minLatencies is the number of latencies of requests to a host that must be
+// known before they determine the hedging delay.
+const minLatencies = 10
+
+// latencies holds the latencies of the most recent requests to a host.
+type latencies struct {
+	samples [100]time.Duration
+	n       int // number of samples added
+}
+
+func (l *latencies) add(d time.Duration) {
+	l.samples[l.n%len(l.samples)] = d
+	l.n++
+}
+
+// percentile returns the latency at percentile p of the samples.
+func (l *latencies) percentile(p float64) time.Duration {
+	n := l.n
+	if n > len(l.samples) {
+		n = len(l.samples)
+	}
+	sorted := make([]time.Duration, n)
+	copy(sorted, l.samples[:n])
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(p * float64(n))
+	if i >= n {
+		i = n - 1
+	}
+	return sorted[i]
+}
+
+func newHedgingTransport(base http.RoundTripper, settings *internal.DialSettings) *hedgingTransport {
+	return &hedgingTransport{
+		base:         base,
+		percentile:   settings.HedgePercentile,
+		initialDelay: settings.HedgeInitialDelay,
+		reporter:     reporter{disabled: settings.TelemetryDisabled},
+		latencies:    make(map[string]*latencies),
+	}
+}
+
+// delay returns how long to wait for a response from host before hedging.
+func (t *hedgingTransport) delay(host string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	l := t.latencies[host]
+	if l == nil || l.n < minLatencies {
+		return t.initialDelay
+	}
+	return l.percentile(t.percentile)
+}
+
+func (t *hedgingTransport) record(host string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	l := t.latencies[host]
+	if l == nil {
+		l = &latencies{}
+		t.latencies[host] = l
+	}
+	l.add(d)
+}
+
+// attempt is the result of one of the requests sent for a hedged request.
+type attempt struct {
+	resp   *http.Response
+	err    error
+	hedged bool
+}
+
+func (t *hedgingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "GET" && req.Method != "HEAD" || req.Body != nil && req.Body != http.NoBody {
+		return t.base.RoundTrip(req)
+	}
+	ctx, host := req.Context(), req.URL.Host
+	results := make(chan attempt, 2)
+	var cancels [2]context.CancelFunc // of the first and the hedged request
+	send := func(hedged bool) {
+		actx, cancel := context.WithCancel(ctx)
+		cancels[index(hedged)] = cancel
+		go func() {
+			start := time.Now()
+			resp, err := t.base.RoundTrip(req.WithContext(actx))
+			if err == nil {
+				t.record(host, time.Since(start))
+			}
+			results <- attempt{resp, err, hedged}
+		}()
+	}
+	send(false)
+
+	timer := time.NewTimer(t.delay(host))
+	var a attempt
+	pending := 1
+	select {
+	case a = <-results:
+		timer.Stop()
+		pending--
+	case <-timer.C:
+		t.reporter.report(ctx, host, decisionHedgeSent)
+		send(true)
+		pending++
+		a = <-results
+		pending--
+		// Prefer a response to an error, if the other request may still
+		// succeed.
+		if a.err != nil && ctx.Err() == nil {
+			cancels[index(a.hedged)]()
+			a = <-results
+			pending--
+		}
+	}
+	if pending > 0 {
+		// Cancel the other request, and discard its result.
+		cancels[1-index(a.hedged)]()
+		go func() {
+			if other := <-results; other.resp != nil {
+				other.resp.Body.Close()
+			}
+		}()
+	}
+	cancel := cancels[index(a.hedged)]
+	if a.err != nil {
+		cancel()
+		return nil, a.err
+	}
+	if a.hedged {
+		t.reporter.report(ctx, host, decisionHedgeWon)
+	}
+	a.resp.Body = &cancelBody{ReadCloser: a.resp.Body, cancel: cancel}
+	return a.resp, nil
+}
+
+// index returns the index in the cancels of hedgingTransport.RoundTrip of the
+// first or hedged request.
+func index(hedged bool) int {
+	if hedged {
+		return 1
+	}
+	return 0
+}
+
+// cancelBody is a response body that cancels the context of its request when
+// it is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,183 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opencensus.io/stats/view"
+	"google.golang.org/api/internal"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	if err := view.Register(ResilienceDecisionsView); err != nil {
+		t.Fatal(err)
+	}
+	defer view.Unregister(ResilienceDecisionsView)
+
+	var (
+		status = 500
+		err    error
+		calls  int
+	)
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		if err != nil {
+			return nil, err
+		}
+		return &http.Response{StatusCode: status, Body: http.NoBody}, nil
+	})
+	now := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+	trans := newCircuitBreakerTransport(base, &internal.DialSettings{
+		CircuitBreakerFailures: 2,
+		CircuitBreakerOpenFor:  time.Minute,
+	})
+	trans.now = func() time.Time { return now }
+
+	do := func(method, host string) error {
+		req, _ := http.NewRequest(method, "https://"+host+"/x", nil)
+		_, err := trans.RoundTrip(req)
+		return err
+	}
+	for i, test := range []struct {
+		desc      string
+		method    string
+		host      string
+		advance   time.Duration
+		status    int
+		err       error
+		wantErr   error
+		wantCalls int
+	}{
+		{"first failure", "GET", "a", 0, 500, nil, nil, 1},
+		{"timeout opens", "GET", "a", 0, 0, context.DeadlineExceeded, context.DeadlineExceeded, 1},
+		{"open", "GET", "a", 0, 200, nil, ErrCircuitOpen, 0},
+		{"other host", "GET", "b", 0, 200, nil, nil, 1},
+		{"not idempotent", "POST", "a", 0, 200, nil, nil, 1},
+		{"still open", "DELETE", "a", 59 * time.Second, 200, nil, ErrCircuitOpen, 0},
+		{"failed probe", "GET", "a", time.Second, 503, nil, nil, 1},
+		{"open again", "GET", "a", 59 * time.Second, 200, nil, ErrCircuitOpen, 0},
+		{"probe", "GET", "a", time.Second, 200, nil, nil, 1},
+		{"closed", "GET", "a", 0, 500, nil, nil, 1},
+		{"success resets", "GET", "a", 0, 200, nil, nil, 1},
+		{"one failure", "GET", "a", 0, 500, nil, nil, 1},
+	} {
+		now = now.Add(test.advance)
+		status, err, calls = test.status, test.err, 0
+		if got := do(test.method, test.host); got != test.wantErr {
+			t.Errorf("#%d %s: got error %v, want %v", i, test.desc, got, test.wantErr)
+		}
+		if calls != test.wantCalls {
+			t.Errorf("#%d %s: got %d calls, want %d", i, test.desc, calls, test.wantCalls)
+		}
+	}
+
+	rows, err := view.RetrieveData(ResilienceDecisionsView.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]int64{}
+	for _, r := range rows {
+		var decision string
+		for _, tg := range r.Tags {
+			if tg.Key == decisionKey {
+				decision = tg.Value
+			}
+		}
+		got[decision] = r.Data.(*view.CountData).Value
+	}
+	want := map[string]int64{
+		decisionCircuitOpened:   2,
+		decisionCircuitRejected: 3,
+		decisionCircuitProbe:    2,
+		decisionCircuitClosed:   1,
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("got decisions %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestHedgedRequests(t *testing.T) {
+	var requests int32
+	canceled := make(chan bool, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			// The first request is slow.
+			select {
+			case <-r.Context().Done():
+				canceled <- true
+				return
+			case <-time.After(5 * time.Second):
+				canceled <- false
+			}
+			w.Write([]byte("slow"))
+			return
+		}
+		w.Write([]byte("fast"))
+	}))
+	defer srv.Close()
+	trans := newHedgingTransport(http.DefaultTransport, &internal.DialSettings{
+		HedgePercentile:   0.9,
+		HedgeInitialDelay: 20 * time.Millisecond,
+	})
+	c := &http.Client{Transport: trans}
+
+	res, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "fast" {
+		t.Errorf("got body %q, want the hedged response", body)
+	}
+	if !<-canceled {
+		t.Error("the slow request was not canceled")
+	}
+
+	// Requests with other methods are not hedged.
+	atomic.StoreInt32(&requests, 0)
+	go func() { <-canceled }()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequest("POST", srv.URL, nil)
+	if _, err := c.Do(req.WithContext(ctx)); err == nil {
+		t.Error("got nil error for the slow POST, want deadline exceeded")
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("POST sent %d times, want 1", n)
+	}
+}
+
+func TestLatencyPercentile(t *testing.T) {
+	trans := newHedgingTransport(nil, &internal.DialSettings{HedgePercentile: 0.9, HedgeInitialDelay: time.Second})
+	for i := 1; i <= 200; i++ {
+		if i == minLatencies+1 {
+			if got, want := trans.delay("h"), 10*time.Millisecond; got != want {
+				t.Errorf("delay after %d requests = %v, want %v", minLatencies, got, want)
+			}
+		}
+		if i < minLatencies && trans.delay("h") != time.Second {
+			t.Errorf("delay after %d requests = %v, want initial delay", i-1, trans.delay("h"))
+		}
+		trans.record("h", time.Duration(i)*time.Millisecond)
+	}
+	// Only the last 100 latencies are kept.
+	if got, want := trans.delay("h"), 191*time.Millisecond; got != want {
+		t.Errorf("delay = %v, want %v", got, want)
+	}
+}
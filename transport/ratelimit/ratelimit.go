@@ -0,0 +1,306 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ratelimit provides a client-side rate limiter for use with
+// option.WithRateLimiter.
+//
+// A Limiter keeps a token bucket for each API method it is configured with,
+// and one shared by all other methods. When a request fails because a rate
+// limit or quota was exceeded, the rate of the bucket it was taken from is
+// halved, and it is doubled again after each recovery period without such
+// failures, up to its configured rate:
+//
+//	l := ratelimit.NewLimiter(ratelimit.Config{
+//		Default: ratelimit.Limit{Rate: 20, Burst: 5},
+//		Methods: map[string]ratelimit.Limit{
+//			"compute.instances.insert": {Rate: 2, Burst: 1},
+//		},
+//	})
+//	svc, err := compute.NewService(ctx, option.WithRateLimiter(l))
+//
+// HTTP requests made by generated clients are identified by the method ID in
+// the discovery document, like "compute.instances.insert", from their
+// x-goog-api-client header. gRPC calls are identified by their full method
+// name, like "/google.pubsub.v1.Publisher/Publish".
+//
+// This is an EXPERIMENTAL API and may be changed or removed in the future.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Limit is the size and refill rate of a token bucket. Each request takes a
+// token from the bucket, waiting for one if it is empty.
+type Limit struct {
+	// Rate is the number of tokens added to the bucket per second. Requests
+	// are not limited if Rate is zero or less.
+	Rate float64
+	// Burst is the number of tokens the bucket holds, which is the number of
+	// requests that may be made at once. Values less than 1 mean 1.
+	Burst int
+}
+
+// Config configures a Limiter.
+type Config struct {
+	// Default is the limit shared by methods not in Methods.
+	Default Limit
+	// Methods holds the limits of methods with a bucket of their own, keyed
+	// by method ID or gRPC method name.
+	Methods map[string]Limit
+	// MinFactor is the lowest fraction of its limit's rate that the rate of a
+	// bucket is reduced to after rate limit errors. The default is 1/16.
+	MinFactor float64
+	// Recovery is the time after which the reduced rate of a bucket is
+	// doubled, if no further rate limit errors are seen. The default is ten
+	// seconds.
+	Recovery time.Duration
+	// Clock is used to measure time and to wait for tokens. The default is
+	// the system clock.
+	Clock Clock
+}
+
+// Clock measures and waits for time. Tests may provide a fake clock to make
+// the behavior of a Limiter deterministic.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// Sleep waits for d to elapse, returning early with ctx.Err() if ctx is
+	// done first.
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) Sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// errDeadline is returned by Wait when a token would not be available before
+// the deadline of the context.
+var errDeadline = errors.New("ratelimit: wait would exceed context deadline")
+
+// A Limiter limits the rate of requests with token buckets. It implements
+// option.RateLimiter, and is safe for concurrent use.
+type Limiter struct {
+	minFactor float64
+	recovery  time.Duration
+	clock     Clock
+
+	mu      sync.Mutex
+	def     *bucket
+	methods map[string]*bucket
+}
+
+// NewLimiter returns a Limiter configured by cfg.
+func NewLimiter(cfg Config) *Limiter {
+	l := &Limiter{
+		minFactor: cfg.MinFactor,
+		recovery:  cfg.Recovery,
+		clock:     cfg.Clock,
+		methods:   make(map[string]*bucket),
+	}
+	if l.minFactor <= 0 || l.minFactor > 1 {
+		l.minFactor = 1.0 / 16
+	}
+	if l.recovery <= 0 {
+		l.recovery = 10 * time.Second
+	}
+	if l.clock == nil {
+		l.clock = systemClock{}
+	}
+	now := l.clock.Now()
+	l.def = newBucket(cfg.Default, now)
+	for m, lim := range cfg.Methods {
+		l.methods[m] = newBucket(lim, now)
+	}
+	return l
+}
+
+// bucket returns the bucket for method, or nil if its requests are not
+// limited.
+func (l *Limiter) bucket(method string) *bucket {
+	b, ok := l.methods[method]
+	if !ok {
+		b = l.def
+	}
+	if b.limit.Rate <= 0 {
+		return nil
+	}
+	return b
+}
+
+// Wait takes a token from the bucket for method, waiting until one is
+// available. It returns an error without waiting if ctx has a deadline
+// before then, or if ctx is done while waiting.
+func (l *Limiter) Wait(ctx context.Context, method string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	b := l.bucket(method)
+	if b == nil {
+		l.mu.Unlock()
+		return nil
+	}
+	now := l.clock.Now()
+	d := b.take(now, l)
+	if d <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Sub(now) < d {
+		b.tokens++
+		l.mu.Unlock()
+		return errDeadline
+	}
+	l.mu.Unlock()
+	if err := l.clock.Sleep(ctx, d); err != nil {
+		l.mu.Lock()
+		b.tokens++
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Observe reduces the rate of the bucket for method if err reports that a
+// rate limit or quota was exceeded, as described by IsRateLimited.
+func (l *Limiter) Observe(method string, err error) {
+	if !IsRateLimited(err) {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.bucket(method)
+	if b == nil {
+		return
+	}
+	now := l.clock.Now()
+	b.refill(now, l)
+	b.factor /= 2
+	if b.factor < l.minFactor {
+		b.factor = l.minFactor
+	}
+	b.slowed = now
+	if b.tokens > 0 {
+		b.tokens = 0
+	}
+}
+
+// Rate returns the current rate of the bucket for method in requests per
+// second, or zero if its requests are not limited.
+func (l *Limiter) Rate(method string) float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.bucket(method)
+	if b == nil {
+		return 0
+	}
+	b.refill(l.clock.Now(), l)
+	return b.rate()
+}
+
+// A bucket is a token bucket whose rate is reduced by factor after rate
+// limit errors.
+type bucket struct {
+	limit  Limit
+	tokens float64   // may be negative, for requests waiting for tokens
+	last   time.Time // time tokens was last updated
+	factor float64   // fraction of limit.Rate currently in effect
+	slowed time.Time // time factor was last changed
+}
+
+func newBucket(limit Limit, now time.Time) *bucket {
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return &bucket{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+		last:   now,
+		factor: 1,
+		slowed: now,
+	}
+}
+
+func (b *bucket) rate() float64 { return b.limit.Rate * b.factor }
+
+// refill adds the tokens accumulated since the last update, and restores the
+// rate for each recovery period that has passed since it was reduced.
+func (b *bucket) refill(now time.Time, l *Limiter) {
+	if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate()
+		if max := float64(b.limit.Burst); b.tokens > max {
+			b.tokens = max
+		}
+		b.last = now
+	}
+	for b.factor < 1 && now.Sub(b.slowed) >= l.recovery {
+		b.factor *= 2
+		if b.factor > 1 {
+			b.factor = 1
+		}
+		b.slowed = b.slowed.Add(l.recovery)
+	}
+}
+
+// take takes a token and returns how long the caller must wait for it.
+func (b *bucket) take(now time.Time, l *Limiter) time.Duration {
+	b.refill(now, l)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate() * float64(time.Second))
+}
+
+// rateLimitReasons are the reasons of googleapi.Error items that report a
+// rate limit or quota was exceeded.
+var rateLimitReasons = map[string]bool{
+	"rateLimitExceeded":     true,
+	"userRateLimitExceeded": true,
+	"quotaExceeded":         true,
+	"RATE_LIMIT_EXCEEDED":   true,
+}
+
+// IsRateLimited reports whether err reports that a rate limit or quota was
+// exceeded: a *googleapi.Error with code 429 or a rate limit reason, like
+// "rateLimitExceeded", or a gRPC error with code ResourceExhausted.
+func IsRateLimited(err error) bool {
+	if err == nil {
+		return false
+	}
+	if e, ok := err.(*googleapi.Error); ok {
+		if e.Code == 429 {
+			return true
+		}
+		for _, item := range e.Errors {
+			if rateLimitReasons[item.Reason] {
+				return true
+			}
+		}
+		return false
+	}
+	if s, ok := status.FromError(err); ok {
+		return s.Code() == codes.ResourceExhausted
+	}
+	return false
+}
@@ -0,0 +1,260 @@
+// Copyright 2020 Google LLC.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeClock is a Clock whose time only changes when it is advanced.
+type fakeClock struct {
+	mu       sync.Mutex
+	now      time.Time
+	sleepers []*sleeper
+}
+
+type sleeper struct {
+	until time.Time
+	done  chan struct{}
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.mu.Lock()
+	s := &sleeper{until: c.now.Add(d), done: make(chan struct{})}
+	c.sleepers = append(c.sleepers, s)
+	c.mu.Unlock()
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// advance moves the time forward by d, waking the sleepers that are due.
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	var rest []*sleeper
+	for _, s := range c.sleepers {
+		if c.now.Before(s.until) {
+			rest = append(rest, s)
+		} else {
+			close(s.done)
+		}
+	}
+	c.sleepers = rest
+}
+
+// waiting returns the number of goroutines sleeping on c.
+func (c *fakeClock) waiting() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.sleepers)
+}
+
+// waitFor blocks until n goroutines are sleeping on c.
+func (c *fakeClock) waitFor(t *testing.T, n int) {
+	t.Helper()
+	for i := 0; c.waiting() != n; i++ {
+		if i == 1000 {
+			t.Fatalf("got %d sleepers, want %d", c.waiting(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWaitBurstAndRate(t *testing.T) {
+	clock := newFakeClock()
+	l := NewLimiter(Config{Default: Limit{Rate: 2, Burst: 3}, Clock: clock})
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(ctx, "m"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := clock.waiting(); n != 0 {
+		t.Fatalf("burst of 3 slept %d times", n)
+	}
+
+	done := make(chan error)
+	go func() { done <- l.Wait(ctx, "m") }()
+	clock.waitFor(t, 1)
+	clock.advance(400 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("Wait returned before a token was available")
+	case <-time.After(10 * time.Millisecond):
+	}
+	clock.advance(100 * time.Millisecond)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitPerMethod(t *testing.T) {
+	clock := newFakeClock()
+	l := NewLimiter(Config{
+		Default: Limit{Rate: 1, Burst: 1},
+		Methods: map[string]Limit{
+			"compute.instances.insert": {Rate: 1, Burst: 1},
+			"compute.instances.list":   {},
+		},
+		Clock: clock,
+	})
+	ctx := context.Background()
+	// Each configured method has its own bucket, and unconfigured methods
+	// share the default one.
+	for _, m := range []string{"compute.instances.insert", "compute.instances.get", "compute.instances.list", "compute.instances.list"} {
+		if err := l.Wait(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := clock.waiting(); n != 0 {
+		t.Fatalf("slept %d times, want 0", n)
+	}
+	for m, want := range map[string]float64{
+		"compute.instances.insert": 1,
+		"compute.instances.delete": 1,
+		"compute.instances.list":   0,
+	} {
+		if got := l.Rate(m); got != want {
+			t.Errorf("Rate(%q) = %v, want %v", m, got, want)
+		}
+	}
+	// The default bucket is now empty, and refills in a second of the
+	// clock.
+	if err := l.Wait(deadlineContext{ctx, clock.Now().Add(500 * time.Millisecond)}, "compute.instances.delete"); err != errDeadline {
+		t.Errorf("got %v, want %v", err, errDeadline)
+	}
+	dctx := deadlineContext{ctx, clock.Now().Add(2 * time.Second)}
+	done := make(chan error)
+	go func() { done <- l.Wait(dctx, "compute.instances.delete") }()
+	clock.waitFor(t, 1)
+	clock.advance(time.Second)
+	if err := <-done; err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+}
+
+// deadlineContext is a context with a deadline on a fake clock, which is
+// never done.
+type deadlineContext struct {
+	context.Context
+	deadline time.Time
+}
+
+func (c deadlineContext) Deadline() (time.Time, bool) { return c.deadline, true }
+
+func TestWaitCanceled(t *testing.T) {
+	clock := newFakeClock()
+	l := NewLimiter(Config{Default: Limit{Rate: 1}, Clock: clock})
+	if err := l.Wait(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- l.Wait(ctx, "") }()
+	clock.waitFor(t, 1)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+	// The canceled request returned its token.
+	clock.advance(time.Second)
+	if err := l.Wait(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if n := clock.waiting(); n != 0 {
+		t.Errorf("got %d sleepers, want 0", n)
+	}
+}
+
+func TestObserveSlowdown(t *testing.T) {
+	clock := newFakeClock()
+	l := NewLimiter(Config{
+		Default:   Limit{Rate: 16, Burst: 4},
+		MinFactor: 0.25,
+		Recovery:  10 * time.Second,
+		Clock:     clock,
+	})
+	limited := &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}
+	var rates []float64
+	for _, err := range []error{
+		nil,
+		&googleapi.Error{Code: 500},
+		limited,
+		&googleapi.Error{Code: 429},
+		status.Error(codes.ResourceExhausted, "quota"),
+	} {
+		l.Observe("m", err)
+		rates = append(rates, l.Rate("m"))
+	}
+	want := []float64{16, 16, 8, 4, 4}
+	for i := range want {
+		if rates[i] != want[i] {
+			t.Fatalf("rates = %v, want %v", rates, want)
+		}
+	}
+	// The bucket was emptied, and refills at the reduced rate.
+	done := make(chan error)
+	go func() { done <- l.Wait(context.Background(), "m") }()
+	clock.waitFor(t, 1)
+	clock.advance(250 * time.Millisecond)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	clock.advance(9 * time.Second)
+	if got := l.Rate("m"); got != 4 {
+		t.Errorf("rate before recovery = %v, want 4", got)
+	}
+	clock.advance(time.Second)
+	if got := l.Rate("m"); got != 8 {
+		t.Errorf("rate after one recovery period = %v, want 8", got)
+	}
+	clock.advance(time.Minute)
+	if got := l.Rate("m"); got != 16 {
+		t.Errorf("rate after recovery = %v, want 16", got)
+	}
+}
+
+func TestIsRateLimited(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("x"), false},
+		{&googleapi.Error{Code: 429}, true},
+		{&googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "userRateLimitExceeded"}}}, true},
+		{&googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "forbidden"}}}, false},
+		{status.Error(codes.ResourceExhausted, ""), true},
+		{status.Error(codes.Unavailable, ""), false},
+	} {
+		if got := IsRateLimited(test.err); got != test.want {
+			t.Errorf("IsRateLimited(%v) = %t, want %t", test.err, got, test.want)
+		}
+	}
+}